@@ -38,6 +38,7 @@ import (
 	cniSpecVersion "github.com/containernetworking/cni/pkg/version"
 	"github.com/containernetworking/plugins/pkg/ns"
 	"github.com/golang/glog"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
 
 	// import plugins
 	_ "git.openstack.org/openstack/stackube/pkg/kubestack/plugins/openvswitch"
@@ -84,6 +85,55 @@ func (os *OpenStack) getNetworkIDByNamespace(namespace string) (string, error) {
 	return network.Uid, nil
 }
 
+// getPortIPConfigs builds the IP configs and host routes of all the fixed IPs
+// of port, so that both addresses of dual-stack networks are set up.
+func getPortIPConfigs(client openstack.Interface, port *ports.Port) ([]*current.IPConfig, []*types.Route, error) {
+	var ips []*current.IPConfig
+	var routes []*types.Route
+	for _, fixedIP := range port.FixedIPs {
+		subnet, err := client.GetProviderSubnet(fixedIP.SubnetID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("get info of subnet %s failed: %v", fixedIP.SubnetID, err)
+		}
+
+		_, cidr, err := net.ParseCIDR(subnet.Cidr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid CIDR of subnet %s: %v", fixedIP.SubnetID, err)
+		}
+		ip := net.ParseIP(fixedIP.IPAddress)
+		if ip == nil {
+			return nil, nil, fmt.Errorf("invalid IP address %q of port %s", fixedIP.IPAddress, port.ID)
+		}
+		version := "4"
+		if ip.To4() == nil {
+			version = "6"
+		}
+
+		ips = append(ips, &current.IPConfig{
+			Version: version,
+			Address: net.IPNet{IP: ip, Mask: cidr.Mask},
+			Gateway: net.ParseIP(subnet.Gateway),
+		})
+
+		for _, r := range subnet.Routes {
+			_, dst, err := net.ParseCIDR(r.DestinationCIDR)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid host route destination %q of subnet %s", r.DestinationCIDR, fixedIP.SubnetID)
+			}
+			gw := net.ParseIP(r.Nexthop)
+			if gw == nil {
+				return nil, nil, fmt.Errorf("invalid host route nexthop %q of subnet %s", r.Nexthop, fixedIP.SubnetID)
+			}
+			routes = append(routes, &types.Route{Dst: *dst, GW: gw})
+		}
+	}
+	if len(ips) == 0 {
+		return nil, nil, fmt.Errorf("port %s has no fixed IPs", port.ID)
+	}
+
+	return ips, routes, nil
+}
+
 func getHostName() string {
 	host, err := os.Hostname()
 	if err != nil {
@@ -158,8 +208,8 @@ func cmdAdd(args *skel.CmdArgs) error {
 		return err
 	}
 
-	// Get tenantID
-	tenantID, err := osClient.Client.GetTenantIDFromName(podNamespace)
+	// Get tenantID of the tenant which owns the namespace
+	tenantID, err := osClient.Client.GetTenantIDFromNamespace(podNamespace)
 	if err != nil {
 		glog.Errorf("Get tenantID failed: %v", err)
 		return err
@@ -208,10 +258,10 @@ func cmdAdd(args *skel.CmdArgs) error {
 	}
 	glog.V(4).Infof("Pod %s's port is %v", podName, port)
 
-	// Get subnet and gateway
-	subnet, err := osClient.Client.GetProviderSubnet(port.FixedIPs[0].SubnetID)
+	// Get addresses, gateways and host routes of all the port's subnets
+	ips, routes, err := getPortIPConfigs(osClient.Client, port)
 	if err != nil {
-		glog.Errorf("Get info of subnet %s failed: %v", port.FixedIPs[0].SubnetID, err)
+		glog.Errorf("Get IP configs of port %s failed: %v", portName, err)
 		return err
 	}
 
@@ -224,8 +274,6 @@ func cmdAdd(args *skel.CmdArgs) error {
 
 	// Setup interface for pod
 	var netnsName string
-	_, cidr, _ := net.ParseCIDR(subnet.Cidr)
-	prefixSize, _ := cidr.Mask.Size()
 	if strings.HasPrefix(netnsBasePath, netns.Path()) {
 		// container runtime has already made the symlink for netns.
 		netnsName = path.Base(netns.Path())
@@ -248,8 +296,7 @@ func cmdAdd(args *skel.CmdArgs) error {
 	}
 
 	brInterface, conInterface, err := osClient.Plugin.SetupInterface(portName, args.ContainerID, port,
-		fmt.Sprintf("%s/%d", port.FixedIPs[0].IPAddress, prefixSize),
-		subnet.Gateway, args.IfName, netnsName)
+		ips, routes, args.IfName, netnsName)
 	if err != nil {
 		glog.Errorf("SetupInterface failed: %v", err)
 		return err
@@ -263,19 +310,9 @@ func cmdAdd(args *skel.CmdArgs) error {
 
 	// Populate result.Interfaces
 	result.Interfaces = []*current.Interface{brInterface, conInterface}
-	// Populate result.IPs
-	ip := net.ParseIP(port.FixedIPs[0].IPAddress)
-	ipCidr := net.IPNet{
-		IP:   ip,
-		Mask: cidr.Mask,
-	}
-	gateway := net.ParseIP(subnet.Gateway)
-	containerIPConfig := &current.IPConfig{
-		Version: "4",
-		Address: ipCidr,
-		Gateway: gateway,
-	}
-	result.IPs = []*current.IPConfig{containerIPConfig}
+	// Populate result.IPs and result.Routes
+	result.IPs = ips
+	result.Routes = routes
 
 	// Print result to stdout, in the format defined by the requested cniVersion.
 	return types.PrintResult(result, cniVersion)
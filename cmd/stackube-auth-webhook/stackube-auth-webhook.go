@@ -0,0 +1,96 @@
+/*
+Copyright (c) 2017 OpenStack Foundation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"git.openstack.org/openstack/stackube/pkg/auth-webhook"
+	"git.openstack.org/openstack/stackube/pkg/metrics"
+	"git.openstack.org/openstack/stackube/pkg/openstack"
+	"git.openstack.org/openstack/stackube/pkg/util"
+
+	"github.com/golang/glog"
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+var (
+	kubeconfig = pflag.String("kubeconfig", "/etc/kubernetes/admin.conf",
+		"path to kubernetes admin config file")
+	cloudconfig = pflag.String("cloudconfig", "/etc/stackube.conf",
+		"path to stackube config file")
+	listenAddress = pflag.String("listen-address", ":8443",
+		"address on which the webhook serves kube-apiserver requests")
+	policyFile = pflag.String("policy-file", "",
+		"path to the policy file mapping keystone roles to permissions, use the default policy if empty")
+	tlsCertFile = pflag.String("tls-cert-file", "",
+		"path to x509 certificate for HTTPS, serve plain HTTP if empty")
+	tlsPrivateKeyFile = pflag.String("tls-private-key-file", "",
+		"path to x509 private key matching --tls-cert-file")
+	metricsBindAddress = pflag.String("metrics-bind-address", "0.0.0.0:9742",
+		"address to serve /healthz, /readyz and /metrics on")
+	version = pflag.Bool("version", false, "Display version")
+	VERSION = "1.0beta"
+)
+
+func main() {
+	util.InitFlags()
+	util.InitLogs()
+	defer util.FlushLogs()
+
+	if *version {
+		fmt.Println(VERSION)
+		os.Exit(0)
+	}
+
+	osClient, err := openstack.NewClient(*cloudconfig, *kubeconfig)
+	if err != nil {
+		glog.Fatalf("Init openstack client failed: %v", err)
+	}
+
+	policy := auth.DefaultPolicy()
+	if *policyFile != "" {
+		policy, err = auth.LoadPolicy(*policyFile)
+		if err != nil {
+			glog.Fatalf("Load policy failed: %v", err)
+		}
+	}
+
+	server := metrics.NewServer(*metricsBindAddress)
+	go func() {
+		if err := server.Run(wait.NeverStop); err != nil {
+			glog.Fatal(err)
+		}
+	}()
+
+	mux := http.NewServeMux()
+	mux.Handle("/authenticate", auth.NewAuthenticator(osClient))
+	mux.Handle("/authorize", auth.NewAuthorizer(osClient, policy))
+
+	glog.Infof("Starting stackube auth webhook on %s", *listenAddress)
+	if *tlsCertFile != "" {
+		err = http.ListenAndServeTLS(*listenAddress, *tlsCertFile, *tlsPrivateKeyFile, mux)
+	} else {
+		err = http.ListenAndServe(*listenAddress, mux)
+	}
+	if err != nil {
+		glog.Fatal(err)
+	}
+}
@@ -21,16 +21,22 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 
 	"git.openstack.org/openstack/stackube/pkg/auth-controller/rbacmanager"
 	"git.openstack.org/openstack/stackube/pkg/auth-controller/tenant"
+	"git.openstack.org/openstack/stackube/pkg/garbage-collector"
+	"git.openstack.org/openstack/stackube/pkg/leaderelection"
+	"git.openstack.org/openstack/stackube/pkg/metrics"
 	"git.openstack.org/openstack/stackube/pkg/network-controller"
 	"git.openstack.org/openstack/stackube/pkg/openstack"
 	"git.openstack.org/openstack/stackube/pkg/service-controller"
 	"git.openstack.org/openstack/stackube/pkg/util"
 
 	extclientset "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	"k8s.io/apimachinery/pkg/util/rand"
 	"k8s.io/client-go/kubernetes"
 
 	"github.com/golang/glog"
@@ -47,16 +53,88 @@ var (
 	userGateway = pflag.String("user-gateway", "10.244.0.1", "user Pod network gateway")
 	version     = pflag.Bool("version", false, "Display version")
 	VERSION     = "1.0beta"
+
+	importTenants = pflag.Bool("import-tenants", false,
+		"periodically import keystone projects as tenants")
+	importDomainID = pflag.String("import-domain-id", "",
+		"domain of the keystone projects to import, defaults to domain-id of the [Tenant] section of the cloudconfig")
+	importTag = pflag.String("import-tag", "",
+		"only import the keystone projects with this tag")
+	importInterval = pflag.Duration("import-interval", 5*time.Minute,
+		"interval of importing keystone projects")
+	importRemovalPolicy = pflag.String("import-removal-policy", tenant.RemovalPolicyFail,
+		"what to do with the imported tenants whose keystone project is removed, \"fail\" or \"delete\"")
+
+	leaderElect = pflag.Bool("leader-elect", false,
+		"only run the controllers while holding the leader lease, for running multiple replicas")
+	leaderElectNamespace = pflag.String("leader-elect-namespace", "kube-system",
+		"namespace of the leader lease ConfigMap")
+	leaderElectName = pflag.String("leader-elect-name", "stackube-controller",
+		"name of the leader lease ConfigMap")
+	leaderElectLeaseDuration = pflag.Duration("leader-elect-lease-duration", 15*time.Second,
+		"how long a standby waits before it takes over a leader which stopped renewing")
+	leaderElectRenewDeadline = pflag.Duration("leader-elect-renew-deadline", 10*time.Second,
+		"how long the leader retries renewing before it gives up the leadership")
+	leaderElectRetryPeriod = pflag.Duration("leader-elect-retry-period", 2*time.Second,
+		"interval between two tries to acquire or renew the leader lease")
+
+	gcOrphans = pflag.Bool("gc-orphans", false,
+		"periodically delete the OpenStack resources which are no longer owned by any Network, Service or Pod")
+	gcInterval = pflag.Duration("gc-interval", 10*time.Minute,
+		"interval of collecting orphaned OpenStack resources")
+	gcGracePeriod = pflag.Duration("gc-grace-period", 30*time.Minute,
+		"how long an OpenStack resource must stay orphaned before it is deleted")
+	gcDryRun = pflag.Bool("gc-dry-run", false,
+		"only log the orphaned OpenStack resources instead of deleting them")
+
+	metricsBindAddress = pflag.String("metrics-bind-address", "0.0.0.0:9740",
+		"address to serve /healthz, /readyz and /metrics on")
+)
+
+var (
+	// The HasSynced functions of the running controllers, a standby doesn't
+	// run any controllers.
+	controllersMu     sync.Mutex
+	controllersSynced []func() bool
 )
 
+// controllersReady returns an error until the running controllers have
+// synced.
+func controllersReady() error {
+	controllersMu.Lock()
+	defer controllersMu.Unlock()
+	for _, synced := range controllersSynced {
+		if !synced() {
+			return fmt.Errorf("controllers not synced")
+		}
+	}
+	return nil
+}
+
+func setControllersSynced(synced ...func() bool) {
+	controllersMu.Lock()
+	defer controllersMu.Unlock()
+	controllersSynced = synced
+}
+
 func startControllers(kubeClient *kubernetes.Clientset,
-	osClient openstack.Interface, kubeExtClient *extclientset.Clientset) error {
+	osClient openstack.Interface, kubeExtClient *extclientset.Clientset, stopCh <-chan struct{}) error {
 	// Creates a new Tenant controller
 	tenantController, err := tenant.NewTenantController(kubeClient, osClient, kubeExtClient)
 	if err != nil {
 		return err
 	}
 
+	// Creates a new Tenant importer if enabled
+	var tenantImporter *tenant.TenantImporter
+	if *importTenants {
+		tenantImporter, err = tenant.NewTenantImporter(osClient, *importDomainID, *importTag,
+			*importRemovalPolicy, *importInterval)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Creates a new Network controller
 	networkController, err := network.NewNetworkController(kubeClient, osClient, kubeExtClient)
 	if err != nil {
@@ -75,12 +153,29 @@ func startControllers(kubeClient *kubernetes.Clientset,
 		return err
 	}
 
+	// Creates a new garbage collector if enabled
+	var garbageCollector *garbagecollector.GarbageCollector
+	if *gcOrphans {
+		garbageCollector, err = garbagecollector.NewGarbageCollector(kubeClient, osClient,
+			*gcInterval, *gcGracePeriod, *gcDryRun)
+		if err != nil {
+			return err
+		}
+	}
+
+	setControllersSynced(tenantController.HasSynced, rbacController.HasSynced,
+		networkController.HasSynced, serviceController.HasSynced)
+	defer setControllersSynced()
+
 	ctx, cancel := context.WithCancel(context.Background())
 	wg, ctx := errgroup.WithContext(ctx)
 
 	// start auth controllers in stackube
 	wg.Go(func() error { return tenantController.Run(ctx.Done()) })
 	wg.Go(func() error { return rbacController.Run(ctx.Done()) })
+	if tenantImporter != nil {
+		wg.Go(func() error { return tenantImporter.Run(ctx.Done()) })
+	}
 
 	// start network controller
 	wg.Go(func() error { return networkController.Run(ctx.Done()) })
@@ -88,12 +183,13 @@ func startControllers(kubeClient *kubernetes.Clientset,
 	// start service controller
 	wg.Go(func() error { return serviceController.Run(ctx.Done()) })
 
-	term := make(chan os.Signal)
-	signal.Notify(term, os.Interrupt, syscall.SIGTERM)
+	// start garbage collector
+	if garbageCollector != nil {
+		wg.Go(func() error { return garbageCollector.Run(ctx.Done()) })
+	}
 
 	select {
-	case <-term:
-		glog.V(4).Info("Received SIGTERM, exiting gracefully...")
+	case <-stopCh:
 	case <-ctx.Done():
 	}
 
@@ -130,6 +226,24 @@ func initClients() (*kubernetes.Clientset, openstack.Interface, *extclientset.Cl
 	return kubeClient, osClient, kubeExtClient, nil
 }
 
+func newLeaderElector(kubeClient *kubernetes.Clientset) (*leaderelection.LeaderElector, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hostname: %v", err)
+	}
+
+	return leaderelection.NewLeaderElector(leaderelection.Config{
+		Client:    kubeClient,
+		Namespace: *leaderElectNamespace,
+		Name:      *leaderElectName,
+		// Replicas in the host network of a node share the hostname.
+		Identity:      hostname + "_" + rand.String(8),
+		LeaseDuration: *leaderElectLeaseDuration,
+		RenewDeadline: *leaderElectRenewDeadline,
+		RetryPeriod:   *leaderElectRetryPeriod,
+	})
+}
+
 func main() {
 	util.InitFlags()
 	util.InitLogs()
@@ -146,8 +260,41 @@ func main() {
 		glog.Fatal(err)
 	}
 
-	// Start stackube controllers.
-	if err := startControllers(kubeClient, osClient, kubeExtClient); err != nil {
+	stopCh := make(chan struct{})
+	term := make(chan os.Signal, 1)
+	signal.Notify(term, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-term
+		glog.V(4).Info("Received SIGTERM, exiting gracefully...")
+		close(stopCh)
+	}()
+
+	server := metrics.NewServer(*metricsBindAddress)
+	server.AddReadyzCheck("controllers", controllersReady)
+	go func() {
+		if err := server.Run(stopCh); err != nil {
+			glog.Fatal(err)
+		}
+	}()
+
+	run := func(stopCh <-chan struct{}) error {
+		return startControllers(kubeClient, osClient, kubeExtClient, stopCh)
+	}
+	if !*leaderElect {
+		// Start stackube controllers.
+		if err := run(stopCh); err != nil {
+			glog.Fatal(err)
+		}
+		return
+	}
+
+	// Start stackube controllers only while leading, exit once the
+	// leadership is lost so that we are restarted as a standby.
+	elector, err := newLeaderElector(kubeClient)
+	if err != nil {
+		glog.Fatal(err)
+	}
+	if err := elector.Run(stopCh, run); err != nil {
 		glog.Fatal(err)
 	}
 }
@@ -19,6 +19,7 @@ package main
 import (
 	"fmt"
 
+	"git.openstack.org/openstack/stackube/pkg/metrics"
 	"git.openstack.org/openstack/stackube/pkg/openstack"
 	"git.openstack.org/openstack/stackube/pkg/proxy"
 	"git.openstack.org/openstack/stackube/pkg/util"
@@ -37,6 +38,9 @@ var (
 		"path to stackube config file")
 	version = pflag.Bool("version", false, "Display version")
 	VERSION = "1.0beta"
+
+	metricsBindAddress = pflag.String("metrics-bind-address", "0.0.0.0:9741",
+		"address to serve /healthz, /readyz and /metrics on")
 )
 
 func verifyClientSetting() error {
@@ -81,6 +85,14 @@ func main() {
 
 	proxier.RegisterInformers()
 
+	server := metrics.NewServer(*metricsBindAddress)
+	server.AddReadyzCheck("proxier", proxier.Ready)
+	go func() {
+		if err := server.Run(wait.NeverStop); err != nil {
+			glog.Fatal(err)
+		}
+	}()
+
 	go proxier.StartNamespaceInformer(wait.NeverStop)
 	go proxier.StartServiceInformer(wait.NeverStop)
 	go proxier.StartEndpointInformer(wait.NeverStop)
@@ -50,4 +50,4 @@ if [ -z $USER_GATEWAY ];then
 	USER_GATEWAY='10.244.0.1'
 fi
 
-./stackube-controller --v=3 --kubeconfig="" --user-cidr=${USER_CIDR} --user-gateway=${USER_GATEWAY}
\ No newline at end of file
+./stackube-controller --v=3 --kubeconfig="" --user-cidr=${USER_CIDR} --user-gateway=${USER_GATEWAY} --leader-elect
\ No newline at end of file
@@ -23,6 +23,7 @@ package v1
 import (
 	reflect "reflect"
 
+	core_v1 "k8s.io/api/core/v1"
 	conversion "k8s.io/apimachinery/pkg/conversion"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
@@ -34,10 +35,26 @@ func GetGeneratedDeepCopyFuncs() []conversion.GeneratedDeepCopyFunc {
 			in.(*Network).DeepCopyInto(out.(*Network))
 			return nil
 		}, InType: reflect.TypeOf(&Network{})},
+		{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*NetworkCondition).DeepCopyInto(out.(*NetworkCondition))
+			return nil
+		}, InType: reflect.TypeOf(&NetworkCondition{})},
 		{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
 			in.(*NetworkList).DeepCopyInto(out.(*NetworkList))
 			return nil
 		}, InType: reflect.TypeOf(&NetworkList{})},
+		{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*NetworkSpec).DeepCopyInto(out.(*NetworkSpec))
+			return nil
+		}, InType: reflect.TypeOf(&NetworkSpec{})},
+		{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*NetworkStatus).DeepCopyInto(out.(*NetworkStatus))
+			return nil
+		}, InType: reflect.TypeOf(&NetworkStatus{})},
+		{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*NetworkSubnet).DeepCopyInto(out.(*NetworkSubnet))
+			return nil
+		}, InType: reflect.TypeOf(&NetworkSubnet{})},
 		{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
 			in.(*Tenant).DeepCopyInto(out.(*Tenant))
 			return nil
@@ -46,6 +63,26 @@ func GetGeneratedDeepCopyFuncs() []conversion.GeneratedDeepCopyFunc {
 			in.(*TenantList).DeepCopyInto(out.(*TenantList))
 			return nil
 		}, InType: reflect.TypeOf(&TenantList{})},
+		{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*TenantQuota).DeepCopyInto(out.(*TenantQuota))
+			return nil
+		}, InType: reflect.TypeOf(&TenantQuota{})},
+		{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*TenantSpec).DeepCopyInto(out.(*TenantSpec))
+			return nil
+		}, InType: reflect.TypeOf(&TenantSpec{})},
+		{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*TenantStatus).DeepCopyInto(out.(*TenantStatus))
+			return nil
+		}, InType: reflect.TypeOf(&TenantStatus{})},
+		{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*TenantUser).DeepCopyInto(out.(*TenantUser))
+			return nil
+		}, InType: reflect.TypeOf(&TenantUser{})},
+		{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*TenantUserStatus).DeepCopyInto(out.(*TenantUserStatus))
+			return nil
+		}, InType: reflect.TypeOf(&TenantUserStatus{})},
 	}
 }
 
@@ -54,8 +91,8 @@ func (in *Network) DeepCopyInto(out *Network) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
-	out.Status = in.Status
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
@@ -78,6 +115,23 @@ func (x *Network) DeepCopyObject() runtime.Object {
 	}
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkCondition) DeepCopyInto(out *NetworkCondition) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+	return
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, creating a new NetworkCondition.
+func (x *NetworkCondition) DeepCopy() *NetworkCondition {
+	if x == nil {
+		return nil
+	}
+	out := new(NetworkCondition)
+	x.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NetworkList) DeepCopyInto(out *NetworkList) {
 	*out = *in
@@ -112,13 +166,114 @@ func (x *NetworkList) DeepCopyObject() runtime.Object {
 	}
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkSpec) DeepCopyInto(out *NetworkSpec) {
+	*out = *in
+	if in.Subnets != nil {
+		in, out := &in.Subnets, &out.Subnets
+		*out = make([]NetworkSubnet, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.DNSNameservers != nil {
+		in, out := &in.DNSNameservers, &out.DNSNameservers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.HostRoutes != nil {
+		in, out := &in.HostRoutes, &out.HostRoutes
+		*out = make([]HostRoute, len(*in))
+		copy(*out, *in)
+	}
+	if in.AllocationPools != nil {
+		in, out := &in.AllocationPools, &out.AllocationPools
+		*out = make([]AllocationPool, len(*in))
+		copy(*out, *in)
+	}
+	if in.AdminStateUp != nil {
+		in, out := &in.AdminStateUp, &out.AdminStateUp
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(bool)
+			**out = **in
+		}
+	}
+	return
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, creating a new NetworkSpec.
+func (x *NetworkSpec) DeepCopy() *NetworkSpec {
+	if x == nil {
+		return nil
+	}
+	out := new(NetworkSpec)
+	x.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkStatus) DeepCopyInto(out *NetworkStatus) {
+	*out = *in
+	if in.SubnetIDs != nil {
+		in, out := &in.SubnetIDs, &out.SubnetIDs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]NetworkCondition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, creating a new NetworkStatus.
+func (x *NetworkStatus) DeepCopy() *NetworkStatus {
+	if x == nil {
+		return nil
+	}
+	out := new(NetworkStatus)
+	x.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkSubnet) DeepCopyInto(out *NetworkSubnet) {
+	*out = *in
+	if in.HostRoutes != nil {
+		in, out := &in.HostRoutes, &out.HostRoutes
+		*out = make([]HostRoute, len(*in))
+		copy(*out, *in)
+	}
+	if in.AllocationPools != nil {
+		in, out := &in.AllocationPools, &out.AllocationPools
+		*out = make([]AllocationPool, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, creating a new NetworkSubnet.
+func (x *NetworkSubnet) DeepCopy() *NetworkSubnet {
+	if x == nil {
+		return nil
+	}
+	out := new(NetworkSubnet)
+	x.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Tenant) DeepCopyInto(out *Tenant) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
-	out.Status = in.Status
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
@@ -174,3 +329,194 @@ func (x *TenantList) DeepCopyObject() runtime.Object {
 		return nil
 	}
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TenantQuota) DeepCopyInto(out *TenantQuota) {
+	*out = *in
+	if in.Pods != nil {
+		in, out := &in.Pods, &out.Pods
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(int64)
+			**out = **in
+		}
+	}
+	if in.CPU != nil {
+		in, out := &in.CPU, &out.CPU
+		if *in == nil {
+			*out = nil
+		} else {
+			x := (*in).DeepCopy()
+			*out = &x
+		}
+	}
+	if in.Memory != nil {
+		in, out := &in.Memory, &out.Memory
+		if *in == nil {
+			*out = nil
+		} else {
+			x := (*in).DeepCopy()
+			*out = &x
+		}
+	}
+	if in.Services != nil {
+		in, out := &in.Services, &out.Services
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(int64)
+			**out = **in
+		}
+	}
+	if in.LoadBalancers != nil {
+		in, out := &in.LoadBalancers, &out.LoadBalancers
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(int64)
+			**out = **in
+		}
+	}
+	if in.FloatingIPs != nil {
+		in, out := &in.FloatingIPs, &out.FloatingIPs
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(int64)
+			**out = **in
+		}
+	}
+	if in.Ports != nil {
+		in, out := &in.Ports, &out.Ports
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(int64)
+			**out = **in
+		}
+	}
+	return
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, creating a new TenantQuota.
+func (x *TenantQuota) DeepCopy() *TenantQuota {
+	if x == nil {
+		return nil
+	}
+	out := new(TenantQuota)
+	x.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TenantSpec) DeepCopyInto(out *TenantSpec) {
+	*out = *in
+	if in.PasswordSecretRef != nil {
+		in, out := &in.PasswordSecretRef, &out.PasswordSecretRef
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(core_v1.SecretKeySelector)
+			(*in).DeepCopyInto(*out)
+		}
+	}
+	if in.Users != nil {
+		in, out := &in.Users, &out.Users
+		*out = make([]TenantUser, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Quota != nil {
+		in, out := &in.Quota, &out.Quota
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(TenantQuota)
+			(*in).DeepCopyInto(*out)
+		}
+	}
+	return
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, creating a new TenantSpec.
+func (x *TenantSpec) DeepCopy() *TenantSpec {
+	if x == nil {
+		return nil
+	}
+	out := new(TenantSpec)
+	x.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TenantStatus) DeepCopyInto(out *TenantStatus) {
+	*out = *in
+	if in.Users != nil {
+		in, out := &in.Users, &out.Users
+		*out = make([]TenantUserStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.QuotaUsed != nil {
+		in, out := &in.QuotaUsed, &out.QuotaUsed
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(TenantQuota)
+			(*in).DeepCopyInto(*out)
+		}
+	}
+	return
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, creating a new TenantStatus.
+func (x *TenantStatus) DeepCopy() *TenantStatus {
+	if x == nil {
+		return nil
+	}
+	out := new(TenantStatus)
+	x.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TenantUser) DeepCopyInto(out *TenantUser) {
+	*out = *in
+	if in.PasswordSecretRef != nil {
+		in, out := &in.PasswordSecretRef, &out.PasswordSecretRef
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(core_v1.SecretKeySelector)
+			(*in).DeepCopyInto(*out)
+		}
+	}
+	return
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, creating a new TenantUser.
+func (x *TenantUser) DeepCopy() *TenantUser {
+	if x == nil {
+		return nil
+	}
+	out := new(TenantUser)
+	x.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TenantUserStatus) DeepCopyInto(out *TenantUserStatus) {
+	*out = *in
+	return
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, creating a new TenantUserStatus.
+func (x *TenantUserStatus) DeepCopy() *TenantUserStatus {
+	if x == nil {
+		return nil
+	}
+	out := new(TenantUserStatus)
+	x.DeepCopyInto(out)
+	return out
+}
@@ -17,6 +17,8 @@ limitations under the License.
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -27,6 +29,10 @@ const (
 	TenantResourcePlural = "tenants"
 )
 
+// Finalizer is set on networks and tenants, so that they are only removed
+// after their OpenStack resources have been deleted.
+const Finalizer = GroupName + "/cleanup"
+
 // These are the valid phases of a network state.
 const (
 	// NetworkInitializing means the network is just accepted by system
@@ -42,6 +48,31 @@ const (
 	NetworkTerminating = "Terminating"
 )
 
+// NetworkConditionType is the type of a network condition.
+type NetworkConditionType string
+
+// These are the valid conditions of a network.
+const (
+	// NetworkCreated means the network and its subnets exist in Neutron
+	NetworkCreated NetworkConditionType = "NetworkCreated"
+	// NetworkRouterAttached means the subnets are attached to the router of
+	// the network, which is connected to the external network
+	NetworkRouterAttached NetworkConditionType = "RouterAttached"
+	// NetworkDNSReady means kube-dns is deployed in the namespace
+	NetworkDNSReady NetworkConditionType = "DNSReady"
+)
+
+// These are the valid IPv6 address modes of a subnet.
+const (
+	// IPv6ModeSLAAC means addresses are configured by router advertisements
+	IPv6ModeSLAAC = "slaac"
+	// IPv6ModeDHCPv6Stateful means addresses are assigned by DHCPv6
+	IPv6ModeDHCPv6Stateful = "dhcpv6-stateful"
+	// IPv6ModeDHCPv6Stateless means addresses are configured by router
+	// advertisements and other options are provided by DHCPv6
+	IPv6ModeDHCPv6Stateless = "dhcpv6-stateless"
+)
+
 // These are the valid phases of a tenant state.
 const (
 	// TenantInitializing means the tenant is just accepted by system
@@ -57,6 +88,19 @@ const (
 	TenantTerminating = "Terminating"
 )
 
+// TenantRole is the access level of a user in a tenant.
+type TenantRole string
+
+// These are the valid roles of a tenant user.
+const (
+	// TenantRoleAdmin means the user can manage all resources of the tenant
+	TenantRoleAdmin TenantRole = "admin"
+	// TenantRoleMember means the user can manage the workloads of the tenant
+	TenantRoleMember TenantRole = "member"
+	// TenantRoleReader means the user can only read the resources of the tenant
+	TenantRoleReader TenantRole = "reader"
+)
+
 // Network describes a Neutron network.
 // +k8s:deepcopy-gen=true
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -81,6 +125,50 @@ type NetworkSpec struct {
 	// The network ID in Neutron.
 	// If provided, wouldn't create a network in Neutron.
 	NetworkID string `json:"networkID"`
+	// Additional subnets of the network besides CIDR, e.g. an IPv6 subnet
+	// for dual-stack networks. CIDR may be empty if subnets are set.
+	Subnets []NetworkSubnet `json:"subnets,omitempty"`
+	// The DNS nameservers of the subnets.
+	DNSNameservers []string `json:"dnsNameservers,omitempty"`
+	// The host routes of the subnet of CIDR.
+	HostRoutes []HostRoute `json:"hostRoutes,omitempty"`
+	// The allocation pools of the subnet of CIDR.
+	AllocationPools []AllocationPool `json:"allocationPools,omitempty"`
+	// The administrative state of the network, defaults to up.
+	AdminStateUp *bool `json:"adminStateUp,omitempty"`
+}
+
+// NetworkSubnet is an additional subnet of a network.
+type NetworkSubnet struct {
+	// The CIDR of the subnet.
+	CIDR string `json:"cidr"`
+	// The gateway IP.
+	Gateway string `json:"gateway"`
+	// The IP version of the subnet, 4 or 6. Defaults to the version of CIDR.
+	IPVersion int `json:"ipVersion,omitempty"`
+	// The IPv6 address mode of the subnet, one of slaac, dhcpv6-stateful
+	// and dhcpv6-stateless. Only valid for IPv6 subnets.
+	IPv6Mode string `json:"ipv6Mode,omitempty"`
+	// The host routes of the subnet.
+	HostRoutes []HostRoute `json:"hostRoutes,omitempty"`
+	// The allocation pools of the subnet.
+	AllocationPools []AllocationPool `json:"allocationPools,omitempty"`
+}
+
+// HostRoute is a route pushed to the pods on a subnet.
+type HostRoute struct {
+	// The destination CIDR of the route.
+	Destination string `json:"destination"`
+	// The next hop IP of the route.
+	Nexthop string `json:"nexthop"`
+}
+
+// AllocationPool is a range of IPs in a subnet which are allocated to pods.
+type AllocationPool struct {
+	// The first IP of the pool.
+	Start string `json:"start"`
+	// The last IP of the pool.
+	End string `json:"end"`
 }
 
 // NetworkStatus is the status of a network.
@@ -89,6 +177,34 @@ type NetworkStatus struct {
 	State string `json:"state,omitempty"`
 	// Message describes why network is in current state.
 	Message string `json:"message,omitempty"`
+	// The network ID in Neutron.
+	NetworkID string `json:"networkID,omitempty"`
+	// The subnet IDs in Neutron.
+	SubnetIDs []string `json:"subnetIDs,omitempty"`
+	// The router ID in Neutron.
+	RouterID string `json:"routerID,omitempty"`
+	// The segmentation ID of the network, e.g. the VLAN or VXLAN ID.
+	SegmentationID int32 `json:"segmentationID,omitempty"`
+	// The IP of the router on the external network.
+	ExternalGatewayIP string `json:"externalGatewayIP,omitempty"`
+	// Conditions describe the current conditions of the network.
+	Conditions []NetworkCondition `json:"conditions,omitempty"`
+}
+
+// NetworkCondition describes the state of a network at a certain point.
+type NetworkCondition struct {
+	// Type of the condition.
+	Type NetworkConditionType `json:"type"`
+	// Status of the condition, one of True, False and Unknown.
+	Status corev1.ConditionStatus `json:"status"`
+	// The generation of the network the condition was set upon.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// The last time the condition transitioned from one status to another.
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+	// The reason of the condition's last transition in CamelCase.
+	Reason string `json:"reason,omitempty"`
+	// A human readable message of the last transition.
+	Message string `json:"message,omitempty"`
 }
 
 // NetworkList is a list of networks.
@@ -123,10 +239,50 @@ type TenantSpec struct {
 	// The username of this user.
 	UserName string `json:"username"`
 	// The password of this user.
-	Password string `json:"password"`
+	// Deprecated: the password is stored in plaintext, use PasswordSecretRef instead.
+	Password string `json:"password,omitempty"`
+	// PasswordSecretRef selects the key of a Secret in the system namespace
+	// which holds the password of this user. If neither Password nor
+	// PasswordSecretRef is set, a random password is generated into a Secret.
+	PasswordSecretRef *corev1.SecretKeySelector `json:"passwordSecretRef,omitempty"`
 	// The tenant ID in Keystone.
 	// If provided, wouldn't create a new tenant in Keystone.
 	TenantID string `json:"tenantID"`
+	// Users are the other users of the tenant.
+	Users []TenantUser `json:"users,omitempty"`
+	// Quota limits the resources of the tenant.
+	Quota *TenantQuota `json:"quota,omitempty"`
+}
+
+// TenantUser is a user of a tenant.
+type TenantUser struct {
+	// Name is the name of the user in Keystone.
+	Name string `json:"name"`
+	// Role is the access level of the user, member by default.
+	Role TenantRole `json:"role,omitempty"`
+	// PasswordSecretRef selects the key of a Secret in the system namespace
+	// which holds the password of the user. A random password is generated
+	// into a Secret if it is not set.
+	PasswordSecretRef *corev1.SecretKeySelector `json:"passwordSecretRef,omitempty"`
+}
+
+// TenantQuota limits the resources of a tenant. Limits which are not set
+// are not enforced by stackube.
+type TenantQuota struct {
+	// Pods is the number of pods.
+	Pods *int64 `json:"pods,omitempty"`
+	// CPU is the sum of the CPU requests of pods.
+	CPU *resource.Quantity `json:"cpu,omitempty"`
+	// Memory is the sum of the memory requests of pods.
+	Memory *resource.Quantity `json:"memory,omitempty"`
+	// Services is the number of services.
+	Services *int64 `json:"services,omitempty"`
+	// LoadBalancers is the number of load balancers.
+	LoadBalancers *int64 `json:"loadBalancers,omitempty"`
+	// FloatingIPs is the number of floating IPs.
+	FloatingIPs *int64 `json:"floatingIPs,omitempty"`
+	// Ports is the number of Neutron ports.
+	Ports *int64 `json:"ports,omitempty"`
 }
 
 // TenantStatus is the status of a tenant.
@@ -135,6 +291,41 @@ type TenantStatus struct {
 	State string `json:"state,omitempty"`
 	// Message describes why tenant is in current state.
 	Message string `json:"message,omitempty"`
+	// TenantID is the ID of the Keystone tenant in use.
+	TenantID string `json:"tenantID,omitempty"`
+	// UserID is the ID of the Keystone user of the tenant.
+	UserID string `json:"userID,omitempty"`
+	// UserName is the name of the Keystone user last synced.
+	UserName string `json:"username,omitempty"`
+	// UserAdopted is true if the Keystone user of the tenant existed before
+	// and is only granted roles on the tenant. Its password is not managed,
+	// and it is never renamed or deleted.
+	UserAdopted bool `json:"userAdopted,omitempty"`
+	// PasswordHMAC is the HMAC-SHA256 of the password last set in Keystone,
+	// keyed by a Secret of the controller, which is used to detect password
+	// changes.
+	PasswordHMAC string `json:"passwordHMAC,omitempty"`
+	// Users are the Keystone users synced from the users of the spec.
+	Users []TenantUserStatus `json:"users,omitempty"`
+	// QuotaUsed is the usage of the resources limited by the quota. Pods,
+	// CPU, memory and services are counted by Kubernetes, the others by
+	// Neutron.
+	QuotaUsed *TenantQuota `json:"quotaUsed,omitempty"`
+}
+
+// TenantUserStatus is the status of a user of a tenant.
+type TenantUserStatus struct {
+	// Name is the name of the user in Keystone.
+	Name string `json:"name"`
+	// UserID is the ID of the user in Keystone.
+	UserID string `json:"userID"`
+	// Role is the access level granted to the user.
+	Role TenantRole `json:"role"`
+	// Adopted is true if the user existed in Keystone before, see
+	// TenantStatus.UserAdopted.
+	Adopted bool `json:"adopted,omitempty"`
+	// PasswordHMAC is the HMAC-SHA256 of the password last set in Keystone.
+	PasswordHMAC string `json:"passwordHMAC,omitempty"`
 }
 
 // TenantList is a list of tenants.
@@ -17,6 +17,9 @@ limitations under the License.
 package rbac
 
 import (
+	crv1 "git.openstack.org/openstack/stackube/pkg/apis/v1"
+	"git.openstack.org/openstack/stackube/pkg/util"
+
 	"k8s.io/api/rbac/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -68,6 +71,43 @@ func GenerateRoleBinding(namespace, tenant string) *v1beta1.RoleBinding {
 	return roleBinding
 }
 
+// GenerateUserRoleBinding generates rolebinding which grants user of tenant the role matching its tenant role in the
+// namespace: default-role for admin, the edit ClusterRole for member and the view ClusterRole for reader.
+func GenerateUserRoleBinding(namespace, tenant, user string, role crv1.TenantRole) *v1beta1.RoleBinding {
+	subject := v1beta1.Subject{
+		Kind: "User",
+		Name: user,
+	}
+	roleRef := v1beta1.RoleRef{
+		APIGroup: "rbac.authorization.k8s.io",
+		Kind:     "ClusterRole",
+		Name:     "edit",
+	}
+	switch role {
+	case crv1.TenantRoleAdmin:
+		roleRef.Kind = "Role"
+		roleRef.Name = "default-role"
+	case crv1.TenantRoleReader:
+		roleRef.Name = "view"
+	}
+	roleBinding := &v1beta1.RoleBinding{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "RoleBinding",
+			APIVersion: "rbac.authorization.k8s.io/v1beta1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      namespace + "-rolebinding-user-" + util.BuildObjectName(user),
+			Namespace: namespace,
+			Labels: map[string]string{
+				util.TenantLabel: tenant,
+			},
+		},
+		Subjects: []v1beta1.Subject{subject},
+		RoleRef:  roleRef,
+	}
+	return roleBinding
+}
+
 // GenerateServiceAccountRoleBinding generates rolebinding of service account in the namespace.
 func GenerateServiceAccountRoleBinding(namespace, tenant string) *v1beta1.RoleBinding {
 	subject := v1beta1.Subject{
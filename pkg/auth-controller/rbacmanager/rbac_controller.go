@@ -17,18 +17,23 @@ limitations under the License.
 package rbacmanager
 
 import (
+	"reflect"
 	"time"
 
 	crv1 "git.openstack.org/openstack/stackube/pkg/apis/v1"
 	"git.openstack.org/openstack/stackube/pkg/auth-controller/rbacmanager/rbac"
+	"git.openstack.org/openstack/stackube/pkg/events"
 	crdClient "git.openstack.org/openstack/stackube/pkg/kubecrd"
+	"git.openstack.org/openstack/stackube/pkg/metrics"
 	"git.openstack.org/openstack/stackube/pkg/util"
 
 	"github.com/golang/glog"
 	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/api/rbac/v1beta1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
@@ -36,6 +41,10 @@ import (
 
 const (
 	resyncPeriod = 5 * time.Minute
+
+	// legacySystemPassword is the constant password which was used by the
+	// system tenant.
+	legacySystemPassword = "password"
 )
 
 // Controller manages life cycle of namespace's rbac.
@@ -44,6 +53,10 @@ type Controller struct {
 	kubeCRDClient crdClient.Interface
 	userCIDR      string
 	userGateway   string
+	recorder      events.EventRecorder
+
+	namespaceInformer cache.Controller
+	tenantInformer    cache.Controller
 }
 
 // NewRBACController creates a new RBAC controller.
@@ -54,22 +67,16 @@ func NewRBACController(kubeClient kubernetes.Interface, kubeCRDClient crdClient.
 		kubeCRDClient: kubeCRDClient,
 		userCIDR:      userCIDR,
 		userGateway:   userGateway,
+		recorder:      events.NewRecorder(kubeClient, "rbac-controller"),
 	}
 
-	return c, nil
-}
-
-// Run the controller.
-func (c *Controller) Run(stopCh <-chan struct{}) error {
-	defer utilruntime.HandleCrash()
-
 	source := cache.NewListWatchFromClient(
 		c.k8sclient.Core().RESTClient(),
 		"namespaces",
 		apiv1.NamespaceAll,
 		fields.Everything())
 
-	_, namespaceInformor := cache.NewInformer(
+	_, c.namespaceInformer = cache.NewInformer(
 		source,
 		&apiv1.Namespace{},
 		resyncPeriod,
@@ -79,11 +86,38 @@ func (c *Controller) Run(stopCh <-chan struct{}) error {
 			DeleteFunc: c.onDelete,
 		})
 
-	go namespaceInformor.Run(stopCh)
+	tenantSource := cache.NewListWatchFromClient(
+		c.kubeCRDClient.Client(),
+		crv1.TenantResourcePlural,
+		apiv1.NamespaceAll,
+		fields.Everything())
+
+	_, c.tenantInformer = cache.NewInformer(
+		tenantSource,
+		&crv1.Tenant{},
+		resyncPeriod,
+		cache.ResourceEventHandlerFuncs{
+			UpdateFunc: c.onTenantUpdate,
+		})
+
+	return c, nil
+}
+
+// Run the controller.
+func (c *Controller) Run(stopCh <-chan struct{}) error {
+	defer utilruntime.HandleCrash()
+
+	go c.namespaceInformer.Run(stopCh)
+	go c.tenantInformer.Run(stopCh)
 	<-stopCh
 	return nil
 }
 
+// HasSynced returns true if the namespaces and tenants have been synced.
+func (c *Controller) HasSynced() bool {
+	return c.namespaceInformer.HasSynced() && c.tenantInformer.HasSynced()
+}
+
 func (c *Controller) onAdd(obj interface{}) {
 	namespace := obj.(*apiv1.Namespace)
 	glog.V(3).Infof("RBAC controller received new object %#v\n", namespace)
@@ -92,11 +126,13 @@ func (c *Controller) onAdd(obj interface{}) {
 	if util.IsSystemNamespace(namespace.Name) {
 		if err := c.initSystemReservedTenantNetwork(); err != nil {
 			glog.Error(err)
+			c.recorder.Eventf(namespace, apiv1.EventTypeWarning, "NetworkFailed", "Failed to create the system tenant and network: %v", err)
 			return
 		}
 	} else {
 		if err := c.createNetworkForTenant(namespace.Name); err != nil {
 			glog.Error(err)
+			c.recorder.Eventf(namespace, apiv1.EventTypeWarning, "NetworkFailed", "Failed to create network: %v", err)
 			return
 		}
 	}
@@ -135,15 +171,18 @@ func (c *Controller) initSystemReservedTenantNetwork() error {
 			// always add tenant to system namespace
 			Namespace: util.SystemTenant,
 		},
+		// The tenant controller generates a password for the system tenant.
 		Spec: crv1.TenantSpec{
 			UserName: util.SystemTenant,
-			Password: util.SystemPassword,
 		},
 	}
 
 	if err := c.kubeCRDClient.AddTenant(tenant); err != nil {
 		return err
 	}
+	if err := c.resetLegacySystemPassword(); err != nil {
+		return err
+	}
 
 	// NOTE(harry): we do not support update Network, so although configurable,
 	// user can not update CIDR by changing the configuration, unless manually delete
@@ -167,36 +206,82 @@ func (c *Controller) initSystemReservedTenantNetwork() error {
 	return nil
 }
 
+// resetLegacySystemPassword drops the constant password which was used by
+// the system tenant, so that a generated password is used instead.
+func (c *Controller) resetLegacySystemPassword() error {
+	tenant, err := c.kubeCRDClient.GetTenant(util.SystemTenant)
+	if err != nil {
+		return err
+	}
+	if tenant.Spec.Password != legacySystemPassword {
+		return nil
+	}
+
+	tenant = tenant.DeepCopy()
+	tenant.Spec.Password = ""
+	return c.kubeCRDClient.UpdateTenant(tenant)
+}
+
 func (c *Controller) onUpdate(obj1, obj2 interface{}) {
 	// NOTE(mozhuli) not supported yet
 }
 
+// onTenantUpdate syncs the rolebindings in the namespaces of the tenant when
+// the users of the tenant are changed.
+func (c *Controller) onTenantUpdate(oldObj, newObj interface{}) {
+	oldTenant := oldObj.(*crv1.Tenant)
+	newTenant := newObj.(*crv1.Tenant)
+	if oldTenant.Spec.UserName == newTenant.Spec.UserName &&
+		reflect.DeepEqual(oldTenant.Spec.Users, newTenant.Spec.Users) {
+		return
+	}
+
+	// The rolebindings of namespaces created later are synced when they are added.
+	namespaces, err := util.ListTenantNamespaces(c.k8sclient, newTenant.Name)
+	if err != nil {
+		glog.Errorf("Failed list namespaces of tenant %s: %v", newTenant.Name, err)
+		return
+	}
+	for i := range namespaces {
+		c.syncRBAC(&namespaces[i])
+	}
+}
+
 func (c *Controller) onDelete(obj interface{}) {
 	namespace := obj.(*apiv1.Namespace)
 	// tenant controller have done all the works so we will not wait here
 	glog.V(3).Infof("RBAC controller received deleted namespace %#v\n", namespace)
 }
 
-func (c *Controller) syncRBAC(ns *apiv1.Namespace) error {
+func (c *Controller) syncRBAC(ns *apiv1.Namespace) (err error) {
 	if ns.DeletionTimestamp != nil {
 		return nil
 	}
+	defer func(start time.Time) {
+		metrics.ObserveReconcile("rbac", start, err)
+		if err != nil {
+			c.recorder.Eventf(ns, apiv1.EventTypeWarning, "RBACFailed", "Failed to sync roles and rolebindings: %v", err)
+		}
+	}(time.Now())
 	rbacClient := c.k8sclient.Rbac()
 
 	// Create role for tenant
 	role := rbac.GenerateRoleByNamespace(ns.Name)
-	_, err := rbacClient.Roles(ns.Name).Create(role)
+	_, err = rbacClient.Roles(ns.Name).Create(role)
 	if err != nil && !apierrors.IsAlreadyExists(err) {
 		glog.Errorf("Failed create default-role in namespace %s for tenant %s: %v", ns.Name, ns.Name, err)
 		return err
 	}
 	glog.V(4).Infof("Created default-role in namespace %s for tenant %s", ns.Name, ns.Name)
 
-	// Create rolebinding for tenant
-	roleBinding := rbac.GenerateRoleBinding(ns.Name, ns.Name)
-	_, err = rbacClient.RoleBindings(ns.Name).Create(roleBinding)
-	if err != nil && !apierrors.IsAlreadyExists(err) {
-		glog.Errorf("Failed create %s-rolebindings in namespace %s for tenant %s: %v", ns.Name, ns.Name, ns.Name, err)
+	// Create rolebindings for the users of tenant, system namespaces keep
+	// the rolebindings named after themselves.
+	tenantName := ns.Name
+	if !util.IsSystemNamespace(ns.Name) {
+		tenantName = util.TenantOfNamespace(ns)
+	}
+	if err := c.syncUserRoleBindings(ns.Name, tenantName); err != nil {
+		glog.Errorf("Failed sync rolebindings in namespace %s for tenant %s: %v", ns.Name, tenantName, err)
 		return err
 	}
 	saRoleBinding := rbac.GenerateServiceAccountRoleBinding(ns.Name, ns.Name)
@@ -209,3 +294,73 @@ func (c *Controller) syncRBAC(ns *apiv1.Namespace) error {
 	glog.V(4).Infof("Created %s-rolebindings in namespace %s for tenant %s", ns.Name, ns.Name, ns.Name)
 	return nil
 }
+
+// syncUserRoleBindings makes the rolebindings of the users of the tenant in
+// the namespace match their roles. A tenant without users keeps the single
+// <tenant>-rolebinding which grants default-role to the tenant.
+func (c *Controller) syncUserRoleBindings(namespace, tenantName string) error {
+	roleBindings := c.k8sclient.Rbac().RoleBindings(namespace)
+	legacyRoleBinding := rbac.GenerateRoleBinding(namespace, tenantName)
+
+	tenant, err := c.kubeCRDClient.GetTenant(tenantName)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	expected := make(map[string]*v1beta1.RoleBinding)
+	if tenant == nil || len(tenant.Spec.Users) == 0 {
+		expected[legacyRoleBinding.Name] = legacyRoleBinding
+	} else {
+		// The tenant user owns the tenant like the legacy rolebinding.
+		binding := rbac.GenerateUserRoleBinding(namespace, tenantName, tenant.Spec.UserName, crv1.TenantRoleAdmin)
+		expected[binding.Name] = binding
+		for _, user := range tenant.Spec.Users {
+			binding := rbac.GenerateUserRoleBinding(namespace, tenantName, user.Name, user.Role)
+			expected[binding.Name] = binding
+		}
+	}
+
+	for _, binding := range expected {
+		existing, err := roleBindings.Get(binding.Name, metav1.GetOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		if err == nil {
+			if reflect.DeepEqual(existing.RoleRef, binding.RoleRef) && reflect.DeepEqual(existing.Subjects, binding.Subjects) {
+				continue
+			}
+			// RoleRef of a rolebinding can't be updated, so recreate it.
+			if err := roleBindings.Delete(binding.Name, nil); err != nil && !apierrors.IsNotFound(err) {
+				return err
+			}
+		}
+		if _, err := roleBindings.Create(binding); err != nil && !apierrors.IsAlreadyExists(err) {
+			return err
+		}
+		glog.V(4).Infof("Created rolebinding %s in namespace %s", binding.Name, namespace)
+	}
+
+	// Delete the rolebindings of the users which are removed from the tenant.
+	selector := labels.SelectorFromSet(labels.Set{util.TenantLabel: tenantName})
+	list, err := roleBindings.List(metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return err
+	}
+	stale := []string{}
+	for _, binding := range list.Items {
+		if _, ok := expected[binding.Name]; !ok {
+			stale = append(stale, binding.Name)
+		}
+	}
+	if _, ok := expected[legacyRoleBinding.Name]; !ok {
+		stale = append(stale, legacyRoleBinding.Name)
+	}
+	for _, name := range stale {
+		if err := roleBindings.Delete(name, nil); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		glog.V(4).Infof("Deleted rolebinding %s in namespace %s", name, namespace)
+	}
+
+	return nil
+}
@@ -23,6 +23,7 @@ import (
 
 	crv1 "git.openstack.org/openstack/stackube/pkg/apis/v1"
 	"git.openstack.org/openstack/stackube/pkg/auth-controller/rbacmanager/rbac"
+	"git.openstack.org/openstack/stackube/pkg/events"
 	crdClient "git.openstack.org/openstack/stackube/pkg/kubecrd"
 	"git.openstack.org/openstack/stackube/pkg/util"
 	"k8s.io/api/core/v1"
@@ -42,7 +43,6 @@ var systemTenant = &crv1.Tenant{
 	},
 	Spec: crv1.TenantSpec{
 		UserName: util.SystemTenant,
-		Password: util.SystemPassword,
 	},
 }
 
@@ -87,6 +87,7 @@ func newController() (*Controller, *crdClient.FakeCRDClient, *fake.Clientset, er
 	}
 
 	controller, _ := NewRBACController(client, kubeCRDClient, userCIDR, userGateway)
+	controller.recorder = events.NewFakeRecorder()
 
 	return controller, kubeCRDClient, client, nil
 }
@@ -206,6 +207,29 @@ func TestInitSystemReservedTenantNetwork(t *testing.T) {
 			},
 			expectErr: true,
 		},
+		{
+			testName: "Reset legacy password",
+			updateFn: func() error {
+
+				// Create a new fake controller.
+				controller, kubeCRDClient, _, err = newController()
+				if err != nil {
+					t.Fatalf("Failed start a new fake controller: %v", err)
+				}
+				// Injects the system tenant with the legacy password.
+				tenant := systemTenant.DeepCopy()
+				tenant.Spec.Password = legacySystemPassword
+				kubeCRDClient.SetTenants(tenant)
+				if err := controller.initSystemReservedTenantNetwork(); err != nil {
+					return err
+				}
+				if password := kubeCRDClient.Tenants["default"].Spec.Password; password != "" {
+					return fmt.Errorf("expected legacy password to be reset, got %q", password)
+				}
+				return nil
+			},
+			expectErr: true,
+		},
 	}
 
 	for tci, tc := range testCases {
@@ -271,6 +295,135 @@ func TestSyncRBAC(t *testing.T) {
 	testRBAC(t, client, testNamespace)
 }
 
+func TestSyncUserRoleBindings(t *testing.T) {
+	testNamespace := "test"
+	controller, kubeCRDClient, client, err := newController()
+	if err != nil {
+		t.Fatalf("Failed start a new fake controller: %v", err)
+	}
+	ns := newNamespace(testNamespace)
+	controller.syncRBAC(ns)
+	testRBAC(t, client, testNamespace)
+
+	tenant := &crv1.Tenant{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      testNamespace,
+			Namespace: util.SystemTenant,
+		},
+		Spec: crv1.TenantSpec{
+			UserName: "owner",
+			Users: []crv1.TenantUser{
+				{Name: "alice", Role: crv1.TenantRoleMember},
+				{Name: "Bob_1", Role: crv1.TenantRoleReader},
+			},
+		},
+	}
+	kubeCRDClient.SetTenants(tenant)
+	if err := controller.syncRBAC(ns); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expectedRoles := map[string]crv1.TenantRole{
+		"owner": crv1.TenantRoleAdmin,
+		"alice": crv1.TenantRoleMember,
+		"Bob_1": crv1.TenantRoleReader,
+	}
+	testUserRoleBindings := func() {
+		list, err := client.Rbac().RoleBindings(testNamespace).List(metav1.ListOptions{})
+		if err != nil {
+			t.Fatalf("Failed list roleBindings: %v", err)
+		}
+		// The users and the service account have rolebindings.
+		if len(list.Items) != len(expectedRoles)+1 {
+			t.Errorf("Expected %d rolebindings, got %v", len(expectedRoles)+1, list.Items)
+		}
+		for user, role := range expectedRoles {
+			expected := rbac.GenerateUserRoleBinding(testNamespace, testNamespace, user, role)
+			roleBinding, err := client.Rbac().RoleBindings(testNamespace).Get(expected.Name, metav1.GetOptions{})
+			if err != nil {
+				t.Errorf("Failed get roleBinding of user %s: %v", user, err)
+			} else if !reflect.DeepEqual(roleBinding, expected) {
+				t.Errorf("Expected rolebinding %v, got %v", expected, roleBinding)
+			}
+		}
+	}
+	testUserRoleBindings()
+
+	// Changing the role of alice and removing Bob_1.
+	tenant = tenant.DeepCopy()
+	tenant.Spec.Users = []crv1.TenantUser{{Name: "alice", Role: crv1.TenantRoleAdmin}}
+	kubeCRDClient.SetTenants(tenant)
+	if err := controller.syncRBAC(ns); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectedRoles = map[string]crv1.TenantRole{
+		"owner": crv1.TenantRoleAdmin,
+		"alice": crv1.TenantRoleAdmin,
+	}
+	testUserRoleBindings()
+
+	// A tenant without users falls back to the tenant rolebinding.
+	tenant = tenant.DeepCopy()
+	tenant.Spec.Users = nil
+	kubeCRDClient.SetTenants(tenant)
+	if err := controller.syncRBAC(ns); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	testRBAC(t, client, testNamespace)
+	list, err := client.Rbac().RoleBindings(testNamespace).List(metav1.ListOptions{})
+	if err != nil || len(list.Items) != 2 {
+		t.Errorf("Expected user rolebindings to be deleted, got %v: %v", list, err)
+	}
+}
+
+func TestSyncRBACTenantNamespace(t *testing.T) {
+	controller, kubeCRDClient, client, err := newController()
+	if err != nil {
+		t.Fatalf("Failed start a new fake controller: %v", err)
+	}
+	ns := newNamespace("staging")
+	ns.Labels = map[string]string{util.TenantLabel: "test"}
+	if _, err := client.CoreV1().Namespaces().Create(ns); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	tenant := &crv1.Tenant{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Namespace: util.SystemTenant,
+		},
+		Spec: crv1.TenantSpec{
+			UserName: "test",
+		},
+	}
+	kubeCRDClient.SetTenants(tenant)
+
+	// The tenant of the namespace is bound in it.
+	if err := controller.syncRBAC(ns); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	roleBinding, err := client.Rbac().RoleBindings("staging").Get("test-rolebinding", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Failed get roleBindings: %v", err)
+	}
+	if !reflect.DeepEqual(roleBinding, rbac.GenerateRoleBinding("staging", "test")) {
+		t.Errorf("Created rolebinding has incorrect parameters: %v", roleBinding)
+	}
+
+	// The users of the tenant are bound in its namespaces when they are changed.
+	newTenant := tenant.DeepCopy()
+	newTenant.Spec.Users = []crv1.TenantUser{{Name: "alice", Role: crv1.TenantRoleReader}}
+	kubeCRDClient.SetTenants(newTenant)
+	controller.onTenantUpdate(tenant, newTenant)
+	expected := rbac.GenerateUserRoleBinding("staging", "test", "alice", crv1.TenantRoleReader)
+	roleBinding, err = client.Rbac().RoleBindings("staging").Get(expected.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Failed get roleBinding of user alice: %v", err)
+	}
+	if !reflect.DeepEqual(roleBinding, expected) {
+		t.Errorf("Expected rolebinding %v, got %v", expected, roleBinding)
+	}
+}
+
 func TestOnAdd(t *testing.T) {
 	var controller *Controller
 	var kubeCRDClient *crdClient.FakeCRDClient
@@ -432,3 +585,19 @@ func TestOnAdd(t *testing.T) {
 		tc.expectedFn(tc.namespace)
 	}
 }
+
+func TestOnAddNetworkFailed(t *testing.T) {
+	controller, kubeCRDClient, _, err := newController()
+	if err != nil {
+		t.Fatalf("Failed start a new fake controller: %v", err)
+	}
+	kubeCRDClient.InjectError("AddNetwork", fmt.Errorf("failed to create Network"))
+
+	controller.onAdd(newNamespace("test"))
+
+	recorded := controller.recorder.(*events.FakeRecorder).GetEvents()
+	expected := []string{"Warning NetworkFailed Failed to create network: failed to create Network"}
+	if !reflect.DeepEqual(recorded, expected) {
+		t.Errorf("Expected events %v, got %v", expected, recorded)
+	}
+}
@@ -18,20 +18,58 @@ package tenant
 
 import (
 	"fmt"
+	"reflect"
+	"sync"
+	"time"
 
 	crv1 "git.openstack.org/openstack/stackube/pkg/apis/v1"
+	"git.openstack.org/openstack/stackube/pkg/events"
 	crdClient "git.openstack.org/openstack/stackube/pkg/kubecrd"
+	"git.openstack.org/openstack/stackube/pkg/metrics"
 	"git.openstack.org/openstack/stackube/pkg/openstack"
+	"git.openstack.org/openstack/stackube/pkg/util"
 
 	"github.com/golang/glog"
 	apiv1 "k8s.io/api/core/v1"
 	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	apismetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const (
+	// Interval of resyncing tenants.
+	resyncPeriod = 5 * time.Minute
+
+	// How long to wait before retrying the sync of a tenant.
+	minRetryDelay = 5 * time.Second
+	maxRetryDelay = 300 * time.Second
+
+	concurrentTenantSyncs = 1
+
+	// Key of the password in the Secrets generated for tenants.
+	passwordSecretKey = "password"
+	// Length in bytes of the random passwords generated for tenants.
+	generatedPasswordLength = 24
+
+	// Name and key of the Secret in the system namespace holding the key of
+	// the password HMACs in tenant status, and its length in bytes.
+	passwordKeySecretName = "stackube-password-hmac-key"
+	passwordKeySecretKey  = "key"
+	passwordKeyLength     = 32
+
+	// Name of the ResourceQuota which enforces the quota of a tenant.
+	quotaName = "stackube-quota"
+
+	// Annotation of the namespaces created by the controller, set to the
+	// name of their tenant. Only these namespaces are deleted with it.
+	createdByAnnotation = "stackube.kubernetes.io/created-by-tenant"
 )
 
 // TenantController manages the life cycle of Tenant.
@@ -39,6 +77,16 @@ type TenantController struct {
 	k8sClient       kubernetes.Interface
 	kubeCRDClient   crdClient.Interface
 	openstackClient openstack.Interface
+	tenantInformer  cache.Controller
+	tenantStore     cache.Store
+	recorder        events.EventRecorder
+
+	// tenants that need to be synced
+	queue workqueue.RateLimitingInterface
+
+	// passwordKey is the key of the password HMACs, read on first use.
+	passwordKeyLock sync.Mutex
+	passwordKey     []byte
 }
 
 // NewTenantController creates a new tenant controller.
@@ -55,59 +103,186 @@ func NewTenantController(kubeClient kubernetes.Interface,
 		kubeCRDClient:   osClient.GetCRDClient(),
 		k8sClient:       kubeClient,
 		openstackClient: osClient,
+		recorder:        events.NewRecorder(kubeClient, "tenant-controller"),
+		queue: workqueue.NewNamedRateLimitingQueue(
+			workqueue.NewItemExponentialFailureRateLimiter(minRetryDelay, maxRetryDelay), "tenant"),
 	}
 
 	if err = c.createClusterRoles(); err != nil {
 		return nil, fmt.Errorf("failed to create cluster roles to kube-apiserver: %v", err)
 	}
 
-	return c, nil
-}
-
-// Run the controller.
-func (c *TenantController) Run(stopCh <-chan struct{}) error {
-	defer utilruntime.HandleCrash()
-
 	source := cache.NewListWatchFromClient(
 		c.kubeCRDClient.Client(),
 		crv1.TenantResourcePlural,
 		apiv1.NamespaceAll,
 		fields.Everything())
-
-	_, tenantInformor := cache.NewInformer(
+	c.tenantStore, c.tenantInformer = cache.NewInformer(
 		source,
 		&crv1.Tenant{},
-		0,
+		resyncPeriod,
 		cache.ResourceEventHandlerFuncs{
 			AddFunc:    c.onAdd,
 			UpdateFunc: c.onUpdate,
 			DeleteFunc: c.onDelete,
 		})
 
-	go tenantInformor.Run(stopCh)
+	return c, nil
+}
+
+// Run the controller.
+func (c *TenantController) Run(stopCh <-chan struct{}) error {
+	defer utilruntime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	go c.tenantInformer.Run(stopCh)
+	if !cache.WaitForCacheSync(stopCh, c.tenantInformer.HasSynced) {
+		return fmt.Errorf("failed to cache tenants")
+	}
+
+	for i := 0; i < concurrentTenantSyncs; i++ {
+		go wait.Until(c.worker, time.Second, stopCh)
+	}
 	<-stopCh
+
 	return nil
 }
 
+// HasSynced returns true if the tenants have been synced.
+func (c *TenantController) HasSynced() bool {
+	return c.tenantInformer.HasSynced()
+}
+
+func (c *TenantController) enqueueTenant(tenant *crv1.Tenant) {
+	key, err := cache.MetaNamespaceKeyFunc(tenant)
+	if err != nil {
+		glog.Errorf("Couldn't get key for tenant %#v: %v", tenant, err)
+		return
+	}
+	c.queue.Add(key)
+}
+
 func (c *TenantController) onAdd(obj interface{}) {
 	tenant := obj.(*crv1.Tenant)
 	glog.V(3).Infof("Tenant controller received new object %#v\n", tenant)
 
-	copyObj, err := c.kubeCRDClient.Scheme().Copy(tenant)
-	if err != nil {
-		glog.Errorf("ERROR creating a deep copy of tenant object: %#v\n", err)
+	c.enqueueTenant(tenant)
+}
+
+func (c *TenantController) onUpdate(oldObj, newObj interface{}) {
+	oldTenant := oldObj.(*crv1.Tenant)
+	newTenant := newObj.(*crv1.Tenant)
+
+	// Status updates made by ourselves also come here, only spec changes
+	// and deletion need to be synced. Some tenants are also synced again on
+	// resync.
+	resync := oldTenant.ResourceVersion == newTenant.ResourceVersion
+	if reflect.DeepEqual(oldTenant.Spec, newTenant.Spec) && newTenant.DeletionTimestamp == nil &&
+		!(resync && needsResync(newTenant)) {
 		return
 	}
+	glog.V(3).Infof("Tenant controller received updated tenant %#v\n", newTenant)
+
+	c.enqueueTenant(newTenant)
+}
+
+// needsResync returns true if tenant has to be synced on resync: it's not
+// active yet, its password Secrets may have been changed, or the usage of its
+// quota has to be refreshed.
+func needsResync(tenant *crv1.Tenant) bool {
+	return tenant.Status.State != crv1.TenantActive ||
+		tenant.Spec.PasswordSecretRef != nil ||
+		len(tenant.Spec.Users) > 0 ||
+		tenant.Spec.Quota != nil
+}
 
-	newTenant := copyObj.(*crv1.Tenant)
-	c.syncTenant(newTenant)
+// worker runs a worker thread that just dequeues items, processes them, and
+// marks them done. It enforces that the same key is never synced concurrently.
+func (c *TenantController) worker() {
+	for c.processNextWorkItem() {
+	}
 }
 
-func (c *TenantController) onUpdate(obj1, obj2 interface{}) {
-	glog.Warning("tenant updates is not supported yet.")
+func (c *TenantController) processNextWorkItem() bool {
+	key, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(key)
+
+	start := time.Now()
+	err := c.syncTenant(key.(string))
+	metrics.ObserveReconcile("tenant", start, err)
+	if err != nil {
+		glog.Errorf("Error syncing tenant %q (will retry): %v", key, err)
+		c.queue.AddRateLimited(key)
+		return true
+	}
+
+	c.queue.Forget(key)
+	return true
+}
+
+// syncTenant creates the resources of the tenant with key, or deletes them
+// if the tenant is being deleted.
+func (c *TenantController) syncTenant(key string) error {
+	obj, exists, err := c.tenantStore.GetByKey(key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		glog.V(4).Infof("Tenant %s has been deleted", key)
+		return nil
+	}
+
+	copyObj, err := c.kubeCRDClient.Scheme().Copy(obj.(*crv1.Tenant))
+	if err != nil {
+		return fmt.Errorf("creating a deep copy of tenant object failed: %v", err)
+	}
+	tenant := copyObj.(*crv1.Tenant)
+
+	if tenant.DeletionTimestamp != nil {
+		return c.finalizeTenant(tenant)
+	}
+
+	// Make sure the resources are deleted before the tenant is removed.
+	if !util.HasFinalizer(tenant, crv1.Finalizer) || tenant.Status.State == "" {
+		util.AddFinalizer(tenant, crv1.Finalizer)
+		if tenant.Status.State == "" {
+			tenant.Status.State = crv1.TenantInitializing
+		}
+		if err := c.kubeCRDClient.UpdateTenant(tenant); err != nil {
+			return err
+		}
+	}
+
+	oldStatus := tenant.Status.DeepCopy()
+	if err := c.createTenantResources(tenant); err != nil {
+		tenant.Status.State = crv1.TenantFailed
+		tenant.Status.Message = err.Error()
+		c.kubeCRDClient.UpdateTenant(tenant)
+		c.recorder.Event(tenant, apiv1.EventTypeWarning, "TenantFailed", err.Error())
+		return err
+	}
+
+	tenant.Status.State = crv1.TenantActive
+	tenant.Status.Message = ""
+	if apiequality.Semantic.DeepEqual(&tenant.Status, oldStatus) {
+		return nil
+	}
+	if err := c.kubeCRDClient.UpdateTenant(tenant); err != nil {
+		return err
+	}
+	if oldStatus.State != crv1.TenantActive {
+		c.recorder.Eventf(tenant, apiv1.EventTypeNormal, "TenantActive", "Tenant is active with keystone tenant %s", tenant.Status.TenantID)
+	}
+	return nil
 }
 
 func (c *TenantController) onDelete(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
 	tenant, ok := obj.(*crv1.Tenant)
 	if !ok {
 		return
@@ -115,6 +290,45 @@ func (c *TenantController) onDelete(obj interface{}) {
 
 	glog.V(3).Infof("Tenant controller received deleted tenant %#v\n", tenant)
 
+	// Tenants with the finalizer have been cleaned up by finalizeTenant
+	// before they are removed.
+	if tenant.Status.State == crv1.TenantTerminating {
+		return
+	}
+	if err := c.deleteTenantResources(tenant); err != nil {
+		glog.Errorf("Clean up tenant %s failed: %v", tenant.Name, err)
+	}
+}
+
+// finalizeTenant deletes the resources of a tenant being deleted, and
+// removes the finalizer so that the tenant can be removed.
+func (c *TenantController) finalizeTenant(tenant *crv1.Tenant) error {
+	if !util.HasFinalizer(tenant, crv1.Finalizer) {
+		return nil
+	}
+
+	if tenant.Status.State != crv1.TenantTerminating {
+		tenant.Status.State = crv1.TenantTerminating
+		tenant.Status.Message = ""
+		if err := c.kubeCRDClient.UpdateTenant(tenant); err != nil {
+			return err
+		}
+	}
+
+	if err := c.deleteTenantResources(tenant); err != nil {
+		tenant.Status.Message = fmt.Sprintf("clean up tenant failed: %v", err)
+		c.kubeCRDClient.UpdateTenant(tenant)
+		c.recorder.Event(tenant, apiv1.EventTypeWarning, "CleanupFailed", tenant.Status.Message)
+		return err
+	}
+
+	util.RemoveFinalizer(tenant, crv1.Finalizer)
+	return c.kubeCRDClient.UpdateTenant(tenant)
+}
+
+// deleteTenantResources deletes the kubernetes and keystone resources of
+// tenant.
+func (c *TenantController) deleteTenantResources(tenant *crv1.Tenant) error {
 	deleteOptions := &apismetav1.DeleteOptions{
 		TypeMeta: apismetav1.TypeMeta{
 			Kind:       "ClusterRoleBinding",
@@ -124,37 +338,64 @@ func (c *TenantController) onDelete(obj interface{}) {
 	tenantName := tenant.Name
 	err := c.k8sClient.Rbac().ClusterRoleBindings().Delete(tenantName+"-namespace-creater", deleteOptions)
 	if err != nil && !apierrors.IsNotFound(err) {
-		glog.Errorf("Failed delete ClusterRoleBinding for tenant %s: %v", tenantName, err)
-	} else {
-		glog.V(4).Infof("Deleted ClusterRoleBinding %s", tenantName)
+		return fmt.Errorf("failed delete ClusterRoleBinding for tenant %s: %v", tenantName, err)
 	}
+	glog.V(4).Infof("Deleted ClusterRoleBinding %s", tenantName)
 
-	// Delete automatically created network
-	// TODO(harry) so that we can not deal with network with different name and namespace,
-	// we need to document that.
-	if err := c.kubeCRDClient.DeleteNetwork(tenantName); err != nil {
-		glog.Errorf("failed to delete network for tenant: %v", tenantName)
+	namespaces, err := c.tenantNamespaces(tenant)
+	if err != nil {
+		return err
 	}
+	for _, namespace := range namespaces {
+		// Delete automatically created network
+		// TODO(harry) so that we can not deal with network with different name and namespace,
+		// we need to document that.
+		if err := c.kubeCRDClient.DeleteNetwork(namespace); err != nil {
+			return fmt.Errorf("failed to delete network for tenant %s: %v", tenantName, err)
+		}
 
-	// Delete namespace
-	err = c.deleteNamespace(tenantName)
-	if err != nil {
-		glog.Errorf("Delete namespace %s failed: %v", tenantName, err)
-	} else {
-		glog.V(4).Infof("Deleted namespace %s", tenantName)
+		// Delete namespace, or only release it if it wasn't created for
+		// the tenant.
+		if err := c.releaseNamespace(tenant, namespace); err != nil {
+			return fmt.Errorf("release namespace %s failed: %v", namespace, err)
+		}
 	}
 
-	// Delete all users on a tenant
-	err = c.openstackClient.DeleteAllUsersOnTenant(tenantName)
-	if err != nil {
-		glog.Errorf("Failed delete all users in the tenant %s: %v", tenantName, err)
+	// Delete the users created for the tenant. Adopted users only lose their
+	// roles, and other users of the keystone tenant, e.g. of an existing
+	// project, are kept.
+	for _, user := range tenant.Status.Users {
+		if err := c.releaseUser(tenant, user.UserID, user.Adopted); err != nil {
+			return fmt.Errorf("failed delete user %s of tenant %s: %v", user.Name, tenantName, err)
+		}
+	}
+	if err := c.releaseUser(tenant, tenant.Status.UserID, tenant.Status.UserAdopted); err != nil {
+		return fmt.Errorf("failed delete user of tenant %s: %v", tenantName, err)
 	}
 
 	// Delete tenant in keystone
 	if tenant.Spec.TenantID == "" {
 		err = c.openstackClient.DeleteTenant(tenantName)
 		if err != nil {
-			glog.Errorf("Failed delete tenant %s: %v", tenantName, err)
+			return fmt.Errorf("failed delete tenant %s: %v", tenantName, err)
+		}
+	}
+
+	return nil
+}
+
+// releaseUser deletes the keystone user userID of tenant, or only revokes its
+// roles in the keystone tenant if the user is adopted.
+func (c *TenantController) releaseUser(tenant *crv1.Tenant, userID string, adopted bool) error {
+	switch {
+	case userID == "":
+		return nil
+	case adopted:
+		if tenant.Status.TenantID == "" {
+			return nil
 		}
+		return c.openstackClient.RevokeUserRoles(userID, tenant.Status.TenantID)
+	default:
+		return c.openstackClient.DeleteUser(userID)
 	}
 }
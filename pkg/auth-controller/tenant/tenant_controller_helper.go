@@ -17,53 +17,575 @@ limitations under the License.
 package tenant
 
 import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+
 	crv1 "git.openstack.org/openstack/stackube/pkg/apis/v1"
 	"git.openstack.org/openstack/stackube/pkg/auth-controller/rbacmanager/rbac"
 	"git.openstack.org/openstack/stackube/pkg/openstack"
+	"git.openstack.org/openstack/stackube/pkg/util"
 
 	"github.com/golang/glog"
 	apiv1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	apismetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-func (c *TenantController) syncTenant(tenant *crv1.Tenant) {
+// createTenantResources creates the kubernetes and keystone resources of
+// tenant, and records the keystone resources in the status of tenant.
+func (c *TenantController) createTenantResources(tenant *crv1.Tenant) error {
 	roleBinding := rbac.GenerateClusterRoleBindingByTenant(tenant.Name)
 	_, err := c.k8sClient.Rbac().ClusterRoleBindings().Create(roleBinding)
 	if err != nil && !apierrors.IsAlreadyExists(err) {
 		glog.Errorf("Failed create ClusterRoleBinding for tenant %s: %v", tenant.Name, err)
-		return
+		return fmt.Errorf("failed to create ClusterRoleBinding: %v", err)
 	}
 	glog.V(4).Infof("Created ClusterRoleBindings %s-namespace-creater for tenant %s", tenant.Name, tenant.Name)
-	if tenant.Spec.TenantID != "" {
-		// Create user with the spec username and password in the given tenant
-		err = c.openstackClient.CreateUser(tenant.Spec.UserName, tenant.Spec.Password, tenant.Spec.TenantID)
-		if err != nil && !openstack.IsAlreadyExists(err) {
-			glog.Errorf("Failed create user %s: %v", tenant.Spec.UserName, err)
-			return
-		}
-	} else {
+
+	tenantID := tenant.Spec.TenantID
+	if tenantID == "" {
 		// Create tenant if the tenant not exist in keystone, or get the tenantID by tenantName
-		tenantID, err := c.openstackClient.CreateTenant(tenant.Name)
+		tenantID, err = c.openstackClient.CreateTenant(tenant.Name)
 		if err != nil {
 			glog.Errorf("Failed create tenant %#v: %v", tenant, err)
-			return
+			return fmt.Errorf("failed to create keystone tenant: %v", err)
 		}
-		// Create user with the spec username and password in the created tenant
-		err = c.openstackClient.CreateUser(tenant.Spec.UserName, tenant.Spec.Password, tenantID)
+	} else {
+		// The keystone tenant of an adopted or imported tenant may have been
+		// removed, don't mark such tenants as active.
+		exist, err := c.openstackClient.CheckTenantByID(tenantID)
 		if err != nil {
-			glog.Errorf("Failed create user %s: %v", tenant.Spec.UserName, err)
-			return
+			glog.Errorf("Failed check tenant %s: %v", tenantID, err)
+			return fmt.Errorf("failed to check keystone tenant %s: %v", tenantID, err)
+		}
+		if !exist {
+			return fmt.Errorf("keystone tenant %s not found", tenantID)
 		}
 	}
 
+	password, err := c.tenantPassword(tenant)
+	if err != nil {
+		glog.Errorf("Failed get password of tenant %s: %v", tenant.Name, err)
+		return err
+	}
+
+	// Create or update the user with the spec username and password in the tenant
+	if err = c.syncUser(tenant, tenantID, password); err != nil {
+		glog.Errorf("Failed sync user %s: %v", tenant.Spec.UserName, err)
+		return fmt.Errorf("failed to sync keystone user %s: %v", tenant.Spec.UserName, err)
+	}
+	if err = c.syncUsers(tenant, tenantID); err != nil {
+		glog.Errorf("Failed sync users of tenant %s: %v", tenant.Name, err)
+		return err
+	}
+	// Users are moved to tenantID only when all of them are synced.
+	tenant.Status.TenantID = tenantID
+
 	// Create namespace which name is the same as the tenant's name
 	err = c.createNamespace(tenant.Name)
 	if err != nil {
 		glog.Errorf("Failed create namespace %s: %v", tenant.Name, err)
-		return
+		return fmt.Errorf("failed to create namespace: %v", err)
 	}
 	glog.V(4).Infof("Created namespace %s for tenant %s", tenant.Name, tenant.Name)
+
+	if err = c.syncQuota(tenant, tenantID); err != nil {
+		glog.Errorf("Failed sync quota of tenant %s: %v", tenant.Name, err)
+		return err
+	}
+	return nil
+}
+
+// tenantNamespaces returns the names of the namespaces owned by tenant: the
+// namespace named after tenant and the namespaces which declare tenant as
+// their tenant.
+func (c *TenantController) tenantNamespaces(tenant *crv1.Tenant) ([]string, error) {
+	namespaces, err := util.ListTenantNamespaces(c.k8sClient, tenant.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list namespaces: %v", err)
+	}
+
+	names := []string{tenant.Name}
+	for _, namespace := range namespaces {
+		if namespace.Name != tenant.Name && !util.IsSystemNamespace(namespace.Name) {
+			names = append(names, namespace.Name)
+		}
+	}
+	return names, nil
+}
+
+// syncQuota enforces the quota of tenant by a ResourceQuota in each of its
+// namespaces and by the Neutron quota of tenantID, and records their usage
+// in the status of tenant. The quota applies to all namespaces together.
+func (c *TenantController) syncQuota(tenant *crv1.Tenant, tenantID string) error {
+	namespaces, err := c.tenantNamespaces(tenant)
+	if err != nil {
+		return err
+	}
+
+	quota := tenant.Spec.Quota
+	if quota == nil {
+		for _, namespace := range namespaces {
+			err := c.k8sClient.CoreV1().ResourceQuotas(namespace).Delete(quotaName, nil)
+			if err != nil && !apierrors.IsNotFound(err) {
+				return fmt.Errorf("failed to delete ResourceQuota: %v", err)
+			}
+		}
+		tenant.Status.QuotaUsed = nil
+		return nil
+	}
+
+	hard := apiv1.ResourceList{}
+	for name, limit := range map[apiv1.ResourceName]*int64{
+		apiv1.ResourcePods:                  quota.Pods,
+		apiv1.ResourceServices:              quota.Services,
+		apiv1.ResourceServicesLoadBalancers: quota.LoadBalancers,
+	} {
+		if limit != nil {
+			hard[name] = *resource.NewQuantity(*limit, resource.DecimalSI)
+		}
+	}
+	if quota.CPU != nil {
+		hard[apiv1.ResourceRequestsCPU] = *quota.CPU
+	}
+	if quota.Memory != nil {
+		hard[apiv1.ResourceRequestsMemory] = *quota.Memory
+	}
+
+	// The hard limits are of the tenant, so each namespace may only use the
+	// headroom left by all namespaces of the tenant.
+	resourceQuotas := make(map[string]*apiv1.ResourceQuota)
+	usedList := apiv1.ResourceList{}
+	for _, namespace := range namespaces {
+		resourceQuota, err := c.k8sClient.CoreV1().ResourceQuotas(namespace).Get(quotaName, apismetav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get ResourceQuota in namespace %s: %v", namespace, err)
+		}
+		resourceQuotas[namespace] = resourceQuota
+		for name, q := range resourceQuota.Status.Used {
+			sum := usedList[name]
+			sum.Add(q)
+			usedList[name] = sum
+		}
+	}
+	for _, namespace := range namespaces {
+		var used apiv1.ResourceList
+		if resourceQuota := resourceQuotas[namespace]; resourceQuota != nil {
+			used = resourceQuota.Status.Used
+		}
+		err := c.syncResourceQuota(namespace, resourceQuotas[namespace], namespaceHard(hard, usedList, used))
+		if err != nil {
+			return fmt.Errorf("failed to sync ResourceQuota in namespace %s: %v", namespace, err)
+		}
+	}
+
+	used, err := c.openstackClient.UpdateQuota(tenantID, quota)
+	if err != nil {
+		return fmt.Errorf("failed to update neutron quota: %v", err)
+	}
+
+	// Usage of load balancers is counted by Neutron.
+	for name, value := range map[apiv1.ResourceName]**int64{
+		apiv1.ResourcePods:     &used.Pods,
+		apiv1.ResourceServices: &used.Services,
+	} {
+		if q, ok := usedList[name]; ok {
+			v := q.Value()
+			*value = &v
+		}
+	}
+	if q, ok := usedList[apiv1.ResourceRequestsCPU]; ok {
+		used.CPU = &q
+	}
+	if q, ok := usedList[apiv1.ResourceRequestsMemory]; ok {
+		used.Memory = &q
+	}
+	tenant.Status.QuotaUsed = used
+	return nil
+}
+
+// namespaceHard returns the hard limits of a namespace using used, which are
+// its usage plus the headroom left by tenantUsed in the hard limits of the
+// tenant.
+func namespaceHard(hard, tenantUsed, used apiv1.ResourceList) apiv1.ResourceList {
+	result := apiv1.ResourceList{}
+	for name, limit := range hard {
+		headroom := limit.DeepCopy()
+		headroom.Sub(tenantUsed[name])
+		if headroom.Sign() < 0 {
+			headroom = *resource.NewQuantity(0, limit.Format)
+		}
+		q := used[name].DeepCopy()
+		q.Add(headroom)
+		result[name] = q
+	}
+	return result
+}
+
+// syncResourceQuota makes the ResourceQuota of a tenant in the namespace
+// enforce the hard limits. resourceQuota is the existing one, or nil if it's
+// not created yet.
+func (c *TenantController) syncResourceQuota(namespace string, resourceQuota *apiv1.ResourceQuota, hard apiv1.ResourceList) error {
+	resourceQuotas := c.k8sClient.CoreV1().ResourceQuotas(namespace)
+	if resourceQuota == nil {
+		_, err := resourceQuotas.Create(&apiv1.ResourceQuota{
+			ObjectMeta: apismetav1.ObjectMeta{
+				Name: quotaName,
+			},
+			Spec: apiv1.ResourceQuotaSpec{
+				Hard: hard,
+			},
+		})
+		return err
+	}
+	if !apiequality.Semantic.DeepEqual(resourceQuota.Spec.Hard, hard) {
+		resourceQuota.Spec.Hard = hard
+		_, err := resourceQuotas.Update(resourceQuota)
+		return err
+	}
+	return nil
+}
+
+// tenantPassword returns the password of the keystone user of tenant. A
+// random password is generated into a Secret if tenant doesn't specify one.
+func (c *TenantController) tenantPassword(tenant *crv1.Tenant) (string, error) {
+	if tenant.Spec.PasswordSecretRef == nil {
+		if tenant.Spec.Password != "" {
+			return tenant.Spec.Password, nil
+		}
+		ref, err := c.generatePasswordSecret(tenant, fmt.Sprintf("stackube-%s-password", tenant.Name))
+		if err != nil {
+			return "", fmt.Errorf("failed to generate password: %v", err)
+		}
+		tenant.Spec.PasswordSecretRef = ref
+		if err := c.kubeCRDClient.UpdateTenant(tenant); err != nil {
+			return "", err
+		}
+	}
+
+	return c.readPasswordSecret(tenant.Spec.PasswordSecretRef)
+}
+
+// userPassword returns the password of user of tenant. A random password is
+// generated into a Secret if user doesn't specify one.
+func (c *TenantController) userPassword(tenant *crv1.Tenant, user *crv1.TenantUser) (string, error) {
+	if user.PasswordSecretRef == nil {
+		ref, err := c.generatePasswordSecret(tenant, userSecretName(tenant, user.Name))
+		if err != nil {
+			return "", fmt.Errorf("failed to generate password of user %s: %v", user.Name, err)
+		}
+		user.PasswordSecretRef = ref
+		if err := c.kubeCRDClient.UpdateTenant(tenant); err != nil {
+			return "", err
+		}
+	}
+
+	return c.readPasswordSecret(user.PasswordSecretRef)
+}
+
+// userSecretName returns the name of the Secret generated for the password
+// of the user of tenant.
+func userSecretName(tenant *crv1.Tenant, username string) string {
+	return fmt.Sprintf("stackube-%s-%s-password", tenant.Name, util.BuildObjectName(username))
+}
+
+// readPasswordSecret reads the password selected by ref from the system
+// namespace.
+func (c *TenantController) readPasswordSecret(ref *apiv1.SecretKeySelector) (string, error) {
+	secret, err := c.k8sClient.CoreV1().Secrets(util.SystemTenant).Get(ref.Name, apismetav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get password secret %s: %v", ref.Name, err)
+	}
+	password := string(secret.Data[ref.Key])
+	if password == "" {
+		return "", fmt.Errorf("password secret %s has no key %s", ref.Name, ref.Key)
+	}
+	return password, nil
+}
+
+// generatePasswordSecret generates a random password into the Secret name
+// owned by tenant, and returns the selector of the password.
+func (c *TenantController) generatePasswordSecret(tenant *crv1.Tenant, name string) (*apiv1.SecretKeySelector, error) {
+	buf := make([]byte, generatedPasswordLength)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+
+	secret := &apiv1.Secret{
+		ObjectMeta: apismetav1.ObjectMeta{
+			Name:      name,
+			Namespace: util.SystemTenant,
+			OwnerReferences: []apismetav1.OwnerReference{
+				{
+					APIVersion: crv1.SchemeGroupVersion.String(),
+					Kind:       "Tenant",
+					Name:       tenant.Name,
+					UID:        tenant.UID,
+				},
+			},
+		},
+		Type: apiv1.SecretTypeOpaque,
+		Data: map[string][]byte{
+			passwordSecretKey: []byte(base64.RawURLEncoding.EncodeToString(buf)),
+		},
+	}
+	_, err := c.k8sClient.CoreV1().Secrets(util.SystemTenant).Create(secret)
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return nil, err
+	}
+	glog.V(4).Infof("Generated password secret %s for tenant %s", secret.Name, tenant.Name)
+
+	return &apiv1.SecretKeySelector{
+		LocalObjectReference: apiv1.LocalObjectReference{Name: secret.Name},
+		Key:                  passwordSecretKey,
+	}, nil
+}
+
+// syncUser makes the keystone user of tenant match its spec. The user is
+// created in tenantID if it's not created yet, otherwise it is renamed, its
+// password is rotated, and it is moved to tenantID if they are changed. An
+// adopted user is never renamed or rotated, it's replaced by the user of the
+// new name instead.
+func (c *TenantController) syncUser(tenant *crv1.Tenant, tenantID, password string) error {
+	status := &tenant.Status
+	hash, err := c.passwordHMAC(password)
+	if err != nil {
+		return err
+	}
+
+	if status.UserID != "" && status.UserAdopted && status.UserName != tenant.Spec.UserName {
+		if err := c.openstackClient.RevokeUserRoles(status.UserID, status.TenantID); err != nil {
+			return err
+		}
+		status.UserID = ""
+		status.UserAdopted = false
+	}
+
+	if status.UserID != "" && !status.UserAdopted &&
+		(status.UserName != tenant.Spec.UserName || status.PasswordHMAC != hash) {
+		var newUsername, newPassword string
+		if status.UserName != tenant.Spec.UserName {
+			newUsername = tenant.Spec.UserName
+		}
+		if status.PasswordHMAC != hash {
+			newPassword = password
+		}
+		err := c.openstackClient.UpdateUser(status.UserID, newUsername, newPassword)
+		if err == openstack.ErrNotFound {
+			glog.Warningf("User %s of tenant %s not found in keystone, creating it again", status.UserID, tenant.Name)
+			status.UserID = ""
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if status.UserID == "" {
+		userID, adopted, err := c.openstackClient.CreateUser(tenant.Spec.UserName, password, tenantID, "")
+		if err != nil {
+			return err
+		}
+		status.UserID = userID
+		status.UserAdopted = adopted
+	} else if status.TenantID != tenantID {
+		err := c.openstackClient.MoveUserToTenant(status.UserID, status.TenantID, tenantID, "")
+		if err != nil {
+			return err
+		}
+		glog.V(4).Infof("Tenant %s is moved from keystone tenant %s to %s", tenant.Name, status.TenantID, tenantID)
+	}
+
+	status.UserName = tenant.Spec.UserName
+	status.PasswordHMAC = ""
+	if !status.UserAdopted {
+		status.PasswordHMAC = hash
+	}
+	return nil
+}
+
+// validateUsers checks the users of tenant have unique names and valid roles.
+func validateUsers(tenant *crv1.Tenant) error {
+	names := map[string]bool{tenant.Spec.UserName: true}
+	for _, user := range tenant.Spec.Users {
+		if user.Name == "" {
+			return fmt.Errorf("user name must not be empty")
+		}
+		if names[user.Name] {
+			return fmt.Errorf("user %s is specified more than once", user.Name)
+		}
+		names[user.Name] = true
+
+		switch user.Role {
+		case "", crv1.TenantRoleAdmin, crv1.TenantRoleMember, crv1.TenantRoleReader:
+		default:
+			return fmt.Errorf("user %s has invalid role %q", user.Name, user.Role)
+		}
+	}
+	return nil
+}
+
+// syncUsers makes the keystone users of tenant match the users of its spec,
+// and deletes the users which are removed from the spec. The users which
+// fail to sync are kept in the status of tenant, so that they are retried.
+func (c *TenantController) syncUsers(tenant *crv1.Tenant, tenantID string) error {
+	if err := validateUsers(tenant); err != nil {
+		return err
+	}
+
+	oldUsers := tenant.Status.Users
+	pending := make(map[string]crv1.TenantUserStatus)
+	for _, status := range oldUsers {
+		pending[status.Name] = status
+	}
+	var synced []crv1.TenantUserStatus
+	defer func() {
+		for _, status := range oldUsers {
+			if _, ok := pending[status.Name]; ok {
+				synced = append(synced, status)
+			}
+		}
+		tenant.Status.Users = synced
+	}()
+
+	for i := range tenant.Spec.Users {
+		user := &tenant.Spec.Users[i]
+		password, err := c.userPassword(tenant, user)
+		if err != nil {
+			return err
+		}
+		status, err := c.syncTenantUser(tenant, user, pending[user.Name], tenantID, password)
+		if err != nil {
+			return fmt.Errorf("failed to sync keystone user %s: %v", user.Name, err)
+		}
+		delete(pending, user.Name)
+		synced = append(synced, status)
+	}
+
+	for name, status := range pending {
+		if status.Adopted {
+			// Adopted users are not deleted, only their roles are.
+			if err := c.openstackClient.RevokeUserRoles(status.UserID, tenantID); err != nil {
+				return fmt.Errorf("failed to revoke roles of keystone user %s: %v", name, err)
+			}
+		} else if err := c.openstackClient.DeleteUser(status.UserID); err != nil {
+			return fmt.Errorf("failed to delete keystone user %s: %v", name, err)
+		}
+		err := c.k8sClient.CoreV1().Secrets(util.SystemTenant).Delete(userSecretName(tenant, name), nil)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete password secret of user %s: %v", name, err)
+		}
+		delete(pending, name)
+		glog.V(4).Infof("Deleted user %s of tenant %s", name, tenant.Name)
+	}
+	return nil
+}
+
+// syncTenantUser makes the keystone user of status match user. The user is
+// created in tenantID if it's not created yet, otherwise its password is
+// rotated, its role is changed and it is moved to tenantID if they are
+// changed. The password of an adopted user is never rotated. The new status
+// of the user is returned.
+func (c *TenantController) syncTenantUser(tenant *crv1.Tenant, user *crv1.TenantUser, status crv1.TenantUserStatus,
+	tenantID, password string) (crv1.TenantUserStatus, error) {
+	hash, err := c.passwordHMAC(password)
+	if err != nil {
+		return status, err
+	}
+	role := user.Role
+	if role == "" {
+		role = crv1.TenantRoleMember
+	}
+
+	if status.UserID != "" && !status.Adopted && status.PasswordHMAC != hash {
+		err := c.openstackClient.UpdateUser(status.UserID, "", password)
+		if err == openstack.ErrNotFound {
+			glog.Warningf("User %s of tenant %s not found in keystone, creating it again", status.UserID, tenant.Name)
+			status.UserID = ""
+		} else if err != nil {
+			return status, err
+		}
+	}
+
+	oldTenantID := tenant.Status.TenantID
+	switch {
+	case status.UserID == "":
+		status.UserID, status.Adopted, err = c.openstackClient.CreateUser(user.Name, password, tenantID, role)
+	case oldTenantID != tenantID:
+		err = c.openstackClient.MoveUserToTenant(status.UserID, oldTenantID, tenantID, role)
+	case status.Role != role:
+		err = c.openstackClient.SetUserRole(status.UserID, tenantID, role)
+	}
+	if err != nil {
+		return status, err
+	}
+
+	status.Name = user.Name
+	status.Role = role
+	status.PasswordHMAC = ""
+	if !status.Adopted {
+		status.PasswordHMAC = hash
+	}
+	return status, nil
+}
+
+// passwordHMAC returns the hex encoded HMAC-SHA256 of password, keyed by the
+// key in the password HMAC key Secret. The key is generated if the Secret
+// doesn't exist, so the HMACs in tenant status can't be brute-forced without
+// access to the system namespace.
+func (c *TenantController) passwordHMAC(password string) (string, error) {
+	c.passwordKeyLock.Lock()
+	defer c.passwordKeyLock.Unlock()
+	if c.passwordKey == nil {
+		key, err := c.readPasswordKey()
+		if err != nil {
+			return "", fmt.Errorf("failed to get password HMAC key: %v", err)
+		}
+		c.passwordKey = key
+	}
+
+	mac := hmac.New(sha256.New, c.passwordKey)
+	mac.Write([]byte(password))
+	return fmt.Sprintf("%x", mac.Sum(nil)), nil
+}
+
+// readPasswordKey reads the password HMAC key, and generates it if it's not
+// created yet.
+func (c *TenantController) readPasswordKey() ([]byte, error) {
+	secrets := c.k8sClient.CoreV1().Secrets(util.SystemTenant)
+	secret, err := secrets.Get(passwordKeySecretName, apismetav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		key := make([]byte, passwordKeyLength)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		secret, err = secrets.Create(&apiv1.Secret{
+			ObjectMeta: apismetav1.ObjectMeta{
+				Name:      passwordKeySecretName,
+				Namespace: util.SystemTenant,
+			},
+			Type: apiv1.SecretTypeOpaque,
+			Data: map[string][]byte{passwordKeySecretKey: key},
+		})
+		if apierrors.IsAlreadyExists(err) {
+			secret, err = secrets.Get(passwordKeySecretName, apismetav1.GetOptions{})
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := secret.Data[passwordKeySecretKey]
+	if len(key) == 0 {
+		return nil, fmt.Errorf("secret %s has no key %s", passwordKeySecretName, passwordKeySecretKey)
+	}
+	return key, nil
 }
 
 func (c *TenantController) createClusterRoles() error {
@@ -77,10 +599,13 @@ func (c *TenantController) createClusterRoles() error {
 	return nil
 }
 
+// createNamespace creates the namespace of the tenant with the same name,
+// marked as created for the tenant.
 func (c *TenantController) createNamespace(namespace string) error {
 	_, err := c.k8sClient.CoreV1().Namespaces().Create(&apiv1.Namespace{
 		ObjectMeta: apismetav1.ObjectMeta{
-			Name: namespace,
+			Name:        namespace,
+			Annotations: map[string]string{createdByAnnotation: namespace},
 		},
 	})
 	if err != nil && !apierrors.IsAlreadyExists(err) {
@@ -97,3 +622,44 @@ func (c *TenantController) deleteNamespace(namespace string) error {
 	}
 	return nil
 }
+
+// releaseNamespace deletes the namespace if it was created for tenant.
+// Otherwise the namespace is kept and only its tenant label and annotation
+// are removed. The namespace named after tenant is created for it if it
+// was created before the created-by annotation was recorded.
+func (c *TenantController) releaseNamespace(tenant *crv1.Tenant, name string) error {
+	namespaces := c.k8sClient.CoreV1().Namespaces()
+	namespace, err := namespaces.Get(name, apismetav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	createdBy, ok := namespace.Annotations[createdByAnnotation]
+	if !ok && name == tenant.Name {
+		createdBy = tenant.Name
+	}
+	if createdBy == tenant.Name {
+		err = c.deleteNamespace(name)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		glog.V(4).Infof("Deleted namespace %s", name)
+		return nil
+	}
+
+	_, hasLabel := namespace.Labels[util.TenantLabel]
+	_, hasAnnotation := namespace.Annotations[util.TenantLabel]
+	if !hasLabel && !hasAnnotation {
+		return nil
+	}
+	delete(namespace.Labels, util.TenantLabel)
+	delete(namespace.Annotations, util.TenantLabel)
+	if _, err := namespaces.Update(namespace); err != nil {
+		return err
+	}
+	glog.V(4).Infof("Released namespace %s of tenant %s", name, tenant.Name)
+	return nil
+}
@@ -17,17 +17,27 @@ limitations under the License.
 package tenant
 
 import (
+	"crypto/sha256"
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	crv1 "git.openstack.org/openstack/stackube/pkg/apis/v1"
 	"git.openstack.org/openstack/stackube/pkg/auth-controller/rbacmanager/rbac"
+	"git.openstack.org/openstack/stackube/pkg/events"
 	crdClient "git.openstack.org/openstack/stackube/pkg/kubecrd"
 	"git.openstack.org/openstack/stackube/pkg/openstack"
 	"git.openstack.org/openstack/stackube/pkg/util"
+	apiv1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	apismetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
 )
 
 const (
@@ -41,7 +51,6 @@ var systemTenant = &crv1.Tenant{
 	},
 	Spec: crv1.TenantSpec{
 		UserName: util.SystemTenant,
-		Password: util.SystemPassword,
 	},
 }
 
@@ -79,6 +88,10 @@ func newTenantController() (*TenantController, *crdClient.FakeCRDClient, *openst
 		kubeCRDClient:   kubeCRDClient,
 		k8sClient:       client,
 		openstackClient: osClient,
+		tenantStore:     cache.NewStore(cache.MetaNamespaceKeyFunc),
+		recorder:        events.NewFakeRecorder(),
+		queue: workqueue.NewRateLimitingQueue(
+			workqueue.NewItemExponentialFailureRateLimiter(time.Millisecond, 10*time.Millisecond)),
 	}
 
 	if err = c.createClusterRoles(); err != nil {
@@ -88,6 +101,17 @@ func newTenantController() (*TenantController, *crdClient.FakeCRDClient, *openst
 	return c, kubeCRDClient, osClient, client, nil
 }
 
+// storeAndSync puts tenant in the informer store of controller, as if it
+// was watched from kube-apiserver, and syncs it.
+func storeAndSync(controller *TenantController, tenant *crv1.Tenant) error {
+	controller.tenantStore.Update(tenant)
+	key, err := cache.MetaNamespaceKeyFunc(tenant)
+	if err != nil {
+		return err
+	}
+	return controller.syncTenant(key)
+}
+
 func TestOperateNamespace(t *testing.T) {
 	testNamespace := "foo"
 	// Created a new fake TenantController.
@@ -105,7 +129,7 @@ func TestOperateNamespace(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Get namespace %v error: %v", testNamespace, err)
 	}
-	if ns.Name != testNamespace {
+	if ns.Name != testNamespace || ns.Annotations[createdByAnnotation] != testNamespace {
 		t.Errorf("Created namespce has incorrect parameters: %v", ns)
 	}
 
@@ -165,7 +189,8 @@ func TestOnAdd(t *testing.T) {
 					t.Fatalf("Failed start a new fake TenantController")
 				}
 				// Add default tenant
-				controller.onAdd(systemTenant)
+				kubeCRDClient.SetTenants(systemTenant)
+				storeAndSync(controller, systemTenant)
 
 			},
 			expectedFn: func(tenantName string) error {
@@ -203,7 +228,8 @@ func TestOnAdd(t *testing.T) {
 			updateFn: func(tenantName string) {
 				// Add tenant
 				tenant := newTenant(tenantName, tenantName, password, "")
-				controller.onAdd(tenant)
+				kubeCRDClient.SetTenants(tenant)
+				storeAndSync(controller, tenant)
 
 			},
 			expectedFn: func(tenantName string) error {
@@ -244,7 +270,8 @@ func TestOnAdd(t *testing.T) {
 				// Injects fake tenant.
 				osClient.SetTenant(tenantName, tenantID)
 
-				controller.onAdd(tenant)
+				kubeCRDClient.SetTenants(tenant)
+				storeAndSync(controller, tenant)
 
 			},
 			expectedFn: func(tenantName string) error {
@@ -278,7 +305,8 @@ func TestOnAdd(t *testing.T) {
 				// Injects fake tenant.
 				osClient.SetTenant(tenantName, tenantID)
 
-				controller.onAdd(tenant)
+				kubeCRDClient.SetTenants(tenant)
+				storeAndSync(controller, tenant)
 
 			},
 			expectedFn: func(tenantName string) error {
@@ -313,7 +341,8 @@ func TestOnAdd(t *testing.T) {
 				// Injects error.
 				osClient.InjectError("CreateUser", fmt.Errorf("Failed create user"))
 
-				controller.onAdd(tenant)
+				kubeCRDClient.SetTenants(tenant)
+				storeAndSync(controller, tenant)
 
 			},
 			expectedFn: func(tenantName string) error {
@@ -342,6 +371,597 @@ func TestOnAdd(t *testing.T) {
 	}
 }
 
+func TestSyncTenantUpdate(t *testing.T) {
+	tenantName := "update"
+	adoptedID := "adopted-id"
+	controller, kubeCRDClient, osClient, _, err := newTenantController()
+	if err != nil {
+		t.Fatalf("Failed start a new fake TenantController")
+	}
+	osClient.SetTenant("adopted", adoptedID)
+
+	testCases := []struct {
+		testName      string
+		updateFn      func(tenant *crv1.Tenant)
+		injectErr     string
+		expectedState string
+		expectedCall  string
+		expectedEvent string
+	}{
+		{
+			testName:      "Create user fails",
+			updateFn:      func(tenant *crv1.Tenant) {},
+			injectErr:     "CreateUser",
+			expectedState: crv1.TenantFailed,
+			expectedEvent: "Warning TenantFailed",
+		},
+		{
+			testName:      "Create user",
+			updateFn:      func(tenant *crv1.Tenant) {},
+			expectedState: crv1.TenantActive,
+			expectedCall:  "CreateUser",
+			expectedEvent: "Normal TenantActive",
+		},
+		{
+			testName: "Rotate password",
+			updateFn: func(tenant *crv1.Tenant) {
+				tenant.Spec.Password = "rotated"
+			},
+			expectedState: crv1.TenantActive,
+			expectedCall:  "UpdateUser",
+		},
+		{
+			testName: "Rename user",
+			updateFn: func(tenant *crv1.Tenant) {
+				tenant.Spec.UserName = "renamed"
+			},
+			expectedState: crv1.TenantActive,
+			expectedCall:  "UpdateUser",
+		},
+		{
+			testName: "Adopt tenantID fails",
+			updateFn: func(tenant *crv1.Tenant) {
+				tenant.Spec.TenantID = adoptedID
+			},
+			injectErr:     "MoveUserToTenant",
+			expectedState: crv1.TenantFailed,
+			expectedEvent: "Warning TenantFailed",
+		},
+		{
+			testName:      "Adopt tenantID",
+			updateFn:      func(tenant *crv1.Tenant) {},
+			expectedState: crv1.TenantActive,
+			expectedCall:  "MoveUserToTenant",
+			expectedEvent: "Normal TenantActive",
+		},
+	}
+
+	kubeCRDClient.SetTenants(newTenant(tenantName, tenantName, password, ""))
+	for _, tc := range testCases {
+		tenant := kubeCRDClient.Tenants[tenantName].DeepCopy()
+		tc.updateFn(tenant)
+		kubeCRDClient.Tenants[tenantName].Spec = tenant.Spec
+		if tc.injectErr != "" {
+			osClient.InjectError(tc.injectErr, fmt.Errorf("keystone unavailable"))
+		}
+		called := len(osClient.GetCalledNames())
+
+		err := storeAndSync(controller, tenant)
+		if tc.injectErr != "" && err == nil {
+			t.Errorf("Case[%s]: expected error, got nil", tc.testName)
+		}
+		if tc.injectErr == "" && err != nil {
+			t.Errorf("Case[%s]: unexpected error: %v", tc.testName, err)
+		}
+
+		status := kubeCRDClient.Tenants[tenantName].Status
+		if status.State != tc.expectedState {
+			t.Errorf("Case[%s]: expected state %s, got %s", tc.testName, tc.expectedState, status.State)
+		}
+		if (status.State == crv1.TenantFailed) != (status.Message != "") {
+			t.Errorf("Case[%s]: unexpected message %q in state %s", tc.testName, status.Message, status.State)
+		}
+		recorded := controller.recorder.(*events.FakeRecorder).GetEvents()
+		if tc.expectedEvent == "" && len(recorded) != 0 ||
+			tc.expectedEvent != "" && (len(recorded) != 1 || !strings.HasPrefix(recorded[0], tc.expectedEvent+" ")) {
+			t.Errorf("Case[%s]: expected event %q, got %v", tc.testName, tc.expectedEvent, recorded)
+		}
+		if tc.expectedCall != "" {
+			names := osClient.GetCalledNames()[called:]
+			if !reflect.DeepEqual(names[len(names)-1:], []string{tc.expectedCall}) {
+				t.Errorf("Case[%s]: expected %s called, got %v", tc.testName, tc.expectedCall, names)
+			}
+		}
+		if tc.expectedState != crv1.TenantActive {
+			continue
+		}
+
+		spec := kubeCRDClient.Tenants[tenantName].Spec
+		expectedTenantID := spec.TenantID
+		if expectedTenantID == "" {
+			expectedTenantID = osClient.Tenants[tenantName].ID
+		}
+		user, ok := osClient.Users[expectedTenantID]
+		if !ok || user.ID != status.UserID || user.Name != spec.UserName {
+			t.Errorf("Case[%s]: expected user %s %s in tenant %s, got %v", tc.testName, status.UserID, spec.UserName, expectedTenantID, user)
+		}
+		if osClient.Passwords[status.UserID] != spec.Password {
+			t.Errorf("Case[%s]: expected password %s, got %s", tc.testName, spec.Password, osClient.Passwords[status.UserID])
+		}
+		if status.TenantID != expectedTenantID || status.UserName != spec.UserName || status.PasswordHMAC != passwordHMAC(t, controller, spec.Password) {
+			t.Errorf("Case[%s]: unexpected status %v", tc.testName, status)
+		}
+	}
+
+	// Tenants which are synced are not updated again.
+	called := len(osClient.GetCalledNames())
+	if err := storeAndSync(controller, kubeCRDClient.Tenants[tenantName]); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	for _, name := range osClient.GetCalledNames()[called:] {
+		if name == "CreateUser" || name == "UpdateUser" || name == "MoveUserToTenant" {
+			t.Errorf("Unexpected call %s for synced tenant", name)
+		}
+	}
+}
+
+// passwordHMAC returns the HMAC of password by the key of controller.
+func passwordHMAC(t *testing.T, controller *TenantController, password string) string {
+	hash, err := controller.passwordHMAC(password)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return hash
+}
+
+func TestPasswordHMAC(t *testing.T) {
+	controller, _, _, client, err := newTenantController()
+	if err != nil {
+		t.Fatalf("Failed start a new fake TenantController")
+	}
+
+	hash := passwordHMAC(t, controller, "secret")
+	if hash == fmt.Sprintf("%x", sha256.Sum256([]byte("secret"))) {
+		t.Errorf("Expected password HMAC not to be the plain SHA-256 of the password")
+	}
+	if hash == passwordHMAC(t, controller, "rotated") {
+		t.Errorf("Expected different HMACs of different passwords")
+	}
+	secret, err := client.CoreV1().Secrets(util.SystemTenant).Get(passwordKeySecretName, apismetav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Expected password HMAC key secret created: %v", err)
+	}
+	if len(secret.Data[passwordKeySecretKey]) != passwordKeyLength {
+		t.Errorf("Expected %d bytes password HMAC key, got %d", passwordKeyLength, len(secret.Data[passwordKeySecretKey]))
+	}
+
+	// The key is kept across restarts of the controller.
+	restarted := &TenantController{k8sClient: client}
+	if passwordHMAC(t, restarted, "secret") != hash {
+		t.Errorf("Expected the same password HMAC after restart")
+	}
+}
+
+func TestTenantPassword(t *testing.T) {
+	controller, kubeCRDClient, osClient, client, err := newTenantController()
+	if err != nil {
+		t.Fatalf("Failed start a new fake TenantController")
+	}
+	secrets := client.CoreV1().Secrets(util.SystemTenant)
+	_, err = secrets.Create(&apiv1.Secret{
+		ObjectMeta: apismetav1.ObjectMeta{Name: "foo-secret"},
+		Data:       map[string][]byte{"pw": []byte("secret")},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Password from a Secret.
+	tenant := newTenant("foo", "foo", "", "")
+	tenant.Spec.PasswordSecretRef = &apiv1.SecretKeySelector{
+		LocalObjectReference: apiv1.LocalObjectReference{Name: "foo-secret"},
+		Key:                  "pw",
+	}
+	kubeCRDClient.SetTenants(tenant)
+	if err := storeAndSync(controller, tenant); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	userID := kubeCRDClient.Tenants["foo"].Status.UserID
+	if osClient.Passwords[userID] != "secret" {
+		t.Errorf("Expected password from secret, got %q", osClient.Passwords[userID])
+	}
+
+	// Password rotated in the Secret.
+	_, err = secrets.Update(&apiv1.Secret{
+		ObjectMeta: apismetav1.ObjectMeta{Name: "foo-secret"},
+		Data:       map[string][]byte{"pw": []byte("rotated")},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := storeAndSync(controller, kubeCRDClient.Tenants["foo"]); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if osClient.Passwords[userID] != "rotated" {
+		t.Errorf("Expected password rotated, got %q", osClient.Passwords[userID])
+	}
+
+	// Password key missing in the Secret.
+	tenant = kubeCRDClient.Tenants["foo"].DeepCopy()
+	tenant.Spec.PasswordSecretRef.Key = "missing"
+	kubeCRDClient.SetTenants(tenant)
+	if err := storeAndSync(controller, tenant); err == nil {
+		t.Errorf("Expected error for missing password key")
+	}
+	if state := kubeCRDClient.Tenants["foo"].Status.State; state != crv1.TenantFailed {
+		t.Errorf("Expected tenant Failed, got %s", state)
+	}
+
+	// Password generated into a Secret.
+	tenant = newTenant("bar", "bar", "", "")
+	tenant.UID = "bar-uid"
+	kubeCRDClient.SetTenants(tenant)
+	if err := storeAndSync(controller, tenant); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	tenant = kubeCRDClient.Tenants["bar"]
+	ref := tenant.Spec.PasswordSecretRef
+	if ref == nil {
+		t.Fatalf("Expected password secret referred by tenant bar")
+	}
+	secret, err := secrets.Get(ref.Name, apismetav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Expected password secret %s created: %v", ref.Name, err)
+	}
+	if len(secret.OwnerReferences) != 1 || secret.OwnerReferences[0].UID != "bar-uid" {
+		t.Errorf("Expected password secret owned by tenant bar, got %v", secret.OwnerReferences)
+	}
+	password := string(secret.Data[ref.Key])
+	if len(password) < generatedPasswordLength || osClient.Passwords[tenant.Status.UserID] != password {
+		t.Errorf("Expected generated password %q, got %q", password, osClient.Passwords[tenant.Status.UserID])
+	}
+}
+
+func TestSyncTenantUsers(t *testing.T) {
+	tenantName := "team"
+	controller, kubeCRDClient, osClient, client, err := newTenantController()
+	if err != nil {
+		t.Fatalf("Failed start a new fake TenantController")
+	}
+	secrets := client.CoreV1().Secrets(util.SystemTenant)
+
+	testCases := []struct {
+		testName      string
+		users         []crv1.TenantUser
+		injectErr     string
+		expectedState string
+		expectedRoles map[string]crv1.TenantRole
+	}{
+		{
+			testName: "Add users",
+			users: []crv1.TenantUser{
+				{Name: "alice"},
+				{Name: "bob", Role: crv1.TenantRoleReader},
+			},
+			expectedState: crv1.TenantActive,
+			expectedRoles: map[string]crv1.TenantRole{"alice": crv1.TenantRoleMember, "bob": crv1.TenantRoleReader},
+		},
+		{
+			testName: "Change role",
+			users: []crv1.TenantUser{
+				{Name: "alice"},
+				{Name: "bob", Role: crv1.TenantRoleAdmin},
+			},
+			expectedState: crv1.TenantActive,
+			expectedRoles: map[string]crv1.TenantRole{"alice": crv1.TenantRoleMember, "bob": crv1.TenantRoleAdmin},
+		},
+		{
+			testName: "Duplicate user",
+			users: []crv1.TenantUser{
+				{Name: "alice"},
+				{Name: "alice", Role: crv1.TenantRoleAdmin},
+			},
+			expectedState: crv1.TenantFailed,
+			expectedRoles: map[string]crv1.TenantRole{"alice": crv1.TenantRoleMember, "bob": crv1.TenantRoleAdmin},
+		},
+		{
+			testName: "Invalid role",
+			users: []crv1.TenantUser{
+				{Name: "alice", Role: "owner"},
+			},
+			expectedState: crv1.TenantFailed,
+			expectedRoles: map[string]crv1.TenantRole{"alice": crv1.TenantRoleMember, "bob": crv1.TenantRoleAdmin},
+		},
+		{
+			testName: "Remove user fails",
+			users: []crv1.TenantUser{
+				{Name: "alice"},
+			},
+			injectErr:     "DeleteUser",
+			expectedState: crv1.TenantFailed,
+			expectedRoles: map[string]crv1.TenantRole{"alice": crv1.TenantRoleMember, "bob": crv1.TenantRoleAdmin},
+		},
+		{
+			testName: "Remove user",
+			users: []crv1.TenantUser{
+				{Name: "alice"},
+			},
+			expectedState: crv1.TenantActive,
+			expectedRoles: map[string]crv1.TenantRole{"alice": crv1.TenantRoleMember},
+		},
+	}
+
+	kubeCRDClient.SetTenants(newTenant(tenantName, tenantName, password, ""))
+	for _, tc := range testCases {
+		tenant := kubeCRDClient.Tenants[tenantName].DeepCopy()
+		// Keep the generated password secrets of the users.
+		refs := make(map[string]*apiv1.SecretKeySelector)
+		for _, user := range tenant.Spec.Users {
+			refs[user.Name] = user.PasswordSecretRef
+		}
+		tenant.Spec.Users = nil
+		for _, user := range tc.users {
+			user.PasswordSecretRef = refs[user.Name]
+			tenant.Spec.Users = append(tenant.Spec.Users, user)
+		}
+		kubeCRDClient.Tenants[tenantName].Spec = tenant.Spec
+		if tc.injectErr != "" {
+			osClient.InjectError(tc.injectErr, fmt.Errorf("keystone unavailable"))
+		}
+
+		err := storeAndSync(controller, tenant)
+		if (tc.expectedState == crv1.TenantFailed) != (err != nil) {
+			t.Errorf("Case[%s]: unexpected error: %v", tc.testName, err)
+		}
+
+		tenant = kubeCRDClient.Tenants[tenantName]
+		if tenant.Status.State != tc.expectedState {
+			t.Errorf("Case[%s]: expected state %s, got %s", tc.testName, tc.expectedState, tenant.Status.State)
+		}
+		roles := make(map[string]crv1.TenantRole)
+		for _, status := range tenant.Status.Users {
+			roles[status.Name] = status.Role
+			if got := osClient.UserRoles[tenant.Status.TenantID+"/"+status.UserID]; !reflect.DeepEqual(got, []string{string(status.Role)}) {
+				t.Errorf("Case[%s]: expected user %s with role %s, got %v", tc.testName, status.Name, status.Role, got)
+			}
+		}
+		if !reflect.DeepEqual(roles, tc.expectedRoles) {
+			t.Errorf("Case[%s]: expected users %v, got %v", tc.testName, tc.expectedRoles, roles)
+		}
+		if len(osClient.RoleUsers) != len(tc.expectedRoles) {
+			t.Errorf("Case[%s]: expected %d keystone users, got %v", tc.testName, len(tc.expectedRoles), osClient.RoleUsers)
+		}
+		for name := range tc.expectedRoles {
+			secret, err := secrets.Get(userSecretName(tenant, name), apismetav1.GetOptions{})
+			if err != nil {
+				t.Errorf("Case[%s]: expected password secret of user %s: %v", tc.testName, name, err)
+				continue
+			}
+			for _, status := range tenant.Status.Users {
+				if status.Name == name && status.PasswordHMAC != passwordHMAC(t, controller, string(secret.Data[passwordSecretKey])) {
+					t.Errorf("Case[%s]: expected password of user %s from its secret", tc.testName, name)
+				}
+			}
+		}
+	}
+
+	if _, err := secrets.Get(userSecretName(kubeCRDClient.Tenants[tenantName], "bob"), apismetav1.GetOptions{}); err == nil {
+		t.Errorf("Expected password secret of removed user bob to be deleted")
+	}
+}
+
+func TestAdoptedUsers(t *testing.T) {
+	tenantName := "team"
+	controller, kubeCRDClient, osClient, _, err := newTenantController()
+	if err != nil {
+		t.Fatalf("Failed start a new fake TenantController")
+	}
+
+	// Injects keystone users existing before the tenant.
+	ownerID, _, err := osClient.CreateUser("dave", "dave-password", "other", "")
+	if err != nil {
+		t.Fatalf("Failed create keystone user dave: %v", err)
+	}
+	userID, _, err := osClient.CreateUser("carol", "carol-password", "other", crv1.TenantRoleReader)
+	if err != nil {
+		t.Fatalf("Failed create keystone user carol: %v", err)
+	}
+
+	tenant := newTenant(tenantName, "dave", password, "")
+	tenant.Spec.Users = []crv1.TenantUser{{Name: "carol"}}
+	kubeCRDClient.SetTenants(tenant)
+	if err := storeAndSync(controller, tenant); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Sync again to make sure the passwords are still not rotated.
+	if err := storeAndSync(controller, kubeCRDClient.Tenants[tenantName]); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	status := kubeCRDClient.Tenants[tenantName].Status
+	if status.UserID != ownerID || !status.UserAdopted || status.PasswordHMAC != "" {
+		t.Errorf("Expected user dave %s adopted, got %+v", ownerID, status)
+	}
+	if len(status.Users) != 1 || status.Users[0].UserID != userID || !status.Users[0].Adopted || status.Users[0].PasswordHMAC != "" {
+		t.Errorf("Expected user carol %s adopted, got %+v", userID, status.Users)
+	}
+	if osClient.Passwords[ownerID] != "dave-password" || osClient.Passwords[userID] != "carol-password" {
+		t.Errorf("Expected passwords of adopted users not rotated, got %v", osClient.Passwords)
+	}
+	if _, ok := osClient.UserRoles[status.TenantID+"/"+userID]; !ok {
+		t.Errorf("Expected user carol granted a role in tenant %s", status.TenantID)
+	}
+
+	// Removing an adopted user only revokes its roles.
+	tenant = kubeCRDClient.Tenants[tenantName].DeepCopy()
+	tenant.Spec.Users = nil
+	kubeCRDClient.Tenants[tenantName].Spec = tenant.Spec
+	if err := storeAndSync(controller, tenant); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, ok := osClient.RoleUsers[userID]; !ok {
+		t.Errorf("Expected adopted user carol not deleted")
+	}
+	if _, ok := osClient.UserRoles[status.TenantID+"/"+userID]; ok {
+		t.Errorf("Expected roles of user carol in tenant %s revoked", status.TenantID)
+	}
+
+	// Renaming an adopted user creates the user of the new name.
+	tenant = kubeCRDClient.Tenants[tenantName].DeepCopy()
+	tenant.Spec.UserName = "erin"
+	kubeCRDClient.Tenants[tenantName].Spec = tenant.Spec
+	if err := storeAndSync(controller, tenant); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	status = kubeCRDClient.Tenants[tenantName].Status
+	if status.UserID == ownerID || status.UserAdopted || status.UserName != "erin" {
+		t.Errorf("Expected user erin created, got %+v", status)
+	}
+	if user := osClient.Users["other"]; user == nil || user.Name != "dave" {
+		t.Errorf("Expected adopted user dave not renamed, got %v", user)
+	}
+	if _, ok := osClient.UserRoles[status.TenantID+"/"+ownerID]; ok {
+		t.Errorf("Expected roles of user dave in tenant %s revoked", status.TenantID)
+	}
+}
+
+func TestSyncTenantQuota(t *testing.T) {
+	tenantName := "quota"
+	controller, kubeCRDClient, osClient, client, err := newTenantController()
+	if err != nil {
+		t.Fatalf("Failed start a new fake TenantController")
+	}
+	int64Ptr := func(i int64) *int64 { return &i }
+	cpu := resource.MustParse("2")
+	memory := resource.MustParse("4Gi")
+
+	tenant := newTenant(tenantName, tenantName, password, "")
+	tenant.Spec.Quota = &crv1.TenantQuota{
+		Pods:          int64Ptr(10),
+		CPU:           &cpu,
+		Memory:        &memory,
+		Services:      int64Ptr(5),
+		LoadBalancers: int64Ptr(2),
+		FloatingIPs:   int64Ptr(3),
+		Ports:         int64Ptr(20),
+	}
+	kubeCRDClient.SetTenants(tenant)
+	if err := storeAndSync(controller, tenant); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	resourceQuotas := client.CoreV1().ResourceQuotas(tenantName)
+	resourceQuota, err := resourceQuotas.Get(quotaName, apismetav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Expected ResourceQuota created: %v", err)
+	}
+	expectedHard := apiv1.ResourceList{
+		apiv1.ResourcePods:                  resource.MustParse("10"),
+		apiv1.ResourceRequestsCPU:           cpu,
+		apiv1.ResourceRequestsMemory:        memory,
+		apiv1.ResourceServices:              resource.MustParse("5"),
+		apiv1.ResourceServicesLoadBalancers: resource.MustParse("2"),
+	}
+	if !apiequality.Semantic.DeepEqual(resourceQuota.Spec.Hard, expectedHard) {
+		t.Errorf("Expected hard limits %v, got %v", expectedHard, resourceQuota.Spec.Hard)
+	}
+	tenantID := osClient.Tenants[tenantName].ID
+	expectedLimits := &crv1.TenantQuota{
+		LoadBalancers: int64Ptr(2),
+		FloatingIPs:   int64Ptr(3),
+		Ports:         int64Ptr(20),
+	}
+	if !reflect.DeepEqual(osClient.Quotas[tenantID], expectedLimits) {
+		t.Errorf("Expected neutron quota %v, got %v", expectedLimits, osClient.Quotas[tenantID])
+	}
+
+	// Usage is reported by both sides.
+	usedCPU := resource.MustParse("500m")
+	resourceQuota.Status.Used = apiv1.ResourceList{
+		apiv1.ResourcePods:        resource.MustParse("3"),
+		apiv1.ResourceRequestsCPU: usedCPU,
+	}
+	if _, err := resourceQuotas.Update(resourceQuota); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	osClient.QuotaUsed[tenantID] = &crv1.TenantQuota{
+		LoadBalancers: int64Ptr(1),
+		Ports:         int64Ptr(4),
+	}
+	if err := storeAndSync(controller, kubeCRDClient.Tenants[tenantName]); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectedUsed := &crv1.TenantQuota{
+		Pods:          int64Ptr(3),
+		CPU:           &usedCPU,
+		LoadBalancers: int64Ptr(1),
+		Ports:         int64Ptr(4),
+	}
+	if used := kubeCRDClient.Tenants[tenantName].Status.QuotaUsed; !apiequality.Semantic.DeepEqual(used, expectedUsed) {
+		t.Errorf("Expected quota usage %v, got %v", expectedUsed, used)
+	}
+
+	// The quota is shared by all namespaces of the tenant.
+	_, err = client.CoreV1().Namespaces().Create(&apiv1.Namespace{ObjectMeta: apismetav1.ObjectMeta{
+		Name:        "quota-dev",
+		Annotations: map[string]string{util.TenantLabel: tenantName},
+	}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := storeAndSync(controller, kubeCRDClient.Tenants[tenantName]); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	devQuotas := client.CoreV1().ResourceQuotas("quota-dev")
+	devQuota, err := devQuotas.Get(quotaName, apismetav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Expected ResourceQuota created in namespace quota-dev: %v", err)
+	}
+	devQuota.Status.Used = apiv1.ResourceList{apiv1.ResourcePods: resource.MustParse("4")}
+	if _, err := devQuotas.Update(devQuota); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := storeAndSync(controller, kubeCRDClient.Tenants[tenantName]); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// 3 pods in namespace quota and 4 in quota-dev leave 3 of 10.
+	for namespace, pods := range map[string]string{tenantName: "6", "quota-dev": "7"} {
+		resourceQuota, err := client.CoreV1().ResourceQuotas(namespace).Get(quotaName, apismetav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if hard := resourceQuota.Spec.Hard[apiv1.ResourcePods]; hard.Cmp(resource.MustParse(pods)) != 0 {
+			t.Errorf("Expected %s pods in namespace %s, got %v", pods, namespace, hard.String())
+		}
+	}
+	if used := kubeCRDClient.Tenants[tenantName].Status.QuotaUsed; used == nil || used.Pods == nil || *used.Pods != 7 {
+		t.Errorf("Expected 7 pods used, got %v", used)
+	}
+
+	// Neutron quota can't be updated.
+	osClient.InjectError("UpdateQuota", fmt.Errorf("neutron unavailable"))
+	if err := storeAndSync(controller, kubeCRDClient.Tenants[tenantName]); err == nil {
+		t.Errorf("Expected error when neutron is unavailable")
+	}
+	if state := kubeCRDClient.Tenants[tenantName].Status.State; state != crv1.TenantFailed {
+		t.Errorf("Expected tenant Failed, got %s", state)
+	}
+
+	// Quota is removed.
+	tenant = kubeCRDClient.Tenants[tenantName].DeepCopy()
+	tenant.Spec.Quota = nil
+	kubeCRDClient.SetTenants(tenant)
+	if err := storeAndSync(controller, tenant); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := resourceQuotas.Get(quotaName, apismetav1.GetOptions{}); err == nil {
+		t.Errorf("Expected ResourceQuota deleted")
+	}
+	if used := kubeCRDClient.Tenants[tenantName].Status.QuotaUsed; used != nil {
+		t.Errorf("Expected no quota usage, got %v", used)
+	}
+}
+
 func TestOnDelete(t *testing.T) {
 	var controller *TenantController
 	var kubeCRDClient *crdClient.FakeCRDClient
@@ -349,6 +969,7 @@ func TestOnDelete(t *testing.T) {
 	var client *fake.Clientset
 	var err error
 	var tenantID string
+	var projectUserID string
 
 	testCases := []struct {
 		testName   string
@@ -371,10 +992,11 @@ func TestOnDelete(t *testing.T) {
 				kubeCRDClient.SetNetworks(network)
 				// Add tenant
 				ns := newTenant(tenantName, tenantName, password, "")
-				controller.onAdd(ns)
+				kubeCRDClient.SetTenants(ns)
+				storeAndSync(controller, ns)
 				tenantID = osClient.Tenants[tenantName].ID
-				// Delete tenant
-				controller.onDelete(ns)
+				// Delete the synced tenant
+				controller.onDelete(kubeCRDClient.Tenants[tenantName])
 
 			},
 			expectedFn: func(tenantName string) error {
@@ -422,13 +1044,18 @@ func TestOnDelete(t *testing.T) {
 
 				tenantID = "123"
 				ns := newTenant(tenantName, tenantName, password, tenantID)
-				// Injects fake tenant
+				// Injects fake tenant with an existing user
 				osClient.SetTenant(tenantName, tenantID)
+				projectUserID, _, err = osClient.CreateUser("alice", password, tenantID, crv1.TenantRoleMember)
+				if err != nil {
+					t.Fatalf("Failed create project user: %v", err)
+				}
 				// Add tenant
-				controller.onAdd(ns)
+				kubeCRDClient.SetTenants(ns)
+				storeAndSync(controller, ns)
 				tenantID = osClient.Tenants[tenantName].ID
-				// Delete tenant
-				controller.onDelete(ns)
+				// Delete the synced tenant
+				controller.onDelete(kubeCRDClient.Tenants[tenantName])
 
 			},
 			expectedFn: func(tenantName string) error {
@@ -452,6 +1079,10 @@ func TestOnDelete(t *testing.T) {
 				if ok {
 					return fmt.Errorf("expected %s user to be deleted, got %v", tenantName, user)
 				}
+				// test existing project user remain existed
+				if _, ok := osClient.RoleUsers[projectUserID]; !ok {
+					return fmt.Errorf("expected project user alice remain existed, got none")
+				}
 				// test namespace deleted
 				err = testNamespaceDeleted(t, client, tenantName)
 				if err != nil {
@@ -460,6 +1091,57 @@ func TestOnDelete(t *testing.T) {
 				return nil
 			},
 		},
+		{
+			testName:   "foo3 Tenant with users existing before it",
+			tenantName: "foo3",
+			updateFn: func(tenantName string) {
+				// Created a new fake TenantController.
+				controller, kubeCRDClient, osClient, client, err = newTenantController()
+				if err != nil {
+					t.Fatalf("Failed start a new fake TenantController")
+				}
+
+				// Injects fake network
+				network := newNetwork(tenantName)
+				kubeCRDClient.SetNetworks(network)
+
+				tenantID = "456"
+				ns := newTenant(tenantName, tenantName, password, tenantID)
+				ns.Spec.Users = []crv1.TenantUser{{Name: "alice"}}
+				// Injects fake tenant whose users exist before the tenant syncs
+				osClient.SetTenant(tenantName, tenantID)
+				if _, _, err := osClient.CreateUser(tenantName, password, tenantID, ""); err != nil {
+					t.Fatalf("Failed create tenant user: %v", err)
+				}
+				projectUserID, _, err = osClient.CreateUser("alice", password, tenantID, crv1.TenantRoleMember)
+				if err != nil {
+					t.Fatalf("Failed create project user: %v", err)
+				}
+				// Add tenant
+				kubeCRDClient.SetTenants(ns)
+				storeAndSync(controller, ns)
+				// Delete the synced tenant
+				controller.onDelete(kubeCRDClient.Tenants[tenantName])
+
+			},
+			expectedFn: func(tenantName string) error {
+				// test adopted users remain existed
+				user, ok := osClient.Users[tenantID]
+				if !ok {
+					return fmt.Errorf("expected %s user remain existed, got none", tenantName)
+				}
+				if _, ok := osClient.RoleUsers[projectUserID]; !ok {
+					return fmt.Errorf("expected project user alice remain existed, got none")
+				}
+				// test roles of adopted users revoked
+				for _, userID := range []string{user.ID, projectUserID} {
+					if roles, ok := osClient.UserRoles[tenantID+"/"+userID]; ok {
+						return fmt.Errorf("expected roles of user %s revoked, got %v", userID, roles)
+					}
+				}
+				return nil
+			},
+		},
 	}
 
 	for tci, tc := range testCases {
@@ -471,6 +1153,139 @@ func TestOnDelete(t *testing.T) {
 	}
 }
 
+func TestReleaseNamespace(t *testing.T) {
+	tenantName := "legacy"
+	controller, _, _, client, err := newTenantController()
+	if err != nil {
+		t.Fatalf("Failed start a new fake TenantController")
+	}
+	// Namespace legacy was created for the tenant before the created-by
+	// annotation was recorded, namespace dev is created by the team.
+	for _, namespace := range []*apiv1.Namespace{
+		{ObjectMeta: apismetav1.ObjectMeta{Name: tenantName}},
+		{ObjectMeta: apismetav1.ObjectMeta{
+			Name:        "dev",
+			Annotations: map[string]string{util.TenantLabel: tenantName},
+		}},
+	} {
+		if _, err := client.CoreV1().Namespaces().Create(namespace); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	tenant := newTenant(tenantName, tenantName, password, "")
+	for _, namespace := range []string{tenantName, "dev"} {
+		if err := controller.releaseNamespace(tenant, namespace); err != nil {
+			t.Fatalf("Unexpected error releasing namespace %s: %v", namespace, err)
+		}
+	}
+	if _, err := client.CoreV1().Namespaces().Get(tenantName, apismetav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("Expected legacy namespace %s deleted, got %v", tenantName, err)
+	}
+	dev, err := client.CoreV1().Namespaces().Get("dev", apismetav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Expected namespace dev kept: %v", err)
+	}
+	if _, ok := dev.Annotations[util.TenantLabel]; ok {
+		t.Errorf("Expected tenant annotation removed from namespace dev")
+	}
+}
+
+func TestFinalizeTenant(t *testing.T) {
+	tenantName := "final"
+	controller, kubeCRDClient, osClient, client, err := newTenantController()
+	if err != nil {
+		t.Fatalf("Failed start a new fake TenantController")
+	}
+	kubeCRDClient.SetNetworks(newNetwork(tenantName), newNetwork("staging"))
+	// Namespace staging is owned by the tenant but not created for it,
+	// namespace other is not owned by the tenant.
+	for _, namespace := range []*apiv1.Namespace{
+		{ObjectMeta: apismetav1.ObjectMeta{
+			Name:        "staging",
+			Labels:      map[string]string{"team": "qa"},
+			Annotations: map[string]string{util.TenantLabel: tenantName},
+		}},
+		{ObjectMeta: apismetav1.ObjectMeta{Name: "other"}},
+	} {
+		if _, err := client.CoreV1().Namespaces().Create(namespace); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	tenant := newTenant(tenantName, tenantName, password, "")
+	kubeCRDClient.SetTenants(tenant)
+	if err := storeAndSync(controller, tenant); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !util.HasFinalizer(kubeCRDClient.Tenants[tenantName], crv1.Finalizer) {
+		t.Fatalf("Expected finalizer added to tenant")
+	}
+	tenantID := osClient.Tenants[tenantName].ID
+
+	// Delete the tenant while keystone is unavailable.
+	tenant = kubeCRDClient.Tenants[tenantName].DeepCopy()
+	now := apismetav1.Now()
+	tenant.DeletionTimestamp = &now
+	osClient.InjectError("DeleteTenant", fmt.Errorf("keystone unavailable"))
+	if err := storeAndSync(controller, tenant); err == nil {
+		t.Errorf("Expected error when keystone is unavailable")
+	}
+	tenant = kubeCRDClient.Tenants[tenantName]
+	if tenant.Status.State != crv1.TenantTerminating || tenant.Status.Message == "" {
+		t.Errorf("Expected tenant Terminating with message, got %v", tenant.Status)
+	}
+	if !util.HasFinalizer(tenant, crv1.Finalizer) {
+		t.Errorf("Expected finalizer kept until tenant is cleaned up")
+	}
+	if _, ok := osClient.Tenants[tenantName]; !ok {
+		t.Errorf("Expected keystone tenant %s kept", tenantName)
+	}
+
+	// The retry cleans up the tenant.
+	if err := storeAndSync(controller, tenant); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if util.HasFinalizer(kubeCRDClient.Tenants[tenantName], crv1.Finalizer) {
+		t.Errorf("Expected finalizer removed")
+	}
+	if _, ok := osClient.Tenants[tenantName]; ok {
+		t.Errorf("Expected keystone tenant %s deleted", tenantName)
+	}
+	if _, ok := osClient.Users[tenantID]; ok {
+		t.Errorf("Expected users of tenant %s deleted", tenantName)
+	}
+	if _, ok := kubeCRDClient.Networks[tenantName]; ok {
+		t.Errorf("Expected network %s deleted", tenantName)
+	}
+	if err := testNamespaceDeleted(t, client, tenantName); err != nil {
+		t.Error(err)
+	}
+	if _, ok := kubeCRDClient.Networks["staging"]; ok {
+		t.Errorf("Expected network staging deleted")
+	}
+	staging, err := client.CoreV1().Namespaces().Get("staging", apismetav1.GetOptions{})
+	if err != nil {
+		t.Errorf("Expected namespace staging kept: %v", err)
+	} else {
+		if _, ok := staging.Annotations[util.TenantLabel]; ok {
+			t.Errorf("Expected tenant annotation removed from namespace staging, got %v", staging.Annotations)
+		}
+		if staging.Labels["team"] != "qa" {
+			t.Errorf("Expected other labels of namespace staging kept, got %v", staging.Labels)
+		}
+	}
+	if err := testNamespaceCreated(t, client, "other"); err != nil {
+		t.Errorf("Expected namespace other kept: %v", err)
+	}
+
+	// Tenants which are finalized are not cleaned up again when removed.
+	called := len(osClient.GetCalledNames())
+	controller.onDelete(tenant)
+	if names := osClient.GetCalledNames(); len(names) != called {
+		t.Errorf("Unexpected calls after finalization: %v", names[called:])
+	}
+}
+
 func testClusterRoleBindingCreated(t *testing.T, client *fake.Clientset, tenantName string) error {
 	clusterRoleBinding, err := client.Rbac().ClusterRoleBindings().Get(tenantName+"-namespace-creater", apismetav1.GetOptions{})
 	if err != nil {
@@ -0,0 +1,203 @@
+/*
+Copyright (c) 2017 OpenStack Foundation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tenant
+
+import (
+	"fmt"
+	"time"
+
+	crv1 "git.openstack.org/openstack/stackube/pkg/apis/v1"
+	crdClient "git.openstack.org/openstack/stackube/pkg/kubecrd"
+	"git.openstack.org/openstack/stackube/pkg/openstack"
+	"git.openstack.org/openstack/stackube/pkg/util"
+
+	"github.com/golang/glog"
+	apismetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// ImportedLabel is set on the tenants created from keystone projects by
+	// the TenantImporter.
+	ImportedLabel = "stackube.kubernetes.io/imported"
+
+	// RemovalPolicyFail marks the imported tenants of removed projects as
+	// Failed.
+	RemovalPolicyFail = "fail"
+	// RemovalPolicyDelete deletes the imported tenants of removed projects.
+	RemovalPolicyDelete = "delete"
+)
+
+// TenantImporter periodically imports the keystone projects matching a
+// domain and a tag as tenants.
+type TenantImporter struct {
+	kubeCRDClient   crdClient.Interface
+	openstackClient openstack.Interface
+
+	// domainID and tag select the keystone projects to import.
+	domainID string
+	tag      string
+	// removalPolicy decides what happens to the imported tenants whose
+	// project has been removed.
+	removalPolicy string
+	// interval of importing the projects.
+	interval time.Duration
+}
+
+// NewTenantImporter creates a new tenant importer.
+func NewTenantImporter(osClient openstack.Interface, domainID, tag, removalPolicy string,
+	interval time.Duration) (*TenantImporter, error) {
+	if removalPolicy != RemovalPolicyFail && removalPolicy != RemovalPolicyDelete {
+		return nil, fmt.Errorf("invalid removal policy %q, must be %q or %q",
+			removalPolicy, RemovalPolicyFail, RemovalPolicyDelete)
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("invalid import interval %v", interval)
+	}
+
+	return &TenantImporter{
+		kubeCRDClient:   osClient.GetCRDClient(),
+		openstackClient: osClient,
+		domainID:        domainID,
+		tag:             tag,
+		removalPolicy:   removalPolicy,
+		interval:        interval,
+	}, nil
+}
+
+// Run the importer.
+func (i *TenantImporter) Run(stopCh <-chan struct{}) error {
+	defer utilruntime.HandleCrash()
+
+	wait.Until(func() {
+		if err := i.importTenants(); err != nil {
+			glog.Errorf("Import tenants from keystone failed: %v", err)
+		}
+	}, i.interval, stopCh)
+
+	return nil
+}
+
+// importTenants creates or updates the tenants of the matching keystone
+// projects, and handles the imported tenants whose project is gone.
+func (i *TenantImporter) importTenants() error {
+	projects, err := i.openstackClient.ListTenants(i.domainID, i.tag)
+	if err != nil {
+		return fmt.Errorf("failed to list keystone tenants: %v", err)
+	}
+	tenantList, err := i.kubeCRDClient.ListTenants()
+	if err != nil {
+		return fmt.Errorf("failed to list tenants: %v", err)
+	}
+	tenants := make(map[string]*crv1.Tenant, len(tenantList.Items))
+	for idx := range tenantList.Items {
+		tenants[tenantList.Items[idx].Name] = &tenantList.Items[idx]
+	}
+
+	var errs []error
+	imported := make(map[string]bool, len(projects))
+	for _, project := range projects {
+		if errors := validation.IsDNS1123Label(project.Name); len(errors) > 0 {
+			glog.V(4).Infof("Skip importing keystone tenant %s: %v", project.Name, errors)
+			continue
+		}
+		if project.Name == util.SystemTenant || util.IsSystemNamespace(project.Name) {
+			glog.V(4).Infof("Skip importing system keystone tenant %s", project.Name)
+			continue
+		}
+		imported[project.Name] = true
+
+		if err := i.importTenant(project, tenants[project.Name]); err != nil {
+			glog.Errorf("Import keystone tenant %s failed: %v", project.Name, err)
+			errs = append(errs, err)
+		}
+	}
+
+	for name, tenant := range tenants {
+		if imported[name] || !isImported(tenant) || tenant.DeletionTimestamp != nil {
+			continue
+		}
+		if err := i.removeTenant(tenant); err != nil {
+			glog.Errorf("Remove imported tenant %s failed: %v", name, err)
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%d tenants failed to import: %v", len(errs), errs)
+	}
+	return nil
+}
+
+// importTenant creates the tenant of project, or updates the imported tenant
+// if the id of project has changed.
+func (i *TenantImporter) importTenant(project openstack.TenantInfo, tenant *crv1.Tenant) error {
+	if tenant == nil {
+		tenant = &crv1.Tenant{
+			ObjectMeta: apismetav1.ObjectMeta{
+				Name:   project.Name,
+				Labels: map[string]string{ImportedLabel: "true"},
+			},
+			Spec: crv1.TenantSpec{
+				UserName: project.Name,
+				TenantID: project.ID,
+			},
+		}
+		glog.V(4).Infof("Importing keystone tenant %s (%s)", project.Name, project.ID)
+		return i.kubeCRDClient.AddTenant(tenant)
+	}
+
+	if !isImported(tenant) {
+		if tenant.Spec.TenantID != "" && tenant.Spec.TenantID != project.ID {
+			glog.Warningf("Tenant %s is bound to keystone tenant %s, not importing %s",
+				tenant.Name, tenant.Spec.TenantID, project.ID)
+		}
+		return nil
+	}
+	if tenant.Spec.TenantID == project.ID {
+		return nil
+	}
+
+	glog.V(4).Infof("Updating imported tenant %s to keystone tenant %s", tenant.Name, project.ID)
+	tenant.Spec.TenantID = project.ID
+	return i.kubeCRDClient.UpdateTenant(tenant)
+}
+
+// removeTenant marks tenant as Failed or deletes it according to the removal
+// policy, since its keystone project has been removed.
+func (i *TenantImporter) removeTenant(tenant *crv1.Tenant) error {
+	if i.removalPolicy == RemovalPolicyDelete {
+		glog.V(4).Infof("Deleting imported tenant %s since its keystone tenant is removed", tenant.Name)
+		return i.kubeCRDClient.DeleteTenant(tenant.Name)
+	}
+
+	message := fmt.Sprintf("keystone tenant %s not found", tenant.Spec.TenantID)
+	if tenant.Status.State == crv1.TenantFailed && tenant.Status.Message == message {
+		return nil
+	}
+	glog.V(4).Infof("Marking imported tenant %s as failed since its keystone tenant is removed", tenant.Name)
+	tenant.Status.State = crv1.TenantFailed
+	tenant.Status.Message = message
+	return i.kubeCRDClient.UpdateTenant(tenant)
+}
+
+// isImported returns true if tenant is created by the TenantImporter.
+func isImported(tenant *crv1.Tenant) bool {
+	return tenant.Labels[ImportedLabel] == "true"
+}
@@ -0,0 +1,160 @@
+/*
+Copyright (c) 2017 OpenStack Foundation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tenant
+
+import (
+	"testing"
+	"time"
+
+	crv1 "git.openstack.org/openstack/stackube/pkg/apis/v1"
+	crdClient "git.openstack.org/openstack/stackube/pkg/kubecrd"
+	"git.openstack.org/openstack/stackube/pkg/openstack"
+)
+
+func newTenantImporter(removalPolicy string) (*TenantImporter, *crdClient.FakeCRDClient, *openstack.FakeOSClient, error) {
+	kubeCRDClient, err := crdClient.NewFake()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	osClient := openstack.NewFake(kubeCRDClient)
+
+	importer, err := NewTenantImporter(osClient, "", "stackube", removalPolicy, time.Minute)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return importer, kubeCRDClient, osClient, nil
+}
+
+func TestNewTenantImporterInvalid(t *testing.T) {
+	kubeCRDClient, err := crdClient.NewFake()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	osClient := openstack.NewFake(kubeCRDClient)
+
+	if _, err := NewTenantImporter(osClient, "", "", "keep", time.Minute); err == nil {
+		t.Errorf("Expected error for invalid removal policy")
+	}
+	if _, err := NewTenantImporter(osClient, "", "", RemovalPolicyFail, 0); err == nil {
+		t.Errorf("Expected error for invalid interval")
+	}
+}
+
+func TestImportTenants(t *testing.T) {
+	importer, kubeCRDClient, osClient, err := newTenantImporter(RemovalPolicyFail)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	osClient.SetTenant("dev", "dev-id")
+	osClient.SetTenant("test", "test-id")
+	osClient.SetTenant("Invalid_Name", "invalid-id")
+	osClient.SetTenant("untagged", "untagged-id")
+	osClient.SetTenant("manual", "manual-id")
+	for _, name := range []string{"dev", "test", "Invalid_Name", "manual"} {
+		osClient.TenantTags[name] = []string{"stackube"}
+	}
+	manual := newTenant("manual", "manual", password, "other-id")
+	kubeCRDClient.SetTenants(manual)
+
+	if err := importer.importTenants(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, name := range []string{"dev", "test"} {
+		tenant, ok := kubeCRDClient.Tenants[name]
+		if !ok {
+			t.Errorf("Expected tenant %s imported", name)
+			continue
+		}
+		if !isImported(tenant) || tenant.Spec.TenantID != name+"-id" || tenant.Spec.UserName != name {
+			t.Errorf("Expected tenant %s imported from %s-id, got %#v", name, name, tenant)
+		}
+	}
+	for _, name := range []string{"Invalid_Name", "untagged"} {
+		if _, ok := kubeCRDClient.Tenants[name]; ok {
+			t.Errorf("Expected tenant %s not imported", name)
+		}
+	}
+	if tenant := kubeCRDClient.Tenants["manual"]; isImported(tenant) || tenant.Spec.TenantID != "other-id" {
+		t.Errorf("Expected tenant manual unchanged, got %#v", tenant)
+	}
+
+	// The project of an imported tenant is recreated.
+	osClient.SetTenant("test", "new-test-id")
+	if err := importer.importTenants(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if tenantID := kubeCRDClient.Tenants["test"].Spec.TenantID; tenantID != "new-test-id" {
+		t.Errorf("Expected tenant test updated to new-test-id, got %s", tenantID)
+	}
+
+	// The project of an imported tenant is removed.
+	delete(osClient.Tenants, "dev")
+	if err := importer.importTenants(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	tenant := kubeCRDClient.Tenants["dev"]
+	if tenant.Status.State != crv1.TenantFailed || tenant.Status.Message != "keystone tenant dev-id not found" {
+		t.Errorf("Expected tenant dev failed, got %#v", tenant.Status)
+	}
+	if _, ok := kubeCRDClient.Tenants["manual"]; !ok {
+		t.Errorf("Expected tenant manual not removed")
+	}
+}
+
+func TestImportTenantsRemovalPolicyDelete(t *testing.T) {
+	importer, kubeCRDClient, osClient, err := newTenantImporter(RemovalPolicyDelete)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	osClient.SetTenant("dev", "dev-id")
+	osClient.TenantTags["dev"] = []string{"stackube"}
+	if err := importer.importTenants(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, ok := kubeCRDClient.Tenants["dev"]; !ok {
+		t.Fatalf("Expected tenant dev imported")
+	}
+
+	delete(osClient.Tenants, "dev")
+	if err := importer.importTenants(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, ok := kubeCRDClient.Tenants["dev"]; ok {
+		t.Errorf("Expected tenant dev deleted")
+	}
+}
+
+func TestSyncTenantRemovedKeystoneTenant(t *testing.T) {
+	controller, kubeCRDClient, _, _, err := newTenantController()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tenant := newTenant("dev", "dev", password, "dev-id")
+	kubeCRDClient.SetTenants(tenant)
+	if err := storeAndSync(controller, tenant); err == nil {
+		t.Fatalf("Expected error for removed keystone tenant")
+	}
+
+	tenant = kubeCRDClient.Tenants["dev"]
+	if tenant.Status.State != crv1.TenantFailed || tenant.Status.Message != "keystone tenant dev-id not found" {
+		t.Errorf("Expected tenant dev failed, got %#v", tenant.Status)
+	}
+}
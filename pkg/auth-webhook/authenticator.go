@@ -0,0 +1,118 @@
+/*
+Copyright (c) 2017 OpenStack Foundation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"git.openstack.org/openstack/stackube/pkg/openstack"
+
+	"github.com/golang/glog"
+	authenticationv1beta1 "k8s.io/api/authentication/v1beta1"
+)
+
+const (
+	// KeystoneUserIDKey is the key of the user's extra info which carries
+	// the keystone user ID from the authenticator to the authorizer.
+	KeystoneUserIDKey = "stackube.kubernetes.io/keystone-user-id"
+)
+
+// Authenticator implements the kubernetes TokenReview webhook by validating
+// bearer tokens against keystone.
+type Authenticator struct {
+	osClient openstack.Interface
+}
+
+// NewAuthenticator returns a new Authenticator.
+func NewAuthenticator(osClient openstack.Interface) *Authenticator {
+	return &Authenticator{
+		osClient: osClient,
+	}
+}
+
+// ServeHTTP handles a TokenReview request from kube-apiserver.
+func (a *Authenticator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, fmt.Sprintf("method %s not allowed", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+
+	var review authenticationv1beta1.TokenReview
+	if err := json.NewDecoder(r.Body).Decode(&review); err != nil {
+		glog.Errorf("Failed to decode TokenReview: %v", err)
+		http.Error(w, fmt.Sprintf("failed to decode TokenReview: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	review.Status = a.authenticate(review.Spec.Token)
+	// Never send the token back.
+	review.Spec.Token = ""
+	if review.APIVersion == "" {
+		review.APIVersion = authenticationv1beta1.SchemeGroupVersion.String()
+	}
+	if review.Kind == "" {
+		review.Kind = "TokenReview"
+	}
+
+	writeResponse(w, &review)
+}
+
+func (a *Authenticator) authenticate(token string) authenticationv1beta1.TokenReviewStatus {
+	if token == "" {
+		return authenticationv1beta1.TokenReviewStatus{Authenticated: false}
+	}
+
+	user, err := a.osClient.AuthenticateToken(token)
+	if err == openstack.ErrNotFound {
+		glog.V(4).Infof("Rejected invalid keystone token")
+		return authenticationv1beta1.TokenReviewStatus{Authenticated: false}
+	} else if err != nil {
+		glog.Errorf("Authenticate keystone token failed: %v", err)
+		return authenticationv1beta1.TokenReviewStatus{
+			Authenticated: false,
+			Error:         err.Error(),
+		}
+	}
+
+	glog.V(4).Infof("Authenticated keystone user %s with projects %v", user.Name, user.Projects)
+	return authenticationv1beta1.TokenReviewStatus{
+		Authenticated: true,
+		User: authenticationv1beta1.UserInfo{
+			Username: user.Name,
+			UID:      user.ID,
+			Groups:   user.Projects,
+			Extra: map[string]authenticationv1beta1.ExtraValue{
+				KeystoneUserIDKey: {user.ID},
+			},
+		},
+	}
+}
+
+func writeResponse(w http.ResponseWriter, obj interface{}) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		glog.Errorf("Failed to encode response: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
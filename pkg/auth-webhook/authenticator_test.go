@@ -0,0 +1,149 @@
+/*
+Copyright (c) 2017 OpenStack Foundation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	crdClient "git.openstack.org/openstack/stackube/pkg/kubecrd"
+	"git.openstack.org/openstack/stackube/pkg/openstack"
+
+	authenticationv1beta1 "k8s.io/api/authentication/v1beta1"
+)
+
+func newTokenReviewRequest(t *testing.T, token string) *http.Request {
+	review := &authenticationv1beta1.TokenReview{
+		Spec: authenticationv1beta1.TokenReviewSpec{Token: token},
+	}
+	review.APIVersion = authenticationv1beta1.SchemeGroupVersion.String()
+	review.Kind = "TokenReview"
+
+	body, err := json.Marshal(review)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return httptest.NewRequest("POST", "/authenticate", bytes.NewReader(body))
+}
+
+func TestAuthenticator(t *testing.T) {
+	testCases := []struct {
+		testName       string
+		token          string
+		updateFn       func(*openstack.FakeOSClient)
+		expectedStatus authenticationv1beta1.TokenReviewStatus
+	}{
+		{
+			testName: "Valid token",
+			token:    "user-token",
+			updateFn: func(osClient *openstack.FakeOSClient) {
+				osClient.SetToken("user-token", &openstack.UserInfo{
+					ID:       "u-123",
+					Name:     "alice",
+					Projects: []string{"dev", "test"},
+				})
+			},
+			expectedStatus: authenticationv1beta1.TokenReviewStatus{
+				Authenticated: true,
+				User: authenticationv1beta1.UserInfo{
+					Username: "alice",
+					UID:      "u-123",
+					Groups:   []string{"dev", "test"},
+					Extra: map[string]authenticationv1beta1.ExtraValue{
+						KeystoneUserIDKey: {"u-123"},
+					},
+				},
+			},
+		},
+		{
+			testName:       "Invalid token",
+			token:          "invalid-token",
+			updateFn:       func(osClient *openstack.FakeOSClient) {},
+			expectedStatus: authenticationv1beta1.TokenReviewStatus{Authenticated: false},
+		},
+		{
+			testName:       "Empty token",
+			token:          "",
+			updateFn:       func(osClient *openstack.FakeOSClient) {},
+			expectedStatus: authenticationv1beta1.TokenReviewStatus{Authenticated: false},
+		},
+		{
+			testName: "Keystone unavailable",
+			token:    "user-token",
+			updateFn: func(osClient *openstack.FakeOSClient) {
+				osClient.InjectError("AuthenticateToken", errors.New("connection refused"))
+			},
+			expectedStatus: authenticationv1beta1.TokenReviewStatus{
+				Authenticated: false,
+				Error:         "connection refused",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		kubeCRDClient, err := crdClient.NewFake()
+		if err != nil {
+			t.Fatalf("Failed start a kube crd client: %v", err)
+		}
+		osClient := openstack.NewFake(kubeCRDClient)
+		tc.updateFn(osClient)
+
+		recorder := httptest.NewRecorder()
+		NewAuthenticator(osClient).ServeHTTP(recorder, newTokenReviewRequest(t, tc.token))
+		if recorder.Code != http.StatusOK {
+			t.Errorf("Case[%s]: expected status code %d, got %d", tc.testName, http.StatusOK, recorder.Code)
+			continue
+		}
+
+		var review authenticationv1beta1.TokenReview
+		if err := json.NewDecoder(recorder.Body).Decode(&review); err != nil {
+			t.Errorf("Case[%s]: unexpected error decoding response: %v", tc.testName, err)
+			continue
+		}
+		if review.Kind != "TokenReview" || review.Spec.Token != "" {
+			t.Errorf("Case[%s]: unexpected TokenReview %v", tc.testName, review)
+		}
+		if !reflect.DeepEqual(tc.expectedStatus, review.Status) {
+			t.Errorf("Case[%s]: expected status %v, got %v", tc.testName, tc.expectedStatus, review.Status)
+		}
+	}
+}
+
+func TestAuthenticatorBadRequest(t *testing.T) {
+	kubeCRDClient, err := crdClient.NewFake()
+	if err != nil {
+		t.Fatalf("Failed start a kube crd client: %v", err)
+	}
+	authenticator := NewAuthenticator(openstack.NewFake(kubeCRDClient))
+
+	recorder := httptest.NewRecorder()
+	authenticator.ServeHTTP(recorder, httptest.NewRequest("POST", "/authenticate", bytes.NewBufferString("{")))
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, recorder.Code)
+	}
+
+	recorder = httptest.NewRecorder()
+	authenticator.ServeHTTP(recorder, httptest.NewRequest("GET", "/authenticate", nil))
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status code %d, got %d", http.StatusMethodNotAllowed, recorder.Code)
+	}
+}
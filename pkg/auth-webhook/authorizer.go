@@ -0,0 +1,124 @@
+/*
+Copyright (c) 2017 OpenStack Foundation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"git.openstack.org/openstack/stackube/pkg/openstack"
+	"git.openstack.org/openstack/stackube/pkg/util"
+
+	"github.com/golang/glog"
+	authorizationv1beta1 "k8s.io/api/authorization/v1beta1"
+)
+
+// Authorizer implements the kubernetes SubjectAccessReview webhook by mapping
+// the keystone roles of a user on a project to permissions inside the
+// namespace of the project. Requests which are not matched by the policy get
+// no opinion, so that kube-apiserver falls through to the next authorizer
+// (e.g. RBAC).
+type Authorizer struct {
+	osClient openstack.Interface
+	policy   *Policy
+}
+
+// NewAuthorizer returns a new Authorizer.
+func NewAuthorizer(osClient openstack.Interface, policy *Policy) *Authorizer {
+	return &Authorizer{
+		osClient: osClient,
+		policy:   policy,
+	}
+}
+
+// ServeHTTP handles a SubjectAccessReview request from kube-apiserver.
+func (a *Authorizer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, fmt.Sprintf("method %s not allowed", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+
+	var review authorizationv1beta1.SubjectAccessReview
+	if err := json.NewDecoder(r.Body).Decode(&review); err != nil {
+		glog.Errorf("Failed to decode SubjectAccessReview: %v", err)
+		http.Error(w, fmt.Sprintf("failed to decode SubjectAccessReview: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	review.Status = a.authorize(&review.Spec)
+	if review.APIVersion == "" {
+		review.APIVersion = authorizationv1beta1.SchemeGroupVersion.String()
+	}
+	if review.Kind == "" {
+		review.Kind = "SubjectAccessReview"
+	}
+
+	writeResponse(w, &review)
+}
+
+func noOpinion(reason string) authorizationv1beta1.SubjectAccessReviewStatus {
+	return authorizationv1beta1.SubjectAccessReviewStatus{
+		Allowed: false,
+		Reason:  reason,
+	}
+}
+
+func (a *Authorizer) authorize(spec *authorizationv1beta1.SubjectAccessReviewSpec) authorizationv1beta1.SubjectAccessReviewStatus {
+	attrs := spec.ResourceAttributes
+	if attrs == nil || attrs.Namespace == "" {
+		return noOpinion("not a namespaced resource request")
+	}
+	if util.IsSystemNamespace(attrs.Namespace) {
+		return noOpinion(fmt.Sprintf("namespace %s is a system namespace", attrs.Namespace))
+	}
+
+	userIDs := spec.Extra[KeystoneUserIDKey]
+	if len(userIDs) == 0 {
+		return noOpinion(fmt.Sprintf("user %s is not a keystone user", spec.User))
+	}
+
+	tenantID, err := a.osClient.GetTenantIDFromNamespace(attrs.Namespace)
+	if err != nil || tenantID == "" {
+		glog.V(4).Infof("Namespace %s is not mapped to a tenant: %v", attrs.Namespace, err)
+		return noOpinion(fmt.Sprintf("namespace %s is not mapped to a tenant", attrs.Namespace))
+	}
+
+	roles, err := a.osClient.ListUserRoles(userIDs[0], tenantID)
+	if err != nil {
+		glog.Errorf("List roles of user %s on tenant %s failed: %v", spec.User, tenantID, err)
+		return authorizationv1beta1.SubjectAccessReviewStatus{
+			Allowed:         false,
+			EvaluationError: err.Error(),
+		}
+	}
+
+	resource := attrs.Resource
+	if attrs.Subresource != "" {
+		resource = resource + "/" + attrs.Subresource
+	}
+	if !a.policy.Allows(roles, attrs.Verb, attrs.Group, resource) {
+		return noOpinion(fmt.Sprintf("no policy rule matches roles %v", roles))
+	}
+
+	glog.V(4).Infof("Allowed user %s with roles %v to %s %s in namespace %s",
+		spec.User, roles, attrs.Verb, resource, attrs.Namespace)
+	return authorizationv1beta1.SubjectAccessReviewStatus{
+		Allowed: true,
+		Reason:  fmt.Sprintf("allowed by keystone roles %v", roles),
+	}
+}
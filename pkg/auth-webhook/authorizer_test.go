@@ -0,0 +1,215 @@
+/*
+Copyright (c) 2017 OpenStack Foundation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	crv1 "git.openstack.org/openstack/stackube/pkg/apis/v1"
+	crdClient "git.openstack.org/openstack/stackube/pkg/kubecrd"
+	"git.openstack.org/openstack/stackube/pkg/openstack"
+	"git.openstack.org/openstack/stackube/pkg/util"
+
+	authorizationv1beta1 "k8s.io/api/authorization/v1beta1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newSubjectAccessReviewRequest(t *testing.T, spec authorizationv1beta1.SubjectAccessReviewSpec) *http.Request {
+	review := &authorizationv1beta1.SubjectAccessReview{Spec: spec}
+	review.APIVersion = authorizationv1beta1.SchemeGroupVersion.String()
+	review.Kind = "SubjectAccessReview"
+
+	body, err := json.Marshal(review)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return httptest.NewRequest("POST", "/authorize", bytes.NewReader(body))
+}
+
+func newKeystoneUserSpec(namespace, verb, resource string) authorizationv1beta1.SubjectAccessReviewSpec {
+	return authorizationv1beta1.SubjectAccessReviewSpec{
+		User:   "alice",
+		Groups: []string{"dev"},
+		Extra: map[string]authorizationv1beta1.ExtraValue{
+			KeystoneUserIDKey: {"u-123"},
+		},
+		ResourceAttributes: &authorizationv1beta1.ResourceAttributes{
+			Namespace: namespace,
+			Verb:      verb,
+			Resource:  resource,
+		},
+	}
+}
+
+func TestAuthorizer(t *testing.T) {
+	testCases := []struct {
+		testName        string
+		spec            authorizationv1beta1.SubjectAccessReviewSpec
+		updateFn        func(*openstack.FakeOSClient)
+		expectedAllowed bool
+		expectedError   bool
+	}{
+		{
+			testName: "Admin deletes pods",
+			spec:     newKeystoneUserSpec("dev", "delete", "pods"),
+			updateFn: func(osClient *openstack.FakeOSClient) {
+				osClient.SetUserRoles("u-123", "t-1", "admin")
+			},
+			expectedAllowed: true,
+		},
+		{
+			testName: "Member creates deployments",
+			spec:     newKeystoneUserSpec("dev", "create", "deployments"),
+			updateFn: func(osClient *openstack.FakeOSClient) {
+				osClient.SetUserRoles("u-123", "t-1", "Member")
+			},
+			expectedAllowed: true,
+		},
+		{
+			testName: "Reader lists pods",
+			spec:     newKeystoneUserSpec("dev", "list", "pods"),
+			updateFn: func(osClient *openstack.FakeOSClient) {
+				osClient.SetUserRoles("u-123", "t-1", "reader")
+			},
+			expectedAllowed: true,
+		},
+		{
+			testName: "Reader gets secrets",
+			spec:     newKeystoneUserSpec("dev", "get", "secrets"),
+			updateFn: func(osClient *openstack.FakeOSClient) {
+				osClient.SetUserRoles("u-123", "t-1", "reader")
+			},
+			expectedAllowed: false,
+		},
+		{
+			testName: "Reader deletes pods",
+			spec:     newKeystoneUserSpec("dev", "delete", "pods"),
+			updateFn: func(osClient *openstack.FakeOSClient) {
+				osClient.SetUserRoles("u-123", "t-1", "reader")
+			},
+			expectedAllowed: false,
+		},
+		{
+			testName:        "User without roles",
+			spec:            newKeystoneUserSpec("dev", "get", "pods"),
+			updateFn:        func(osClient *openstack.FakeOSClient) {},
+			expectedAllowed: false,
+		},
+		{
+			testName: "Namespace without tenant",
+			spec:     newKeystoneUserSpec("other", "get", "pods"),
+			updateFn: func(osClient *openstack.FakeOSClient) {
+				osClient.SetUserRoles("u-123", "t-1", "admin")
+			},
+			expectedAllowed: false,
+		},
+		{
+			testName: "Namespace of tenant",
+			spec:     newKeystoneUserSpec("staging", "delete", "pods"),
+			updateFn: func(osClient *openstack.FakeOSClient) {
+				osClient.SetNamespace(&v1.Namespace{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:   "staging",
+						Labels: map[string]string{util.TenantLabel: "dev"},
+					},
+				})
+				osClient.SetUserRoles("u-123", "t-1", "admin")
+			},
+			expectedAllowed: true,
+		},
+		{
+			testName: "System namespace",
+			spec:     newKeystoneUserSpec("kube-system", "get", "pods"),
+			updateFn: func(osClient *openstack.FakeOSClient) {
+				osClient.SetUserRoles("u-123", "t-1", "admin")
+			},
+			expectedAllowed: false,
+		},
+		{
+			testName: "Non keystone user",
+			spec: authorizationv1beta1.SubjectAccessReviewSpec{
+				User: "system:serviceaccount:dev:default",
+				ResourceAttributes: &authorizationv1beta1.ResourceAttributes{
+					Namespace: "dev",
+					Verb:      "get",
+					Resource:  "pods",
+				},
+			},
+			updateFn:        func(osClient *openstack.FakeOSClient) {},
+			expectedAllowed: false,
+		},
+		{
+			testName: "Non resource request",
+			spec: authorizationv1beta1.SubjectAccessReviewSpec{
+				User: "alice",
+				NonResourceAttributes: &authorizationv1beta1.NonResourceAttributes{
+					Path: "/healthz",
+					Verb: "get",
+				},
+			},
+			updateFn:        func(osClient *openstack.FakeOSClient) {},
+			expectedAllowed: false,
+		},
+		{
+			testName: "Keystone unavailable",
+			spec:     newKeystoneUserSpec("dev", "get", "pods"),
+			updateFn: func(osClient *openstack.FakeOSClient) {
+				osClient.InjectError("ListUserRoles", errors.New("connection refused"))
+			},
+			expectedAllowed: false,
+			expectedError:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		kubeCRDClient, err := crdClient.NewFake()
+		if err != nil {
+			t.Fatalf("Failed start a kube crd client: %v", err)
+		}
+		kubeCRDClient.SetTenants(&crv1.Tenant{
+			ObjectMeta: metav1.ObjectMeta{Name: "dev"},
+			Spec:       crv1.TenantSpec{TenantID: "t-1"},
+		})
+		osClient := openstack.NewFake(kubeCRDClient)
+		tc.updateFn(osClient)
+
+		recorder := httptest.NewRecorder()
+		NewAuthorizer(osClient, DefaultPolicy()).ServeHTTP(recorder, newSubjectAccessReviewRequest(t, tc.spec))
+		if recorder.Code != http.StatusOK {
+			t.Errorf("Case[%s]: expected status code %d, got %d", tc.testName, http.StatusOK, recorder.Code)
+			continue
+		}
+
+		var review authorizationv1beta1.SubjectAccessReview
+		if err := json.NewDecoder(recorder.Body).Decode(&review); err != nil {
+			t.Errorf("Case[%s]: unexpected error decoding response: %v", tc.testName, err)
+			continue
+		}
+		if review.Status.Allowed != tc.expectedAllowed {
+			t.Errorf("Case[%s]: expected allowed %v, got %v (%s)", tc.testName, tc.expectedAllowed, review.Status.Allowed, review.Status.Reason)
+		}
+		if (review.Status.EvaluationError != "") != tc.expectedError {
+			t.Errorf("Case[%s]: unexpected evaluation error %q", tc.testName, review.Status.EvaluationError)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+/*
+Copyright (c) 2017 OpenStack Foundation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auth
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+const (
+	// policyWildcard matches every verb, api group or resource.
+	policyWildcard = "*"
+)
+
+// readerResources are the resources readable by the reader role of the
+// default policy, like the view ClusterRole. Secrets are left out since they
+// hold service account tokens, TLS keys and tenant credentials.
+var readerResources = []string{
+	"configmaps",
+	"endpoints",
+	"events",
+	"limitranges",
+	"persistentvolumeclaims",
+	"pods",
+	"pods/log",
+	"pods/status",
+	"replicationcontrollers",
+	"replicationcontrollers/scale",
+	"replicationcontrollers/status",
+	"resourcequotas",
+	"resourcequotas/status",
+	"serviceaccounts",
+	"services",
+	"services/status",
+	"cronjobs",
+	"cronjobs/status",
+	"daemonsets",
+	"daemonsets/status",
+	"deployments",
+	"deployments/scale",
+	"deployments/status",
+	"horizontalpodautoscalers",
+	"horizontalpodautoscalers/status",
+	"ingresses",
+	"ingresses/status",
+	"jobs",
+	"jobs/status",
+	"networkpolicies",
+	"poddisruptionbudgets",
+	"poddisruptionbudgets/status",
+	"replicasets",
+	"replicasets/scale",
+	"replicasets/status",
+	"statefulsets",
+	"statefulsets/scale",
+	"statefulsets/status",
+	"networks",
+}
+
+// Policy maps keystone roles on a project to the permissions they grant inside
+// the namespace of the project.
+type Policy struct {
+	Rules []PolicyRule `json:"rules"`
+}
+
+// PolicyRule grants the verbs on the resources to the users who have the role.
+type PolicyRule struct {
+	// Role is the keystone role name, it is matched case-insensitively.
+	Role string `json:"role"`
+	// Verbs is a list of kubernetes verbs, "*" means all verbs.
+	Verbs []string `json:"verbs"`
+	// APIGroups is a list of api groups, "*" or empty means all groups.
+	APIGroups []string `json:"apiGroups,omitempty"`
+	// Resources is a list of resources such as "pods" or "pods/log",
+	// "*" or empty means all resources.
+	Resources []string `json:"resources,omitempty"`
+}
+
+// DefaultPolicy returns the policy used when no policy file is given:
+// admin has full access, member has write access and reader has read-only
+// access to the namespace of the project, except for secrets.
+func DefaultPolicy() *Policy {
+	return &Policy{
+		Rules: []PolicyRule{
+			{
+				Role:  "admin",
+				Verbs: []string{policyWildcard},
+			},
+			{
+				Role:  "member",
+				Verbs: []string{"get", "list", "watch", "create", "update", "patch", "delete", "deletecollection"},
+			},
+			{
+				Role:      "reader",
+				Verbs:     []string{"get", "list", "watch"},
+				Resources: readerResources,
+			},
+		},
+	}
+}
+
+// LoadPolicy reads policy from a yaml or json file.
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := &Policy{}
+	if err := yaml.Unmarshal(data, policy); err != nil {
+		return nil, fmt.Errorf("failed to parse policy file %s: %v", path, err)
+	}
+
+	for i, rule := range policy.Rules {
+		if rule.Role == "" {
+			return nil, fmt.Errorf("rule %d of policy file %s has no role", i, path)
+		}
+		if len(rule.Verbs) == 0 {
+			return nil, fmt.Errorf("rule %d of policy file %s has no verbs", i, path)
+		}
+	}
+
+	return policy, nil
+}
+
+// Allows checks whether any of the roles is allowed to perform verb on the
+// resource of the api group.
+func (p *Policy) Allows(roles []string, verb, apiGroup, resource string) bool {
+	for _, rule := range p.Rules {
+		for _, role := range roles {
+			if strings.EqualFold(rule.Role, role) && rule.matches(verb, apiGroup, resource) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (r *PolicyRule) matches(verb, apiGroup, resource string) bool {
+	if !contains(r.Verbs, verb) {
+		return false
+	}
+	if len(r.APIGroups) > 0 && !contains(r.APIGroups, apiGroup) {
+		return false
+	}
+	if len(r.Resources) > 0 && !contains(r.Resources, resource) {
+		return false
+	}
+
+	return true
+}
+
+func contains(items []string, item string) bool {
+	for _, i := range items {
+		if i == policyWildcard || i == item {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,99 @@
+/*
+Copyright (c) 2017 OpenStack Foundation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auth
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testPolicy = `
+rules:
+- role: admin
+  verbs: ["*"]
+- role: ci
+  verbs: ["get", "list", "create", "update", "patch"]
+  apiGroups: ["extensions", "apps"]
+  resources: ["deployments"]
+- role: auditor
+  verbs: ["get", "list"]
+  resources: ["pods", "pods/log", "events"]
+`
+
+func writePolicyFile(t *testing.T, content string) (string, func()) {
+	dir, err := ioutil.TempDir("", "stackube-policy")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	path := filepath.Join(dir, "policy.yaml")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func TestLoadPolicy(t *testing.T) {
+	path, cleanup := writePolicyFile(t, testPolicy)
+	defer cleanup()
+
+	policy, err := LoadPolicy(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	testCases := []struct {
+		roles    []string
+		verb     string
+		apiGroup string
+		resource string
+		expected bool
+	}{
+		{[]string{"admin"}, "delete", "", "secrets", true},
+		{[]string{"ci"}, "update", "apps", "deployments", true},
+		{[]string{"ci"}, "delete", "apps", "deployments", false},
+		{[]string{"ci"}, "update", "", "pods", false},
+		{[]string{"auditor"}, "get", "", "pods/log", true},
+		{[]string{"auditor"}, "get", "", "secrets", false},
+		{[]string{"reader"}, "get", "", "pods", false},
+		{[]string{"reader", "Auditor"}, "list", "", "events", true},
+	}
+
+	for _, tc := range testCases {
+		allowed := policy.Allows(tc.roles, tc.verb, tc.apiGroup, tc.resource)
+		if allowed != tc.expected {
+			t.Errorf("Expected roles %v %s %s/%s to be %v, got %v",
+				tc.roles, tc.verb, tc.apiGroup, tc.resource, tc.expected, allowed)
+		}
+	}
+}
+
+func TestLoadInvalidPolicy(t *testing.T) {
+	for _, content := range []string{
+		"rules: [",
+		"rules:\n- verbs: [get]\n",
+		"rules:\n- role: reader\n",
+	} {
+		path, cleanup := writePolicyFile(t, content)
+		if _, err := LoadPolicy(path); err == nil {
+			t.Errorf("Expected error loading policy %q", content)
+		}
+		cleanup()
+	}
+}
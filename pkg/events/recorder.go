@@ -0,0 +1,183 @@
+/*
+Copyright (c) 2017 OpenStack Foundation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package events records Kubernetes events on the objects reconciled by
+// stackube controllers, so that their progress and failures can be seen by
+// `kubectl describe`.
+package events
+
+import (
+	"fmt"
+	"sync"
+
+	crv1 "git.openstack.org/openstack/stackube/pkg/apis/v1"
+
+	"github.com/golang/glog"
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/client-go/kubernetes"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+)
+
+const (
+	// Maximum number of events remembered for aggregation.
+	maxCachedEvents = 4096
+	// Maximum length of the messages of events.
+	maxMessageLength = 1024
+)
+
+// EventRecorder records events on objects.
+type EventRecorder interface {
+	// Event records an event of eventtype, which is apiv1.EventTypeNormal
+	// or apiv1.EventTypeWarning, on obj. reason is a short CamelCase
+	// reason of the event, and message is shown to users.
+	Event(obj runtime.Object, eventtype, reason, message string)
+	// Eventf is like Event, but formats the message with fmt.Sprintf.
+	Eventf(obj runtime.Object, eventtype, reason, messageFmt string, args ...interface{})
+}
+
+// Recorder records events to kube-apiserver. Repeated events of an object
+// are aggregated into one event by increasing its count.
+type Recorder struct {
+	client    kubernetes.Interface
+	component string
+	scheme    *runtime.Scheme
+	clock     clock.Clock
+
+	mu sync.Mutex
+	// recorded events by their object, type, reason and message.
+	cache map[string]*apiv1.Event
+}
+
+var _ EventRecorder = &Recorder{}
+
+// NewRecorder creates a new Recorder which records events from component.
+func NewRecorder(client kubernetes.Interface, component string) *Recorder {
+	scheme := runtime.NewScheme()
+	clientgoscheme.AddToScheme(scheme)
+	crv1.AddToScheme(scheme)
+
+	return &Recorder{
+		client:    client,
+		component: component,
+		scheme:    scheme,
+		clock:     clock.RealClock{},
+		cache:     make(map[string]*apiv1.Event),
+	}
+}
+
+// Event records an event on obj.
+func (r *Recorder) Event(obj runtime.Object, eventtype, reason, message string) {
+	ref, err := r.objectReference(obj)
+	if err != nil {
+		glog.Errorf("Could not get reference of %#v, event %s %s not recorded: %v", obj, reason, message, err)
+		return
+	}
+	if len(message) > maxMessageLength {
+		message = message[:maxMessageLength]
+	}
+
+	// Events of cluster-scoped objects are recorded in the default
+	// namespace.
+	namespace := ref.Namespace
+	if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+	key := fmt.Sprintf("%s/%s/%s/%s/%s/%s/%s", ref.Kind, namespace, ref.Name, ref.UID, eventtype, reason, message)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := metav1.NewTime(r.clock.Now())
+	if event, ok := r.cache[key]; ok {
+		updated := &apiv1.Event{}
+		event.DeepCopyInto(updated)
+		updated.Count++
+		updated.LastTimestamp = now
+		result, err := r.client.CoreV1().Events(namespace).Update(updated)
+		if err == nil {
+			r.cache[key] = result
+			return
+		}
+		if !apierrors.IsNotFound(err) {
+			glog.Errorf("Could not update event %s %s of %s %s/%s: %v", reason, message, ref.Kind, namespace, ref.Name, err)
+			return
+		}
+		// The event has expired, record it again.
+		delete(r.cache, key)
+	}
+
+	event := &apiv1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%v.%x", ref.Name, now.UnixNano()),
+			Namespace: namespace,
+		},
+		InvolvedObject: *ref,
+		Reason:         reason,
+		Message:        message,
+		Source:         apiv1.EventSource{Component: r.component},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+		Type:           eventtype,
+	}
+	result, err := r.client.CoreV1().Events(namespace).Create(event)
+	if err != nil {
+		glog.Errorf("Could not create event %s %s of %s %s/%s: %v", reason, message, ref.Kind, namespace, ref.Name, err)
+		return
+	}
+
+	if len(r.cache) >= maxCachedEvents {
+		r.cache = make(map[string]*apiv1.Event)
+	}
+	r.cache[key] = result
+}
+
+// Eventf records an event on obj with a formatted message.
+func (r *Recorder) Eventf(obj runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.Event(obj, eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+// objectReference returns the reference of obj, its kind is looked up in
+// the scheme since objects got from clients don't keep their TypeMeta.
+func (r *Recorder) objectReference(obj runtime.Object) (*apiv1.ObjectReference, error) {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	gvk := obj.GetObjectKind().GroupVersionKind()
+	if gvk.Kind == "" {
+		gvks, _, err := r.scheme.ObjectKinds(obj)
+		if err != nil {
+			return nil, err
+		}
+		gvk = gvks[0]
+	}
+
+	return &apiv1.ObjectReference{
+		Kind:            gvk.Kind,
+		APIVersion:      gvk.GroupVersion().String(),
+		Namespace:       accessor.GetNamespace(),
+		Name:            accessor.GetName(),
+		UID:             accessor.GetUID(),
+		ResourceVersion: accessor.GetResourceVersion(),
+	}, nil
+}
@@ -0,0 +1,59 @@
+/*
+Copyright (c) 2017 OpenStack Foundation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"fmt"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// FakeRecorder is a simple fake event recorder for testing, it keeps the
+// recorded events as "<type> <reason> <message>".
+type FakeRecorder struct {
+	sync.Mutex
+	Events []string
+}
+
+var _ EventRecorder = &FakeRecorder{}
+
+// NewFakeRecorder creates a new FakeRecorder.
+func NewFakeRecorder() *FakeRecorder {
+	return &FakeRecorder{}
+}
+
+// Event records an event.
+func (f *FakeRecorder) Event(obj runtime.Object, eventtype, reason, message string) {
+	f.Lock()
+	defer f.Unlock()
+	f.Events = append(f.Events, fmt.Sprintf("%s %s %s", eventtype, reason, message))
+}
+
+// Eventf records an event with a formatted message.
+func (f *FakeRecorder) Eventf(obj runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	f.Event(obj, eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+// GetEvents returns the recorded events and clears them.
+func (f *FakeRecorder) GetEvents() []string {
+	f.Lock()
+	defer f.Unlock()
+	events := f.Events
+	f.Events = nil
+	return events
+}
@@ -0,0 +1,98 @@
+/*
+Copyright (c) 2017 OpenStack Foundation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"testing"
+	"time"
+
+	crv1 "git.openstack.org/openstack/stackube/pkg/apis/v1"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRecorder(t *testing.T) {
+	network := &crv1.Network{
+		ObjectMeta: metav1.ObjectMeta{Name: "net", Namespace: "ns", UID: "net-uid"},
+	}
+	namespace := &apiv1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: "ns", UID: "ns-uid"},
+	}
+	service := &apiv1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: "ns", UID: "svc-uid"},
+	}
+
+	testCases := []struct {
+		name      string
+		obj       runtime.Object
+		objName   string
+		namespace string
+		kind      string
+		version   string
+	}{
+		{name: "network", obj: network, objName: "net", namespace: "ns", kind: "Network", version: "stackube.kubernetes.io/v1"},
+		{name: "namespace", obj: namespace, objName: "ns", namespace: metav1.NamespaceDefault, kind: "Namespace", version: "v1"},
+		{name: "service", obj: service, objName: "svc", namespace: "ns", kind: "Service", version: "v1"},
+	}
+
+	for _, tc := range testCases {
+		client := fake.NewSimpleClientset()
+		fakeClock := clock.NewFakeClock(time.Now())
+		recorder := NewRecorder(client, "stackube-controller")
+		recorder.clock = fakeClock
+
+		recorder.Event(tc.obj, apiv1.EventTypeWarning, "Failed", "something failed")
+		fakeClock.Step(time.Minute)
+		recorder.Eventf(tc.obj, apiv1.EventTypeWarning, "Failed", "something %s", "failed")
+		recorder.Event(tc.obj, apiv1.EventTypeNormal, "Created", "created")
+
+		list, err := client.CoreV1().Events(tc.namespace).List(metav1.ListOptions{})
+		if err != nil {
+			t.Fatalf("Case[%s]: unexpected error: %v", tc.name, err)
+		}
+		if len(list.Items) != 2 {
+			t.Fatalf("Case[%s]: expected 2 events, got %#v", tc.name, list.Items)
+		}
+		for _, event := range list.Items {
+			ref := event.InvolvedObject
+			if ref.Kind != tc.kind || ref.APIVersion != tc.version || ref.Name != tc.objName {
+				t.Errorf("Case[%s]: unexpected involved object %#v", tc.name, ref)
+			}
+			if event.Source.Component != "stackube-controller" {
+				t.Errorf("Case[%s]: unexpected source %#v", tc.name, event.Source)
+			}
+
+			expectedCount := int32(1)
+			if event.Reason == "Failed" {
+				expectedCount = 2
+				if event.Type != apiv1.EventTypeWarning || event.Message != "something failed" {
+					t.Errorf("Case[%s]: unexpected event %#v", tc.name, event)
+				}
+				if !event.LastTimestamp.After(event.FirstTimestamp.Time) {
+					t.Errorf("Case[%s]: expected last timestamp to be updated, got %#v", tc.name, event)
+				}
+			}
+			if event.Count != expectedCount {
+				t.Errorf("Case[%s]: expected count %d of event %s, got %d", tc.name, expectedCount, event.Reason, event.Count)
+			}
+		}
+	}
+}
@@ -0,0 +1,288 @@
+/*
+Copyright (c) 2017 OpenStack Foundation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package garbagecollector deletes the Neutron resources left behind by
+// partial failures of stackube, which are no longer owned by any Network,
+// Service or Pod.
+package garbagecollector
+
+import (
+	"fmt"
+	"time"
+
+	crdClient "git.openstack.org/openstack/stackube/pkg/kubecrd"
+	"git.openstack.org/openstack/stackube/pkg/metrics"
+	"git.openstack.org/openstack/stackube/pkg/openstack"
+	"git.openstack.org/openstack/stackube/pkg/util"
+
+	"github.com/golang/glog"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+var (
+	orphanedResources = metrics.NewGaugeVec("stackube_gc_orphaned_resources",
+		"Number of orphaned OpenStack resources found by the last garbage collection.", "kind")
+	deletedResources = metrics.NewCounterVec("stackube_gc_deleted_resources_total",
+		"Number of orphaned OpenStack resources deleted by the garbage collector.", "kind")
+	deleteErrors = metrics.NewCounterVec("stackube_gc_delete_errors_total",
+		"Number of failed deletions of orphaned OpenStack resources.", "kind")
+)
+
+func init() {
+	metrics.MustRegister(orphanedResources, deletedResources, deleteErrors)
+}
+
+// GarbageCollector periodically deletes the orphaned Neutron networks,
+// routers, ports, load balancers and floating IPs of the tenants.
+type GarbageCollector struct {
+	kubeClient      kubernetes.Interface
+	kubeCRDClient   crdClient.Interface
+	openstackClient openstack.Interface
+
+	// interval of collecting garbage.
+	interval time.Duration
+	// gracePeriod is how long a resource must stay orphaned before it is
+	// deleted, so that resources being created are not deleted.
+	gracePeriod time.Duration
+	// dryRun only reports the orphaned resources without deleting them.
+	dryRun bool
+
+	clock clock.Clock
+	// firstSeen is when the orphaned resources were first found, by their
+	// kind and ID.
+	firstSeen map[string]time.Time
+}
+
+// NewGarbageCollector creates a new garbage collector.
+func NewGarbageCollector(kubeClient kubernetes.Interface, osClient openstack.Interface,
+	interval, gracePeriod time.Duration, dryRun bool) (*GarbageCollector, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("invalid garbage collection interval %v", interval)
+	}
+	if gracePeriod < 0 {
+		return nil, fmt.Errorf("invalid garbage collection grace period %v", gracePeriod)
+	}
+
+	return &GarbageCollector{
+		kubeClient:      kubeClient,
+		kubeCRDClient:   osClient.GetCRDClient(),
+		openstackClient: osClient,
+		interval:        interval,
+		gracePeriod:     gracePeriod,
+		dryRun:          dryRun,
+		clock:           clock.RealClock{},
+		firstSeen:       make(map[string]time.Time),
+	}, nil
+}
+
+// Run the garbage collector.
+func (gc *GarbageCollector) Run(stopCh <-chan struct{}) error {
+	defer utilruntime.HandleCrash()
+
+	wait.Until(func() {
+		if err := gc.collect(); err != nil {
+			glog.Errorf("Collect orphaned OpenStack resources failed: %v", err)
+		}
+	}, gc.interval, stopCh)
+
+	return nil
+}
+
+// collect finds the orphaned resources of the tenants, and deletes the ones
+// which have been orphaned for longer than the grace period.
+func (gc *GarbageCollector) collect() error {
+	tenantList, err := gc.kubeCRDClient.ListTenants()
+	if err != nil {
+		return fmt.Errorf("failed to list tenants: %v", err)
+	}
+
+	// OpenStack resources are listed before the kubernetes objects, so that
+	// the resources created in between are owned by the objects listed.
+	resources := make(map[string][]openstack.Resource, len(openstack.ResourceKinds))
+	listed := make(map[string]bool)
+	for _, tenant := range tenantList.Items {
+		tenantID := tenant.Status.TenantID
+		if tenantID == "" {
+			tenantID = tenant.Spec.TenantID
+		}
+		if tenantID == "" || listed[tenantID] {
+			continue
+		}
+		listed[tenantID] = true
+
+		for _, kind := range openstack.ResourceKinds {
+			list, err := gc.openstackClient.ListResources(kind, tenantID)
+			if err != nil {
+				return fmt.Errorf("failed to list %ss of tenant %s: %v", kind, tenant.Name, err)
+			}
+			resources[kind] = append(resources[kind], list...)
+		}
+	}
+
+	owners, err := gc.listOwners()
+	if err != nil {
+		return err
+	}
+
+	now := gc.clock.Now()
+	seen := make(map[string]time.Time)
+	var errs []error
+	for _, kind := range openstack.ResourceKinds {
+		orphans := 0
+		for _, resource := range resources[kind] {
+			if !owners.isOrphan(resource) {
+				continue
+			}
+			orphans++
+
+			key := resource.Kind + "/" + resource.ID
+			firstSeen, ok := gc.firstSeen[key]
+			if !ok {
+				firstSeen = now
+			}
+			seen[key] = firstSeen
+			if now.Sub(firstSeen) < gc.gracePeriod {
+				glog.V(4).Infof("Found orphaned %s, deleting it after the grace period", describe(resource))
+				continue
+			}
+
+			if gc.dryRun {
+				glog.Infof("Found orphaned %s, not deleting it in dry run mode", describe(resource))
+				continue
+			}
+			glog.Infof("Deleting orphaned %s", describe(resource))
+			if err := gc.openstackClient.DeleteResource(resource); err != nil {
+				glog.Errorf("Delete orphaned %s failed: %v", describe(resource), err)
+				deleteErrors.WithLabelValues(kind).Inc()
+				errs = append(errs, err)
+				continue
+			}
+			deletedResources.WithLabelValues(kind).Inc()
+			delete(seen, key)
+		}
+		orphanedResources.WithLabelValues(kind).Set(float64(orphans))
+	}
+	gc.firstSeen = seen
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%d orphaned resources failed to delete: %v", len(errs), errs)
+	}
+	return nil
+}
+
+// owners are the names and addresses of the resources owned by kubernetes
+// objects.
+type owners struct {
+	// networks are the names of the networks and routers of Networks.
+	networks map[string]bool
+	// ports are the names of the ports of Pods.
+	ports map[string]bool
+	// loadBalancers are the names of the load balancers of Services.
+	loadBalancers map[string]bool
+	// floatingIPs are the external, requested and allocated IPs of
+	// Services.
+	floatingIPs map[string]bool
+}
+
+// listOwners lists the Networks, Pods and Services owning the resources.
+func (gc *GarbageCollector) listOwners() (*owners, error) {
+	o := &owners{
+		networks:      make(map[string]bool),
+		ports:         make(map[string]bool),
+		loadBalancers: make(map[string]bool),
+		floatingIPs:   make(map[string]bool),
+	}
+
+	networkList, err := gc.kubeCRDClient.ListNetworks()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list networks: %v", err)
+	}
+	for _, network := range networkList.Items {
+		o.networks[util.BuildNetworkName(network.Namespace, network.Name)] = true
+	}
+
+	podList, err := gc.kubeClient.CoreV1().Pods(metav1.NamespaceAll).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %v", err)
+	}
+	for _, pod := range podList.Items {
+		o.ports[util.BuildPortName(pod.Namespace, pod.Name)] = true
+	}
+
+	serviceList, err := gc.kubeClient.CoreV1().Services(metav1.NamespaceAll).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %v", err)
+	}
+	for _, service := range serviceList.Items {
+		if service.Spec.Type != apiv1.ServiceTypeLoadBalancer {
+			continue
+		}
+		o.loadBalancers[util.BuildLoadBalancerName(service.Namespace, service.Name)] = true
+		for _, ip := range service.Spec.ExternalIPs {
+			o.floatingIPs[ip] = true
+		}
+		if service.Spec.LoadBalancerIP != "" {
+			o.floatingIPs[service.Spec.LoadBalancerIP] = true
+		}
+		if ip := service.Annotations[util.AllocatedFloatingIPAnnotation]; ip != "" {
+			o.floatingIPs[ip] = true
+		}
+		for _, ingress := range service.Status.LoadBalancer.Ingress {
+			o.floatingIPs[ingress.IP] = true
+		}
+	}
+
+	return o, nil
+}
+
+// isOrphan returns true if resource is created by stackube and not owned by
+// any object.
+func (o *owners) isOrphan(resource openstack.Resource) bool {
+	switch resource.Kind {
+	case openstack.ResourceNetwork, openstack.ResourceRouter:
+		return isCreated(resource) && !o.networks[resource.Name]
+	case openstack.ResourcePort:
+		return isCreated(resource) && !o.ports[resource.Name]
+	case openstack.ResourceLoadBalancer:
+		return util.IsLoadBalancerName(resource.Name) && !o.loadBalancers[resource.Name]
+	case openstack.ResourceFloatingIP:
+		// Floating IPs have no names, the ones allocated by stackube are
+		// told by their description, and the ones of load balancers are
+		// associated with their VIP ports.
+		return resource.Description == openstack.FloatingIPDescription &&
+			resource.PortID == "" && !o.floatingIPs[resource.FloatingIP]
+	}
+	return false
+}
+
+// isCreated returns true if the network, router or port is created by
+// stackube, which marks them by their description.
+func isCreated(resource openstack.Resource) bool {
+	return resource.Description == openstack.ResourceDescription && util.IsNetworkOrPortName(resource.Name)
+}
+
+// describe returns a description of resource for logs.
+func describe(resource openstack.Resource) string {
+	if resource.Kind == openstack.ResourceFloatingIP {
+		return fmt.Sprintf("%s %s (%s) of tenant %s", resource.Kind, resource.FloatingIP, resource.ID, resource.TenantID)
+	}
+	return fmt.Sprintf("%s %s (%s) of tenant %s", resource.Kind, resource.Name, resource.ID, resource.TenantID)
+}
@@ -0,0 +1,222 @@
+/*
+Copyright (c) 2017 OpenStack Foundation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package garbagecollector
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	crv1 "git.openstack.org/openstack/stackube/pkg/apis/v1"
+	crdClient "git.openstack.org/openstack/stackube/pkg/kubecrd"
+	"git.openstack.org/openstack/stackube/pkg/openstack"
+	"git.openstack.org/openstack/stackube/pkg/util"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const tenantID = "tenant-id"
+
+func newGarbageCollector(dryRun bool) (*GarbageCollector, *openstack.FakeOSClient, *clock.FakeClock, error) {
+	kubeCRDClient, err := crdClient.NewFake()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	kubeCRDClient.SetTenants(
+		&crv1.Tenant{
+			ObjectMeta: metav1.ObjectMeta{Name: "team"},
+			Status:     crv1.TenantStatus{TenantID: tenantID},
+		},
+	)
+	kubeCRDClient.SetNetworks(
+		&crv1.Network{ObjectMeta: metav1.ObjectMeta{Name: "team", Namespace: "team"}},
+	)
+
+	kubeClient := fake.NewSimpleClientset(
+		&apiv1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "team"}},
+		&apiv1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: "team"},
+			Spec: apiv1.ServiceSpec{
+				Type:        apiv1.ServiceTypeLoadBalancer,
+				ExternalIPs: []string{"172.24.4.10"},
+			},
+		},
+		&apiv1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "requested", Namespace: "team"},
+			Spec: apiv1.ServiceSpec{
+				Type:           apiv1.ServiceTypeLoadBalancer,
+				LoadBalancerIP: "172.24.4.13",
+			},
+		},
+		&apiv1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "allocated",
+				Namespace:   "team",
+				Annotations: map[string]string{util.AllocatedFloatingIPAnnotation: "172.24.4.14"},
+			},
+			Spec: apiv1.ServiceSpec{Type: apiv1.ServiceTypeLoadBalancer},
+		},
+	)
+
+	osClient := openstack.NewFake(kubeCRDClient)
+	resources := []openstack.Resource{
+		{Kind: openstack.ResourceNetwork, ID: "net-1", Name: "kube-team-team", Description: openstack.ResourceDescription},
+		{Kind: openstack.ResourceNetwork, ID: "net-2", Name: "kube-team-old", Description: openstack.ResourceDescription},
+		{Kind: openstack.ResourceNetwork, ID: "net-3", Name: "user-network"},
+		{Kind: openstack.ResourceRouter, ID: "router-1", Name: "kube-team-team", Description: openstack.ResourceDescription},
+		{Kind: openstack.ResourceRouter, ID: "router-2", Name: "kube-team-old", Description: openstack.ResourceDescription},
+		{Kind: openstack.ResourcePort, ID: "port-1", Name: "kube-team-pod", Description: openstack.ResourceDescription},
+		{Kind: openstack.ResourcePort, ID: "port-2", Name: "kube-team-gone", Description: openstack.ResourceDescription},
+		{Kind: openstack.ResourcePort, ID: "port-3", Name: ""},
+		// Resources of users named like the ones of stackube are never
+		// collected.
+		{Kind: openstack.ResourceNetwork, ID: "net-4", Name: "kube-team-user"},
+		{Kind: openstack.ResourceRouter, ID: "router-3", Name: "kube-team-user"},
+		{Kind: openstack.ResourcePort, ID: "port-6", Name: "kube-team-user"},
+		{Kind: openstack.ResourceLoadBalancer, ID: "lb-1", Name: "stackube_team_svc"},
+		{Kind: openstack.ResourceLoadBalancer, ID: "lb-2", Name: "stackube_team_old"},
+		{Kind: openstack.ResourceFloatingIP, ID: "fip-1", FloatingIP: "172.24.4.10", Description: openstack.FloatingIPDescription},
+		{Kind: openstack.ResourceFloatingIP, ID: "fip-2", FloatingIP: "172.24.4.11", Description: openstack.FloatingIPDescription},
+		{Kind: openstack.ResourceFloatingIP, ID: "fip-3", FloatingIP: "172.24.4.12", PortID: "port-4",
+			Description: openstack.FloatingIPDescription},
+		// Unassociated floating IPs which stackube didn't allocate are
+		// never collected.
+		{Kind: openstack.ResourceFloatingIP, ID: "fip-4", FloatingIP: "172.24.4.15"},
+		{Kind: openstack.ResourceFloatingIP, ID: "fip-5", FloatingIP: "172.24.4.13", Description: openstack.FloatingIPDescription},
+		{Kind: openstack.ResourceFloatingIP, ID: "fip-6", FloatingIP: "172.24.4.14", Description: openstack.FloatingIPDescription},
+	}
+	for _, resource := range resources {
+		resource.TenantID = tenantID
+		osClient.SetResource(resource)
+	}
+	// Resources of other tenants are never collected.
+	osClient.SetResource(openstack.Resource{Kind: openstack.ResourcePort, ID: "port-5",
+		Name: "kube-other-pod", TenantID: "other-id", Description: openstack.ResourceDescription})
+
+	gc, err := NewGarbageCollector(kubeClient, osClient, time.Minute, 10*time.Minute, dryRun)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	fakeClock := clock.NewFakeClock(time.Now())
+	gc.clock = fakeClock
+	return gc, osClient, fakeClock, nil
+}
+
+func remainingResources(osClient *openstack.FakeOSClient) []string {
+	var ids []string
+	for _, resource := range osClient.Resources {
+		ids = append(ids, resource.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestNewGarbageCollectorInvalid(t *testing.T) {
+	kubeCRDClient, err := crdClient.NewFake()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	osClient := openstack.NewFake(kubeCRDClient)
+	kubeClient := fake.NewSimpleClientset()
+
+	if _, err := NewGarbageCollector(kubeClient, osClient, 0, time.Minute, false); err == nil {
+		t.Errorf("Expected error for invalid interval")
+	}
+	if _, err := NewGarbageCollector(kubeClient, osClient, time.Minute, -time.Minute, false); err == nil {
+		t.Errorf("Expected error for invalid grace period")
+	}
+}
+
+func TestCollect(t *testing.T) {
+	all := []string{"fip-1", "fip-2", "fip-3", "fip-4", "fip-5", "fip-6", "lb-1", "lb-2", "net-1", "net-2", "net-3",
+		"net-4", "port-1", "port-2", "port-3", "port-5", "port-6", "router-1", "router-2", "router-3"}
+	owned := []string{"fip-1", "fip-3", "fip-4", "fip-5", "fip-6", "lb-1", "net-1", "net-3", "net-4",
+		"port-1", "port-3", "port-5", "port-6", "router-1", "router-3"}
+
+	testCases := []struct {
+		name      string
+		dryRun    bool
+		steps     []time.Duration
+		remaining []string
+	}{
+		{
+			name:      "within grace period",
+			steps:     []time.Duration{0, 5 * time.Minute},
+			remaining: all,
+		},
+		{
+			name:      "after grace period",
+			steps:     []time.Duration{0, 10 * time.Minute},
+			remaining: owned,
+		},
+		{
+			name:      "dry run",
+			dryRun:    true,
+			steps:     []time.Duration{0, 10 * time.Minute},
+			remaining: all,
+		},
+	}
+
+	for _, tc := range testCases {
+		gc, osClient, fakeClock, err := newGarbageCollector(tc.dryRun)
+		if err != nil {
+			t.Fatalf("Case[%s]: unexpected error: %v", tc.name, err)
+		}
+
+		for _, step := range tc.steps {
+			fakeClock.Step(step)
+			if err := gc.collect(); err != nil {
+				t.Errorf("Case[%s]: unexpected error: %v", tc.name, err)
+			}
+		}
+
+		remaining := remainingResources(osClient)
+		if !reflect.DeepEqual(remaining, tc.remaining) {
+			t.Errorf("Case[%s]: expected remaining resources %v, got %v", tc.name, tc.remaining, remaining)
+		}
+	}
+}
+
+func TestCollectDeleteError(t *testing.T) {
+	gc, osClient, fakeClock, err := newGarbageCollector(false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := gc.collect(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	fakeClock.Step(10 * time.Minute)
+	osClient.InjectError("DeleteResource", fmt.Errorf("delete failed"))
+	if err := gc.collect(); err == nil {
+		t.Errorf("Expected error for failed deletion")
+	}
+
+	// The failed resource is deleted by the next collection without
+	// waiting for another grace period.
+	if err := gc.collect(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(osClient.Resources) != 15 {
+		t.Errorf("Expected orphaned resources to be deleted, got %v", remainingResources(osClient))
+	}
+}
@@ -38,12 +38,18 @@ type Interface interface {
 	GetTenant(tenantName string) (*crv1.Tenant, error)
 	// UpdateTenant updates Tenant CRD object by given object.
 	UpdateTenant(tenant *crv1.Tenant) error
+	// ListTenants returns all Tenant CRD objects.
+	ListTenants() (*crv1.TenantList, error)
+	// DeleteTenant deletes Tenant CRD object by tenantName.
+	DeleteTenant(tenantName string) error
 	// AddNetwork adds Network CRD object by given object.
 	AddNetwork(network *crv1.Network) error
 	// UpdateNetwork updates Network CRD object by given object.
 	UpdateNetwork(network *crv1.Network) error
 	// DeleteNetwork deletes Network CRD object by networkName.
 	DeleteNetwork(networkName string) error
+	// ListNetworks returns the Network CRD objects in all namespaces.
+	ListNetworks() (*crv1.NetworkList, error)
 	// Client returns the RESTClient.
 	Client() *rest.RESTClient
 	// Scheme returns runtime scheme.
@@ -90,7 +96,8 @@ func (c *CRDClient) Scheme() *runtime.Scheme {
 	return c.scheme
 }
 
-// UpdateNetwork updates Network CRD object by given object.
+// UpdateNetwork updates Network CRD object by given object. The object is
+// refreshed with the result, so that it can be updated again.
 func (c *CRDClient) UpdateNetwork(network *crv1.Network) error {
 	err := c.client.Put().
 		Name(network.Name).
@@ -98,7 +105,7 @@ func (c *CRDClient) UpdateNetwork(network *crv1.Network) error {
 		Resource(crv1.NetworkResourcePlural).
 		Body(network).
 		Do().
-		Error()
+		Into(network)
 
 	if err != nil {
 		glog.Errorf("ERROR updating network: %v\n", err)
@@ -108,7 +115,8 @@ func (c *CRDClient) UpdateNetwork(network *crv1.Network) error {
 	return nil
 }
 
-// UpdateTenant updates Network CRD object by given object.
+// UpdateTenant updates Tenant CRD object by given object. The object is
+// refreshed with the result, so that it can be updated again.
 func (c *CRDClient) UpdateTenant(tenant *crv1.Tenant) error {
 	err := c.client.Put().
 		Name(tenant.Name).
@@ -116,7 +124,7 @@ func (c *CRDClient) UpdateTenant(tenant *crv1.Tenant) error {
 		Resource(crv1.TenantResourcePlural).
 		Body(tenant).
 		Do().
-		Error()
+		Into(tenant)
 
 	if err != nil {
 		glog.Errorf("ERROR updating tenant: %v\n", err)
@@ -142,6 +150,34 @@ func (c *CRDClient) GetTenant(tenantName string) (*crv1.Tenant, error) {
 	return &tenant, nil
 }
 
+// ListTenants returns all Tenant CRD objects.
+// NOTE: all tenant are stored under system namespace.
+func (c *CRDClient) ListTenants() (*crv1.TenantList, error) {
+	tenants := crv1.TenantList{}
+	err := c.client.Get().
+		Resource(crv1.TenantResourcePlural).
+		Namespace(util.SystemTenant).
+		Do().Into(&tenants)
+	if err != nil {
+		return nil, err
+	}
+	return &tenants, nil
+}
+
+// DeleteTenant deletes Tenant CRD object by tenantName. It is not an error
+// if the tenant has already been deleted.
+func (c *CRDClient) DeleteTenant(tenantName string) error {
+	err := c.client.Delete().
+		Resource(crv1.TenantResourcePlural).
+		Namespace(util.SystemTenant).
+		Name(tenantName).
+		Do().Error()
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete Tenant: %v", err)
+	}
+	return nil
+}
+
 // AddTenant adds Tenant CRD object by given object.
 // NOTE: all tenant are added to system namespace.
 func (c *CRDClient) AddTenant(tenant *crv1.Tenant) error {
@@ -169,7 +205,8 @@ func (c *CRDClient) AddNetwork(network *crv1.Network) error {
 	return nil
 }
 
-// DeleteNetwork deletes Network CRD object by networkName.
+// DeleteNetwork deletes Network CRD object by networkName. It is not an
+// error if the network has already been deleted.
 // NOTE: the automatically created network for tenant use namespace as name.
 func (c *CRDClient) DeleteNetwork(networkName string) error {
 	err := c.client.Delete().
@@ -177,8 +214,20 @@ func (c *CRDClient) DeleteNetwork(networkName string) error {
 		Namespace(networkName).
 		Name(networkName).
 		Do().Error()
-	if err != nil {
+	if err != nil && !apierrors.IsNotFound(err) {
 		return fmt.Errorf("failed to delete Network: %v", err)
 	}
 	return nil
 }
+
+// ListNetworks returns the Network CRD objects in all namespaces.
+func (c *CRDClient) ListNetworks() (*crv1.NetworkList, error) {
+	networks := crv1.NetworkList{}
+	err := c.client.Get().
+		Resource(crv1.NetworkResourcePlural).
+		Do().Into(&networks)
+	if err != nil {
+		return nil, err
+	}
+	return &networks, nil
+}
@@ -21,6 +21,7 @@ import (
 	"sync"
 
 	crv1 "git.openstack.org/openstack/stackube/pkg/apis/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/rest"
 )
@@ -173,7 +174,7 @@ func (f *FakeCRDClient) GetTenant(tenantName string) (*crv1.Tenant, error) {
 
 	tenant, ok := f.Tenants[tenantName]
 	if !ok {
-		return nil, fmt.Errorf("Tenant %s not found", tenantName)
+		return nil, apierrors.NewNotFound(crv1.SchemeGroupVersion.WithResource(crv1.TenantResourcePlural).GroupResource(), tenantName)
 	}
 
 	return tenant, nil
@@ -227,6 +228,22 @@ func (f *FakeCRDClient) UpdateTenant(tenant *crv1.Tenant) error {
 	return nil
 }
 
+// ListTenants is a test implementation of Interface.ListTenants.
+func (f *FakeCRDClient) ListTenants() (*crv1.TenantList, error) {
+	f.Lock()
+	defer f.Unlock()
+	f.appendCalled("ListTenants", nil)
+	if err := f.getError("ListTenants"); err != nil {
+		return nil, err
+	}
+
+	list := &crv1.TenantList{}
+	for _, tenant := range f.Tenants {
+		list.Items = append(list.Items, *tenant)
+	}
+	return list, nil
+}
+
 // UpdateNetwork is a test implementation of Interface.UpdateNetwork.
 func (f *FakeCRDClient) UpdateNetwork(network *crv1.Network) error {
 	f.Lock()
@@ -257,3 +274,19 @@ func (f *FakeCRDClient) DeleteNetwork(networkName string) error {
 
 	return nil
 }
+
+// ListNetworks is a test implementation of Interface.ListNetworks.
+func (f *FakeCRDClient) ListNetworks() (*crv1.NetworkList, error) {
+	f.Lock()
+	defer f.Unlock()
+	f.appendCalled("ListNetworks", nil)
+	if err := f.getError("ListNetworks"); err != nil {
+		return nil, err
+	}
+
+	list := &crv1.NetworkList{}
+	for _, network := range f.Networks {
+		list.Items = append(list.Items, *network)
+	}
+	return list, nil
+}
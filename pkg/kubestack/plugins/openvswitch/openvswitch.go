@@ -22,6 +22,7 @@ import (
 
 	"git.openstack.org/openstack/stackube/pkg/kubestack/plugins"
 	"git.openstack.org/openstack/stackube/pkg/util"
+	"github.com/containernetworking/cni/pkg/types"
 	"github.com/containernetworking/cni/pkg/types/current"
 	"github.com/golang/glog"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
@@ -70,7 +71,7 @@ func (p *OVSPlugin) buildVethName(portID string) (string, string) {
 	return ("qvb" + portID)[:14], ("qvo" + portID)[:14]
 }
 
-func (p *OVSPlugin) SetupSandboxInterface(podName, podInfraContainerID string, port *ports.Port, ipcidr, gateway, ifName, netns string) (*current.Interface, error) {
+func (p *OVSPlugin) SetupSandboxInterface(podName, podInfraContainerID string, port *ports.Port, ips []*current.IPConfig, routes []*types.Route, ifName, netns string) (*current.Interface, error) {
 	vibName, vifName := p.buildSandboxInterfaceName(port.ID)
 	ret, err := util.RunCommand("ip", "link", "add", vibName, "type", "veth", "peer", "name", vifName)
 	if err != nil {
@@ -122,18 +123,38 @@ func (p *OVSPlugin) SetupSandboxInterface(podName, podInfraContainerID string, p
 		return nil, err
 	}
 
-	ret, err = util.RunCommand("ip", "netns", "exec", netns, "ip", "addr", "add", "dev", ifName, ipcidr)
-	if err != nil {
-		glog.Warningf("SetupInterface failed, ret:%s, error:%v", strings.Join(ret, "\n"), err)
-		p.DestroyInterface(podName, podInfraContainerID, port)
-		return nil, err
+	for _, ip := range ips {
+		ipcidr := ip.Address.String()
+		ret, err = util.RunCommand("ip", "netns", "exec", netns, "ip", "addr", "add", "dev", ifName, ipcidr)
+		if err != nil {
+			glog.Warningf("SetupInterface failed, ret:%s, error:%v", strings.Join(ret, "\n"), err)
+			p.DestroyInterface(podName, podInfraContainerID, port)
+			return nil, err
+		}
 	}
 
-	ret, err = util.RunCommand("ip", "netns", "exec", netns, "ip", "route", "add", "default", "via", gateway)
-	if err != nil {
-		glog.Warningf("SetupInterface failed, ret:%s, error:%v", strings.Join(ret, "\n"), err)
-		p.DestroyInterface(podName, podInfraContainerID, port)
-		return nil, err
+	// Default routes go via the first gateway of each IP version.
+	defaultRoutes := make(map[string]bool)
+	for _, ip := range ips {
+		if ip.Gateway == nil || defaultRoutes[ip.Version] {
+			continue
+		}
+		ret, err = util.RunCommand("ip", "netns", "exec", netns, "ip", "-"+ip.Version, "route", "add", "default", "via", ip.Gateway.String())
+		if err != nil {
+			glog.Warningf("SetupInterface failed, ret:%s, error:%v", strings.Join(ret, "\n"), err)
+			p.DestroyInterface(podName, podInfraContainerID, port)
+			return nil, err
+		}
+		defaultRoutes[ip.Version] = true
+	}
+
+	for _, route := range routes {
+		ret, err = util.RunCommand("ip", "netns", "exec", netns, "ip", "route", "add", route.Dst.String(), "via", route.GW.String())
+		if err != nil {
+			glog.Warningf("SetupInterface failed, ret:%s, error:%v", strings.Join(ret, "\n"), err)
+			p.DestroyInterface(podName, podInfraContainerID, port)
+			return nil, err
+		}
 	}
 
 	ret, err = util.RunCommand("ip", "link", "set", "dev", vibName, "up")
@@ -225,14 +246,14 @@ func (p *OVSPlugin) SetupOVSInterface(podName, podInfraContainerID string, port
 	}, nil
 }
 
-func (p *OVSPlugin) SetupInterface(podName, podInfraContainerID string, port *ports.Port, ipcidr, gateway, ifName, netns string) (*current.Interface, *current.Interface, error) {
+func (p *OVSPlugin) SetupInterface(podName, podInfraContainerID string, port *ports.Port, ips []*current.IPConfig, routes []*types.Route, ifName, netns string) (*current.Interface, *current.Interface, error) {
 	brInterface, err := p.SetupOVSInterface(podName, podInfraContainerID, port)
 	if err != nil {
 		glog.Errorf("SetupOVSInterface failed: %v", err)
 		return nil, nil, err
 	}
 
-	conInterface, err := p.SetupSandboxInterface(podName, podInfraContainerID, port, ipcidr, gateway, ifName, netns)
+	conInterface, err := p.SetupSandboxInterface(podName, podInfraContainerID, port, ips, routes, ifName, netns)
 	if err != nil {
 		glog.Errorf("SetupSandboxInterface failed: %v", err)
 		return nil, nil, err
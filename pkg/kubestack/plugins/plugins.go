@@ -20,13 +20,14 @@ import (
 	"fmt"
 	"sync"
 
+	"github.com/containernetworking/cni/pkg/types"
 	"github.com/containernetworking/cni/pkg/types/current"
 	"github.com/golang/glog"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
 )
 
 type PluginInterface interface {
-	SetupInterface(podName, podInfraContainerID string, port *ports.Port, ipcidr, gateway, ifName, netns string) (*current.Interface, *current.Interface, error)
+	SetupInterface(podName, podInfraContainerID string, port *ports.Port, ips []*current.IPConfig, routes []*types.Route, ifName, netns string) (*current.Interface, *current.Interface, error)
 	DestroyInterface(podName, podInfraContainerID string, port *ports.Port) error
 	Init(integrationBridge string) error
 }
@@ -0,0 +1,310 @@
+/*
+Copyright (c) 2017 OpenStack Foundation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package leaderelection implements leader election of stackube components
+// on top of a ConfigMap lock, which is compatible with the ConfigMap lock of
+// Kubernetes components.
+package leaderelection
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// LeaderAnnotation is the annotation of the lock ConfigMap which holds
+	// the LeaderElectionRecord.
+	LeaderAnnotation = "control-plane.alpha.kubernetes.io/leader"
+)
+
+// LeaderElectionRecord is the record of the current leader stored in the
+// lock ConfigMap.
+type LeaderElectionRecord struct {
+	HolderIdentity       string      `json:"holderIdentity"`
+	LeaseDurationSeconds int         `json:"leaseDurationSeconds"`
+	AcquireTime          metav1.Time `json:"acquireTime"`
+	RenewTime            metav1.Time `json:"renewTime"`
+	LeaderTransitions    int         `json:"leaderTransitions"`
+}
+
+// Config is the configuration of a LeaderElector.
+type Config struct {
+	// Client is used to read and write the lock ConfigMap.
+	Client kubernetes.Interface
+	// Namespace and Name of the lock ConfigMap.
+	Namespace string
+	Name      string
+	// Identity of this candidate, it must be unique among the candidates.
+	Identity string
+
+	// LeaseDuration is how long the standbys wait before they take over
+	// a leader which stopped renewing.
+	LeaseDuration time.Duration
+	// RenewDeadline is how long the leader retries renewing before it
+	// gives up the leadership.
+	RenewDeadline time.Duration
+	// RetryPeriod is the interval between two tries to acquire or renew.
+	RetryPeriod time.Duration
+}
+
+// LeaderElector runs a function only while it holds the lock.
+type LeaderElector struct {
+	config Config
+	clock  clock.Clock
+	// fatalf exits the process once the leadership is lost.
+	fatalf func(format string, args ...interface{})
+
+	// The last record observed in the lock, and when it was observed. The
+	// lease of other candidates is measured by the local clock from
+	// observedTime, so that clock skew between hosts doesn't matter.
+	observedRecord LeaderElectionRecord
+	observedTime   time.Time
+}
+
+// NewLeaderElector creates a new LeaderElector.
+func NewLeaderElector(config Config) (*LeaderElector, error) {
+	if config.Client == nil {
+		return nil, fmt.Errorf("client must be set")
+	}
+	if config.Namespace == "" || config.Name == "" {
+		return nil, fmt.Errorf("namespace and name of the lock must be set")
+	}
+	if config.Identity == "" {
+		return nil, fmt.Errorf("identity must be set")
+	}
+	if config.RetryPeriod <= 0 {
+		return nil, fmt.Errorf("retry period must be greater than zero")
+	}
+	if config.RenewDeadline <= config.RetryPeriod {
+		return nil, fmt.Errorf("renew deadline must be greater than retry period")
+	}
+	if config.LeaseDuration <= config.RenewDeadline {
+		return nil, fmt.Errorf("lease duration must be greater than renew deadline")
+	}
+
+	return &LeaderElector{
+		config: config,
+		clock:  clock.RealClock{},
+		fatalf: glog.Fatalf,
+	}, nil
+}
+
+// Run waits until the lock is acquired, then runs run with a stop channel
+// which is closed once stopCh is closed, and returns after run has returned.
+// The lock is released when run returns, so that a standby takes over
+// immediately. The process exits as soon as the leadership is lost, without
+// waiting for run, since a standby may already be leading.
+func (le *LeaderElector) Run(stopCh <-chan struct{}, run func(stopCh <-chan struct{}) error) error {
+	defer utilruntime.HandleCrash()
+
+	if !le.acquire(stopCh) {
+		return nil
+	}
+	glog.Infof("Became leader %s of %s/%s", le.config.Identity, le.config.Namespace, le.config.Name)
+
+	leadingCh := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- run(leadingCh)
+	}()
+
+	ticker := time.NewTicker(le.config.RetryPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-done:
+			close(leadingCh)
+			le.release()
+			return err
+		case <-stopCh:
+			close(leadingCh)
+			err := <-done
+			le.release()
+			return err
+		case <-ticker.C:
+		}
+
+		if !le.renew() {
+			le.fatalf("Lost leader lease %s/%s", le.config.Namespace, le.config.Name)
+			return fmt.Errorf("lost leader lease %s/%s", le.config.Namespace, le.config.Name)
+		}
+	}
+}
+
+// acquire tries to acquire the lock every RetryPeriod until it succeeds or
+// stopCh is closed. It returns false if stopCh is closed.
+func (le *LeaderElector) acquire(stopCh <-chan struct{}) bool {
+	glog.Infof("Attempting to acquire leader lease %s/%s", le.config.Namespace, le.config.Name)
+	for {
+		if le.tryAcquireOrRenew() {
+			return true
+		}
+		glog.V(4).Infof("Leader lease %s/%s is held by %s", le.config.Namespace, le.config.Name,
+			le.observedRecord.HolderIdentity)
+
+		select {
+		case <-stopCh:
+			return false
+		case <-le.clock.After(wait.Jitter(le.config.RetryPeriod, 1.2)):
+		}
+	}
+}
+
+// renew retries renewing the lock until it succeeds or RenewDeadline is
+// reached. It returns false if the lock isn't renewed.
+func (le *LeaderElector) renew() bool {
+	err := wait.PollImmediate(le.config.RetryPeriod/2, le.config.RenewDeadline, func() (bool, error) {
+		return le.tryAcquireOrRenew(), nil
+	})
+	if err != nil {
+		glog.Errorf("Failed to renew leader lease %s/%s: %v", le.config.Namespace, le.config.Name, err)
+		return false
+	}
+	return true
+}
+
+// tryAcquireOrRenew acquires the lock if it's free or its lease has expired,
+// or renews it if it's already held by us. It returns true on success.
+func (le *LeaderElector) tryAcquireOrRenew() bool {
+	now := metav1.NewTime(le.clock.Now())
+	record := LeaderElectionRecord{
+		HolderIdentity:       le.config.Identity,
+		LeaseDurationSeconds: int(le.config.LeaseDuration / time.Second),
+		AcquireTime:          now,
+		RenewTime:            now,
+	}
+
+	configMaps := le.config.Client.CoreV1().ConfigMaps(le.config.Namespace)
+	cm, err := configMaps.Get(le.config.Name, metav1.GetOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			glog.Errorf("Failed to get leader lease %s/%s: %v", le.config.Namespace, le.config.Name, err)
+			return false
+		}
+		cm = &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: le.config.Namespace,
+				Name:      le.config.Name,
+			},
+		}
+		if err := setRecord(cm, &record); err != nil {
+			glog.Errorf("Failed to encode leader lease %s/%s: %v", le.config.Namespace, le.config.Name, err)
+			return false
+		}
+		if _, err := configMaps.Create(cm); err != nil {
+			glog.Errorf("Failed to create leader lease %s/%s: %v", le.config.Namespace, le.config.Name, err)
+			return false
+		}
+		le.observe(record)
+		return true
+	}
+
+	oldRecord, err := getRecord(cm)
+	if err != nil {
+		glog.Errorf("Failed to decode leader lease %s/%s: %v", le.config.Namespace, le.config.Name, err)
+		return false
+	}
+	if *oldRecord != le.observedRecord {
+		le.observe(*oldRecord)
+	}
+	if oldRecord.HolderIdentity != "" && oldRecord.HolderIdentity != le.config.Identity &&
+		le.observedTime.Add(time.Duration(oldRecord.LeaseDurationSeconds)*time.Second).After(now.Time) {
+		return false
+	}
+
+	if oldRecord.HolderIdentity == le.config.Identity {
+		record.AcquireTime = oldRecord.AcquireTime
+		record.LeaderTransitions = oldRecord.LeaderTransitions
+	} else {
+		record.LeaderTransitions = oldRecord.LeaderTransitions + 1
+	}
+	if err := setRecord(cm, &record); err != nil {
+		glog.Errorf("Failed to encode leader lease %s/%s: %v", le.config.Namespace, le.config.Name, err)
+		return false
+	}
+	// The update fails with a conflict if another candidate has updated the
+	// lock since we got it.
+	if _, err := configMaps.Update(cm); err != nil {
+		glog.Errorf("Failed to update leader lease %s/%s: %v", le.config.Namespace, le.config.Name, err)
+		return false
+	}
+	le.observe(record)
+	return true
+}
+
+// release gives up the lock if it's held by us.
+func (le *LeaderElector) release() {
+	configMaps := le.config.Client.CoreV1().ConfigMaps(le.config.Namespace)
+	cm, err := configMaps.Get(le.config.Name, metav1.GetOptions{})
+	if err != nil {
+		glog.Errorf("Failed to get leader lease %s/%s: %v", le.config.Namespace, le.config.Name, err)
+		return
+	}
+	record, err := getRecord(cm)
+	if err != nil || record.HolderIdentity != le.config.Identity {
+		return
+	}
+
+	record.HolderIdentity = ""
+	if err := setRecord(cm, record); err != nil {
+		return
+	}
+	if _, err := configMaps.Update(cm); err != nil {
+		glog.Errorf("Failed to release leader lease %s/%s: %v", le.config.Namespace, le.config.Name, err)
+		return
+	}
+	glog.Infof("Released leader lease %s/%s", le.config.Namespace, le.config.Name)
+}
+
+func (le *LeaderElector) observe(record LeaderElectionRecord) {
+	le.observedRecord = record
+	le.observedTime = le.clock.Now()
+}
+
+// getRecord decodes the LeaderElectionRecord of the lock ConfigMap cm. A
+// ConfigMap without the record is free.
+func getRecord(cm *v1.ConfigMap) (*LeaderElectionRecord, error) {
+	record := &LeaderElectionRecord{}
+	if data, ok := cm.Annotations[LeaderAnnotation]; ok {
+		if err := json.Unmarshal([]byte(data), record); err != nil {
+			return nil, err
+		}
+	}
+	return record, nil
+}
+
+// setRecord encodes record into the lock ConfigMap cm.
+func setRecord(cm *v1.ConfigMap, record *LeaderElectionRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if cm.Annotations == nil {
+		cm.Annotations = make(map[string]string)
+	}
+	cm.Annotations[LeaderAnnotation] = string(data)
+	return nil
+}
@@ -0,0 +1,246 @@
+/*
+Copyright (c) 2017 OpenStack Foundation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package leaderelection
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const (
+	lockNamespace = "kube-system"
+	lockName      = "stackube-controller"
+
+	// How long the tests wait for the electors.
+	waitTimeout = 5 * time.Second
+)
+
+func newLeaderElector(t *testing.T, client kubernetes.Interface, identity string, fakeClock clock.Clock) *LeaderElector {
+	le, err := NewLeaderElector(Config{
+		Client:        client,
+		Namespace:     lockNamespace,
+		Name:          lockName,
+		Identity:      identity,
+		LeaseDuration: 15 * time.Second,
+		RenewDeadline: 100 * time.Millisecond,
+		RetryPeriod:   10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	le.clock = fakeClock
+	return le
+}
+
+func getHolder(t *testing.T, client kubernetes.Interface) *LeaderElectionRecord {
+	cm, err := client.CoreV1().ConfigMaps(lockNamespace).Get(lockName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	record, err := getRecord(cm)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return record
+}
+
+func TestNewLeaderElectorInvalid(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	valid := Config{
+		Client:        client,
+		Namespace:     lockNamespace,
+		Name:          lockName,
+		Identity:      "a",
+		LeaseDuration: 15 * time.Second,
+		RenewDeadline: 10 * time.Second,
+		RetryPeriod:   2 * time.Second,
+	}
+
+	testCases := []struct {
+		name   string
+		modify func(*Config)
+	}{
+		{name: "no identity", modify: func(c *Config) { c.Identity = "" }},
+		{name: "no name", modify: func(c *Config) { c.Name = "" }},
+		{name: "renew deadline too long", modify: func(c *Config) { c.RenewDeadline = c.LeaseDuration }},
+		{name: "retry period too long", modify: func(c *Config) { c.RetryPeriod = c.RenewDeadline }},
+	}
+
+	if _, err := NewLeaderElector(valid); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, tc := range testCases {
+		config := valid
+		tc.modify(&config)
+		if _, err := NewLeaderElector(config); err == nil {
+			t.Errorf("Case[%s]: expected error", tc.name)
+		}
+	}
+}
+
+func TestTryAcquireOrRenew(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	fakeClock := clock.NewFakeClock(time.Now())
+	a := newLeaderElector(t, client, "a", fakeClock)
+	b := newLeaderElector(t, client, "b", fakeClock)
+
+	if !a.tryAcquireOrRenew() {
+		t.Fatalf("Expected a to acquire the free lock")
+	}
+	if record := getHolder(t, client); record.HolderIdentity != "a" || record.LeaderTransitions != 0 {
+		t.Errorf("Expected lock held by a, got %#v", record)
+	}
+
+	// The lease of a hasn't expired.
+	if b.tryAcquireOrRenew() {
+		t.Errorf("Expected b not to acquire the lock held by a")
+	}
+	fakeClock.Step(10 * time.Second)
+	if !a.tryAcquireOrRenew() {
+		t.Errorf("Expected a to renew the lock")
+	}
+	fakeClock.Step(10 * time.Second)
+	if b.tryAcquireOrRenew() {
+		t.Errorf("Expected b not to acquire the renewed lock")
+	}
+
+	// a stops renewing and its lease expires.
+	fakeClock.Step(16 * time.Second)
+	if !b.tryAcquireOrRenew() {
+		t.Fatalf("Expected b to acquire the expired lock")
+	}
+	if record := getHolder(t, client); record.HolderIdentity != "b" || record.LeaderTransitions != 1 {
+		t.Errorf("Expected lock held by b, got %#v", record)
+	}
+	if a.tryAcquireOrRenew() {
+		t.Errorf("Expected a not to renew the lock held by b")
+	}
+
+	// A released lock is acquired at once.
+	b.release()
+	if !a.tryAcquireOrRenew() {
+		t.Errorf("Expected a to acquire the released lock")
+	}
+}
+
+func TestRun(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	fakeClock := clock.NewFakeClock(time.Now())
+	le := newLeaderElector(t, client, "a", fakeClock)
+
+	stopCh := make(chan struct{})
+	started := make(chan struct{})
+	stopped := make(chan struct{})
+	errCh := make(chan error)
+	go func() {
+		errCh <- le.Run(stopCh, func(leadingCh <-chan struct{}) error {
+			close(started)
+			<-leadingCh
+			close(stopped)
+			return nil
+		})
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(waitTimeout):
+		t.Fatalf("Expected run to be started")
+	}
+	if record := getHolder(t, client); record.HolderIdentity != "a" {
+		t.Errorf("Expected lock held by a, got %#v", record)
+	}
+
+	close(stopCh)
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	case <-time.After(waitTimeout):
+		t.Fatalf("Expected Run to return")
+	}
+	select {
+	case <-stopped:
+	default:
+		t.Errorf("Expected run to be stopped")
+	}
+	if record := getHolder(t, client); record.HolderIdentity != "" {
+		t.Errorf("Expected lock released, got %#v", record)
+	}
+}
+
+func TestRunLostLease(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	fakeClock := clock.NewFakeClock(time.Now())
+	a := newLeaderElector(t, client, "a", fakeClock)
+
+	var fatal string
+	a.fatalf = func(format string, args ...interface{}) {
+		fatal = fmt.Sprintf(format, args...)
+	}
+	errCh := make(chan error)
+	blockCh := make(chan struct{})
+	defer close(blockCh)
+	go func() {
+		// run never returns, the lost lease must not wait for it.
+		errCh <- a.Run(make(chan struct{}), func(leadingCh <-chan struct{}) error {
+			<-blockCh
+			return nil
+		})
+	}()
+
+	deadline := time.After(waitTimeout)
+	for {
+		cm, err := client.CoreV1().ConfigMaps(lockNamespace).Get(lockName, metav1.GetOptions{})
+		if err == nil {
+			if record, _ := getRecord(cm); record.HolderIdentity == "a" {
+				break
+			}
+		}
+		select {
+		case <-deadline:
+			t.Fatalf("Expected a to acquire the lock")
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	// b takes over the lock as if a had been partitioned for longer than
+	// its lease.
+	cm, err := client.CoreV1().ConfigMaps(lockNamespace).Get(lockName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	setRecord(cm, &LeaderElectionRecord{HolderIdentity: "b", LeaseDurationSeconds: 15})
+	if _, err := client.CoreV1().ConfigMaps(lockNamespace).Update(cm); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	select {
+	case err := <-errCh:
+		if err == nil || fatal == "" {
+			t.Errorf("Expected fatal error for lost lease, got %q: %v", fatal, err)
+		}
+	case <-time.After(waitTimeout):
+		t.Fatalf("Expected Run to return")
+	}
+}
@@ -0,0 +1,91 @@
+/*
+Copyright (c) 2017 OpenStack Foundation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"time"
+
+	"k8s.io/client-go/util/workqueue"
+)
+
+var (
+	reconcileTotal = NewCounterVec("stackube_controller_reconcile_total",
+		"Number of reconciles by controller and result.", "controller", "result")
+	reconcileDuration = NewHistogramVec("stackube_controller_reconcile_duration_seconds",
+		"Duration of reconciles by controller.", DefBuckets, "controller")
+
+	workqueueDepth = NewGaugeVec("stackube_workqueue_depth",
+		"Current depth of work queues.", "name")
+	workqueueAdds = NewCounterVec("stackube_workqueue_adds_total",
+		"Number of adds handled by work queues.", "name")
+	workqueueLatency = NewHistogramVec("stackube_workqueue_queue_duration_seconds",
+		"How long items stay in work queues before being processed.", DefBuckets, "name")
+	workqueueWorkDuration = NewHistogramVec("stackube_workqueue_work_duration_seconds",
+		"How long processing items from work queues takes.", DefBuckets, "name")
+	workqueueRetries = NewCounterVec("stackube_workqueue_retries_total",
+		"Number of retries handled by work queues.", "name")
+)
+
+func init() {
+	MustRegister(reconcileTotal, reconcileDuration)
+	MustRegister(workqueueDepth, workqueueAdds, workqueueLatency, workqueueWorkDuration, workqueueRetries)
+	workqueue.SetProvider(workqueueMetricsProvider{})
+}
+
+// ObserveReconcile records a reconcile of controller, which started at
+// start and returned err.
+func ObserveReconcile(controller string, start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	reconcileTotal.WithLabelValues(controller, result).Inc()
+	reconcileDuration.WithLabelValues(controller).Observe(time.Since(start).Seconds())
+}
+
+// workqueueMetricsProvider provides the metrics of the named work queues.
+type workqueueMetricsProvider struct{}
+
+func (workqueueMetricsProvider) NewDepthMetric(name string) workqueue.GaugeMetric {
+	return workqueueDepth.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewAddsMetric(name string) workqueue.CounterMetric {
+	return workqueueAdds.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewLatencyMetric(name string) workqueue.SummaryMetric {
+	return microseconds{workqueueLatency.WithLabelValues(name)}
+}
+
+func (workqueueMetricsProvider) NewWorkDurationMetric(name string) workqueue.SummaryMetric {
+	return microseconds{workqueueWorkDuration.WithLabelValues(name)}
+}
+
+func (workqueueMetricsProvider) NewRetriesMetric(name string) workqueue.CounterMetric {
+	return workqueueRetries.WithLabelValues(name)
+}
+
+// microseconds observes the durations in microseconds reported by work
+// queues in seconds.
+type microseconds struct {
+	Histogram
+}
+
+func (m microseconds) Observe(f float64) {
+	m.Histogram.Observe(f / 1e6)
+}
@@ -0,0 +1,365 @@
+/*
+Copyright (c) 2017 OpenStack Foundation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metrics implements the metrics of stackube daemons, which are
+// exposed in the Prometheus text format.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets are the default buckets of histograms, in seconds.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Collector is a metric which can be registered in a Registry.
+type Collector interface {
+	// Name returns the name of the metric.
+	Name() string
+	// write writes the metric in the Prometheus text format.
+	write(w io.Writer)
+}
+
+// Registry is a set of metrics.
+type Registry struct {
+	mu         sync.Mutex
+	collectors map[string]Collector
+}
+
+// NewRegistry creates a new Registry.
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]Collector)}
+}
+
+// DefaultRegistry is the Registry of the metrics of stackube.
+var DefaultRegistry = NewRegistry()
+
+// MustRegister registers the metrics in DefaultRegistry.
+func MustRegister(collectors ...Collector) {
+	DefaultRegistry.MustRegister(collectors...)
+}
+
+// MustRegister registers the metrics, it panics if a metric of the same
+// name has already been registered.
+func (r *Registry) MustRegister(collectors ...Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range collectors {
+		if _, ok := r.collectors[c.Name()]; ok {
+			panic(fmt.Sprintf("metric %s is already registered", c.Name()))
+		}
+		r.collectors[c.Name()] = c
+	}
+}
+
+// WriteText writes all the metrics in the Prometheus text format.
+func (r *Registry) WriteText(w io.Writer) {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.collectors))
+	for name := range r.collectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	collectors := make([]Collector, len(names))
+	for i, name := range names {
+		collectors[i] = r.collectors[name]
+	}
+	r.mu.Unlock()
+
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
+
+// ServeHTTP serves the metrics in the Prometheus text format.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	buf := &bytes.Buffer{}
+	r.WriteText(buf)
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(buf.Bytes())
+}
+
+// vec keeps the series of a metric by their label values.
+type vec struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]interface{}
+	values map[string][]string
+}
+
+func newVec(name, help, typ string, labels []string) *vec {
+	return &vec{
+		name:   name,
+		help:   help,
+		typ:    typ,
+		labels: labels,
+		series: make(map[string]interface{}),
+		values: make(map[string][]string),
+	}
+}
+
+// Name returns the name of the metric.
+func (v *vec) Name() string {
+	return v.name
+}
+
+// get returns the series of the label values, it's created by newSeries if
+// it doesn't exist.
+func (v *vec) get(values []string, newSeries func() interface{}) interface{} {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	s, ok := v.series[key]
+	if !ok {
+		s = newSeries()
+		v.series[key] = s
+		v.values[key] = append([]string(nil), values...)
+	}
+	return s
+}
+
+// write writes the header of the metric and each series by writeSeries, in
+// the order of their label values.
+func (v *vec) write(w io.Writer, writeSeries func(w io.Writer, labels string, s interface{})) {
+	fmt.Fprintf(w, "# HELP %s %s\n", v.name, escapeHelp(v.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.name, v.typ)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		writeSeries(w, formatLabels(v.labels, v.values[key]), v.series[key])
+	}
+}
+
+// Counter is a value which only goes up.
+type Counter interface {
+	Inc()
+	Add(float64)
+}
+
+// Gauge is a value which can go up and down.
+type Gauge interface {
+	Set(float64)
+	Inc()
+	Dec()
+	Add(float64)
+}
+
+type value struct {
+	mu    sync.Mutex
+	value float64
+}
+
+func (v *value) Set(f float64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.value = f
+}
+
+func (v *value) Add(f float64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.value += f
+}
+
+func (v *value) Inc() {
+	v.Add(1)
+}
+
+func (v *value) Dec() {
+	v.Add(-1)
+}
+
+func (v *value) get() float64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.value
+}
+
+// CounterVec is a counter partitioned by labels.
+type CounterVec struct {
+	*vec
+}
+
+// NewCounterVec creates a new CounterVec.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{vec: newVec(name, help, "counter", labels)}
+}
+
+// WithLabelValues returns the counter of the label values.
+func (c *CounterVec) WithLabelValues(values ...string) Counter {
+	return c.get(values, func() interface{} { return &value{} }).(*value)
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.vec.write(w, func(w io.Writer, labels string, s interface{}) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, labels, formatFloat(s.(*value).get()))
+	})
+}
+
+// GaugeVec is a gauge partitioned by labels.
+type GaugeVec struct {
+	*vec
+}
+
+// NewGaugeVec creates a new GaugeVec.
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{vec: newVec(name, help, "gauge", labels)}
+}
+
+// WithLabelValues returns the gauge of the label values.
+func (g *GaugeVec) WithLabelValues(values ...string) Gauge {
+	return g.get(values, func() interface{} { return &value{} }).(*value)
+}
+
+func (g *GaugeVec) write(w io.Writer) {
+	g.vec.write(w, func(w io.Writer, labels string, s interface{}) {
+		fmt.Fprintf(w, "%s%s %s\n", g.name, labels, formatFloat(s.(*value).get()))
+	})
+}
+
+// Histogram counts observations in buckets.
+type Histogram interface {
+	Observe(float64)
+}
+
+type histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+func (h *histogram) Observe(f float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, upper := range h.buckets {
+		if f <= upper {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += f
+}
+
+// HistogramVec is a histogram partitioned by labels.
+type HistogramVec struct {
+	*vec
+	buckets []float64
+}
+
+// NewHistogramVec creates a new HistogramVec with the upper bounds of
+// buckets in increasing order.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if !sort.Float64sAreSorted(buckets) {
+		panic(fmt.Sprintf("buckets of histogram %s are not sorted", name))
+	}
+	return &HistogramVec{
+		vec:     newVec(name, help, "histogram", labels),
+		buckets: buckets,
+	}
+}
+
+// WithLabelValues returns the histogram of the label values.
+func (h *HistogramVec) WithLabelValues(values ...string) Histogram {
+	return h.get(values, func() interface{} {
+		return &histogram{
+			buckets: h.buckets,
+			counts:  make([]uint64, len(h.buckets)),
+		}
+	}).(*histogram)
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.vec.write(w, func(w io.Writer, labels string, s interface{}) {
+		hist := s.(*histogram)
+		hist.mu.Lock()
+		defer hist.mu.Unlock()
+
+		for i, upper := range hist.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, addLabel(labels, "le", formatFloat(upper)), hist.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, addLabel(labels, "le", "+Inf"), hist.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, labels, formatFloat(hist.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, labels, hist.count)
+	})
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i := range names {
+		pairs[i] = fmt.Sprintf("%s=\"%s\"", names[i], escapeLabelValue(values[i]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func addLabel(labels, name, value string) string {
+	pair := fmt.Sprintf("%s=\"%s\"", name, value)
+	if labels == "" {
+		return "{" + pair + "}"
+	}
+	return labels[:len(labels)-1] + "," + pair + "}"
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+var (
+	helpReplacer       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelValueReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpReplacer.Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return labelValueReplacer.Replace(s)
+}
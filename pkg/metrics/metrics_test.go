@@ -0,0 +1,116 @@
+/*
+Copyright (c) 2017 OpenStack Foundation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistryWriteText(t *testing.T) {
+	registry := NewRegistry()
+	counter := NewCounterVec("test_requests_total", "Number of requests.", "operation", "result")
+	gauge := NewGaugeVec("test_depth", "Current depth.")
+	histogram := NewHistogramVec("test_duration_seconds", "Duration\nof requests.", []float64{0.1, 1}, "operation")
+	registry.MustRegister(counter, gauge, histogram)
+
+	counter.WithLabelValues("get", "success").Inc()
+	counter.WithLabelValues("get", "success").Add(2)
+	counter.WithLabelValues(`a"b`, "error").Inc()
+	gauge.WithLabelValues().Set(5)
+	gauge.WithLabelValues().Dec()
+	histogram.WithLabelValues("get").Observe(0.05)
+	histogram.WithLabelValues("get").Observe(0.5)
+	histogram.WithLabelValues("get").Observe(2)
+
+	buf := &bytes.Buffer{}
+	registry.WriteText(buf)
+	expected := `# HELP test_depth Current depth.
+# TYPE test_depth gauge
+test_depth 4
+# HELP test_duration_seconds Duration\nof requests.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{operation="get",le="0.1"} 1
+test_duration_seconds_bucket{operation="get",le="1"} 2
+test_duration_seconds_bucket{operation="get",le="+Inf"} 3
+test_duration_seconds_sum{operation="get"} 2.55
+test_duration_seconds_count{operation="get"} 3
+# HELP test_requests_total Number of requests.
+# TYPE test_requests_total counter
+test_requests_total{operation="a\"b",result="error"} 1
+test_requests_total{operation="get",result="success"} 3
+`
+	if buf.String() != expected {
+		t.Errorf("Expected metrics:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
+
+func TestRegistryDuplicate(t *testing.T) {
+	registry := NewRegistry()
+	registry.MustRegister(NewCounterVec("test_total", "Test."))
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected panic for duplicate metric")
+		}
+	}()
+	registry.MustRegister(NewGaugeVec("test_total", "Test."))
+}
+
+func TestServer(t *testing.T) {
+	s := NewServer(":0")
+	ready := fmt.Errorf("informers not synced")
+	s.AddReadyzCheck("informers", func() error { return ready })
+	server := httptest.NewServer(s.server.Handler)
+	defer server.Close()
+
+	testCases := []struct {
+		path     string
+		code     int
+		contains string
+	}{
+		{path: "/healthz", code: http.StatusOK, contains: "ok"},
+		{path: "/readyz", code: http.StatusServiceUnavailable, contains: "[-]informers failed: informers not synced"},
+		{path: "/metrics", code: http.StatusOK, contains: "# TYPE stackube_controller_reconcile_total counter"},
+	}
+	for _, tc := range testCases {
+		code, body := get(t, server.URL+tc.path)
+		if code != tc.code || !strings.Contains(body, tc.contains) {
+			t.Errorf("Case[%s]: expected %d with %q, got %d with %q", tc.path, tc.code, tc.contains, code, body)
+		}
+	}
+
+	ready = nil
+	if code, _ := get(t, server.URL+"/readyz"); code != http.StatusOK {
+		t.Errorf("Expected readyz ok, got %d", code)
+	}
+}
+
+func get(t *testing.T, url string) (int, string) {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	buf := &bytes.Buffer{}
+	buf.ReadFrom(resp.Body)
+	return resp.StatusCode, buf.String()
+}
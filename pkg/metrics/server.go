@@ -0,0 +1,101 @@
+/*
+Copyright (c) 2017 OpenStack Foundation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+type readyzCheck struct {
+	name  string
+	check func() error
+}
+
+// Server serves /healthz, /readyz and the metrics of DefaultRegistry on
+// /metrics.
+type Server struct {
+	server *http.Server
+
+	mu     sync.Mutex
+	checks []readyzCheck
+}
+
+// NewServer creates a new Server listening on addr.
+func NewServer(addr string) *Server {
+	s := &Server{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", s.healthz)
+	mux.HandleFunc("/readyz", s.readyz)
+	mux.Handle("/metrics", DefaultRegistry)
+	s.server = &http.Server{Addr: addr, Handler: mux}
+	return s
+}
+
+// AddReadyzCheck adds a check to /readyz, which is ready only if all the
+// checks return nil.
+func (s *Server) AddReadyzCheck(name string, check func() error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checks = append(s.checks, readyzCheck{name: name, check: check})
+}
+
+// Run serves until stopCh is closed.
+func (s *Server) Run(stopCh <-chan struct{}) error {
+	go func() {
+		<-stopCh
+		s.server.Close()
+	}()
+
+	glog.Infof("Serving healthz, readyz and metrics on %s", s.server.Addr)
+	if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return fmt.Errorf("failed to serve metrics on %s: %v", s.server.Addr, err)
+	}
+	return nil
+}
+
+func (s *Server) healthz(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok"))
+}
+
+func (s *Server) readyz(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	checks := s.checks
+	s.mu.Unlock()
+
+	buf := &bytes.Buffer{}
+	ready := true
+	for _, c := range checks {
+		if err := c.check(); err != nil {
+			ready = false
+			fmt.Fprintf(buf, "[-]%s failed: %v\n", c.name, err)
+			continue
+		}
+		fmt.Fprintf(buf, "[+]%s ok\n", c.name)
+	}
+
+	if !ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write(buf.Bytes())
+		return
+	}
+	w.Write([]byte("ok"))
+}
@@ -19,6 +19,7 @@ package network
 import (
 	"fmt"
 	"os"
+	"reflect"
 	"time"
 
 	"github.com/golang/glog"
@@ -34,9 +35,12 @@ import (
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
 
 	crv1 "git.openstack.org/openstack/stackube/pkg/apis/v1"
+	"git.openstack.org/openstack/stackube/pkg/events"
 	"git.openstack.org/openstack/stackube/pkg/kubecrd"
+	"git.openstack.org/openstack/stackube/pkg/metrics"
 	"git.openstack.org/openstack/stackube/pkg/openstack"
 	"git.openstack.org/openstack/stackube/pkg/util"
 )
@@ -46,6 +50,16 @@ const (
 	defaultKubeDNSImage = "stackube/k8s-dns-kube-dns-amd64:1.14.4"
 	defaultDNSMasqImage = "stackube/k8s-dns-dnsmasq-nanny-amd64:1.14.4"
 	defaultSideCarImage = "stackube/k8s-dns-sidecar-amd64:1.14.4"
+
+	// Interval of resyncing networks, networks which are not Active are
+	// synced again.
+	resyncPeriod = 5 * time.Minute
+
+	// How long to wait before retrying the sync of a network.
+	minRetryDelay = 5 * time.Second
+	maxRetryDelay = 300 * time.Second
+
+	concurrentNetworkSyncs = 1
 )
 
 // NetworkController manages the life cycle of Network.
@@ -54,18 +68,36 @@ type NetworkController struct {
 	kubeCRDClient   kubecrd.Interface
 	driver          openstack.Interface
 	networkInformer cache.Controller
+	networkStore    cache.Store
+	recorder        events.EventRecorder
+
+	// networks that need to be synced
+	queue workqueue.RateLimitingInterface
 }
 
 // Run the network controller.
 func (c *NetworkController) Run(stopCh <-chan struct{}) error {
 	defer utilruntime.HandleCrash()
+	defer c.queue.ShutDown()
 
 	go c.networkInformer.Run(stopCh)
+	if !cache.WaitForCacheSync(stopCh, c.networkInformer.HasSynced) {
+		return fmt.Errorf("failed to cache networks")
+	}
+
+	for i := 0; i < concurrentNetworkSyncs; i++ {
+		go wait.Until(c.worker, time.Second, stopCh)
+	}
 	<-stopCh
 
 	return nil
 }
 
+// HasSynced returns true if the networks have been synced.
+func (c *NetworkController) HasSynced() bool {
+	return c.networkInformer.HasSynced()
+}
+
 // NewNetworkController creates a new NetworkController.
 func NewNetworkController(kubeClient kubernetes.Interface, osClient openstack.Interface, kubeExtClient *apiextensionsclient.Clientset) (*NetworkController, error) {
 	// initialize CRD if it does not exist
@@ -83,64 +115,165 @@ func NewNetworkController(kubeClient kubernetes.Interface, osClient openstack.In
 		k8sclient:     kubeClient,
 		kubeCRDClient: osClient.GetCRDClient(),
 		driver:        osClient,
+		recorder:      events.NewRecorder(kubeClient, "network-controller"),
+		queue: workqueue.NewNamedRateLimitingQueue(
+			workqueue.NewItemExponentialFailureRateLimiter(minRetryDelay, maxRetryDelay), "network"),
 	}
-	_, networkInformer := cache.NewInformer(
+	networkStore, networkInformer := cache.NewInformer(
 		source,
 		&crv1.Network{},
-		0,
+		resyncPeriod,
 		cache.ResourceEventHandlerFuncs{
 			AddFunc:    networkController.onAdd,
 			UpdateFunc: networkController.onUpdate,
 			DeleteFunc: networkController.onDelete,
 		})
+	networkController.networkStore = networkStore
 	networkController.networkInformer = networkInformer
 
 	return networkController, nil
 }
 
+func (c *NetworkController) enqueueNetwork(network *crv1.Network) {
+	key, err := cache.MetaNamespaceKeyFunc(network)
+	if err != nil {
+		glog.Errorf("Couldn't get key for network %#v: %v", network, err)
+		return
+	}
+	c.queue.Add(key)
+}
+
 func (c *NetworkController) onAdd(obj interface{}) {
 	network := obj.(*crv1.Network)
-	// glog.Infof("[NETWORK CONTROLLER] OnAdd %\n", network.ObjectMeta.SelfLink)
-	glog.Infof("[NETWORK CONTROLLER] OnAdd %#v\n", network)
+	glog.V(4).Infof("[NETWORK CONTROLLER] OnAdd %s/%s", network.Namespace, network.Name)
+
+	c.enqueueNetwork(network)
+}
+
+func (c *NetworkController) onUpdate(oldObj, newObj interface{}) {
+	oldNetwork := oldObj.(*crv1.Network)
+	newNetwork := newObj.(*crv1.Network)
+
+	// Status updates made by ourselves also come here, only spec changes
+	// and deletion need to be synced. Networks which are not converged yet
+	// are synced again on resync.
+	resync := oldNetwork.ResourceVersion == newNetwork.ResourceVersion
+	if reflect.DeepEqual(oldNetwork.Spec, newNetwork.Spec) && newNetwork.DeletionTimestamp == nil &&
+		!(resync && !networkConverged(newNetwork)) {
+		return
+	}
+	glog.V(4).Infof("[NETWORK CONTROLLER] OnUpdate %s/%s", newNetwork.Namespace, newNetwork.Name)
+
+	c.enqueueNetwork(newNetwork)
+}
+
+// worker runs a worker thread that just dequeues items, processes them, and
+// marks them done. It enforces that the same key is never synced concurrently.
+func (c *NetworkController) worker() {
+	for c.processNextWorkItem() {
+	}
+}
+
+func (c *NetworkController) processNextWorkItem() bool {
+	key, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(key)
+
+	start := time.Now()
+	err := c.syncNetwork(key.(string))
+	metrics.ObserveReconcile("network", start, err)
+	if err == nil {
+		c.queue.Forget(key)
+		return true
+	}
+	if _, ok := err.(*specError); ok {
+		// Retrying won't help until the spec is changed.
+		glog.Warningf("Network %q has invalid spec, not retrying: %v", key, err)
+		c.queue.Forget(key)
+		return true
+	}
+
+	glog.Errorf("Error syncing network %q (will retry): %v", key, err)
+	c.queue.AddRateLimited(key)
+	return true
+}
+
+// syncNetwork makes the Neutron network and kube-dns of the network with key
+// match its spec, and updates the network status.
+func (c *NetworkController) syncNetwork(key string) error {
+	obj, exists, err := c.networkStore.GetByKey(key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		// Deleted networks are cleaned up by onDelete.
+		glog.V(4).Infof("[NETWORK CONTROLLER] network %s has been deleted", key)
+		return nil
+	}
 
 	// NEVER modify objects from the store. It's a read-only, local cache.
 	// You can use networkScheme.Copy() to make a deep copy of original object and modify this copy
 	// Or create a copy manually for better performance
-	copyObj, err := c.kubeCRDClient.Scheme().Copy(network)
+	copyObj, err := c.kubeCRDClient.Scheme().Copy(obj.(*crv1.Network))
 	if err != nil {
-		glog.Errorf("ERROR creating a deep copy of network object: %v\n", err)
-		return
+		return fmt.Errorf("creating a deep copy of network object failed: %v", err)
+	}
+	network := copyObj.(*crv1.Network)
+
+	if network.DeletionTimestamp != nil {
+		return c.finalizeNetwork(network)
 	}
 
-	networkCopy := copyObj.(*crv1.Network)
+	// Make sure the resources are deleted before the network is removed.
+	if !util.HasFinalizer(network, crv1.Finalizer) {
+		util.AddFinalizer(network, crv1.Finalizer)
+		if err := c.kubeCRDClient.UpdateNetwork(network); err != nil {
+			return err
+		}
+	}
 
-	// This will:
-	// 1. Create Network in Neutron
-	// 2. Update Network CRD object status to Active or Failed
-	err = c.addNetworkToDriver(networkCopy)
+	// Networks which were never synced and provider networks are added,
+	// which is a no-op for networks already in Neutron. Others are updated
+	// to their spec, which creates them if they are missing.
+	if network.Status.State == "" || network.Spec.NetworkID != "" {
+		err = c.addNetworkToDriver(network)
+	} else {
+		err = c.updateNetworkInDriver(network)
+	}
 	if err != nil {
-		glog.Errorf("Add network to driver failed: %v", err)
-		return
+		return err
 	}
 
-	// create kube-dns in this namespace.
-	namespace := networkCopy.Namespace
-	if err := c.createKubeDNSDeployment(namespace); err != nil {
-		glog.Errorf("Create kube-dns deployment failed: %v", err)
-		return
+	return c.ensureKubeDNS(network)
+}
+
+// ensureKubeDNS creates kube-dns in the namespace of network, unless it is
+// already there.
+func (c *NetworkController) ensureKubeDNS(network *crv1.Network) error {
+	if condition := getNetworkCondition(network, crv1.NetworkDNSReady); condition != nil && condition.Status == apiv1.ConditionTrue {
+		return nil
 	}
 
-	if err := c.createKubeDNSService(namespace); err != nil {
-		glog.Errorf("Create kube-dns service failed: %v", err)
-		return
+	err := c.createKubeDNS(network.Namespace)
+	if err != nil {
+		setNetworkCondition(network, crv1.NetworkDNSReady, apiv1.ConditionFalse, "KubeDNSFailed", err.Error())
+		c.recorder.Event(network, apiv1.EventTypeWarning, "KubeDNSFailed", err.Error())
+	} else {
+		setNetworkCondition(network, crv1.NetworkDNSReady, apiv1.ConditionTrue, "KubeDNSCreated", "")
+	}
+	if updateErr := c.kubeCRDClient.UpdateNetwork(network); updateErr != nil && err == nil {
+		err = updateErr
 	}
-}
 
-func (c *NetworkController) onUpdate(oldObj, newObj interface{}) {
-	// NOTE(harry) not supported yet
+	return err
 }
 
 func (c *NetworkController) onDelete(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
 	net, ok := obj.(*crv1.Network)
 	if !ok {
 		glog.Warningf("Receiving an unkown object: %v", obj)
@@ -149,27 +282,75 @@ func (c *NetworkController) onDelete(obj interface{}) {
 
 	glog.V(4).Infof("NetworkController: network %s deleted", net.Name)
 
+	// Networks with the finalizer have been cleaned up by finalizeNetwork
+	// before they are removed.
+	if net.Status.State == crv1.NetworkTerminating {
+		return
+	}
+	if err := c.deleteNetworkResources(net); err != nil {
+		glog.Errorf("NetworkController: clean up network %s failed: %v", net.Name, err)
+	}
+}
+
+// finalizeNetwork deletes the resources of a network being deleted, and
+// removes the finalizer so that the network can be removed.
+func (c *NetworkController) finalizeNetwork(network *crv1.Network) error {
+	if !util.HasFinalizer(network, crv1.Finalizer) {
+		return nil
+	}
+
+	if network.Status.State != crv1.NetworkTerminating {
+		network.Status.State = crv1.NetworkTerminating
+		network.Status.Message = ""
+		if err := c.kubeCRDClient.UpdateNetwork(network); err != nil {
+			return err
+		}
+	}
+
+	if err := c.deleteNetworkResources(network); err != nil {
+		network.Status.Message = fmt.Sprintf("clean up network failed: %v", err)
+		c.kubeCRDClient.UpdateNetwork(network)
+		c.recorder.Event(network, apiv1.EventTypeWarning, "CleanupFailed", network.Status.Message)
+		return err
+	}
+
+	util.RemoveFinalizer(network, crv1.Finalizer)
+	return c.kubeCRDClient.UpdateNetwork(network)
+}
+
+// deleteNetworkResources deletes kube-dns and the Neutron network of network.
+func (c *NetworkController) deleteNetworkResources(net *crv1.Network) error {
 	// Delete kube-dns deployment.
-	if err := c.deleteDeployment(net.Namespace, "kube-dns"); err != nil {
-		glog.Warningf("error on deleting kube-dns deployment: %v", err)
+	if err := c.deleteDeployment(net.Namespace, "kube-dns"); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("delete kube-dns deployment failed: %v", err)
 	}
 	// Delete kube-dns services for non-system namespaces.
 	if !util.IsSystemNamespace(net.Namespace) {
-		if err := c.k8sclient.Core().Services(net.Namespace).Delete("kube-dns", apismetav1.NewDeleteOptions(0)); err != nil {
-			glog.Warningf("error on deleting kube-dns service: %v", err)
+		err := c.k8sclient.Core().Services(net.Namespace).Delete("kube-dns", apismetav1.NewDeleteOptions(0))
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("delete kube-dns service failed: %v", err)
 		}
 	}
 
 	// Delete neutron network created by stackube.
 	if net.Spec.NetworkID == "" {
 		networkName := util.BuildNetworkName(net.GetNamespace(), net.GetName())
-		err := c.driver.DeleteNetwork(networkName)
-		if err != nil {
-			glog.Errorf("NetworkController: delete network %s failed in networkprovider: %v", networkName, err)
-		} else {
-			glog.V(4).Infof("NetworkController: network %s deleted in networkprovider", networkName)
+		if err := c.driver.DeleteNetwork(networkName); err != nil {
+			return fmt.Errorf("delete network %s failed in networkprovider: %v", networkName, err)
 		}
+		glog.V(4).Infof("NetworkController: network %s deleted in networkprovider", networkName)
 	}
+
+	return nil
+}
+
+// createKubeDNS creates the kube-dns deployment and service in namespace.
+func (c *NetworkController) createKubeDNS(namespace string) error {
+	if err := c.createKubeDNSDeployment(namespace); err != nil {
+		return err
+	}
+
+	return c.createKubeDNSService(namespace)
 }
 
 func (c *NetworkController) createKubeDNSDeployment(namespace string) error {
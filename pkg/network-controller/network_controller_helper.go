@@ -20,13 +20,17 @@ import (
 	"bytes"
 	"fmt"
 	"html/template"
+	"net"
 	"time"
 
 	crv1 "git.openstack.org/openstack/stackube/pkg/apis/v1"
+	"git.openstack.org/openstack/stackube/pkg/openstack"
 	drivertypes "git.openstack.org/openstack/stackube/pkg/openstack/types"
 	"git.openstack.org/openstack/stackube/pkg/util"
 
 	"github.com/golang/glog"
+	apiv1 "k8s.io/api/core/v1"
+	apismetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/wait"
 )
 
@@ -36,47 +40,42 @@ const (
 )
 
 func (c *NetworkController) addNetworkToDriver(kubeNetwork *crv1.Network) error {
-	// The tenant name is the same with namespace, let's get tenantID by tenantName
-	tenantName := kubeNetwork.GetNamespace()
-	tenantID, err := c.driver.GetTenantIDFromName(tenantName)
+	// Get tenantID of the tenant which owns the namespace of the network
+	namespace := kubeNetwork.GetNamespace()
+	tenantID, err := c.driver.GetTenantIDFromNamespace(namespace)
 
 	// Retry for a while if fetch tenantID failed or tenantID not found,
 	// this is normally caused by cloud provider processing
 	if err != nil || tenantID == "" {
 		err = wait.Poll(2*time.Second, 10*time.Second, func() (bool, error) {
-			tenantID, err = c.driver.GetTenantIDFromName(kubeNetwork.GetNamespace())
+			tenantID, err = c.driver.GetTenantIDFromNamespace(namespace)
 			if err != nil {
-				glog.Errorf("failed to fetch tenantID for tenantName: %v, error: %v retrying\n", tenantName, err)
+				glog.Errorf("failed to fetch tenantID for namespace: %v, error: %v retrying\n", namespace, err)
 				return false, err
 			}
 
 			if tenantID == "" {
-				glog.V(5).Infof("tenantID is empty for tenantName: %v, retrying\n", tenantName)
+				glog.V(5).Infof("tenantID is empty for namespace: %v, retrying\n", namespace)
 				return false, err
 			}
 			return true, nil
 		})
 	}
 	if err != nil || tenantID == "" {
-		return fmt.Errorf("failed to fetch tenantID for tenantName: %v, error: %v abort! \n", tenantName, err)
+		c.recorder.Eventf(kubeNetwork, apiv1.EventTypeWarning, "TenantNotFound", "Failed to fetch tenantID for namespace %s: %v", namespace, err)
+		return fmt.Errorf("failed to fetch tenantID for namespace: %v, error: %v abort! \n", namespace, err)
 	}
 
-	networkName := util.BuildNetworkName(tenantName, kubeNetwork.GetName())
+	if err := validateNetworkSpec(&kubeNetwork.Spec); err != nil {
+		kubeNetwork.Status.Message = fmt.Sprintf("invalid network spec: %v", err)
+		c.networkCreateFailed(kubeNetwork, "InvalidSpec", err)
+		return &specError{err}
+	}
+
+	networkName := util.BuildNetworkName(namespace, kubeNetwork.GetName())
 
 	// Translate Kubernetes network to OpenStack network
-	driverNetwork := &drivertypes.Network{
-		Name:     networkName,
-		TenantID: tenantID,
-		Subnets: []*drivertypes.Subnet{
-			{
-				// network: subnet = 1:1
-				Name:     networkName + "-" + subnetSuffix,
-				Cidr:     kubeNetwork.Spec.CIDR,
-				Gateway:  kubeNetwork.Spec.Gateway,
-				Tenantid: tenantID,
-			},
-		},
-	}
+	driverNetwork := buildDriverNetwork(kubeNetwork, tenantID)
 
 	glog.V(4).Infof("[NetworkController]: adding network %s", driverNetwork.Name)
 
@@ -87,45 +86,370 @@ func (c *NetworkController) addNetworkToDriver(kubeNetwork *crv1.Network) error
 		return err
 	}
 	if !check {
-		kubeNetwork.Status.State = crv1.NetworkFailed
-		c.kubeCRDClient.UpdateNetwork(kubeNetwork)
-		return fmt.Errorf("tenantID %s doesn't exist in network provider", driverNetwork.TenantID)
+		err := fmt.Errorf("tenantID %s doesn't exist in network provider", driverNetwork.TenantID)
+		c.networkCreateFailed(kubeNetwork, "TenantNotFound", err)
+		return err
 	}
 
+	var osNetwork *drivertypes.Network
 	// Check if provider network id exist
 	if kubeNetwork.Spec.NetworkID != "" {
-		_, err := c.driver.GetNetworkByID(kubeNetwork.Spec.NetworkID)
+		osNetwork, err = c.driver.GetNetworkByID(kubeNetwork.Spec.NetworkID)
 		if err != nil {
-			kubeNetwork.Status.State = crv1.NetworkFailed
-			c.kubeCRDClient.UpdateNetwork(kubeNetwork)
-			return fmt.Errorf("network %s doesn't exit in network provider", kubeNetwork.Spec.NetworkID)
+			err := fmt.Errorf("network %s doesn't exit in network provider", kubeNetwork.Spec.NetworkID)
+			c.networkCreateFailed(kubeNetwork, "NetworkNotFound", err)
+			return err
 		}
 	} else {
 		if len(driverNetwork.Subnets) == 0 {
-			kubeNetwork.Status.State = crv1.NetworkFailed
-			c.kubeCRDClient.UpdateNetwork(kubeNetwork)
-			return fmt.Errorf("subnets of %s is null", driverNetwork.Name)
+			err := fmt.Errorf("subnets of %s is null", driverNetwork.Name)
+			c.networkCreateFailed(kubeNetwork, "InvalidSpec", err)
+			return &specError{err}
 		}
 		// Check if provider network has already created
-		_, err := c.driver.GetNetworkByName(networkName)
+		osNetwork, err = c.driver.GetNetworkByName(networkName)
 		if err == nil {
 			glog.Infof("[NetworkController]: network %s has already created", networkName)
 		} else if err.Error() == util.ErrNotFound.Error() {
 			// Create a new network by network provider
+			c.recorder.Eventf(kubeNetwork, apiv1.EventTypeNormal, "CreatingNetwork", "Creating network %s with its subnets and router", networkName)
 			err := c.driver.CreateNetwork(driverNetwork)
 			if err != nil {
-				kubeNetwork.Status.State = crv1.NetworkFailed
-				c.kubeCRDClient.UpdateNetwork(kubeNetwork)
-				return fmt.Errorf("create network %s failed: %v", driverNetwork.Name, err)
+				err = fmt.Errorf("create network %s failed: %v", driverNetwork.Name, err)
+				c.networkCreateFailed(kubeNetwork, "CreateFailed", err)
+				return err
+			}
+			// Get the network again for the IDs of the created resources.
+			osNetwork, err = c.driver.GetNetworkByName(networkName)
+			if err != nil {
+				err = fmt.Errorf("get network %s failed: %v", networkName, err)
+				c.networkCreateFailed(kubeNetwork, "GetFailed", err)
+				return err
 			}
+			c.recorder.Eventf(kubeNetwork, apiv1.EventTypeNormal, "NetworkCreated", "Created network %s (%s)", networkName, osNetwork.Uid)
 		} else {
-			kubeNetwork.Status.State = crv1.NetworkFailed
-			c.kubeCRDClient.UpdateNetwork(kubeNetwork)
-			return fmt.Errorf("get network failed: %v", err)
+			err = fmt.Errorf("get network failed: %v", err)
+			c.networkCreateFailed(kubeNetwork, "GetFailed", err)
+			return err
+		}
+	}
+
+	if err := c.driver.GetNetworkDetails(osNetwork); err != nil {
+		return fmt.Errorf("get details of network %s failed: %v", osNetwork.Name, err)
+	}
+	setNetworkResources(kubeNetwork, osNetwork)
+	setNetworkCondition(kubeNetwork, crv1.NetworkCreated, apiv1.ConditionTrue, "Created", "")
+	kubeNetwork.Status.State = crv1.NetworkActive
+	c.kubeCRDClient.UpdateNetwork(kubeNetwork)
+	return nil
+}
+
+// specError is returned when the spec of a network is invalid, syncing the
+// network is not retried until the spec is changed.
+type specError struct {
+	err error
+}
+
+func (e *specError) Error() string {
+	return e.err.Error()
+}
+
+// networkConverged returns true if network needn't be synced on resync.
+func networkConverged(network *crv1.Network) bool {
+	if network.Status.State != crv1.NetworkActive {
+		return false
+	}
+	condition := getNetworkCondition(network, crv1.NetworkDNSReady)
+	return condition != nil && condition.Status == apiv1.ConditionTrue
+}
+
+// networkCreateFailed marks kubeNetwork as Failed because the network
+// couldn't be created for reason.
+func (c *NetworkController) networkCreateFailed(kubeNetwork *crv1.Network, reason string, err error) {
+	kubeNetwork.Status.State = crv1.NetworkFailed
+	setNetworkCondition(kubeNetwork, crv1.NetworkCreated, apiv1.ConditionFalse, reason, err.Error())
+	c.kubeCRDClient.UpdateNetwork(kubeNetwork)
+	c.recorder.Event(kubeNetwork, apiv1.EventTypeWarning, reason, err.Error())
+}
+
+// setNetworkResources records the Neutron resources of driverNetwork in the
+// status of kubeNetwork.
+func setNetworkResources(kubeNetwork *crv1.Network, driverNetwork *drivertypes.Network) {
+	status := &kubeNetwork.Status
+	status.NetworkID = driverNetwork.Uid
+	status.SubnetIDs = nil
+	for _, subnet := range driverNetwork.Subnets {
+		status.SubnetIDs = append(status.SubnetIDs, subnet.Uid)
+	}
+	status.RouterID = driverNetwork.RouterID
+	status.SegmentationID = driverNetwork.SegmentID
+	status.ExternalGatewayIP = driverNetwork.ExternalGatewayIP
+
+	if driverNetwork.RouterID != "" {
+		setNetworkCondition(kubeNetwork, crv1.NetworkRouterAttached, apiv1.ConditionTrue, "RouterAttached", "")
+	} else {
+		setNetworkCondition(kubeNetwork, crv1.NetworkRouterAttached, apiv1.ConditionFalse, "RouterNotFound",
+			"no router is managed by stackube for the network")
+	}
+}
+
+// getNetworkCondition returns the condition of conditionType in the status
+// of network, or nil if it is not set.
+func getNetworkCondition(network *crv1.Network, conditionType crv1.NetworkConditionType) *crv1.NetworkCondition {
+	for i := range network.Status.Conditions {
+		if network.Status.Conditions[i].Type == conditionType {
+			return &network.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// setNetworkCondition sets the condition of conditionType in the status of
+// network. The transition time is only changed together with the status.
+func setNetworkCondition(network *crv1.Network, conditionType crv1.NetworkConditionType, status apiv1.ConditionStatus, reason, message string) {
+	condition := crv1.NetworkCondition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: network.Generation,
+		LastTransitionTime: apismetav1.Now(),
+		Reason:             reason,
+		Message:            message,
+	}
+	conditions := network.Status.Conditions
+	for i := range conditions {
+		if conditions[i].Type != conditionType {
+			continue
+		}
+		if conditions[i].Status == status {
+			condition.LastTransitionTime = conditions[i].LastTransitionTime
+		}
+		conditions[i] = condition
+		return
+	}
+	network.Status.Conditions = append(conditions, condition)
+}
+
+// specSubnets returns all the subnets in spec, including the one set by
+// spec.CIDR.
+func specSubnets(spec *crv1.NetworkSpec) []crv1.NetworkSubnet {
+	var result []crv1.NetworkSubnet
+	if spec.CIDR != "" {
+		result = append(result, crv1.NetworkSubnet{
+			CIDR:            spec.CIDR,
+			Gateway:         spec.Gateway,
+			HostRoutes:      spec.HostRoutes,
+			AllocationPools: spec.AllocationPools,
+		})
+	}
+	return append(result, spec.Subnets...)
+}
+
+// validateNetworkSpec checks the subnets of spec.
+func validateNetworkSpec(spec *crv1.NetworkSpec) error {
+	// Networks provided by spec.networkID are not managed by stackube.
+	if spec.NetworkID != "" {
+		return nil
+	}
+
+	subnets := specSubnets(spec)
+	if len(subnets) == 0 {
+		return fmt.Errorf("either cidr or subnets must be set")
+	}
+	if spec.CIDR == "" && (len(spec.HostRoutes) != 0 || len(spec.AllocationPools) != 0) {
+		return fmt.Errorf("hostRoutes and allocationPools require cidr")
+	}
+	for _, nameserver := range spec.DNSNameservers {
+		if net.ParseIP(nameserver) == nil {
+			return fmt.Errorf("invalid DNS nameserver %q", nameserver)
+		}
+	}
+
+	cidrs := make(map[string]bool)
+	for _, subnet := range subnets {
+		ip, ipNet, err := net.ParseCIDR(subnet.CIDR)
+		if err != nil {
+			return fmt.Errorf("invalid cidr %q: %v", subnet.CIDR, err)
+		}
+		if cidrs[ipNet.String()] {
+			return fmt.Errorf("duplicate cidr %q", subnet.CIDR)
+		}
+		cidrs[ipNet.String()] = true
+
+		version := ipVersion(ip)
+		if subnet.IPVersion != 0 && subnet.IPVersion != version {
+			return fmt.Errorf("cidr %q is not an IPv%d cidr", subnet.CIDR, subnet.IPVersion)
+		}
+		switch subnet.IPv6Mode {
+		case "":
+		case crv1.IPv6ModeSLAAC, crv1.IPv6ModeDHCPv6Stateful, crv1.IPv6ModeDHCPv6Stateless:
+			if version != 6 {
+				return fmt.Errorf("ipv6Mode is set for IPv4 cidr %q", subnet.CIDR)
+			}
+		default:
+			return fmt.Errorf("invalid ipv6Mode %q of cidr %q", subnet.IPv6Mode, subnet.CIDR)
 		}
+		if subnet.Gateway != "" {
+			gateway := net.ParseIP(subnet.Gateway)
+			if gateway == nil || !ipNet.Contains(gateway) {
+				return fmt.Errorf("gateway %q is not in cidr %q", subnet.Gateway, subnet.CIDR)
+			}
+		}
+		if err := validateHostRoutes(subnet.HostRoutes, version); err != nil {
+			return fmt.Errorf("invalid host routes of cidr %q: %v", subnet.CIDR, err)
+		}
+		if err := validateAllocationPools(subnet.AllocationPools, ipNet); err != nil {
+			return fmt.Errorf("invalid allocation pools of cidr %q: %v", subnet.CIDR, err)
+		}
+	}
+
+	return nil
+}
+
+func validateHostRoutes(routes []crv1.HostRoute, version int) error {
+	for _, route := range routes {
+		ip, _, err := net.ParseCIDR(route.Destination)
+		if err != nil {
+			return fmt.Errorf("invalid destination %q", route.Destination)
+		}
+		nexthop := net.ParseIP(route.Nexthop)
+		if nexthop == nil {
+			return fmt.Errorf("invalid nexthop %q", route.Nexthop)
+		}
+		if ipVersion(ip) != version || ipVersion(nexthop) != version {
+			return fmt.Errorf("route to %q via %q is not IPv%d", route.Destination, route.Nexthop, version)
+		}
+	}
+
+	return nil
+}
+
+func validateAllocationPools(pools []crv1.AllocationPool, ipNet *net.IPNet) error {
+	for _, pool := range pools {
+		start, end := net.ParseIP(pool.Start), net.ParseIP(pool.End)
+		if start == nil || !ipNet.Contains(start) {
+			return fmt.Errorf("start %q is not in cidr", pool.Start)
+		}
+		if end == nil || !ipNet.Contains(end) {
+			return fmt.Errorf("end %q is not in cidr", pool.End)
+		}
+		if bytes.Compare(start.To16(), end.To16()) > 0 {
+			return fmt.Errorf("start %q is after end %q", pool.Start, pool.End)
+		}
+	}
+
+	return nil
+}
+
+func ipVersion(ip net.IP) int {
+	if ip.To4() != nil {
+		return 4
+	}
+	return 6
+}
+
+// buildDriverNetwork translates Kubernetes network to OpenStack network.
+func buildDriverNetwork(kubeNetwork *crv1.Network, tenantID string) *drivertypes.Network {
+	networkName := util.BuildNetworkName(kubeNetwork.GetNamespace(), kubeNetwork.GetName())
+	driverNetwork := &drivertypes.Network{
+		Name:         networkName,
+		TenantID:     tenantID,
+		AdminStateUp: kubeNetwork.Spec.AdminStateUp,
+	}
+	for i, subnet := range specSubnets(&kubeNetwork.Spec) {
+		// The first subnet keeps the name used when network: subnet was 1:1.
+		name := networkName + "-" + subnetSuffix
+		if i > 0 {
+			name = fmt.Sprintf("%s-%d", name, i)
+		}
+		version := 4
+		if ip, _, err := net.ParseCIDR(subnet.CIDR); err == nil {
+			version = ipVersion(ip)
+		}
+		driverSubnet := &drivertypes.Subnet{
+			Name:       name,
+			Cidr:       subnet.CIDR,
+			Gateway:    subnet.Gateway,
+			Tenantid:   tenantID,
+			Dnsservers: kubeNetwork.Spec.DNSNameservers,
+			IPVersion:  version,
+			IPv6Mode:   subnet.IPv6Mode,
+		}
+		for _, route := range subnet.HostRoutes {
+			driverSubnet.Routes = append(driverSubnet.Routes, &drivertypes.Route{
+				DestinationCIDR: route.Destination,
+				Nexthop:         route.Nexthop,
+			})
+		}
+		for _, pool := range subnet.AllocationPools {
+			driverSubnet.AllocationPools = append(driverSubnet.AllocationPools, &drivertypes.AllocationPool{
+				Start: pool.Start,
+				End:   pool.End,
+			})
+		}
+		driverNetwork.Subnets = append(driverNetwork.Subnets, driverSubnet)
+	}
+
+	return driverNetwork
+}
+
+func (c *NetworkController) updateNetworkInDriver(kubeNetwork *crv1.Network) error {
+	// Networks provided by spec.networkID are not managed by stackube.
+	if kubeNetwork.Spec.NetworkID != "" {
+		glog.V(4).Infof("[NetworkController]: network %s is provided by network provider, skip updating", kubeNetwork.Name)
+		return nil
+	}
+
+	if err := validateNetworkSpec(&kubeNetwork.Spec); err != nil {
+		// The network keeps working with its previous spec.
+		kubeNetwork.Status.Message = fmt.Sprintf("invalid network spec: %v", err)
+		c.kubeCRDClient.UpdateNetwork(kubeNetwork)
+		c.recorder.Event(kubeNetwork, apiv1.EventTypeWarning, "InvalidSpec", kubeNetwork.Status.Message)
+		return &specError{err}
+	}
+
+	namespace := kubeNetwork.GetNamespace()
+	tenantID, err := c.driver.GetTenantIDFromNamespace(namespace)
+	if err != nil || tenantID == "" {
+		return fmt.Errorf("failed to fetch tenantID for namespace: %v, error: %v", namespace, err)
+	}
+
+	driverNetwork := buildDriverNetwork(kubeNetwork, tenantID)
+	glog.V(4).Infof("[NetworkController]: updating network %s", driverNetwork.Name)
+
+	err = c.driver.UpdateNetwork(driverNetwork)
+	if err == nil {
+		// Subnets may have been replaced, record their new IDs.
+		var osNetwork *drivertypes.Network
+		osNetwork, err = c.driver.GetNetworkByName(driverNetwork.Name)
+		if err == nil {
+			err = c.driver.GetNetworkDetails(osNetwork)
+		}
+		if err == nil {
+			setNetworkResources(kubeNetwork, osNetwork)
+		}
+	}
+	if err == openstack.ErrNotFound {
+		// The network was never created, e.g. the previous spec failed.
+		return c.addNetworkToDriver(kubeNetwork)
+	}
+	if openstack.IsSubnetInUse(err) {
+		// The network keeps working with its previous subnets.
+		kubeNetwork.Status.Message = fmt.Sprintf("CIDR change rejected: %v, delete the pods in the network first", err)
+		c.kubeCRDClient.UpdateNetwork(kubeNetwork)
+		c.recorder.Event(kubeNetwork, apiv1.EventTypeWarning, "SubnetInUse", kubeNetwork.Status.Message)
+		return err
+	}
+	if err != nil {
+		kubeNetwork.Status.State = crv1.NetworkFailed
+		kubeNetwork.Status.Message = fmt.Sprintf("update network failed: %v", err)
+		c.kubeCRDClient.UpdateNetwork(kubeNetwork)
+		c.recorder.Event(kubeNetwork, apiv1.EventTypeWarning, "UpdateFailed", kubeNetwork.Status.Message)
+		return fmt.Errorf("update network %s failed: %v", driverNetwork.Name, err)
 	}
 
+	setNetworkCondition(kubeNetwork, crv1.NetworkCreated, apiv1.ConditionTrue, "Updated", "")
 	kubeNetwork.Status.State = crv1.NetworkActive
+	kubeNetwork.Status.Message = ""
 	c.kubeCRDClient.UpdateNetwork(kubeNetwork)
 	return nil
 }
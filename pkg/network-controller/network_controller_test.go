@@ -20,9 +20,12 @@ import (
 	"fmt"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	crv1 "git.openstack.org/openstack/stackube/pkg/apis/v1"
+	"git.openstack.org/openstack/stackube/pkg/events"
 	crdClient "git.openstack.org/openstack/stackube/pkg/kubecrd"
 	"git.openstack.org/openstack/stackube/pkg/openstack"
 	drivertypes "git.openstack.org/openstack/stackube/pkg/openstack/types"
@@ -34,6 +37,9 @@ import (
 	kuberuntime "k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes/fake"
 	"k8s.io/client-go/kubernetes/scheme"
+	core "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
 )
 
 const (
@@ -51,7 +57,6 @@ var systemTenant = &crv1.Tenant{
 	},
 	Spec: crv1.TenantSpec{
 		UserName: util.SystemTenant,
-		Password: util.SystemPassword,
 	},
 }
 
@@ -101,11 +106,26 @@ func newNetworkController() (*NetworkController, *crdClient.FakeCRDClient, *open
 		k8sclient:     client,
 		kubeCRDClient: kubeCRDClient,
 		driver:        osClient,
+		networkStore:  cache.NewStore(cache.MetaNamespaceKeyFunc),
+		recorder:      events.NewFakeRecorder(),
+		queue: workqueue.NewRateLimitingQueue(
+			workqueue.NewItemExponentialFailureRateLimiter(time.Millisecond, 10*time.Millisecond)),
 	}
 
 	return c, kubeCRDClient, osClient, client, nil
 }
 
+// storeAndSync puts network in the informer store of controller, as if it
+// was watched from kube-apiserver, and syncs it.
+func storeAndSync(controller *NetworkController, network *crv1.Network) error {
+	controller.networkStore.Update(network)
+	key, err := cache.MetaNamespaceKeyFunc(network)
+	if err != nil {
+		return err
+	}
+	return controller.syncNetwork(key)
+}
+
 func TestCreateKubeDNSDeployment(t *testing.T) {
 	testNamespace := "foo"
 	// Created a new fake NetworkController.
@@ -236,7 +256,7 @@ func TestOnAdd(t *testing.T) {
 				// openstack injects fake tenant
 				osClient.SetTenant(util.BuildNetworkName(networkName, networkName), tenantID)
 				// Add network
-				controller.onAdd(network)
+				storeAndSync(controller, network)
 
 			},
 			expectedFn: func(networkName string) error {
@@ -289,7 +309,7 @@ func TestOnAdd(t *testing.T) {
 				net := osNetwork(util.BuildNetworkName(networkName, networkName), tenantID, "")
 				osClient.SetNetwork(net)
 				// Add network
-				controller.onAdd(network)
+				storeAndSync(controller, network)
 
 			},
 			expectedFn: func(networkName string) error {
@@ -334,7 +354,7 @@ func TestOnAdd(t *testing.T) {
 				net := osNetwork(util.BuildNetworkName(networkName, networkName), tenantID, networkID)
 				osClient.SetNetwork(net)
 				// Add network
-				controller.onAdd(network)
+				storeAndSync(controller, network)
 
 			},
 			expectedFn: func(networkName string) error {
@@ -374,7 +394,7 @@ func TestOnAdd(t *testing.T) {
 				network := newNetwork(networkName, "")
 				kubeCRDClient.SetNetworks(network)
 				// Add network
-				controller.onAdd(network)
+				storeAndSync(controller, network)
 
 			},
 			expectedFn: func(networkName string) error {
@@ -416,7 +436,7 @@ func TestOnAdd(t *testing.T) {
 				// openstack injects fake tenant
 				osClient.SetTenant(util.BuildNetworkName(networkName, networkName), tenantID)
 				// Add network
-				controller.onAdd(network)
+				storeAndSync(controller, network)
 
 			},
 			expectedFn: func(networkName string) error {
@@ -460,7 +480,7 @@ func TestOnAdd(t *testing.T) {
 				// openstack injects createNework error
 				osClient.InjectError("CreateNetwork", fmt.Errorf("Failed create network"))
 				// Add network
-				controller.onAdd(network)
+				storeAndSync(controller, network)
 
 			},
 			expectedFn: func(networkName string) error {
@@ -504,7 +524,7 @@ func TestOnAdd(t *testing.T) {
 				// openstack injects GetNetworkByName error
 				osClient.InjectError("GetNetworkByName", fmt.Errorf("Failed get network by name"))
 				// Add network
-				controller.onAdd(network)
+				storeAndSync(controller, network)
 
 			},
 			expectedFn: func(networkName string) error {
@@ -540,7 +560,6 @@ func TestOnAdd(t *testing.T) {
 
 func TestOnDelete(t *testing.T) {
 	var controller *NetworkController
-	var kubeCRDClient *crdClient.FakeCRDClient
 	var osClient *openstack.FakeOSClient
 	var client *fake.Clientset
 	var err error
@@ -557,7 +576,7 @@ func TestOnDelete(t *testing.T) {
 			updateFn: func(networkName string) {
 
 				// Created a new fake NetworkController
-				controller, kubeCRDClient, osClient, client, err = newNetworkController()
+				controller, _, osClient, client, err = newNetworkController()
 				if err != nil {
 					t.Fatalf("Failed start a new fake NetworkController")
 				}
@@ -600,7 +619,7 @@ func TestOnDelete(t *testing.T) {
 			updateFn: func(networkName string) {
 
 				// Created a new fake NetworkController
-				controller, kubeCRDClient, osClient, client, err = newNetworkController()
+				controller, _, osClient, client, err = newNetworkController()
 				if err != nil {
 					t.Fatalf("Failed start a new fake NetworkController")
 				}
@@ -645,7 +664,7 @@ func TestOnDelete(t *testing.T) {
 			updateFn: func(networkName string) {
 
 				// Created a new fake NetworkController
-				controller, kubeCRDClient, osClient, client, err = newNetworkController()
+				controller, _, osClient, client, err = newNetworkController()
 				if err != nil {
 					t.Fatalf("Failed start a new fake NetworkController")
 				}
@@ -693,6 +712,661 @@ func TestOnDelete(t *testing.T) {
 	}
 }
 
+func TestOnUpdate(t *testing.T) {
+	adminStateDown := false
+
+	testCases := []struct {
+		testName   string
+		updateFn   func(network *crv1.Network)
+		withPort   bool
+		injectErr  error
+		expectedFn func(network *crv1.Network, osNet *drivertypes.Network) error
+	}{
+		{
+			testName: "Update gateway, DNS nameservers and admin state, add subnet",
+			updateFn: func(network *crv1.Network) {
+				network.Spec.Gateway = "10.244.0.254"
+				network.Spec.DNSNameservers = []string{"8.8.8.8"}
+				network.Spec.AdminStateUp = &adminStateDown
+				network.Spec.Subnets = []crv1.NetworkSubnet{{CIDR: "10.245.0.0/16", Gateway: "10.245.0.1"}}
+			},
+			expectedFn: func(network *crv1.Network, osNet *drivertypes.Network) error {
+				if network.Status.State != crv1.NetworkActive || network.Status.Message != "" {
+					return fmt.Errorf("expected network status Active without message, got %v", network.Status)
+				}
+				if osNet.AdminStateUp == nil || *osNet.AdminStateUp {
+					return fmt.Errorf("expected network admin state down, got %v", osNet.AdminStateUp)
+				}
+				if len(osNet.Subnets) != 2 {
+					return fmt.Errorf("expected 2 subnets, got %d", len(osNet.Subnets))
+				}
+				first, second := osNet.Subnets[0], osNet.Subnets[1]
+				if first.Gateway != "10.244.0.254" || !reflect.DeepEqual(first.Dnsservers, []string{"8.8.8.8"}) {
+					return fmt.Errorf("unexpected first subnet %v", first)
+				}
+				if second.Cidr != "10.245.0.0/16" || second.Gateway != "10.245.0.1" ||
+					!reflect.DeepEqual(second.Dnsservers, []string{"8.8.8.8"}) {
+					return fmt.Errorf("unexpected second subnet %v", second)
+				}
+				return nil
+			},
+		},
+		{
+			testName: "Change CIDR without ports",
+			updateFn: func(network *crv1.Network) {
+				network.Spec.CIDR = "10.246.0.0/16"
+				network.Spec.Gateway = "10.246.0.1"
+			},
+			expectedFn: func(network *crv1.Network, osNet *drivertypes.Network) error {
+				if network.Status.State != crv1.NetworkActive {
+					return fmt.Errorf("expected network status Active, got %v", network.Status)
+				}
+				if len(osNet.Subnets) != 1 || osNet.Subnets[0].Cidr != "10.246.0.0/16" {
+					return fmt.Errorf("expected subnet 10.246.0.0/16, got %v", osNet.Subnets)
+				}
+				return nil
+			},
+		},
+		{
+			testName: "Change CIDR with ports is rejected",
+			updateFn: func(network *crv1.Network) {
+				network.Spec.CIDR = "10.246.0.0/16"
+				network.Spec.Gateway = "10.246.0.1"
+			},
+			withPort: true,
+			expectedFn: func(network *crv1.Network, osNet *drivertypes.Network) error {
+				if network.Status.State != crv1.NetworkActive {
+					return fmt.Errorf("expected network status Active, got %v", network.Status)
+				}
+				if !strings.Contains(network.Status.Message, "CIDR change rejected") {
+					return fmt.Errorf("expected CIDR change rejected message, got %q", network.Status.Message)
+				}
+				if len(osNet.Subnets) != 1 || osNet.Subnets[0].Cidr != userCIDR {
+					return fmt.Errorf("expected subnet %s unchanged, got %v", userCIDR, osNet.Subnets)
+				}
+				return nil
+			},
+		},
+		{
+			testName: "Update failed",
+			updateFn: func(network *crv1.Network) {
+				network.Spec.DNSNameservers = []string{"8.8.8.8"}
+			},
+			injectErr: fmt.Errorf("neutron unavailable"),
+			expectedFn: func(network *crv1.Network, osNet *drivertypes.Network) error {
+				if network.Status.State != crv1.NetworkFailed || network.Status.Message == "" {
+					return fmt.Errorf("expected network status Failed with message, got %v", network.Status)
+				}
+				return nil
+			},
+		},
+	}
+
+	for tci, tc := range testCases {
+		networkName := fmt.Sprintf("bar%d", tci)
+		controller, kubeCRDClient, osClient, _, err := newNetworkController()
+		if err != nil {
+			t.Fatalf("Failed start a new fake NetworkController")
+		}
+		kubeCRDClient.SetTenants(newTenant(networkName, tenantID))
+		oldNetwork := newNetwork(networkName, "")
+		kubeCRDClient.SetNetworks(oldNetwork)
+		osClient.SetTenant(util.BuildNetworkName(networkName, networkName), tenantID)
+		storeAndSync(controller, oldNetwork)
+
+		osNetName := util.BuildNetworkName(networkName, networkName)
+		if tc.withPort {
+			osClient.SetPort(osClient.Networks[osNetName].Uid, "compute:nova", "pod")
+		}
+		if tc.injectErr != nil {
+			osClient.InjectError("UpdateNetwork", tc.injectErr)
+		}
+
+		oldNetwork = kubeCRDClient.Networks[networkName]
+		newNetwork := oldNetwork.DeepCopy()
+		tc.updateFn(newNetwork)
+		storeAndSync(controller, newNetwork)
+
+		if err := tc.expectedFn(kubeCRDClient.Networks[networkName], osClient.Networks[osNetName]); err != nil {
+			t.Errorf("Case[%d]: %s %v", tci, tc.testName, err)
+		}
+	}
+}
+
+func TestOnUpdateEnqueue(t *testing.T) {
+	converged := newNetwork("foo", "")
+	converged.ResourceVersion = "1"
+	converged.Status.State = crv1.NetworkActive
+	setNetworkCondition(converged, crv1.NetworkDNSReady, apiv1.ConditionTrue, "KubeDNSCreated", "")
+
+	testCases := []struct {
+		testName        string
+		updateFn        func(network *crv1.Network)
+		resync          bool
+		expectedEnqueue bool
+	}{
+		{
+			testName: "Status only update",
+			updateFn: func(network *crv1.Network) {
+				network.ResourceVersion = "2"
+				network.Status.Message = "foo"
+			},
+		},
+		{
+			testName: "Spec update",
+			updateFn: func(network *crv1.Network) {
+				network.ResourceVersion = "2"
+				network.Spec.Gateway = "10.244.0.254"
+			},
+			expectedEnqueue: true,
+		},
+		{
+			testName: "Resync converged network",
+			updateFn: func(network *crv1.Network) {},
+			resync:   true,
+		},
+		{
+			testName: "Resync failed network",
+			updateFn: func(network *crv1.Network) {
+				network.Status.State = crv1.NetworkFailed
+			},
+			resync:          true,
+			expectedEnqueue: true,
+		},
+		{
+			testName: "Resync network without kube-dns",
+			updateFn: func(network *crv1.Network) {
+				network.Status.Conditions = nil
+			},
+			resync:          true,
+			expectedEnqueue: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		controller, _, _, _, err := newNetworkController()
+		if err != nil {
+			t.Fatalf("Failed start a new fake NetworkController")
+		}
+		oldNetwork := converged.DeepCopy()
+		newNetwork := converged.DeepCopy()
+		tc.updateFn(newNetwork)
+		if tc.resync {
+			// Resync delivers the cached object as both old and new.
+			oldNetwork = newNetwork.DeepCopy()
+		}
+		controller.onUpdate(oldNetwork, newNetwork)
+
+		if enqueued := controller.queue.Len() == 1; enqueued != tc.expectedEnqueue {
+			t.Errorf("Case[%s]: expected enqueue %v, got %v", tc.testName, tc.expectedEnqueue, enqueued)
+		}
+	}
+}
+
+func TestSyncNetworkRetry(t *testing.T) {
+	networkName := "retry"
+	osNetName := util.BuildNetworkName(networkName, networkName)
+
+	testCases := []struct {
+		testName        string
+		updateFn        func(network *crv1.Network, osClient *openstack.FakeOSClient, client *fake.Clientset)
+		expectedRequeue bool
+		expectedState   string
+	}{
+		{
+			testName: "Neutron create failure is retried",
+			updateFn: func(network *crv1.Network, osClient *openstack.FakeOSClient, client *fake.Clientset) {
+				osClient.InjectError("CreateNetwork", fmt.Errorf("neutron unavailable"))
+			},
+			expectedRequeue: true,
+			expectedState:   crv1.NetworkFailed,
+		},
+		{
+			testName: "Neutron get failure is retried",
+			updateFn: func(network *crv1.Network, osClient *openstack.FakeOSClient, client *fake.Clientset) {
+				osClient.InjectError("GetNetworkByName", fmt.Errorf("neutron unavailable"))
+			},
+			expectedRequeue: true,
+			expectedState:   crv1.NetworkFailed,
+		},
+		{
+			testName: "Neutron update failure is retried",
+			updateFn: func(network *crv1.Network, osClient *openstack.FakeOSClient, client *fake.Clientset) {
+				// The network was created before, and its spec is changed.
+				network.Status.State = crv1.NetworkActive
+				osClient.SetNetwork(osNetwork(osNetName, tenantID, networkID))
+				osClient.InjectError("UpdateNetwork", fmt.Errorf("neutron unavailable"))
+			},
+			expectedRequeue: true,
+			expectedState:   crv1.NetworkFailed,
+		},
+		{
+			testName: "Kube-dns failure is retried",
+			updateFn: func(network *crv1.Network, osClient *openstack.FakeOSClient, client *fake.Clientset) {
+				failed := false
+				client.PrependReactor("create", "deployments", func(action core.Action) (bool, kuberuntime.Object, error) {
+					if failed {
+						return false, nil, nil
+					}
+					failed = true
+					return true, nil, fmt.Errorf("create deployment failed")
+				})
+			},
+			expectedRequeue: true,
+			expectedState:   crv1.NetworkActive,
+		},
+		{
+			testName: "Invalid spec is not retried",
+			updateFn: func(network *crv1.Network, osClient *openstack.FakeOSClient, client *fake.Clientset) {
+				network.Spec.CIDR = "10.244.0.0"
+			},
+			expectedState: crv1.NetworkFailed,
+		},
+	}
+
+	for _, tc := range testCases {
+		controller, kubeCRDClient, osClient, client, err := newNetworkController()
+		if err != nil {
+			t.Fatalf("Failed start a new fake NetworkController")
+		}
+		kubeCRDClient.SetTenants(newTenant(networkName, tenantID))
+		osClient.SetTenant(osNetName, tenantID)
+		network := newNetwork(networkName, "")
+		tc.updateFn(network, osClient, client)
+		kubeCRDClient.SetNetworks(network)
+		controller.networkStore.Add(network)
+
+		key := networkName + "/" + networkName
+		controller.queue.Add(key)
+		controller.processNextWorkItem()
+
+		network = kubeCRDClient.Networks[networkName]
+		if network.Status.State != tc.expectedState {
+			t.Errorf("Case[%s]: expected state %s, got %s", tc.testName, tc.expectedState, network.Status.State)
+		}
+		if requeued := controller.queue.NumRequeues(key) == 1; requeued != tc.expectedRequeue {
+			t.Errorf("Case[%s]: expected requeue %v, got %v", tc.testName, tc.expectedRequeue, requeued)
+		}
+		if !tc.expectedRequeue {
+			continue
+		}
+
+		// Neutron recovers, the network converges on the next retry.
+		controller.networkStore.Update(network)
+		controller.processNextWorkItem()
+
+		network = kubeCRDClient.Networks[networkName]
+		if !networkConverged(network) {
+			t.Errorf("Case[%s]: expected network converged after retry, got %v", tc.testName, network.Status)
+		}
+		if controller.queue.NumRequeues(key) != 0 {
+			t.Errorf("Case[%s]: expected retries of network forgotten", tc.testName)
+		}
+		if err := testKubeDNSDeploymentCreated(t, client, networkName); err != nil {
+			t.Errorf("Case[%s]: %v", tc.testName, err)
+		}
+	}
+}
+
+func TestOnAddDualStack(t *testing.T) {
+	networkName := "dual"
+	controller, kubeCRDClient, osClient, _, err := newNetworkController()
+	if err != nil {
+		t.Fatalf("Failed start a new fake NetworkController")
+	}
+	kubeCRDClient.SetTenants(newTenant(networkName, tenantID))
+	network := newNetwork(networkName, "")
+	network.Spec.Subnets = []crv1.NetworkSubnet{
+		{CIDR: "fd00:244::/64", Gateway: "fd00:244::1", IPv6Mode: crv1.IPv6ModeSLAAC},
+	}
+	network.Spec.DNSNameservers = []string{"8.8.8.8"}
+	network.Spec.HostRoutes = []crv1.HostRoute{{Destination: "192.168.0.0/16", Nexthop: "10.244.0.254"}}
+	network.Spec.AllocationPools = []crv1.AllocationPool{{Start: "10.244.1.1", End: "10.244.1.254"}}
+	kubeCRDClient.SetNetworks(network)
+	osClient.SetTenant(util.BuildNetworkName(networkName, networkName), tenantID)
+	storeAndSync(controller, network)
+
+	if state := kubeCRDClient.Networks[networkName].Status.State; state != crv1.NetworkActive {
+		t.Fatalf("Expected network status Active, got %v", state)
+	}
+	osNetName := util.BuildNetworkName(networkName, networkName)
+	subnets := osClient.Networks[osNetName].Subnets
+	if len(subnets) != 2 {
+		t.Fatalf("Expected 2 subnets, got %d", len(subnets))
+	}
+	if subnets[0].IPVersion != 4 || subnets[0].Name != osNetName+"-subnet" {
+		t.Errorf("Unexpected IPv4 subnet %v", subnets[0])
+	}
+	if subnets[1].IPVersion != 6 || subnets[1].IPv6Mode != crv1.IPv6ModeSLAAC || subnets[1].Name != osNetName+"-subnet-1" {
+		t.Errorf("Unexpected IPv6 subnet %v", subnets[1])
+	}
+	if len(subnets[0].Routes) != 1 || subnets[0].Routes[0].DestinationCIDR != "192.168.0.0/16" || subnets[0].Routes[0].Nexthop != "10.244.0.254" {
+		t.Errorf("Unexpected host routes %v", subnets[0].Routes)
+	}
+	if len(subnets[0].AllocationPools) != 1 || subnets[0].AllocationPools[0].Start != "10.244.1.1" {
+		t.Errorf("Unexpected allocation pools %v", subnets[0].AllocationPools)
+	}
+	if len(subnets[1].Routes) != 0 || len(subnets[1].AllocationPools) != 0 {
+		t.Errorf("Expected no host routes or allocation pools on IPv6 subnet, got %v", subnets[1])
+	}
+	for _, subnet := range subnets {
+		if !reflect.DeepEqual(subnet.Dnsservers, []string{"8.8.8.8"}) {
+			t.Errorf("Unexpected DNS nameservers %v of subnet %s", subnet.Dnsservers, subnet.Name)
+		}
+	}
+}
+
+func TestOnAddTenantNamespace(t *testing.T) {
+	networkName := "staging"
+	teamTenantID := "team-id"
+	controller, kubeCRDClient, osClient, _, err := newNetworkController()
+	if err != nil {
+		t.Fatalf("Failed start a new fake NetworkController")
+	}
+	// Namespace staging is owned by tenant team.
+	kubeCRDClient.SetTenants(newTenant("team", teamTenantID))
+	osClient.SetTenant("team", teamTenantID)
+	osClient.SetNamespace(&apiv1.Namespace{
+		ObjectMeta: apismetav1.ObjectMeta{
+			Name:   networkName,
+			Labels: map[string]string{util.TenantLabel: "team"},
+		},
+	})
+	network := newNetwork(networkName, "")
+	kubeCRDClient.SetNetworks(network)
+	if err := storeAndSync(controller, network); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	osNetwork, ok := osClient.Networks[util.BuildNetworkName(networkName, networkName)]
+	if !ok || osNetwork.TenantID != teamTenantID {
+		t.Errorf("Expected network in tenant %s, got %v", teamTenantID, osNetwork)
+	}
+}
+
+func TestOnAddStatus(t *testing.T) {
+	networkName := "status"
+	osNetName := util.BuildNetworkName(networkName, networkName)
+
+	testCases := []struct {
+		testName           string
+		injectErr          string
+		dnsErr             bool
+		expectedState      string
+		expectedConditions map[crv1.NetworkConditionType]apiv1.ConditionStatus
+		expectedEvents     []string
+	}{
+		{
+			testName:      "Network created",
+			expectedState: crv1.NetworkActive,
+			expectedConditions: map[crv1.NetworkConditionType]apiv1.ConditionStatus{
+				crv1.NetworkCreated:        apiv1.ConditionTrue,
+				crv1.NetworkRouterAttached: apiv1.ConditionTrue,
+				crv1.NetworkDNSReady:       apiv1.ConditionTrue,
+			},
+			expectedEvents: []string{"Normal CreatingNetwork", "Normal NetworkCreated"},
+		},
+		{
+			testName:      "Network create failed",
+			injectErr:     "CreateNetwork",
+			expectedState: crv1.NetworkFailed,
+			expectedConditions: map[crv1.NetworkConditionType]apiv1.ConditionStatus{
+				crv1.NetworkCreated: apiv1.ConditionFalse,
+			},
+			expectedEvents: []string{"Normal CreatingNetwork", "Warning CreateFailed"},
+		},
+		{
+			testName:      "Kube-dns create failed",
+			dnsErr:        true,
+			expectedState: crv1.NetworkActive,
+			expectedConditions: map[crv1.NetworkConditionType]apiv1.ConditionStatus{
+				crv1.NetworkCreated:        apiv1.ConditionTrue,
+				crv1.NetworkRouterAttached: apiv1.ConditionTrue,
+				crv1.NetworkDNSReady:       apiv1.ConditionFalse,
+			},
+			expectedEvents: []string{"Normal CreatingNetwork", "Normal NetworkCreated", "Warning KubeDNSFailed"},
+		},
+	}
+
+	for _, tc := range testCases {
+		controller, kubeCRDClient, osClient, client, err := newNetworkController()
+		if err != nil {
+			t.Fatalf("Failed start a new fake NetworkController")
+		}
+		if tc.injectErr != "" {
+			osClient.InjectError(tc.injectErr, fmt.Errorf("%s failed", tc.injectErr))
+		}
+		if tc.dnsErr {
+			client.PrependReactor("create", "deployments", func(action core.Action) (bool, kuberuntime.Object, error) {
+				return true, nil, fmt.Errorf("create deployment failed")
+			})
+		}
+		kubeCRDClient.SetTenants(newTenant(networkName, tenantID))
+		network := newNetwork(networkName, "")
+		network.Generation = 2
+		kubeCRDClient.SetNetworks(network)
+		osClient.SetTenant(osNetName, tenantID)
+		storeAndSync(controller, network)
+
+		network = kubeCRDClient.Networks[networkName]
+		if network.Status.State != tc.expectedState {
+			t.Errorf("Case[%s]: expected state %s, got %s", tc.testName, tc.expectedState, network.Status.State)
+		}
+		if len(network.Status.Conditions) != len(tc.expectedConditions) {
+			t.Errorf("Case[%s]: unexpected conditions %v", tc.testName, network.Status.Conditions)
+		}
+		for conditionType, status := range tc.expectedConditions {
+			condition := getNetworkCondition(network, conditionType)
+			if condition == nil {
+				t.Errorf("Case[%s]: condition %s not set", tc.testName, conditionType)
+				continue
+			}
+			if condition.Status != status || condition.ObservedGeneration != 2 {
+				t.Errorf("Case[%s]: unexpected condition %v", tc.testName, condition)
+			}
+			if status == apiv1.ConditionFalse && condition.Message == "" {
+				t.Errorf("Case[%s]: expected message of condition %s", tc.testName, conditionType)
+			}
+		}
+		var reasons []string
+		for _, event := range controller.recorder.(*events.FakeRecorder).GetEvents() {
+			fields := strings.SplitN(event, " ", 3)
+			reasons = append(reasons, fields[0]+" "+fields[1])
+		}
+		if !reflect.DeepEqual(reasons, tc.expectedEvents) {
+			t.Errorf("Case[%s]: expected events %v, got %v", tc.testName, tc.expectedEvents, reasons)
+		}
+
+		if tc.expectedState != crv1.NetworkActive {
+			continue
+		}
+		osNet := osClient.Networks[osNetName]
+		if network.Status.NetworkID != osNet.Uid || network.Status.RouterID != osNet.RouterID || network.Status.RouterID == "" {
+			t.Errorf("Case[%s]: unexpected neutron resources in status %v", tc.testName, network.Status)
+		}
+		if len(network.Status.SubnetIDs) != 1 || network.Status.SubnetIDs[0] != osNet.Subnets[0].Uid {
+			t.Errorf("Case[%s]: unexpected subnet IDs %v", tc.testName, network.Status.SubnetIDs)
+		}
+	}
+}
+
+func TestFinalizeNetwork(t *testing.T) {
+	networkName := "final"
+	osNetName := util.BuildNetworkName(networkName, networkName)
+	controller, kubeCRDClient, osClient, client, err := newNetworkController()
+	if err != nil {
+		t.Fatalf("Failed start a new fake NetworkController")
+	}
+	kubeCRDClient.SetTenants(newTenant(networkName, tenantID))
+	osClient.SetTenant(osNetName, tenantID)
+	network := newNetwork(networkName, "")
+	kubeCRDClient.SetNetworks(network)
+	if err := storeAndSync(controller, network); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !util.HasFinalizer(kubeCRDClient.Networks[networkName], crv1.Finalizer) {
+		t.Fatalf("Expected finalizer added to network")
+	}
+
+	// Delete the network while neutron is unavailable.
+	network = kubeCRDClient.Networks[networkName].DeepCopy()
+	now := apismetav1.Now()
+	network.DeletionTimestamp = &now
+	osClient.InjectError("DeleteNetwork", fmt.Errorf("neutron unavailable"))
+	if err := storeAndSync(controller, network); err == nil {
+		t.Errorf("Expected error when neutron is unavailable")
+	}
+	network = kubeCRDClient.Networks[networkName]
+	if network.Status.State != crv1.NetworkTerminating || network.Status.Message == "" {
+		t.Errorf("Expected network Terminating with message, got %v", network.Status)
+	}
+	if !util.HasFinalizer(network, crv1.Finalizer) {
+		t.Errorf("Expected finalizer kept until network is cleaned up")
+	}
+	if _, ok := osClient.Networks[osNetName]; !ok {
+		t.Errorf("Expected neutron network %s kept", osNetName)
+	}
+
+	// The retry cleans up the network.
+	if err := storeAndSync(controller, network); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if util.HasFinalizer(kubeCRDClient.Networks[networkName], crv1.Finalizer) {
+		t.Errorf("Expected finalizer removed")
+	}
+	if _, ok := osClient.Networks[osNetName]; ok {
+		t.Errorf("Expected neutron network %s deleted", osNetName)
+	}
+	if err := testKubeDNSDeploymentDeletedOrNoCreated(t, client, networkName); err != nil {
+		t.Error(err)
+	}
+	if err := testKubeDNSServiceDeletedOrNoCreated(t, client, networkName); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestValidateNetworkSpec(t *testing.T) {
+	testCases := []struct {
+		testName    string
+		spec        crv1.NetworkSpec
+		expectedErr bool
+	}{
+		{
+			testName: "IPv4 cidr",
+			spec:     crv1.NetworkSpec{CIDR: userCIDR, Gateway: userGateway},
+		},
+		{
+			testName: "IPv6 only",
+			spec: crv1.NetworkSpec{Subnets: []crv1.NetworkSubnet{
+				{CIDR: "fd00::/64", IPVersion: 6, IPv6Mode: crv1.IPv6ModeDHCPv6Stateful},
+			}},
+		},
+		{
+			testName: "Provider network",
+			spec:     crv1.NetworkSpec{NetworkID: networkID},
+		},
+		{
+			testName:    "No subnets",
+			spec:        crv1.NetworkSpec{},
+			expectedErr: true,
+		},
+		{
+			testName:    "Invalid cidr",
+			spec:        crv1.NetworkSpec{CIDR: "10.244.0.0"},
+			expectedErr: true,
+		},
+		{
+			testName: "Duplicate cidr",
+			spec: crv1.NetworkSpec{CIDR: userCIDR, Subnets: []crv1.NetworkSubnet{
+				{CIDR: "10.244.1.0/16"},
+			}},
+			expectedErr: true,
+		},
+		{
+			testName: "Mismatched ip version",
+			spec: crv1.NetworkSpec{CIDR: userCIDR, Subnets: []crv1.NetworkSubnet{
+				{CIDR: "10.245.0.0/16", IPVersion: 6},
+			}},
+			expectedErr: true,
+		},
+		{
+			testName: "IPv6 mode on IPv4 cidr",
+			spec: crv1.NetworkSpec{Subnets: []crv1.NetworkSubnet{
+				{CIDR: userCIDR, IPv6Mode: crv1.IPv6ModeSLAAC},
+			}},
+			expectedErr: true,
+		},
+		{
+			testName: "Invalid IPv6 mode",
+			spec: crv1.NetworkSpec{Subnets: []crv1.NetworkSubnet{
+				{CIDR: "fd00::/64", IPv6Mode: "dhcp"},
+			}},
+			expectedErr: true,
+		},
+		{
+			testName:    "Gateway out of cidr",
+			spec:        crv1.NetworkSpec{CIDR: userCIDR, Gateway: "10.245.0.1"},
+			expectedErr: true,
+		},
+		{
+			testName: "DNS, host routes and allocation pools",
+			spec: crv1.NetworkSpec{
+				CIDR:           userCIDR,
+				Gateway:        userGateway,
+				DNSNameservers: []string{"8.8.8.8", "2001:4860:4860::8888"},
+				HostRoutes:     []crv1.HostRoute{{Destination: "192.168.0.0/16", Nexthop: "10.244.0.254"}},
+				AllocationPools: []crv1.AllocationPool{
+					{Start: "10.244.1.1", End: "10.244.1.254"},
+				},
+			},
+		},
+		{
+			testName:    "Invalid DNS nameserver",
+			spec:        crv1.NetworkSpec{CIDR: userCIDR, DNSNameservers: []string{"dns.example.com"}},
+			expectedErr: true,
+		},
+		{
+			testName: "Host route with mismatched nexthop",
+			spec: crv1.NetworkSpec{CIDR: userCIDR, HostRoutes: []crv1.HostRoute{
+				{Destination: "192.168.0.0/16", Nexthop: "fd00::1"},
+			}},
+			expectedErr: true,
+		},
+		{
+			testName: "Allocation pool out of cidr",
+			spec: crv1.NetworkSpec{CIDR: userCIDR, AllocationPools: []crv1.AllocationPool{
+				{Start: "10.244.0.10", End: "10.245.0.10"},
+			}},
+			expectedErr: true,
+		},
+		{
+			testName: "Allocation pool start after end",
+			spec: crv1.NetworkSpec{CIDR: userCIDR, AllocationPools: []crv1.AllocationPool{
+				{Start: "10.244.0.20", End: "10.244.0.10"},
+			}},
+			expectedErr: true,
+		},
+		{
+			testName: "Host routes without cidr",
+			spec: crv1.NetworkSpec{
+				HostRoutes: []crv1.HostRoute{{Destination: "192.168.0.0/16", Nexthop: "10.244.0.254"}},
+				Subnets:    []crv1.NetworkSubnet{{CIDR: userCIDR}},
+			},
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		err := validateNetworkSpec(&tc.spec)
+		if tc.expectedErr && err == nil {
+			t.Errorf("Case[%s]: expected error, got nil", tc.testName)
+		}
+		if !tc.expectedErr && err != nil {
+			t.Errorf("Case[%s]: unexpected error: %v", tc.testName, err)
+		}
+	}
+}
+
 func testKubeDNSDeploymentCreated(t *testing.T, client *fake.Clientset, namespace string) error {
 	kubeDNSDeploy, err := client.ExtensionsV1beta1().Deployments(namespace).Get("kube-dns", apismetav1.GetOptions{})
 	if err != nil {
@@ -0,0 +1,228 @@
+/*
+Copyright (c) 2017 OpenStack Foundation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/pem"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/gophercloud/gophercloud"
+)
+
+// TLSCertificate is the certificate of the TERMINATED_HTTPS listeners of a
+// load balancer, it's stored as a barbican certificate container.
+type TLSCertificate struct {
+	// Certificate is the PEM encoded certificate, followed by its
+	// intermediates.
+	Certificate []byte
+	// PrivateKey is the PEM encoded private key.
+	PrivateKey []byte
+}
+
+type barbicanSecretRef struct {
+	Name      string `json:"name"`
+	SecretRef string `json:"secret_ref"`
+}
+
+type barbicanContainer struct {
+	Name         string              `json:"name"`
+	ContainerRef string              `json:"container_ref,omitempty"`
+	Type         string              `json:"type"`
+	SecretRefs   []barbicanSecretRef `json:"secret_refs"`
+}
+
+// newKeyManagerV1 returns the client of the barbican v1 API.
+func newKeyManagerV1(provider *gophercloud.ProviderClient, region string) (*gophercloud.ServiceClient, error) {
+	endpoint, err := provider.EndpointLocator(gophercloud.EndpointOpts{
+		Type:   "key-manager",
+		Region: region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find barbican endpoint: %v", err)
+	}
+
+	// The catalog may register a versionless or a v1 endpoint.
+	endpoint = strings.TrimSuffix(gophercloud.NormalizeURL(endpoint), "v1/")
+	return &gophercloud.ServiceClient{
+		ProviderClient: provider,
+		Endpoint:       endpoint,
+		ResourceBase:   endpoint + "v1/",
+	}, nil
+}
+
+func createSecret(client *gophercloud.ServiceClient, name, secretType string, payload []byte) (string, error) {
+	var s struct {
+		SecretRef string `json:"secret_ref"`
+	}
+	body := map[string]interface{}{
+		"name":                 name,
+		"secret_type":          secretType,
+		"payload":              string(payload),
+		"payload_content_type": "text/plain",
+	}
+	_, err := client.Post(client.ServiceURL("secrets"), body, &s, &gophercloud.RequestOpts{
+		OkCodes: []int{201},
+	})
+	return s.SecretRef, err
+}
+
+func listContainers(client *gophercloud.ServiceClient, name string) ([]barbicanContainer, error) {
+	var s struct {
+		Containers []barbicanContainer `json:"containers"`
+	}
+	query := url.Values{"name": []string{name}}
+	_, err := client.Get(withQuery(client.ServiceURL("containers"), query), &s, nil)
+	return s.Containers, err
+}
+
+func createContainer(client *gophercloud.ServiceClient, container *barbicanContainer) (string, error) {
+	var s struct {
+		ContainerRef string `json:"container_ref"`
+	}
+	_, err := client.Post(client.ServiceURL("containers"), container, &s, &gophercloud.RequestOpts{
+		OkCodes: []int{201},
+	})
+	return s.ContainerRef, err
+}
+
+// ensureTLSContainer ensures the certificate container of the load balancer
+// named lbName is created, and returns its reference. Containers are named
+// by the hash of the certificate, so that a new container is created when the
+// certificate is renewed.
+func (os *Client) ensureTLSContainer(lbName string, cert *TLSCertificate) (string, error) {
+	client, err := newKeyManagerV1(os.Provider, os.Region)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	hash.Write(cert.Certificate)
+	hash.Write(cert.PrivateKey)
+	name := fmt.Sprintf("%s_%x", lbName, hash.Sum(nil)[:8])
+	containers, err := listContainers(client, name)
+	if err != nil {
+		return "", fmt.Errorf("error listing certificate containers %q: %v", name, err)
+	}
+	if len(containers) > 0 {
+		return containers[0].ContainerRef, nil
+	}
+
+	certificate, intermediates := splitCertificateChain(cert.Certificate)
+	if len(certificate) == 0 {
+		return "", fmt.Errorf("no PEM encoded certificate found for load balancer %q", lbName)
+	}
+	secrets := []struct {
+		name       string
+		secretType string
+		payload    []byte
+	}{
+		{name: "certificate", secretType: "certificate", payload: certificate},
+		{name: "private_key", secretType: "private", payload: cert.PrivateKey},
+		{name: "intermediates", secretType: "certificate", payload: intermediates},
+	}
+
+	container := &barbicanContainer{Name: name, Type: "certificate"}
+	for _, secret := range secrets {
+		if len(secret.payload) == 0 {
+			continue
+		}
+		ref, err := createSecret(client, name+"_"+secret.name, secret.secretType, secret.payload)
+		if err != nil {
+			deleteSecrets(client, container.SecretRefs)
+			return "", fmt.Errorf("error creating %s secret %q: %v", secret.name, name, err)
+		}
+		container.SecretRefs = append(container.SecretRefs, barbicanSecretRef{Name: secret.name, SecretRef: ref})
+	}
+
+	ref, err := createContainer(client, container)
+	if err != nil {
+		deleteSecrets(client, container.SecretRefs)
+		return "", fmt.Errorf("error creating certificate container %q: %v", name, err)
+	}
+	glog.V(3).Infof("Created certificate container %s for load balancer %s", name, lbName)
+	return ref, nil
+}
+
+// deleteSecrets deletes the secrets left by a failed creation of a
+// certificate container. Failures are only logged, since the creation
+// error is returned instead.
+func deleteSecrets(client *gophercloud.ServiceClient, secrets []barbicanSecretRef) {
+	for _, secret := range secrets {
+		_, err := client.Delete(secret.SecretRef, nil)
+		if err != nil && !isNotFound(err) {
+			glog.Errorf("Delete secret %s failed: %v", secret.SecretRef, err)
+		}
+	}
+}
+
+// deleteTLSContainer deletes the certificate container and its secrets.
+func (os *Client) deleteTLSContainer(containerRef string) error {
+	client, err := newKeyManagerV1(os.Provider, os.Region)
+	if err != nil {
+		return err
+	}
+
+	var container barbicanContainer
+	_, err = client.Get(containerRef, &container, nil)
+	if err != nil {
+		if isNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	_, err = client.Delete(containerRef, nil)
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+	for _, secret := range container.SecretRefs {
+		_, err = client.Delete(secret.SecretRef, nil)
+		if err != nil && !isNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// splitCertificateChain splits a PEM encoded certificate chain into the
+// first certificate and its intermediates.
+func splitCertificateChain(chain []byte) ([]byte, []byte) {
+	var certificate, intermediates bytes.Buffer
+	for {
+		var block *pem.Block
+		block, chain = pem.Decode(chain)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		if certificate.Len() == 0 {
+			pem.Encode(&certificate, block)
+		} else {
+			pem.Encode(&intermediates, block)
+		}
+	}
+
+	return certificate.Bytes(), intermediates.Bytes()
+}
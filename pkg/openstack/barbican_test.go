@@ -0,0 +1,234 @@
+/*
+Copyright (c) 2017 OpenStack Foundation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gophercloud/gophercloud"
+)
+
+func pemBlock(blockType, data string) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: []byte(data)})
+}
+
+func concat(blocks ...[]byte) []byte {
+	var result []byte
+	for _, block := range blocks {
+		result = append(result, block...)
+	}
+	return result
+}
+
+func TestSplitCertificateChain(t *testing.T) {
+	leaf := pemBlock("CERTIFICATE", "leaf")
+	intermediate := pemBlock("CERTIFICATE", "intermediate")
+	root := pemBlock("CERTIFICATE", "root")
+	key := pemBlock("RSA PRIVATE KEY", "key")
+
+	testCases := []struct {
+		testName              string
+		chain                 []byte
+		expectedCertificate   []byte
+		expectedIntermediates []byte
+	}{
+		{
+			testName:            "Single certificate",
+			chain:               leaf,
+			expectedCertificate: leaf,
+		},
+		{
+			testName:              "Certificate chain",
+			chain:                 concat(leaf, key, intermediate, root),
+			expectedCertificate:   leaf,
+			expectedIntermediates: concat(intermediate, root),
+		},
+		{
+			testName: "No certificate",
+			chain:    []byte("not PEM"),
+		},
+	}
+
+	for _, tc := range testCases {
+		certificate, intermediates := splitCertificateChain(tc.chain)
+		if string(certificate) != string(tc.expectedCertificate) {
+			t.Errorf("Case[%s]: expected certificate %q, got %q", tc.testName, tc.expectedCertificate, certificate)
+		}
+		if string(intermediates) != string(tc.expectedIntermediates) {
+			t.Errorf("Case[%s]: expected intermediates %q, got %q", tc.testName, tc.expectedIntermediates, intermediates)
+		}
+	}
+}
+
+func TestEnsureTLSContainer(t *testing.T) {
+	var server *httptest.Server
+	var secrets []string
+	containers := make(map[string]barbicanContainer)
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/v1/secrets":
+			var s struct {
+				Name string `json:"name"`
+			}
+			json.NewDecoder(r.Body).Decode(&s)
+			secrets = append(secrets, s.Name)
+			writeJSON(w, http.StatusCreated, map[string]string{
+				"secret_ref": fmt.Sprintf("%s/v1/secrets/%d", server.URL, len(secrets)),
+			})
+		case r.Method == "POST" && r.URL.Path == "/v1/containers":
+			var container barbicanContainer
+			json.NewDecoder(r.Body).Decode(&container)
+			container.ContainerRef = fmt.Sprintf("%s/v1/containers/%d", server.URL, len(containers)+1)
+			containers[container.Name] = container
+			writeJSON(w, http.StatusCreated, map[string]string{"container_ref": container.ContainerRef})
+		case r.Method == "GET" && r.URL.Path == "/v1/containers":
+			list := []barbicanContainer{}
+			if container, ok := containers[r.URL.Query().Get("name")]; ok {
+				list = append(list, container)
+			}
+			writeJSON(w, http.StatusOK, map[string]interface{}{"containers": list})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := &Client{
+		Provider: &gophercloud.ProviderClient{
+			EndpointLocator: func(opts gophercloud.EndpointOpts) (string, error) {
+				return server.URL + "/", nil
+			},
+		},
+	}
+
+	cert := &TLSCertificate{
+		Certificate: concat(pemBlock("CERTIFICATE", "leaf"), pemBlock("CERTIFICATE", "intermediate")),
+		PrivateKey:  pemBlock("RSA PRIVATE KEY", "key"),
+	}
+	ref, err := client.ensureTLSContainer("stackube_default_svc", cert)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(containers) != 1 {
+		t.Fatalf("Expected one container to be created, got %v", containers)
+	}
+	for _, container := range containers {
+		if container.ContainerRef != ref {
+			t.Errorf("Expected container ref %s, got %s", container.ContainerRef, ref)
+		}
+		var names []string
+		for _, secret := range container.SecretRefs {
+			names = append(names, secret.Name)
+		}
+		expected := []string{"certificate", "private_key", "intermediates"}
+		if !reflect.DeepEqual(names, expected) {
+			t.Errorf("Expected container secrets %v, got %v", expected, names)
+		}
+	}
+
+	// The container of the same certificate is reused.
+	again, err := client.ensureTLSContainer("stackube_default_svc", cert)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if again != ref || len(secrets) != 3 {
+		t.Errorf("Expected container %s to be reused, got %s with secrets %v", ref, again, secrets)
+	}
+
+	// A renewed certificate gets a new container.
+	renewed := &TLSCertificate{
+		Certificate: pemBlock("CERTIFICATE", "renewed"),
+		PrivateKey:  cert.PrivateKey,
+	}
+	if _, err := client.ensureTLSContainer("stackube_default_svc", renewed); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(containers) != 2 {
+		t.Errorf("Expected a new container for the renewed certificate, got %v", containers)
+	}
+}
+
+func TestEnsureTLSContainerCleanup(t *testing.T) {
+	testCases := []struct {
+		testName        string
+		failPath        string
+		expectedDeleted []string
+	}{
+		{
+			testName:        "Container creation fails",
+			failPath:        "/v1/containers",
+			expectedDeleted: []string{"/v1/secrets/1", "/v1/secrets/2", "/v1/secrets/3"},
+		},
+		{
+			testName:        "Secret creation fails",
+			failPath:        "/v1/secrets/3",
+			expectedDeleted: []string{"/v1/secrets/1", "/v1/secrets/2"},
+		},
+	}
+
+	for _, tc := range testCases {
+		var server *httptest.Server
+		var secrets, deleted []string
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.Method == "POST" && r.URL.Path == "/v1/secrets":
+				secrets = append(secrets, "")
+				if tc.failPath == fmt.Sprintf("/v1/secrets/%d", len(secrets)) {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				writeJSON(w, http.StatusCreated, map[string]string{
+					"secret_ref": fmt.Sprintf("%s/v1/secrets/%d", server.URL, len(secrets)),
+				})
+			case r.Method == "POST" && r.URL.Path == tc.failPath:
+				w.WriteHeader(http.StatusInternalServerError)
+			case r.Method == "GET" && r.URL.Path == "/v1/containers":
+				writeJSON(w, http.StatusOK, map[string]interface{}{"containers": []barbicanContainer{}})
+			case r.Method == "DELETE":
+				deleted = append(deleted, r.URL.Path)
+				w.WriteHeader(http.StatusNoContent)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		client := &Client{
+			Provider: &gophercloud.ProviderClient{
+				EndpointLocator: func(opts gophercloud.EndpointOpts) (string, error) {
+					return server.URL + "/", nil
+				},
+			},
+		}
+		cert := &TLSCertificate{
+			Certificate: concat(pemBlock("CERTIFICATE", "leaf"), pemBlock("CERTIFICATE", "intermediate")),
+			PrivateKey:  pemBlock("RSA PRIVATE KEY", "key"),
+		}
+		if _, err := client.ensureTLSContainer("stackube_default_svc", cert); err == nil {
+			t.Errorf("Case[%s]: expected error", tc.testName)
+		}
+		if !reflect.DeepEqual(deleted, tc.expectedDeleted) {
+			t.Errorf("Case[%s]: expected secrets %v deleted, got %v", tc.testName, tc.expectedDeleted, deleted)
+		}
+		server.Close()
+	}
+}
@@ -19,7 +19,10 @@ package openstack
 import (
 	"errors"
 	"fmt"
+	"net"
 	"os"
+	"reflect"
+	"strings"
 
 	crv1 "git.openstack.org/openstack/stackube/pkg/apis/v1"
 	crdClient "git.openstack.org/openstack/stackube/pkg/kubecrd"
@@ -30,8 +33,6 @@ import (
 	"github.com/golang/glog"
 	"github.com/gophercloud/gophercloud"
 	"github.com/gophercloud/gophercloud/openstack"
-	"github.com/gophercloud/gophercloud/openstack/identity/v2/tenants"
-	"github.com/gophercloud/gophercloud/openstack/identity/v2/users"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/layer3/routers"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/portsbinding"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/security/groups"
@@ -42,6 +43,7 @@ import (
 	"github.com/gophercloud/gophercloud/pagination"
 
 	gcfg "gopkg.in/gcfg.v1"
+	"k8s.io/client-go/kubernetes"
 )
 
 const (
@@ -51,6 +53,12 @@ const (
 	securitygroupName = "kube-securitygroup-default"
 	HostnameMaxLen    = 63
 
+	// Keystone defaults for tenants
+	defaultTenantDomainID = "default"
+	defaultMemberRole     = "member"
+	defaultAdminRole      = "admin"
+	defaultReaderRole     = "reader"
+
 	// Service affinities
 	ServiceAffinityNone     = "None"
 	ServiceAffinityClientIP = "ClientIP"
@@ -63,6 +71,23 @@ var (
 	ErrMultipleResults = errors.New("MultipleResults")
 )
 
+// SubnetInUseError is returned by UpdateNetwork if a subnet to be deleted
+// still has ports on it.
+type SubnetInUseError struct {
+	CIDR  string
+	Ports int
+}
+
+func (e *SubnetInUseError) Error() string {
+	return fmt.Sprintf("subnet %s still has %d ports in use", e.CIDR, e.Ports)
+}
+
+// IsSubnetInUse determines if the err is a SubnetInUseError.
+func IsSubnetInUse(err error) bool {
+	_, ok := err.(*SubnetInUseError)
+	return ok
+}
+
 // Interface should be implemented by a openstack client.
 type Interface interface {
 	// CreateTenant creates tenant by tenantname.
@@ -71,18 +96,44 @@ type Interface interface {
 	DeleteTenant(tenantName string) error
 	// GetTenantIDFromName gets tenantID by tenantName.
 	GetTenantIDFromName(tenantName string) (string, error)
+	// GetTenantIDFromNamespace gets tenantID of the tenant which owns the namespace.
+	GetTenantIDFromNamespace(namespace string) (string, error)
+	// ListTenants lists the enabled tenants in the domain which have the tag.
+	ListTenants(domainID, tag string) ([]TenantInfo, error)
 	// CheckTenantByID checks tenant exist or not by tenantID.
 	CheckTenantByID(tenantID string) (bool, error)
-	// CreateUser creates user with username, password in the tenant.
-	CreateUser(username, password, tenantID string) error
+	// CreateUser creates user with username, password and role in the tenant, and returns the user ID.
+	// An existing user is only granted the role, and adopted is true.
+	CreateUser(username, password, tenantID string, role crv1.TenantRole) (userID string, adopted bool, err error)
+	// UpdateUser renames the user and changes its password.
+	UpdateUser(userID, username, password string) error
+	// SetUserRole changes the role of the user in the tenant.
+	SetUserRole(userID, tenantID string, role crv1.TenantRole) error
+	// RevokeUserRoles revokes the roles managed by stackube in the tenant from the user.
+	RevokeUserRoles(userID, tenantID string) error
+	// MoveUserToTenant moves the user with role from one tenant to another.
+	MoveUserToTenant(userID, fromTenantID, toTenantID string, role crv1.TenantRole) error
+	// DeleteUser deletes the user by userID.
+	DeleteUser(userID string) error
 	// DeleteAllUsersOnTenant deletes all users on the tenant.
 	DeleteAllUsersOnTenant(tenantName string) error
+	// AuthenticateToken validates a keystone token and returns the user who owns it.
+	AuthenticateToken(token string) (*UserInfo, error)
+	// ListUserRoles lists the names of the roles which the user has on the tenant.
+	ListUserRoles(userID, tenantID string) ([]string, error)
+	// UpdateQuota updates the Neutron quota of the tenant and returns its usage.
+	UpdateQuota(tenantID string, quota *crv1.TenantQuota) (*crv1.TenantQuota, error)
 	// CreateNetwork creates network.
 	CreateNetwork(network *drivertypes.Network) error
 	// GetNetworkByID gets network by networkID.
 	GetNetworkByID(networkID string) (*drivertypes.Network, error)
 	// GetNetworkByName gets network by networkName.
 	GetNetworkByName(networkName string) (*drivertypes.Network, error)
+	// GetNetworkDetails sets the segmentation ID and the router of network
+	// got by GetNetworkByID or GetNetworkByName.
+	GetNetworkDetails(network *drivertypes.Network) error
+	// UpdateNetwork updates network and its subnets.
+	UpdateNetwork(network *drivertypes.Network) error
 	// DeleteNetwork deletes network by networkName.
 	DeleteNetwork(networkName string) error
 	// GetProviderSubnet gets provider subnet by id
@@ -103,8 +154,13 @@ type Interface interface {
 	LoadBalancerExist(name string) (bool, error)
 	// EnsureLoadBalancer ensures a load balancer is created.
 	EnsureLoadBalancer(lb *LoadBalancer) (*LoadBalancerStatus, error)
-	// EnsureLoadBalancerDeleted ensures a load balancer is deleted.
-	EnsureLoadBalancerDeleted(name string) error
+	// EnsureLoadBalancerDeleted ensures a load balancer is deleted, and
+	// releases its floating IP if releaseFloatingIP is true.
+	EnsureLoadBalancerDeleted(name string, releaseFloatingIP bool) error
+	// ListResources lists the resources of kind in the tenant.
+	ListResources(kind, tenantID string) ([]Resource, error)
+	// DeleteResource deletes the resource listed by ListResources.
+	DeleteResource(resource Resource) error
 	// GetCRDClient returns the CRDClient.
 	GetCRDClient() crdClient.Interface
 	// GetPluginName returns the plugin name.
@@ -122,7 +178,12 @@ type Client struct {
 	ExtNetID          string
 	PluginName        string
 	IntegrationBridge string
+	TenantDomainID    string
+	MemberRole        string
+	AdminRole         string
+	ReaderRole        string
 	CRDClient         crdClient.Interface
+	KubeClient        kubernetes.Interface
 }
 
 type PluginOpts struct {
@@ -130,32 +191,137 @@ type PluginOpts struct {
 	IntegrationBridge string `gcfg:"integration-bridge"`
 }
 
+// TenantOpts configures how tenants are created in keystone.
+type TenantOpts struct {
+	// DomainID is the keystone domain which tenants and their users are created in.
+	DomainID string `gcfg:"domain-id"`
+	// MemberRole is the keystone role granted to tenant users on their tenants.
+	MemberRole string `gcfg:"member-role"`
+	// AdminRole is the keystone role granted to tenant users with the admin role.
+	AdminRole string `gcfg:"admin-role"`
+	// ReaderRole is the keystone role granted to tenant users with the reader role.
+	ReaderRole string `gcfg:"reader-role"`
+}
+
 // Config used to configure the openstack client.
 type Config struct {
 	Global struct {
 		AuthUrl    string `gcfg:"auth-url"`
 		Username   string `gcfg:"username"`
+		UserID     string `gcfg:"user-id"`
 		Password   string `gcfg:"password"`
 		TenantName string `gcfg:"tenant-name"`
+		TenantID   string `gcfg:"tenant-id"`
 		Region     string `gcfg:"region"`
 		ExtNetID   string `gcfg:"ext-net-id"`
+
+		// Keystone v3 only options.
+		UserDomainID                string `gcfg:"user-domain-id"`
+		UserDomainName              string `gcfg:"user-domain-name"`
+		TenantDomainID              string `gcfg:"tenant-domain-id"`
+		TenantDomainName            string `gcfg:"tenant-domain-name"`
+		ApplicationCredentialID     string `gcfg:"application-credential-id"`
+		ApplicationCredentialName   string `gcfg:"application-credential-name"`
+		ApplicationCredentialSecret string `gcfg:"application-credential-secret"`
+		TrustID                     string `gcfg:"trust-id"`
+
+		// Cloud is the name of a cloud in clouds.yaml, whose options are used
+		// for those not set here.
+		Cloud      string `gcfg:"cloud"`
+		CloudsFile string `gcfg:"clouds-file"`
+
+		// TLS options.
+		CAFile   string `gcfg:"ca-file"`
+		CertFile string `gcfg:"cert-file"`
+		KeyFile  string `gcfg:"key-file"`
+		Insecure bool   `gcfg:"insecure"`
 	}
 	Plugin PluginOpts
+	Tenant TenantOpts
 }
 
 func toAuthOptions(cfg Config) gophercloud.AuthOptions {
 	return gophercloud.AuthOptions{
 		IdentityEndpoint: cfg.Global.AuthUrl,
 		Username:         cfg.Global.Username,
+		UserID:           cfg.Global.UserID,
 		Password:         cfg.Global.Password,
 		TenantName:       cfg.Global.TenantName,
+		TenantID:         cfg.Global.TenantID,
 		AllowReauth:      true,
 	}
 }
 
+func toV3AuthOptions(cfg Config) *v3AuthOptions {
+	return &v3AuthOptions{
+		UserID:                      cfg.Global.UserID,
+		Username:                    cfg.Global.Username,
+		Password:                    cfg.Global.Password,
+		UserDomainID:                cfg.Global.UserDomainID,
+		UserDomainName:              cfg.Global.UserDomainName,
+		ProjectID:                   cfg.Global.TenantID,
+		ProjectName:                 cfg.Global.TenantName,
+		ProjectDomainID:             cfg.Global.TenantDomainID,
+		ProjectDomainName:           cfg.Global.TenantDomainName,
+		ApplicationCredentialID:     cfg.Global.ApplicationCredentialID,
+		ApplicationCredentialName:   cfg.Global.ApplicationCredentialName,
+		ApplicationCredentialSecret: cfg.Global.ApplicationCredentialSecret,
+		TrustID:                     cfg.Global.TrustID,
+	}
+}
+
+// useKeystoneV3 returns true if auth-url is a keystone v3 endpoint or any
+// keystone v3 only option is set.
+func useKeystoneV3(cfg Config) bool {
+	if strings.HasSuffix(gophercloud.NormalizeURL(cfg.Global.AuthUrl), "/v3/") {
+		return true
+	}
+
+	return cfg.Global.UserDomainID != "" || cfg.Global.UserDomainName != "" ||
+		cfg.Global.TenantDomainID != "" || cfg.Global.TenantDomainName != "" ||
+		cfg.Global.ApplicationCredentialSecret != "" || cfg.Global.TrustID != ""
+}
+
+// newProviderClient authenticates against keystone v2 or v3 according to cfg.
+func newProviderClient(cfg Config) (*gophercloud.ProviderClient, error) {
+	httpClient, err := newHTTPClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if !useKeystoneV3(cfg) {
+		provider, err := openstack.NewClient(cfg.Global.AuthUrl)
+		if err != nil {
+			return nil, err
+		}
+		provider.HTTPClient = httpClient
+		if err := openstack.Authenticate(provider, toAuthOptions(cfg)); err != nil {
+			return nil, err
+		}
+		return provider, nil
+	}
+
+	authURL := gophercloud.NormalizeURL(cfg.Global.AuthUrl)
+	if strings.HasSuffix(authURL, "/v2.0/") {
+		return nil, fmt.Errorf("keystone v3 options are set but auth-url %s is a keystone v2 endpoint", cfg.Global.AuthUrl)
+	}
+	if !strings.HasSuffix(authURL, "/v3/") {
+		authURL = authURL + "v3/"
+	}
+
+	provider, err := openstack.NewClient(authURL)
+	if err != nil {
+		return nil, err
+	}
+	provider.HTTPClient = httpClient
+	if err := authenticateV3(provider, toV3AuthOptions(cfg)); err != nil {
+		return nil, err
+	}
+	return provider, nil
+}
+
 // NewClient returns a new openstack client.
 func NewClient(config string, kubeConfig string) (Interface, error) {
-	var opts gophercloud.AuthOptions
 	cfg, err := readConfig(config)
 	if err != nil {
 		return nil, fmt.Errorf("Failed read cloudconfig: %v", err)
@@ -166,16 +332,14 @@ func NewClient(config string, kubeConfig string) (Interface, error) {
 		return nil, fmt.Errorf("external network ID not set")
 	}
 
-	opts = toAuthOptions(cfg)
-	provider, err := openstack.AuthenticatedClient(opts)
+	provider, err := newProviderClient(cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	identity, err := openstack.NewIdentityV2(provider, gophercloud.EndpointOpts{
-		Availability: gophercloud.AvailabilityAdmin,
-	})
+	identity, err := newIdentityV3(provider, cfg.Global.Region)
 	if err != nil {
+		glog.Warningf("Failed to find keystone endpoint: %v", err)
 		return nil, err
 	}
 
@@ -183,7 +347,7 @@ func NewClient(config string, kubeConfig string) (Interface, error) {
 		Region: cfg.Global.Region,
 	})
 	if err != nil {
-		glog.Warning("Failed to find neutron endpoint: %v", err)
+		glog.Warningf("Failed to find neutron endpoint: %v", err)
 		return nil, err
 	}
 
@@ -196,6 +360,10 @@ func NewClient(config string, kubeConfig string) (Interface, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to create client for CRD: %v", err)
 	}
+	kubeClient, err := kubernetes.NewForConfig(k8sConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes client: %v", err)
+	}
 
 	client := &Client{
 		Identity:          identity,
@@ -205,9 +373,14 @@ func NewClient(config string, kubeConfig string) (Interface, error) {
 		ExtNetID:          cfg.Global.ExtNetID,
 		PluginName:        cfg.Plugin.PluginName,
 		IntegrationBridge: cfg.Plugin.IntegrationBridge,
+		TenantDomainID:    cfg.Tenant.DomainID,
+		MemberRole:        cfg.Tenant.MemberRole,
+		AdminRole:         cfg.Tenant.AdminRole,
+		ReaderRole:        cfg.Tenant.ReaderRole,
 		CRDClient:         kubeCRDClient,
+		KubeClient:        kubeClient,
 	}
-	return client, nil
+	return newInstrumentedClient(client), nil
 }
 
 func readConfig(config string) (Config, error) {
@@ -216,10 +389,19 @@ func readConfig(config string) (Config, error) {
 		return Config{}, err
 	}
 	var cfg Config
+	cfg.Tenant.DomainID = defaultTenantDomainID
+	cfg.Tenant.MemberRole = defaultMemberRole
+	cfg.Tenant.AdminRole = defaultAdminRole
+	cfg.Tenant.ReaderRole = defaultReaderRole
 	err = gcfg.ReadInto(&cfg, conf)
 	if err != nil {
 		return Config{}, err
 	}
+	if cfg.Global.Cloud != "" {
+		if err := applyCloud(&cfg); err != nil {
+			return Config{}, err
+		}
+	}
 	return cfg, nil
 }
 
@@ -238,131 +420,6 @@ func (os *Client) GetIntegrationBridge() string {
 	return os.IntegrationBridge
 }
 
-// GetTenantIDFromName gets tenantID by tenantName.
-func (os *Client) GetTenantIDFromName(tenantName string) (string, error) {
-	if util.IsSystemNamespace(tenantName) {
-		tenantName = util.SystemTenant
-	}
-
-	// If tenantID is specified, return it directly
-	var (
-		tenant *crv1.Tenant
-		err    error
-	)
-	if tenant, err = os.CRDClient.GetTenant(tenantName); err != nil {
-		return "", err
-	}
-	if tenant.Spec.TenantID != "" {
-		return tenant.Spec.TenantID, nil
-	}
-
-	// Otherwise, fetch tenantID from OpenStack
-	var tenantID string
-	err = tenants.List(os.Identity, nil).EachPage(func(page pagination.Page) (bool, error) {
-		tenantList, err1 := tenants.ExtractTenants(page)
-		if err1 != nil {
-			return false, err1
-		}
-		for _, t := range tenantList {
-			if t.Name == tenantName {
-				tenantID = t.ID
-				break
-			}
-		}
-		return true, nil
-	})
-	if err != nil {
-		return "", err
-	}
-
-	glog.V(3).Infof("Got tenantID: %v for tenantName: %v", tenantID, tenantName)
-
-	return tenantID, nil
-}
-
-// CreateTenant creates tenant by tenantname.
-func (os *Client) CreateTenant(tenantName string) (string, error) {
-	createOpts := tenants.CreateOpts{
-		Name:        tenantName,
-		Description: "stackube",
-		Enabled:     gophercloud.Enabled,
-	}
-
-	_, err := tenants.Create(os.Identity, createOpts).Extract()
-	if err != nil && !IsAlreadyExists(err) {
-		glog.Errorf("Failed to create tenant %s: %v", tenantName, err)
-		return "", err
-	}
-	glog.V(4).Infof("Tenant %s created", tenantName)
-	tenantID, err := os.GetTenantIDFromName(tenantName)
-	if err != nil {
-		return "", err
-	}
-	return tenantID, nil
-}
-
-// DeleteTenant deletes tenant by tenantName.
-func (os *Client) DeleteTenant(tenantName string) error {
-	return tenants.List(os.Identity, nil).EachPage(func(page pagination.Page) (bool, error) {
-		tenantList, err := tenants.ExtractTenants(page)
-		if err != nil {
-			return false, err
-		}
-		for _, t := range tenantList {
-			if t.Name == tenantName {
-				err := tenants.Delete(os.Identity, t.ID).ExtractErr()
-				if err != nil {
-					glog.Errorf("Delete openstack tenant %s error: %v", tenantName, err)
-					return false, err
-				}
-				glog.V(4).Infof("Tenant %s deleted", tenantName)
-				break
-			}
-		}
-		return true, nil
-	})
-}
-
-// CreateUser creates user with username, password in the tenant.
-func (os *Client) CreateUser(username, password, tenantID string) error {
-	opts := users.CreateOpts{
-		Name:     username,
-		TenantID: tenantID,
-		Enabled:  gophercloud.Enabled,
-		Password: password,
-	}
-	_, err := users.Create(os.Identity, opts).Extract()
-	if err != nil && !IsAlreadyExists(err) {
-		glog.Errorf("Failed to create user %s: %v", username, err)
-		return err
-	}
-	glog.V(4).Infof("User %s created", username)
-	return nil
-}
-
-// DeleteAllUsersOnTenant deletes all users on the tenant.
-func (os *Client) DeleteAllUsersOnTenant(tenantName string) error {
-	tenantID, err := os.GetTenantIDFromName(tenantName)
-	if err != nil {
-		return nil
-	}
-	return users.ListUsers(os.Identity, tenantID).EachPage(func(page pagination.Page) (bool, error) {
-		usersList, err := users.ExtractUsers(page)
-		if err != nil {
-			return false, err
-		}
-		for _, u := range usersList {
-			res := users.Delete(os.Identity, u.ID)
-			if res.Err != nil {
-				glog.Errorf("Delete openstack user %s error: %v", u.Name, err)
-				return false, err
-			}
-			glog.V(4).Infof("User %s deleted", u.Name)
-		}
-		return true, nil
-	})
-}
-
 // IsAlreadyExists determines if the err is an error which indicates that a specified resource already exists.
 func IsAlreadyExists(err error) bool {
 	return reasonForError(err) == StatusCodeAlreadyExists
@@ -435,13 +492,20 @@ func (os *Client) GetProviderSubnet(osSubnetID string) (*drivertypes.Subnet, err
 		routes = append(routes, &route)
 	}
 
+	var pools []*drivertypes.AllocationPool
+	for _, p := range s.AllocationPools {
+		pools = append(pools, &drivertypes.AllocationPool{Start: p.Start, End: p.End})
+	}
+
 	providerSubnet := drivertypes.Subnet{
-		Uid:        s.ID,
-		Cidr:       s.CIDR,
-		Gateway:    s.GatewayIP,
-		Name:       s.Name,
-		Dnsservers: s.DNSNameservers,
-		Routes:     routes,
+		Uid:             s.ID,
+		Cidr:            s.CIDR,
+		Gateway:         s.GatewayIP,
+		Name:            s.Name,
+		Dnsservers:      s.DNSNameservers,
+		Routes:          routes,
+		IPVersion:       s.IPVersion,
+		AllocationPools: pools,
 	}
 
 	return &providerSubnet, nil
@@ -491,6 +555,82 @@ func (os *Client) OSNetworktoProviderNetwork(osNetwork *networks.Network) (*driv
 	return &providerNetwork, nil
 }
 
+// GetNetworkDetails sets the segmentation ID and the router of network. They
+// are only needed by the status of Networks, so they are not got with the
+// network, which is got for every pod.
+func (os *Client) GetNetworkDetails(network *drivertypes.Network) error {
+	segmentID, err := os.getNetworkSegmentID(network.Uid)
+	if err != nil {
+		return err
+	}
+	network.SegmentID = segmentID
+
+	// Routers are named after the networks created by stackube, so provider
+	// networks normally have no router here.
+	routerID, gatewayIP, err := os.getRouterGateway(network.Name)
+	if err != nil {
+		return err
+	}
+	network.RouterID = routerID
+	network.ExternalGatewayIP = gatewayIP
+	return nil
+}
+
+// getNetworkSegmentID gets the segmentation ID of network, which is only
+// visible to admin users.
+func (os *Client) getNetworkSegmentID(networkID string) (int32, error) {
+	var s struct {
+		Network struct {
+			SegmentationID int32 `json:"provider:segmentation_id"`
+		} `json:"network"`
+	}
+	if err := networks.Get(os.Network, networkID).ExtractInto(&s); err != nil {
+		glog.Errorf("Get openstack network %s failed: %v", networkID, err)
+		return 0, err
+	}
+
+	return s.Network.SegmentationID, nil
+}
+
+// getRouterGateway gets the ID and the external gateway IP of the router
+// by name. Empty strings are returned if the router doesn't exist.
+func (os *Client) getRouterGateway(name string) (string, string, error) {
+	var routerID, gatewayIP string
+	opts := routers.ListOpts{Name: name}
+	err := routers.List(os.Network, opts).EachPage(func(page pagination.Page) (bool, error) {
+		var s struct {
+			Routers []struct {
+				ID          string `json:"id"`
+				GatewayInfo struct {
+					ExternalFixedIPs []struct {
+						IPAddress string `json:"ip_address"`
+					} `json:"external_fixed_ips"`
+				} `json:"external_gateway_info"`
+			} `json:"routers"`
+		}
+		if err := page.(routers.RouterPage).ExtractInto(&s); err != nil {
+			return false, err
+		}
+		if len(s.Routers) > 1 {
+			return false, ErrMultipleResults
+		}
+		if len(s.Routers) == 1 {
+			routerID = s.Routers[0].ID
+			if ips := s.Routers[0].GatewayInfo.ExternalFixedIPs; len(ips) > 0 {
+				gatewayIP = ips[0].IPAddress
+			}
+		}
+
+		return true, nil
+	})
+	if err != nil {
+		glog.Errorf("Get openstack router %s failed: %v", name, err)
+		return "", "", err
+	}
+
+	return routerID, gatewayIP, nil
+}
+
 // ToProviderStatus transfers networks.Network's status to drivertypes.Network's status.
 func (os *Client) ToProviderStatus(status string) string {
 	switch status {
@@ -517,7 +657,10 @@ func (os *Client) CreateNetwork(network *drivertypes.Network) error {
 		AdminStateUp: &adminStateUp,
 		TenantID:     network.TenantID,
 	}
-	osNet, err := networks.Create(os.Network, opts).Extract()
+	if network.AdminStateUp != nil {
+		opts.AdminStateUp = network.AdminStateUp
+	}
+	osNet, err := networks.Create(os.Network, networkCreateOpts{opts, ResourceDescription}).Extract()
 	if err != nil {
 		glog.Errorf("Create openstack network %s failed: %v", network.Name, err)
 		return err
@@ -530,7 +673,7 @@ func (os *Client) CreateNetwork(network *drivertypes.Network) error {
 		TenantID:    network.TenantID,
 		GatewayInfo: &routers.GatewayInfo{NetworkID: os.ExtNetID},
 	}
-	osRouter, err := routers.Create(os.Network, routerOpts).Extract()
+	osRouter, err := routers.Create(os.Network, routerCreateOpts{routerOpts, ResourceDescription}).Extract()
 	if err != nil {
 		glog.Errorf("Create openstack router %s failed: %v", network.Name, err)
 		delErr := os.DeleteNetwork(network.Name)
@@ -545,37 +688,249 @@ func (os *Client) CreateNetwork(network *drivertypes.Network) error {
 	network.Status = os.ToProviderStatus(osNet.Status)
 	network.Uid = osNet.ID
 	for _, sub := range network.Subnets {
-		// create subnet
-		subnetOpts := subnets.CreateOpts{
-			NetworkID:      networkID,
-			CIDR:           sub.Cidr,
-			Name:           sub.Name,
-			IPVersion:      gophercloud.IPv4,
-			TenantID:       network.TenantID,
-			GatewayIP:      &sub.Gateway,
-			DNSNameservers: sub.Dnsservers,
-		}
-		s, err := subnets.Create(os.Network, subnetOpts).Extract()
+		err := os.createSubnet(networkID, network.TenantID, osRouter.ID, sub)
 		if err != nil {
-			glog.Errorf("Create openstack subnet %s failed: %v", sub.Name, err)
 			delErr := os.DeleteNetwork(network.Name)
 			if delErr != nil {
 				glog.Errorf("Delete openstack network %s failed: %v", network.Name, delErr)
 			}
 			return err
 		}
+	}
+
+	return nil
+}
+
+// networkCreateOpts are the create options of a network with a description.
+type networkCreateOpts struct {
+	networks.CreateOpts
+	description string
+}
+
+func (opts networkCreateOpts) ToNetworkCreateMap() (map[string]interface{}, error) {
+	body, err := opts.CreateOpts.ToNetworkCreateMap()
+	if err != nil {
+		return nil, err
+	}
+	body["network"].(map[string]interface{})["description"] = opts.description
+	return body, nil
+}
+
+// routerCreateOpts are the create options of a router with a description.
+type routerCreateOpts struct {
+	routers.CreateOpts
+	description string
+}
+
+func (opts routerCreateOpts) ToRouterCreateMap() (map[string]interface{}, error) {
+	body, err := opts.CreateOpts.ToRouterCreateMap()
+	if err != nil {
+		return nil, err
+	}
+	body["router"].(map[string]interface{})["description"] = opts.description
+	return body, nil
+}
+
+// createSubnet creates subnet in network and connects it to router.
+func (os *Client) createSubnet(networkID, tenantID, routerID string, sub *drivertypes.Subnet) error {
+	ipVersion := gophercloud.IPv4
+	if sub.IPVersion == 6 {
+		ipVersion = gophercloud.IPv6
+	}
+	subnetOpts := subnetCreateOpts{
+		CreateOpts: subnets.CreateOpts{
+			NetworkID:       networkID,
+			CIDR:            sub.Cidr,
+			Name:            sub.Name,
+			IPVersion:       ipVersion,
+			TenantID:        tenantID,
+			GatewayIP:       &sub.Gateway,
+			DNSNameservers:  sub.Dnsservers,
+			HostRoutes:      toHostRoutes(sub.Routes),
+			AllocationPools: toAllocationPools(sub.AllocationPools),
+		},
+		IPv6Mode: sub.IPv6Mode,
+	}
+	s, err := subnets.Create(os.Network, subnetOpts).Extract()
+	if err != nil {
+		glog.Errorf("Create openstack subnet %s failed: %v", sub.Name, err)
+		return err
+	}
 
-		// add subnet to router
-		opts := routers.AddInterfaceOpts{
-			SubnetID: s.ID,
+	// add subnet to router
+	opts := routers.AddInterfaceOpts{
+		SubnetID: s.ID,
+	}
+	_, err = routers.AddInterface(os.Network, routerID, opts).Extract()
+	if err != nil {
+		glog.Errorf("Add openstack subnet %s to router failed: %v", sub.Name, err)
+		return err
+	}
+
+	return nil
+}
+
+// subnetCreateOpts adds the IPv6 modes, which subnets.CreateOpts doesn't
+// support, to subnets.CreateOpts.
+type subnetCreateOpts struct {
+	subnets.CreateOpts
+	IPv6Mode string
+}
+
+// ToSubnetCreateMap casts a subnetCreateOpts struct to a map.
+func (opts subnetCreateOpts) ToSubnetCreateMap() (map[string]interface{}, error) {
+	b, err := opts.CreateOpts.ToSubnetCreateMap()
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.IPv6Mode != "" {
+		subnet := b["subnet"].(map[string]interface{})
+		subnet["ipv6_address_mode"] = opts.IPv6Mode
+		subnet["ipv6_ra_mode"] = opts.IPv6Mode
+	}
+
+	return b, nil
+}
+
+func toHostRoutes(routes []*drivertypes.Route) []subnets.HostRoute {
+	var result []subnets.HostRoute
+	for _, r := range routes {
+		result = append(result, subnets.HostRoute{
+			DestinationCIDR: r.DestinationCIDR,
+			NextHop:         r.Nexthop,
+		})
+	}
+	return result
+}
+
+func toAllocationPools(pools []*drivertypes.AllocationPool) []subnets.AllocationPool {
+	var result []subnets.AllocationPool
+	for _, p := range pools {
+		result = append(result, subnets.AllocationPool{Start: p.Start, End: p.End})
+	}
+	return result
+}
+
+// subnetUpdateOpts always sends dns_nameservers and host_routes so that they
+// can be cleared, which subnets.UpdateOpts can't do.
+type subnetUpdateOpts struct {
+	GatewayIP       *string
+	DNSNameservers  []string
+	HostRoutes      []subnets.HostRoute
+	AllocationPools []subnets.AllocationPool
+}
+
+// ToSubnetUpdateMap casts a subnetUpdateOpts struct to a map.
+func (opts subnetUpdateOpts) ToSubnetUpdateMap() (map[string]interface{}, error) {
+	dnsNameservers := opts.DNSNameservers
+	if dnsNameservers == nil {
+		dnsNameservers = []string{}
+	}
+	hostRoutes := opts.HostRoutes
+	if hostRoutes == nil {
+		hostRoutes = []subnets.HostRoute{}
+	}
+	subnet := map[string]interface{}{
+		"dns_nameservers": dnsNameservers,
+		"host_routes":     hostRoutes,
+	}
+	if opts.GatewayIP != nil {
+		subnet["gateway_ip"] = *opts.GatewayIP
+	}
+	// Empty allocation pools are left alone, since neutron would allocate
+	// no IPs at all.
+	if len(opts.AllocationPools) != 0 {
+		subnet["allocation_pools"] = opts.AllocationPools
+	}
+
+	return map[string]interface{}{"subnet": subnet}, nil
+}
+
+// UpdateNetwork updates network. Subnets are matched by CIDR: gateway and DNS
+// nameservers of existing subnets are updated, new subnets are created and
+// connected to the router, and subnets not in network are deleted. A
+// SubnetInUseError is returned without changing anything if a subnet to be
+// deleted still has ports on it.
+func (os *Client) UpdateNetwork(network *drivertypes.Network) error {
+	osNetwork, err := os.getOpenStackNetworkByName(network.Name)
+	if err != nil {
+		glog.Errorf("Get openstack network %s failed: %v", network.Name, err)
+		return err
+	}
+
+	existing := make(map[string]*subnets.Subnet)
+	for _, subnetID := range osNetwork.Subnets {
+		s, err := subnets.Get(os.Network, subnetID).Extract()
+		if err != nil {
+			glog.Errorf("Get openstack subnet %s failed: %v", subnetID, err)
+			return err
+		}
+		existing[normalizeCIDR(s.CIDR)] = s
+	}
+
+	wanted := make(map[string]bool)
+	for _, sub := range network.Subnets {
+		wanted[normalizeCIDR(sub.Cidr)] = true
+	}
+	var removed []*subnets.Subnet
+	for cidr, s := range existing {
+		if wanted[cidr] {
+			continue
 		}
-		_, err = routers.AddInterface(os.Network, osRouter.ID, opts).Extract()
+		count, err := os.countSubnetPorts(osNetwork.ID, s.ID)
 		if err != nil {
-			glog.Errorf("Create openstack subnet %s failed: %v", sub.Name, err)
-			delErr := os.DeleteNetwork(network.Name)
-			if delErr != nil {
-				glog.Errorf("Delete openstack network %s failed: %v", network.Name, delErr)
+			return err
+		}
+		if count > 0 {
+			return &SubnetInUseError{CIDR: cidr, Ports: count}
+		}
+		removed = append(removed, s)
+	}
+
+	if network.AdminStateUp != nil && *network.AdminStateUp != osNetwork.AdminStateUp {
+		opts := networks.UpdateOpts{AdminStateUp: network.AdminStateUp}
+		_, err := networks.Update(os.Network, osNetwork.ID, opts).Extract()
+		if err != nil {
+			glog.Errorf("Update openstack network %s failed: %v", network.Name, err)
+			return err
+		}
+	}
+
+	router, err := os.getRouterByName(network.Name)
+	if err != nil {
+		glog.Errorf("Get openstack router %s error: %v", network.Name, err)
+		return err
+	}
+	if router == nil {
+		return fmt.Errorf("router of network %s not found", network.Name)
+	}
+
+	for _, sub := range network.Subnets {
+		s, ok := existing[normalizeCIDR(sub.Cidr)]
+		if !ok {
+			err := os.createSubnet(osNetwork.ID, network.TenantID, router.ID, sub)
+			if err != nil {
+				return err
 			}
+			continue
+		}
+
+		if err := os.updateSubnet(s, router.ID, sub); err != nil {
+			return err
+		}
+	}
+
+	for _, s := range removed {
+		opts := routers.RemoveInterfaceOpts{SubnetID: s.ID}
+		_, err := routers.RemoveInterface(os.Network, router.ID, opts).Extract()
+		if err != nil && !isNotFound(err) {
+			glog.Errorf("Remove openstack subnet %s from router failed: %v", s.ID, err)
+			return err
+		}
+		err = subnets.Delete(os.Network, s.ID).ExtractErr()
+		if err != nil {
+			glog.Errorf("Delete openstack subnet %s error: %v", s.ID, err)
 			return err
 		}
 	}
@@ -583,10 +938,124 @@ func (os *Client) CreateNetwork(network *drivertypes.Network) error {
 	return nil
 }
 
-// UpdateNetwork updates network.
-func (os *Client) UpdateNetwork(network *drivertypes.Network) error {
-	// TODO: update network subnets
-	return nil
+// updateSubnet updates gateway, DNS nameservers, host routes and allocation
+// pools of subnet s to those of sub.
+func (os *Client) updateSubnet(s *subnets.Subnet, routerID string, sub *drivertypes.Subnet) error {
+	opts := subnetUpdateOpts{
+		DNSNameservers: sub.Dnsservers,
+		HostRoutes:     toHostRoutes(sub.Routes),
+	}
+	if sub.Gateway != "" && sub.Gateway != s.GatewayIP {
+		opts.GatewayIP = &sub.Gateway
+	}
+	pools := toAllocationPools(sub.AllocationPools)
+	if len(pools) != 0 && !reflect.DeepEqual(pools, s.AllocationPools) {
+		opts.AllocationPools = pools
+	}
+	if opts.GatewayIP == nil && opts.AllocationPools == nil &&
+		equalStrings(s.DNSNameservers, sub.Dnsservers) &&
+		equalHostRoutes(s.HostRoutes, opts.HostRoutes) {
+		return nil
+	}
+
+	// The router interface holds the gateway IP, so move it with the gateway.
+	if opts.GatewayIP != nil {
+		removeOpts := routers.RemoveInterfaceOpts{SubnetID: s.ID}
+		_, err := routers.RemoveInterface(os.Network, routerID, removeOpts).Extract()
+		if err != nil && !isNotFound(err) {
+			glog.Errorf("Remove openstack subnet %s from router failed: %v", s.ID, err)
+			return err
+		}
+	}
+
+	_, updateErr := subnets.Update(os.Network, s.ID, opts).Extract()
+	if updateErr != nil {
+		glog.Errorf("Update openstack subnet %s failed: %v", s.ID, updateErr)
+		if opts.GatewayIP == nil {
+			return updateErr
+		}
+	}
+
+	// The interface is added back even if the update failed, so that the
+	// subnet isn't left detached from the router.
+	if opts.GatewayIP != nil {
+		addOpts := routers.AddInterfaceOpts{SubnetID: s.ID}
+		_, err := routers.AddInterface(os.Network, routerID, addOpts).Extract()
+		if err != nil {
+			glog.Errorf("Add openstack subnet %s to router failed: %v", s.ID, err)
+			if updateErr == nil {
+				return err
+			}
+		}
+	}
+
+	return updateErr
+}
+
+// countSubnetPorts counts the ports with addresses in subnet, excluding those
+// owned by neutron itself such as router interfaces and DHCP ports.
+func (os *Client) countSubnetPorts(networkID, subnetID string) (int, error) {
+	count := 0
+	opts := ports.ListOpts{NetworkID: networkID}
+	err := ports.List(os.Network, opts).EachPage(func(page pagination.Page) (bool, error) {
+		portList, err := ports.ExtractPorts(page)
+		if err != nil {
+			return false, err
+		}
+
+		for _, port := range portList {
+			if strings.HasPrefix(port.DeviceOwner, "network:") {
+				continue
+			}
+			for _, ip := range port.FixedIPs {
+				if ip.SubnetID == subnetID {
+					count++
+					break
+				}
+			}
+		}
+
+		return true, nil
+	})
+	if err != nil {
+		glog.Errorf("List ports of network %s failed: %v", networkID, err)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// normalizeCIDR returns cidr in the form neutron returns it.
+func normalizeCIDR(cidr string) string {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return cidr
+	}
+	return ipNet.String()
+}
+
+func equalHostRoutes(a, b []subnets.HostRoute) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
 }
 
 func (os *Client) getRouterByName(name string) (*routers.Router, error) {
@@ -611,9 +1080,14 @@ func (os *Client) getRouterByName(name string) (*routers.Router, error) {
 	return result, nil
 }
 
-// DeleteNetwork deletes network by networkName.
+// DeleteNetwork deletes network by networkName. It is not an error if the
+// network has already been deleted.
 func (os *Client) DeleteNetwork(networkName string) error {
 	osNetwork, err := os.getOpenStackNetworkByName(networkName)
+	if err == ErrNotFound {
+		glog.V(4).Infof("Network %s already deleted", networkName)
+		return nil
+	}
 	if err != nil {
 		glog.Errorf("Get openstack network failed: %v", err)
 		return err
@@ -691,35 +1165,6 @@ func (os *Client) DeleteNetwork(networkName string) error {
 	return nil
 }
 
-// CheckTenantByID checks tenant exist or not by tenantID.
-func (os *Client) CheckTenantByID(tenantID string) (bool, error) {
-	opts := tenants.ListOpts{}
-	pager := tenants.List(os.Identity, &opts)
-
-	var found bool
-	err := pager.EachPage(func(page pagination.Page) (bool, error) {
-
-		tenantList, err := tenants.ExtractTenants(page)
-		if err != nil {
-			return false, err
-		}
-
-		if len(tenantList) == 0 {
-			return false, ErrNotFound
-		}
-
-		for _, t := range tenantList {
-			if t.ID == tenantID || t.Name == tenantID {
-				found = true
-			}
-		}
-
-		return true, nil
-	})
-
-	return found, err
-}
-
 // GetPort gets port by portName.
 func (os *Client) GetPort(name string) (*ports.Port, error) {
 	opts := ports.ListOpts{Name: name}
@@ -852,7 +1297,7 @@ func (os *Client) CreatePort(networkID, tenantID, portName string) (*portsbindin
 
 	opts := portsbinding.CreateOpts{
 		HostID: getHostName(),
-		CreateOptsBuilder: ports.CreateOpts{
+		CreateOptsBuilder: portCreateOpts{ports.CreateOpts{
 			NetworkID:      networkID,
 			Name:           portName,
 			AdminStateUp:   &adminStateUp,
@@ -860,7 +1305,7 @@ func (os *Client) CreatePort(networkID, tenantID, portName string) (*portsbindin
 			DeviceID:       uuid.Generate().String(),
 			DeviceOwner:    fmt.Sprintf("compute:%s", getHostName()),
 			SecurityGroups: []string{securitygroup},
-		},
+		}, ResourceDescription},
 	}
 
 	port, err := portsbinding.Create(os.Network, opts).Extract()
@@ -871,6 +1316,21 @@ func (os *Client) CreatePort(networkID, tenantID, portName string) (*portsbindin
 	return port, nil
 }
 
+// portCreateOpts are the create options of a port with a description.
+type portCreateOpts struct {
+	ports.CreateOpts
+	description string
+}
+
+func (opts portCreateOpts) ToPortCreateMap() (map[string]interface{}, error) {
+	body, err := opts.CreateOpts.ToPortCreateMap()
+	if err != nil {
+		return nil, err
+	}
+	body["port"].(map[string]interface{})["description"] = opts.description
+	return body, nil
+}
+
 // ListPorts lists ports by networkID and deviceOwner.
 func (os *Client) ListPorts(networkID, deviceOwner string) ([]ports.Port, error) {
 	var results []ports.Port
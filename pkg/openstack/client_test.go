@@ -0,0 +1,197 @@
+/*
+Copyright (c) 2017 OpenStack Foundation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	drivertypes "git.openstack.org/openstack/stackube/pkg/openstack/types"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/layer3/routers"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/subnets"
+)
+
+func TestUpdateSubnetGateway(t *testing.T) {
+	testCases := []struct {
+		testName         string
+		updateStatus     int
+		expectedRequests []string
+		expectErr        bool
+	}{
+		{
+			testName:     "Move gateway",
+			updateStatus: http.StatusOK,
+			expectedRequests: []string{
+				"PUT /v2.0/routers/router-1/remove_router_interface",
+				"PUT /v2.0/subnets/subnet-1",
+				"PUT /v2.0/routers/router-1/add_router_interface",
+			},
+		},
+		{
+			testName:     "Failed update keeps router interface",
+			updateStatus: http.StatusConflict,
+			expectedRequests: []string{
+				"PUT /v2.0/routers/router-1/remove_router_interface",
+				"PUT /v2.0/subnets/subnet-1",
+				"PUT /v2.0/routers/router-1/add_router_interface",
+			},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		var requests []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests = append(requests, r.Method+" "+r.URL.Path)
+			switch r.URL.Path {
+			case "/v2.0/subnets/subnet-1":
+				writeJSON(w, tc.updateStatus, map[string]interface{}{"subnet": map[string]string{"id": "subnet-1"}})
+			default:
+				writeJSON(w, http.StatusOK, map[string]string{"subnet_id": "subnet-1"})
+			}
+		}))
+		client := &Client{
+			Network: &gophercloud.ServiceClient{
+				ProviderClient: &gophercloud.ProviderClient{},
+				Endpoint:       server.URL + "/",
+				ResourceBase:   server.URL + "/v2.0/",
+			},
+		}
+
+		subnet := &subnets.Subnet{ID: "subnet-1", GatewayIP: "10.0.0.1"}
+		err := client.updateSubnet(subnet, "router-1", &drivertypes.Subnet{Gateway: "10.0.0.254"})
+		server.Close()
+		if tc.expectErr != (err != nil) {
+			t.Errorf("Case[%s]: expected error %v, got %v", tc.testName, tc.expectErr, err)
+		}
+		if !reflect.DeepEqual(requests, tc.expectedRequests) {
+			t.Errorf("Case[%s]: expected requests %v, got %v", tc.testName, tc.expectedRequests, requests)
+		}
+	}
+}
+
+func TestGetNetworkDetails(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch r.URL.Path {
+		case "/v2.0/networks":
+			writeJSON(w, http.StatusOK, map[string]interface{}{"networks": []map[string]interface{}{
+				{"id": "net-1", "name": "kube-team-team", "subnets": []string{"subnet-1"}},
+			}})
+		case "/v2.0/subnets/subnet-1":
+			writeJSON(w, http.StatusOK, map[string]interface{}{"subnet": map[string]string{"id": "subnet-1", "cidr": "10.0.0.0/24"}})
+		case "/v2.0/networks/net-1":
+			writeJSON(w, http.StatusOK, map[string]interface{}{"network": map[string]interface{}{
+				"id": "net-1", "provider:segmentation_id": 100,
+			}})
+		case "/v2.0/routers":
+			writeJSON(w, http.StatusOK, map[string]interface{}{"routers": []map[string]interface{}{
+				{"id": "router-1", "external_gateway_info": map[string]interface{}{
+					"external_fixed_ips": []map[string]string{{"ip_address": "172.24.4.2"}},
+				}},
+			}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	client := &Client{
+		Network: &gophercloud.ServiceClient{
+			ProviderClient: &gophercloud.ProviderClient{},
+			Endpoint:       server.URL + "/",
+			ResourceBase:   server.URL + "/v2.0/",
+		},
+	}
+
+	// The network of every pod is got without its details.
+	network, err := client.GetNetworkByName("kube-team-team")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectedRequests := []string{"GET /v2.0/networks", "GET /v2.0/subnets/subnet-1"}
+	if !reflect.DeepEqual(requests, expectedRequests) {
+		t.Errorf("Expected requests %v, got %v", expectedRequests, requests)
+	}
+
+	if err := client.GetNetworkDetails(network); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if network.SegmentID != 100 || network.RouterID != "router-1" || network.ExternalGatewayIP != "172.24.4.2" {
+		t.Errorf("Expected network details set, got %+v", network)
+	}
+}
+
+func TestCreatedResourceDescription(t *testing.T) {
+	var created []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/v2.0/networks":
+			writeJSON(w, http.StatusOK, map[string]interface{}{"networks": created})
+		case r.Method == "POST" && r.URL.Path == "/v2.0/networks":
+			var body map[string]map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			network := body["network"]
+			network["id"] = "net-1"
+			created = append(created, network)
+			writeJSON(w, http.StatusCreated, map[string]interface{}{"network": network})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	client := &Client{
+		Network: &gophercloud.ServiceClient{
+			ProviderClient: &gophercloud.ProviderClient{},
+			Endpoint:       server.URL + "/",
+			ResourceBase:   server.URL + "/v2.0/",
+		},
+	}
+
+	// The creation fails at the router, which is not served.
+	err := client.CreateNetwork(&drivertypes.Network{
+		Name:     "kube-team-team",
+		TenantID: "tenant-id",
+		Subnets:  []*drivertypes.Subnet{{Cidr: "10.244.0.0/16"}},
+	})
+	if err == nil {
+		t.Errorf("Expected error creating the router")
+	}
+
+	resources, err := client.ListResources(ResourceNetwork, "tenant-id")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(resources) != 1 || resources[0].Name != "kube-team-team" || resources[0].Description != ResourceDescription {
+		t.Errorf("Expected network listed with description %q, got %v", ResourceDescription, resources)
+	}
+
+	body, err := routerCreateOpts{routers.CreateOpts{Name: "kube-team-team"}, ResourceDescription}.ToRouterCreateMap()
+	if err != nil || body["router"].(map[string]interface{})["description"] != ResourceDescription {
+		t.Errorf("Expected router created with description %q, got %v: %v", ResourceDescription, body, err)
+	}
+	body, err = portCreateOpts{ports.CreateOpts{NetworkID: "net-1", Name: "kube-team-pod"}, ResourceDescription}.ToPortCreateMap()
+	if err != nil || body["port"].(map[string]interface{})["description"] != ResourceDescription {
+		t.Errorf("Expected port created with description %q, got %v: %v", ResourceDescription, body, err)
+	}
+}
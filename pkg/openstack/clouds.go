@@ -0,0 +1,193 @@
+/*
+Copyright (c) 2017 OpenStack Foundation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// cloudsFile is the content of a clouds.yaml file as used by the openstack
+// command line clients.
+type cloudsFile struct {
+	Clouds map[string]cloud `yaml:"clouds"`
+}
+
+type cloud struct {
+	Auth struct {
+		AuthURL                     string `yaml:"auth_url"`
+		Username                    string `yaml:"username"`
+		UserID                      string `yaml:"user_id"`
+		Password                    string `yaml:"password"`
+		ProjectName                 string `yaml:"project_name"`
+		ProjectID                   string `yaml:"project_id"`
+		UserDomainID                string `yaml:"user_domain_id"`
+		UserDomainName              string `yaml:"user_domain_name"`
+		ProjectDomainID             string `yaml:"project_domain_id"`
+		ProjectDomainName           string `yaml:"project_domain_name"`
+		ApplicationCredentialID     string `yaml:"application_credential_id"`
+		ApplicationCredentialName   string `yaml:"application_credential_name"`
+		ApplicationCredentialSecret string `yaml:"application_credential_secret"`
+		TrustID                     string `yaml:"trust_id"`
+	} `yaml:"auth"`
+	RegionName string `yaml:"region_name"`
+	CACert     string `yaml:"cacert"`
+	Cert       string `yaml:"cert"`
+	Key        string `yaml:"key"`
+	Verify     *bool  `yaml:"verify"`
+}
+
+// cloudsFileCandidates returns the paths searched for clouds.yaml, in the
+// same order as the openstack command line clients.
+func cloudsFileCandidates() []string {
+	var candidates []string
+	if file := os.Getenv("OS_CLIENT_CONFIG_FILE"); file != "" {
+		candidates = append(candidates, file)
+	}
+	candidates = append(candidates, "clouds.yaml")
+	if home := os.Getenv("HOME"); home != "" {
+		candidates = append(candidates, filepath.Join(home, ".config", "openstack", "clouds.yaml"))
+	}
+	return append(candidates, "/etc/openstack/clouds.yaml")
+}
+
+// loadCloud reads the named cloud from path, or from the first clouds.yaml
+// found if path is empty.
+func loadCloud(path, name string) (*cloud, error) {
+	if path == "" {
+		for _, candidate := range cloudsFileCandidates() {
+			if _, err := os.Stat(candidate); err == nil {
+				path = candidate
+				break
+			}
+		}
+		if path == "" {
+			return nil, fmt.Errorf("clouds.yaml not found")
+		}
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var clouds cloudsFile
+	if err := yaml.Unmarshal(data, &clouds); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	c, ok := clouds.Clouds[name]
+	if !ok {
+		return nil, fmt.Errorf("cloud %q not found in %s", name, path)
+	}
+
+	return &c, nil
+}
+
+// applyCloud fills in the options which are not set in cfg from the cloud
+// named by cfg.Global.Cloud. Options set in stackube.conf take precedence.
+func applyCloud(cfg *Config) error {
+	c, err := loadCloud(cfg.Global.CloudsFile, cfg.Global.Cloud)
+	if err != nil {
+		return err
+	}
+
+	g := &cfg.Global
+	for _, opt := range []struct {
+		value *string
+		cloud string
+	}{
+		{&g.AuthUrl, c.Auth.AuthURL},
+		{&g.Username, c.Auth.Username},
+		{&g.UserID, c.Auth.UserID},
+		{&g.Password, c.Auth.Password},
+		{&g.TenantName, c.Auth.ProjectName},
+		{&g.TenantID, c.Auth.ProjectID},
+		{&g.UserDomainID, c.Auth.UserDomainID},
+		{&g.UserDomainName, c.Auth.UserDomainName},
+		{&g.TenantDomainID, c.Auth.ProjectDomainID},
+		{&g.TenantDomainName, c.Auth.ProjectDomainName},
+		{&g.ApplicationCredentialID, c.Auth.ApplicationCredentialID},
+		{&g.ApplicationCredentialName, c.Auth.ApplicationCredentialName},
+		{&g.ApplicationCredentialSecret, c.Auth.ApplicationCredentialSecret},
+		{&g.TrustID, c.Auth.TrustID},
+		{&g.Region, c.RegionName},
+		{&g.CAFile, c.CACert},
+		{&g.CertFile, c.Cert},
+		{&g.KeyFile, c.Key},
+	} {
+		if *opt.value == "" {
+			*opt.value = opt.cloud
+		}
+	}
+	if c.Verify != nil && !*c.Verify {
+		g.Insecure = true
+	}
+
+	return nil
+}
+
+// newHTTPClient returns the http client used to talk to openstack, with the
+// TLS options of cfg applied.
+func newHTTPClient(cfg Config) (http.Client, error) {
+	g := cfg.Global
+	if g.CAFile == "" && g.CertFile == "" && g.KeyFile == "" && !g.Insecure {
+		return http.Client{}, nil
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: g.Insecure}
+	if g.CAFile != "" {
+		ca, err := ioutil.ReadFile(g.CAFile)
+		if err != nil {
+			return http.Client{}, fmt.Errorf("failed to read ca-file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return http.Client{}, fmt.Errorf("no certificates found in ca-file %s", g.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if g.CertFile != "" || g.KeyFile != "" {
+		if g.CertFile == "" || g.KeyFile == "" {
+			return http.Client{}, fmt.Errorf("cert-file and key-file must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(g.CertFile, g.KeyFile)
+		if err != nil {
+			return http.Client{}, fmt.Errorf("failed to load client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			TLSClientConfig:     tlsConfig,
+			TLSHandshakeTimeout: 10 * time.Second,
+		},
+	}, nil
+}
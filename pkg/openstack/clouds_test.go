@@ -0,0 +1,179 @@
+/*
+Copyright (c) 2017 OpenStack Foundation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testCloudsYAML = `
+clouds:
+  devstack:
+    auth:
+      auth_url: https://keystone.example.com/identity/v3
+      username: admin
+      password: secret
+      project_name: admin
+      user_domain_name: Default
+      project_domain_name: Default
+    region_name: RegionTwo
+    cacert: /etc/ssl/ca.pem
+    verify: false
+`
+
+func writeTestFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return path
+}
+
+func TestReadConfigWithCloud(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stackube-clouds")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	clouds := writeTestFile(t, dir, "clouds.yaml", testCloudsYAML)
+	conf := writeTestFile(t, dir, "stackube.conf", `
+[Global]
+cloud = devstack
+clouds-file = `+clouds+`
+region = RegionOne
+ext-net-id = ext-net
+`)
+
+	cfg, err := readConfig(conf)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	g := cfg.Global
+	for _, tc := range []struct {
+		name     string
+		expected string
+		got      string
+	}{
+		{"auth-url", "https://keystone.example.com/identity/v3", g.AuthUrl},
+		{"username", "admin", g.Username},
+		{"password", "secret", g.Password},
+		{"tenant-name", "admin", g.TenantName},
+		{"user-domain-name", "Default", g.UserDomainName},
+		{"tenant-domain-name", "Default", g.TenantDomainName},
+		// Options in stackube.conf take precedence over clouds.yaml.
+		{"region", "RegionOne", g.Region},
+		{"ext-net-id", "ext-net", g.ExtNetID},
+		{"ca-file", "/etc/ssl/ca.pem", g.CAFile},
+	} {
+		if tc.got != tc.expected {
+			t.Errorf("Expected %s %q, got %q", tc.name, tc.expected, tc.got)
+		}
+	}
+	if !g.Insecure {
+		t.Errorf("Expected insecure to be set by verify: false")
+	}
+
+	conf = writeTestFile(t, dir, "missing.conf", `
+[Global]
+cloud = missing
+clouds-file = `+clouds+`
+`)
+	if _, err := readConfig(conf); err == nil {
+		t.Errorf("Expected error for cloud not in clouds.yaml")
+	}
+}
+
+func TestNewProviderClientTLS(t *testing.T) {
+	k := newFakeKeystone(t)
+	k.server.Close()
+	k.server = httptest.NewTLSServer(k)
+	defer k.close()
+
+	dir, err := ioutil.TempDir("", "stackube-tls")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	caFile := writeTestFile(t, dir, "ca.pem", string(pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: k.server.Certificate().Raw,
+	})))
+	badCAFile := writeTestFile(t, dir, "bad.pem", "not a certificate")
+
+	testCases := []struct {
+		testName    string
+		updateFn    func(cfg *Config)
+		expectedErr bool
+	}{
+		{
+			testName:    "Unknown authority",
+			updateFn:    func(cfg *Config) {},
+			expectedErr: true,
+		},
+		{
+			testName: "Insecure",
+			updateFn: func(cfg *Config) {
+				cfg.Global.Insecure = true
+			},
+		},
+		{
+			testName: "CA file",
+			updateFn: func(cfg *Config) {
+				cfg.Global.CAFile = caFile
+			},
+		},
+		{
+			testName: "Invalid CA file",
+			updateFn: func(cfg *Config) {
+				cfg.Global.CAFile = badCAFile
+			},
+			expectedErr: true,
+		},
+		{
+			testName: "Cert file without key file",
+			updateFn: func(cfg *Config) {
+				cfg.Global.Insecure = true
+				cfg.Global.CertFile = caFile
+			},
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		var cfg Config
+		cfg.Global.AuthUrl = k.server.URL + "/v3"
+		cfg.Global.Username = "admin"
+		cfg.Global.Password = "password"
+		cfg.Global.UserDomainName = "Default"
+		tc.updateFn(&cfg)
+
+		_, err := newProviderClient(cfg)
+		if tc.expectedErr && err == nil {
+			t.Errorf("Case[%s]: expected error, got nil", tc.testName)
+		}
+		if !tc.expectedErr && err != nil {
+			t.Errorf("Case[%s]: unexpected error: %v", tc.testName, err)
+		}
+	}
+}
@@ -0,0 +1,482 @@
+/*
+Copyright (c) 2017 OpenStack Foundation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"net/url"
+
+	crv1 "git.openstack.org/openstack/stackube/pkg/apis/v1"
+	"git.openstack.org/openstack/stackube/pkg/util"
+
+	"github.com/golang/glog"
+)
+
+// UserInfo is the keystone identity behind a token.
+type UserInfo struct {
+	// ID is the keystone user ID.
+	ID string
+	// Name is the keystone user name.
+	Name string
+	// Projects are the names of the projects the user is a member of.
+	Projects []string
+}
+
+// TenantInfo is a keystone project.
+type TenantInfo struct {
+	// ID is the keystone project ID.
+	ID string
+	// Name is the keystone project name.
+	Name string
+}
+
+// GetTenantIDFromName gets tenantID by tenantName.
+func (os *Client) GetTenantIDFromName(tenantName string) (string, error) {
+	if util.IsSystemNamespace(tenantName) {
+		tenantName = util.SystemTenant
+	}
+
+	// If tenantID is specified, return it directly
+	var (
+		tenant *crv1.Tenant
+		err    error
+	)
+	if tenant, err = os.CRDClient.GetTenant(tenantName); err != nil {
+		return "", err
+	}
+	if tenant.Spec.TenantID != "" {
+		return tenant.Spec.TenantID, nil
+	}
+
+	// Otherwise, fetch tenantID from OpenStack
+	project, err := os.getProjectByName(tenantName)
+	if err != nil {
+		return "", err
+	}
+
+	var tenantID string
+	if project != nil {
+		tenantID = project.ID
+	}
+	glog.V(3).Infof("Got tenantID: %v for tenantName: %v", tenantID, tenantName)
+
+	return tenantID, nil
+}
+
+// GetTenantIDFromNamespace gets tenantID of the tenant which owns the
+// namespace.
+func (os *Client) GetTenantIDFromNamespace(namespace string) (string, error) {
+	tenantName, err := util.GetTenantOfNamespace(os.KubeClient, namespace)
+	if err != nil {
+		return "", err
+	}
+	return os.GetTenantIDFromName(tenantName)
+}
+
+// getProjectByName gets the project in the tenant domain by name, nil is
+// returned if the project doesn't exist.
+func (os *Client) getProjectByName(name string) (*keystoneProject, error) {
+	query := url.Values{}
+	query.Set("name", name)
+	query.Set("domain_id", os.TenantDomainID)
+	projects, err := listProjects(os.Identity, query)
+	if err != nil {
+		return nil, err
+	}
+	if len(projects) == 0 {
+		return nil, nil
+	}
+
+	return &projects[0], nil
+}
+
+// CreateTenant creates tenant by tenantname.
+func (os *Client) CreateTenant(tenantName string) (string, error) {
+	project := &keystoneProject{
+		Name:        tenantName,
+		Description: "stackube",
+		DomainID:    os.TenantDomainID,
+		Enabled:     true,
+	}
+	_, err := createProject(os.Identity, project)
+	if err != nil && !IsAlreadyExists(err) {
+		glog.Errorf("Failed to create tenant %s: %v", tenantName, err)
+		return "", err
+	}
+	glog.V(4).Infof("Tenant %s created", tenantName)
+	tenantID, err := os.GetTenantIDFromName(tenantName)
+	if err != nil {
+		return "", err
+	}
+	return tenantID, nil
+}
+
+// DeleteTenant deletes tenant by tenantName.
+func (os *Client) DeleteTenant(tenantName string) error {
+	project, err := os.getProjectByName(tenantName)
+	if err != nil {
+		return err
+	}
+	if project == nil {
+		glog.V(4).Infof("Tenant %s already deleted", tenantName)
+		return nil
+	}
+
+	err = deleteProject(os.Identity, project.ID)
+	if err != nil && !isNotFound(err) {
+		glog.Errorf("Delete openstack tenant %s error: %v", tenantName, err)
+		return err
+	}
+	glog.V(4).Infof("Tenant %s deleted", tenantName)
+	return nil
+}
+
+// ListTenants lists the enabled tenants in the domain which have the tag.
+// The tenant domain is used if domainID is empty, and tenants are not
+// filtered by tag if tag is empty.
+func (os *Client) ListTenants(domainID, tag string) ([]TenantInfo, error) {
+	if domainID == "" {
+		domainID = os.TenantDomainID
+	}
+	query := url.Values{}
+	query.Set("domain_id", domainID)
+	query.Set("enabled", "true")
+	if tag != "" {
+		query.Set("tags", tag)
+	}
+	projects, err := listProjects(os.Identity, query)
+	if err != nil {
+		glog.Errorf("List tenants in domain %s failed: %v", domainID, err)
+		return nil, err
+	}
+
+	var tenants []TenantInfo
+	for _, p := range projects {
+		if p.Enabled {
+			tenants = append(tenants, TenantInfo{ID: p.ID, Name: p.Name})
+		}
+	}
+	return tenants, nil
+}
+
+// CheckTenantByID checks tenant exist or not by tenantID.
+func (os *Client) CheckTenantByID(tenantID string) (bool, error) {
+	_, err := getProject(os.Identity, tenantID)
+	if err == nil {
+		return true, nil
+	}
+	if !isNotFound(err) {
+		return false, err
+	}
+
+	// tenantID may also be the name of the tenant.
+	project, err := os.getProjectByName(tenantID)
+	if err != nil {
+		return false, err
+	}
+
+	return project != nil, nil
+}
+
+// CreateUser creates user with username, password in the tenant, grants it
+// the keystone role mapped from role, and returns the ID of the user. If the
+// user already exists in the tenant domain, it is only granted the role and
+// adopted is true, its password is left unchanged.
+func (os *Client) CreateUser(username, password, tenantID string, role crv1.TenantRole) (string, bool, error) {
+	opts := &keystoneUser{
+		Name:             username,
+		Password:         password,
+		DomainID:         os.TenantDomainID,
+		DefaultProjectID: tenantID,
+		Enabled:          true,
+	}
+	user, err := createUser(os.Identity, opts)
+	if err != nil && !IsAlreadyExists(err) {
+		glog.Errorf("Failed to create user %s: %v", username, err)
+		return "", false, err
+	}
+	adopted := err != nil
+	if adopted {
+		// The user already exists, look it up for role assignment.
+		if user, err = os.getUserByName(username); err != nil {
+			return "", false, err
+		}
+		glog.Warningf("User %s already exists, only granting it a role on tenant %s", username, tenantID)
+	}
+
+	if err := os.SetUserRole(user.ID, tenantID, role); err != nil {
+		return "", false, err
+	}
+	if !adopted {
+		glog.V(4).Infof("User %s created", username)
+	}
+	return user.ID, adopted, nil
+}
+
+// UpdateUser renames the user and changes its password. Empty username or
+// password are left unchanged. ErrNotFound is returned if the user doesn't
+// exist.
+func (os *Client) UpdateUser(userID, username, password string) error {
+	opts := map[string]interface{}{}
+	if username != "" {
+		opts["name"] = username
+	}
+	if password != "" {
+		opts["password"] = password
+	}
+	if len(opts) == 0 {
+		return nil
+	}
+
+	err := updateUser(os.Identity, userID, opts)
+	if isNotFound(err) {
+		return ErrNotFound
+	}
+	if err != nil {
+		glog.Errorf("Failed to update user %s: %v", userID, err)
+		return err
+	}
+	glog.V(4).Infof("User %s updated", userID)
+	return nil
+}
+
+// SetUserRole grants the user the keystone role mapped from role on the
+// tenant, and revokes the other roles managed by stackube on it.
+func (os *Client) SetUserRole(userID, tenantID string, role crv1.TenantRole) error {
+	name := os.keystoneRole(role)
+	roleID, err := os.getRoleIDByName(name)
+	if err != nil {
+		return err
+	}
+	err = assignProjectRole(os.Identity, tenantID, userID, roleID)
+	if err != nil {
+		glog.Errorf("Failed to grant role %s on tenant %s to user %s: %v", name, tenantID, userID, err)
+		return err
+	}
+
+	for _, other := range os.managedRoles() {
+		if other == name {
+			continue
+		}
+		if err := os.revokeRole(userID, tenantID, other); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MoveUserToTenant grants the user the keystone role mapped from role on
+// tenant toTenantID and makes it the user's default project, then revokes
+// the roles managed by stackube on tenant fromTenantID.
+func (os *Client) MoveUserToTenant(userID, fromTenantID, toTenantID string, role crv1.TenantRole) error {
+	if err := os.SetUserRole(userID, toTenantID, role); err != nil {
+		return err
+	}
+	err := updateUser(os.Identity, userID, map[string]interface{}{"default_project_id": toTenantID})
+	if err != nil {
+		glog.Errorf("Failed to set default tenant of user %s: %v", userID, err)
+		return err
+	}
+
+	if fromTenantID != "" && fromTenantID != toTenantID {
+		if err := os.RevokeUserRoles(userID, fromTenantID); err != nil {
+			return err
+		}
+	}
+	glog.V(4).Infof("User %s moved from tenant %s to %s", userID, fromTenantID, toTenantID)
+	return nil
+}
+
+// RevokeUserRoles revokes the roles managed by stackube on the tenant from
+// the user.
+func (os *Client) RevokeUserRoles(userID, tenantID string) error {
+	for _, name := range os.managedRoles() {
+		if err := os.revokeRole(userID, tenantID, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteUser deletes the user by userID, it's not an error if the user
+// doesn't exist.
+func (os *Client) DeleteUser(userID string) error {
+	err := deleteUser(os.Identity, userID)
+	if err != nil && !isNotFound(err) {
+		glog.Errorf("Delete openstack user %s error: %v", userID, err)
+		return err
+	}
+	glog.V(4).Infof("User %s deleted", userID)
+	return nil
+}
+
+// keystoneRole maps a tenant role to the keystone role name configured for it.
+func (os *Client) keystoneRole(role crv1.TenantRole) string {
+	switch role {
+	case crv1.TenantRoleAdmin:
+		return os.AdminRole
+	case crv1.TenantRoleReader:
+		return os.ReaderRole
+	default:
+		return os.MemberRole
+	}
+}
+
+// managedRoles returns the names of the keystone roles managed by stackube.
+func (os *Client) managedRoles() []string {
+	var roles []string
+	for _, name := range []string{os.AdminRole, os.MemberRole, os.ReaderRole} {
+		if name != "" {
+			roles = append(roles, name)
+		}
+	}
+	return roles
+}
+
+// revokeRole revokes the keystone role from the user on the tenant, it's not
+// an error if the role or the assignment doesn't exist.
+func (os *Client) revokeRole(userID, tenantID, name string) error {
+	roleID, err := os.getRoleIDByName(name)
+	if err != nil {
+		if err == ErrNotFound {
+			return nil
+		}
+		return err
+	}
+	err = unassignProjectRole(os.Identity, tenantID, userID, roleID)
+	if err != nil && !isNotFound(err) {
+		glog.Errorf("Failed to revoke role %s on tenant %s from user %s: %v", name, tenantID, userID, err)
+		return err
+	}
+	return nil
+}
+
+func (os *Client) getUserByName(name string) (*keystoneUser, error) {
+	query := url.Values{}
+	query.Set("name", name)
+	query.Set("domain_id", os.TenantDomainID)
+	users, err := listUsers(os.Identity, query)
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return &users[0], nil
+}
+
+func (os *Client) getRoleIDByName(name string) (string, error) {
+	query := url.Values{}
+	query.Set("name", name)
+	roles, err := listRoles(os.Identity, query)
+	if err != nil {
+		return "", err
+	}
+	if len(roles) == 0 {
+		glog.Errorf("Keystone role %s not found", name)
+		return "", ErrNotFound
+	}
+
+	return roles[0].ID, nil
+}
+
+// DeleteAllUsersOnTenant deletes all users on the tenant.
+func (os *Client) DeleteAllUsersOnTenant(tenantName string) error {
+	tenantID, err := os.GetTenantIDFromName(tenantName)
+	if err != nil || tenantID == "" {
+		return nil
+	}
+
+	query := url.Values{}
+	query.Set("scope.project.id", tenantID)
+	assignments, err := listRoleAssignments(os.Identity, query)
+	if err != nil {
+		glog.Errorf("List role assignments on tenant %s error: %v", tenantName, err)
+		return err
+	}
+
+	deleted := make(map[string]bool)
+	for _, assignment := range assignments {
+		userID := assignment.User.ID
+		if userID == "" || deleted[userID] {
+			continue
+		}
+		err := deleteUser(os.Identity, userID)
+		if err != nil && !isNotFound(err) {
+			glog.Errorf("Delete openstack user %s error: %v", userID, err)
+			return err
+		}
+		deleted[userID] = true
+		glog.V(4).Infof("User %s deleted", userID)
+	}
+
+	return nil
+}
+
+// AuthenticateToken validates a keystone token and returns the user who owns it.
+// ErrNotFound is returned if the token is invalid or expired.
+func (os *Client) AuthenticateToken(token string) (*UserInfo, error) {
+	user, err := validateToken(os.Identity, token)
+	if err != nil {
+		// Keystone returns 404 for tokens which are invalid or expired.
+		if isNotFound(err) {
+			return nil, ErrNotFound
+		}
+		glog.Errorf("Validate keystone token failed: %v", err)
+		return nil, err
+	}
+
+	projectList, err := listUserProjects(os.Identity, user.ID)
+	if err != nil {
+		glog.Errorf("List projects of user %s failed: %v", user.ID, err)
+		return nil, err
+	}
+
+	var projects []string
+	for _, p := range projectList {
+		if p.Enabled {
+			projects = append(projects, p.Name)
+		}
+	}
+
+	return &UserInfo{
+		ID:       user.ID,
+		Name:     user.Name,
+		Projects: projects,
+	}, nil
+}
+
+// ListUserRoles lists the names of the roles which the user has on the tenant.
+func (os *Client) ListUserRoles(userID, tenantID string) ([]string, error) {
+	query := url.Values{}
+	query.Set("user.id", userID)
+	query.Set("scope.project.id", tenantID)
+	query.Set("effective", "")
+	query.Set("include_names", "true")
+	assignments, err := listRoleAssignments(os.Identity, query)
+	if err != nil {
+		glog.Errorf("List roles of user %s on tenant %s failed: %v", userID, tenantID, err)
+		return nil, err
+	}
+
+	var roles []string
+	for _, assignment := range assignments {
+		roles = append(roles, assignment.Role.Name)
+	}
+
+	return roles, nil
+}
@@ -0,0 +1,662 @@
+/*
+Copyright (c) 2017 OpenStack Foundation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	crv1 "git.openstack.org/openstack/stackube/pkg/apis/v1"
+	crdClient "git.openstack.org/openstack/stackube/pkg/kubecrd"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	fakeAdminToken = "admin-token"
+	fakeUserToken  = "user-token"
+)
+
+type fakeRoleAssignment struct {
+	projectID string
+	userID    string
+	roleID    string
+}
+
+// fakeKeystone is a local keystone v3 stand-in.
+type fakeKeystone struct {
+	sync.Mutex
+	server       *httptest.Server
+	authRequests []map[string]interface{}
+	projects     map[string]*keystoneProject
+	projectTags  map[string][]string
+	users        map[string]*keystoneUser
+	passwords    map[string]string
+	roles        map[string]*keystoneRole
+	assignments  []fakeRoleAssignment
+	nextID       int
+}
+
+func newFakeKeystone(t *testing.T) *fakeKeystone {
+	k := &fakeKeystone{
+		projects: make(map[string]*keystoneProject),
+		projectTags: map[string][]string{
+			"p-dev": {"stackube"},
+		},
+		users:     make(map[string]*keystoneUser),
+		passwords: make(map[string]string),
+		roles:     make(map[string]*keystoneRole),
+	}
+	k.server = httptest.NewServer(k)
+
+	k.projects["p-dev"] = &keystoneProject{ID: "p-dev", Name: "dev", DomainID: "default", Enabled: true}
+	k.projects["p-test"] = &keystoneProject{ID: "p-test", Name: "test", DomainID: "default", Enabled: true}
+	k.projects["p-old"] = &keystoneProject{ID: "p-old", Name: "archived", DomainID: "default", Enabled: false}
+	k.users["u-123"] = &keystoneUser{ID: "u-123", Name: "alice", DomainID: "default", Enabled: true}
+	k.roles["r-admin"] = &keystoneRole{ID: "r-admin", Name: "admin"}
+	k.roles["r-member"] = &keystoneRole{ID: "r-member", Name: "member"}
+	k.roles["r-reader"] = &keystoneRole{ID: "r-reader", Name: "reader"}
+	k.assignments = []fakeRoleAssignment{
+		{projectID: "p-dev", userID: "u-123", roleID: "r-member"},
+		{projectID: "p-dev", userID: "u-123", roleID: "r-reader"},
+		{projectID: "p-test", userID: "u-123", roleID: "r-reader"},
+		{projectID: "p-old", userID: "u-123", roleID: "r-reader"},
+	}
+
+	return k
+}
+
+func (k *fakeKeystone) close() {
+	k.server.Close()
+}
+
+func (k *fakeKeystone) genID(prefix string) string {
+	k.nextID++
+	return fmt.Sprintf("%s-%d", prefix, k.nextID)
+}
+
+func writeJSON(w http.ResponseWriter, code int, obj interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(obj)
+}
+
+func (k *fakeKeystone) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	k.Lock()
+	defer k.Unlock()
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/v3"), "/")
+	if path == "auth/tokens" && r.Method == "POST" {
+		k.handleAuth(w, r)
+		return
+	}
+	if r.Header.Get("X-Auth-Token") != fakeAdminToken {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	parts := strings.Split(path, "/")
+	query := r.URL.Query()
+	switch {
+	case path == "auth/tokens":
+		if r.Header.Get("X-Subject-Token") != fakeUserToken {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"token": map[string]interface{}{
+				"user": map[string]interface{}{
+					"id":     "u-123",
+					"name":   "alice",
+					"domain": map[string]string{"id": "default", "name": "Default"},
+				},
+			},
+		})
+
+	case path == "projects" && r.Method == "GET":
+		var projects []keystoneProject
+		for _, p := range k.projects {
+			if name := query.Get("name"); name != "" && p.Name != name {
+				continue
+			}
+			if enabled := query.Get("enabled"); enabled != "" && enabled != fmt.Sprint(p.Enabled) {
+				continue
+			}
+			if tag := query.Get("tags"); tag != "" && !containsString(k.projectTags[p.ID], tag) {
+				continue
+			}
+			if p.DomainID == query.Get("domain_id") {
+				projects = append(projects, *p)
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"projects": projects})
+
+	case path == "projects" && r.Method == "POST":
+		var s struct {
+			Project keystoneProject `json:"project"`
+		}
+		json.NewDecoder(r.Body).Decode(&s)
+		for _, p := range k.projects {
+			if p.Name == s.Project.Name && p.DomainID == s.Project.DomainID {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+		}
+		s.Project.ID = k.genID("p")
+		k.projects[s.Project.ID] = &s.Project
+		writeJSON(w, http.StatusCreated, s)
+
+	case len(parts) == 2 && parts[0] == "projects":
+		p, ok := k.projects[parts[1]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Method == "DELETE" {
+			delete(k.projects, p.ID)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"project": p})
+
+	case len(parts) == 6 && parts[0] == "projects" && r.Method == "PUT":
+		assignment := fakeRoleAssignment{projectID: parts[1], userID: parts[3], roleID: parts[5]}
+		for _, a := range k.assignments {
+			if a == assignment {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		k.assignments = append(k.assignments, assignment)
+		w.WriteHeader(http.StatusNoContent)
+
+	case len(parts) == 6 && parts[0] == "projects" && r.Method == "DELETE":
+		assignment := fakeRoleAssignment{projectID: parts[1], userID: parts[3], roleID: parts[5]}
+		for i, a := range k.assignments {
+			if a == assignment {
+				k.assignments = append(k.assignments[:i], k.assignments[i+1:]...)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+
+	case path == "users" && r.Method == "GET":
+		var users []keystoneUser
+		for _, u := range k.users {
+			if u.Name == query.Get("name") && u.DomainID == query.Get("domain_id") {
+				users = append(users, *u)
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"users": users})
+
+	case path == "users" && r.Method == "POST":
+		var s struct {
+			User keystoneUser `json:"user"`
+		}
+		json.NewDecoder(r.Body).Decode(&s)
+		for _, u := range k.users {
+			if u.Name == s.User.Name && u.DomainID == s.User.DomainID {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+		}
+		s.User.ID = k.genID("u")
+		k.passwords[s.User.ID] = s.User.Password
+		s.User.Password = ""
+		k.users[s.User.ID] = &s.User
+		writeJSON(w, http.StatusCreated, s)
+
+	case len(parts) == 2 && parts[0] == "users" && r.Method == "PATCH":
+		u, ok := k.users[parts[1]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var s struct {
+			User keystoneUser `json:"user"`
+		}
+		json.NewDecoder(r.Body).Decode(&s)
+		if s.User.Name != "" {
+			u.Name = s.User.Name
+		}
+		if s.User.Password != "" {
+			k.passwords[u.ID] = s.User.Password
+		}
+		if s.User.DefaultProjectID != "" {
+			u.DefaultProjectID = s.User.DefaultProjectID
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"user": u})
+
+	case len(parts) == 2 && parts[0] == "users" && r.Method == "DELETE":
+		if _, ok := k.users[parts[1]]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(k.users, parts[1])
+		w.WriteHeader(http.StatusNoContent)
+
+	case len(parts) == 3 && parts[0] == "users" && parts[2] == "projects":
+		var projects []keystoneProject
+		seen := make(map[string]bool)
+		for _, a := range k.assignments {
+			if a.userID == parts[1] && !seen[a.projectID] {
+				seen[a.projectID] = true
+				projects = append(projects, *k.projects[a.projectID])
+			}
+		}
+		sort.Slice(projects, func(i, j int) bool { return projects[i].Name < projects[j].Name })
+		writeJSON(w, http.StatusOK, map[string]interface{}{"projects": projects})
+
+	case path == "roles":
+		var roles []keystoneRole
+		for _, role := range k.roles {
+			if role.Name == query.Get("name") {
+				roles = append(roles, *role)
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"roles": roles})
+
+	case path == "role_assignments":
+		var assignments []map[string]interface{}
+		for _, a := range k.assignments {
+			if projectID := query.Get("scope.project.id"); projectID != "" && projectID != a.projectID {
+				continue
+			}
+			if userID := query.Get("user.id"); userID != "" && userID != a.userID {
+				continue
+			}
+			role := map[string]string{"id": a.roleID}
+			if query.Get("include_names") == "true" {
+				role["name"] = k.roles[a.roleID].Name
+			}
+			assignments = append(assignments, map[string]interface{}{
+				"role":  role,
+				"user":  map[string]string{"id": a.userID},
+				"scope": map[string]interface{}{"project": map[string]string{"id": a.projectID}},
+			})
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"role_assignments": assignments})
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (k *fakeKeystone) handleAuth(w http.ResponseWriter, r *http.Request) {
+	var body map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&body)
+	k.authRequests = append(k.authRequests, body)
+
+	endpoint := k.server.URL + "/v3"
+	w.Header().Set("X-Subject-Token", fakeAdminToken)
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"token": map[string]interface{}{
+			"expires_at": "2099-01-01T00:00:00.000000Z",
+			"catalog": []map[string]interface{}{{
+				"type": "identity",
+				"name": "keystone",
+				"endpoints": []map[string]string{
+					{"interface": "admin", "region": "RegionOne", "url": endpoint},
+					{"interface": "public", "region": "RegionOne", "url": endpoint},
+				},
+			}},
+		},
+	})
+}
+
+func newFakeKeystoneClient(t *testing.T, k *fakeKeystone) *Client {
+	var cfg Config
+	cfg.Global.AuthUrl = k.server.URL + "/v3"
+	cfg.Global.Username = "admin"
+	cfg.Global.Password = "password"
+	cfg.Global.UserDomainName = "Default"
+	cfg.Global.TenantName = "admin"
+	cfg.Global.Region = "RegionOne"
+
+	provider, err := newProviderClient(cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error authenticating against fake keystone: %v", err)
+	}
+	identity, err := newIdentityV3(provider, cfg.Global.Region)
+	if err != nil {
+		t.Fatalf("Unexpected error creating identity client: %v", err)
+	}
+
+	kubeCRDClient, err := crdClient.NewFake()
+	if err != nil {
+		t.Fatalf("Failed start a kube crd client: %v", err)
+	}
+	kubeCRDClient.SetTenants(
+		&crv1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "dev"}},
+		&crv1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "new"}},
+	)
+
+	return &Client{
+		Identity:       identity,
+		Provider:       provider,
+		Region:         cfg.Global.Region,
+		TenantDomainID: defaultTenantDomainID,
+		MemberRole:     defaultMemberRole,
+		AdminRole:      defaultAdminRole,
+		ReaderRole:     defaultReaderRole,
+		CRDClient:      kubeCRDClient,
+	}
+}
+
+func TestNewProviderClientV3(t *testing.T) {
+	testCases := []struct {
+		testName    string
+		updateFn    func(cfg *Config)
+		expectedReq string
+	}{
+		{
+			testName: "Password with domains",
+			updateFn: func(cfg *Config) {
+				cfg.Global.Username = "admin"
+				cfg.Global.Password = "password"
+				cfg.Global.UserDomainName = "users"
+				cfg.Global.TenantName = "admin"
+				cfg.Global.TenantDomainID = "projects"
+			},
+			expectedReq: `{"auth": {
+				"identity": {"methods": ["password"], "password": {"user": {"name": "admin", "domain": {"name": "users"}, "password": "password"}}},
+				"scope": {"project": {"name": "admin", "domain": {"id": "projects"}}}
+			}}`,
+		},
+		{
+			testName: "Application credential",
+			updateFn: func(cfg *Config) {
+				cfg.Global.ApplicationCredentialID = "app-id"
+				cfg.Global.ApplicationCredentialSecret = "secret"
+				cfg.Global.TenantName = "ignored"
+			},
+			expectedReq: `{"auth": {
+				"identity": {"methods": ["application_credential"], "application_credential": {"id": "app-id", "secret": "secret"}}
+			}}`,
+		},
+		{
+			testName: "Application credential by name",
+			updateFn: func(cfg *Config) {
+				cfg.Global.UserID = "u-1"
+				cfg.Global.ApplicationCredentialName = "stackube"
+				cfg.Global.ApplicationCredentialSecret = "secret"
+			},
+			expectedReq: `{"auth": {
+				"identity": {"methods": ["application_credential"], "application_credential": {"name": "stackube", "secret": "secret", "user": {"id": "u-1"}}}
+			}}`,
+		},
+		{
+			testName: "Trust scoped",
+			updateFn: func(cfg *Config) {
+				cfg.Global.UserID = "trustee"
+				cfg.Global.Password = "password"
+				cfg.Global.TrustID = "trust-1"
+			},
+			expectedReq: `{"auth": {
+				"identity": {"methods": ["password"], "password": {"user": {"id": "trustee", "password": "password"}}},
+				"scope": {"OS-TRUST:trust": {"id": "trust-1"}}
+			}}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		k := newFakeKeystone(t)
+
+		var cfg Config
+		// auth-url without version is upgraded to v3 by the v3 only options.
+		cfg.Global.AuthUrl = k.server.URL
+		tc.updateFn(&cfg)
+
+		provider, err := newProviderClient(cfg)
+		if err != nil {
+			t.Errorf("Case[%s]: unexpected error: %v", tc.testName, err)
+			k.close()
+			continue
+		}
+		if provider.TokenID != fakeAdminToken {
+			t.Errorf("Case[%s]: expected token %s, got %s", tc.testName, fakeAdminToken, provider.TokenID)
+		}
+
+		var expected map[string]interface{}
+		if err := json.Unmarshal([]byte(tc.expectedReq), &expected); err != nil {
+			t.Fatalf("Case[%s]: unexpected error: %v", tc.testName, err)
+		}
+		if len(k.authRequests) != 1 || !reflect.DeepEqual(expected, k.authRequests[0]) {
+			t.Errorf("Case[%s]: expected auth request %v, got %v", tc.testName, expected, k.authRequests)
+		}
+		k.close()
+	}
+}
+
+func TestNewProviderClientV3Invalid(t *testing.T) {
+	var cfg Config
+	cfg.Global.AuthUrl = "http://127.0.0.1:5000/v2.0"
+	cfg.Global.UserDomainName = "Default"
+	if _, err := newProviderClient(cfg); err == nil {
+		t.Errorf("Expected error for keystone v3 options with a v2.0 auth-url")
+	}
+
+	opts := &v3AuthOptions{Username: "admin", Password: "password"}
+	if _, err := opts.ToTokenV3CreateMap(nil); err == nil {
+		t.Errorf("Expected error for username without user domain")
+	}
+}
+
+func TestTenantLifecycle(t *testing.T) {
+	k := newFakeKeystone(t)
+	defer k.close()
+	client := newFakeKeystoneClient(t, k)
+
+	tenantID, err := client.CreateTenant("new")
+	if err != nil {
+		t.Fatalf("Unexpected error creating tenant: %v", err)
+	}
+	if p, ok := k.projects[tenantID]; !ok || p.Name != "new" || p.DomainID != defaultTenantDomainID {
+		t.Errorf("Expected project new in domain %s, got %v", defaultTenantDomainID, p)
+	}
+
+	// Creating an existing tenant returns the existing ID.
+	existingID, err := client.CreateTenant("new")
+	if err != nil || existingID != tenantID {
+		t.Errorf("Expected tenant ID %s, got %s: %v", tenantID, existingID, err)
+	}
+
+	for _, id := range []string{tenantID, "new"} {
+		found, err := client.CheckTenantByID(id)
+		if err != nil || !found {
+			t.Errorf("Expected tenant %s to be found, got %v: %v", id, found, err)
+		}
+	}
+
+	userID, adopted, err := client.CreateUser("bob", "secret", tenantID, "")
+	if err != nil || adopted {
+		t.Fatalf("Unexpected error creating user: %v %v", adopted, err)
+	}
+	if u, ok := k.users[userID]; !ok || u.Name != "bob" {
+		t.Errorf("Expected user bob with ID %s, got %v", userID, u)
+	}
+	roles, err := client.ListUserRoles(userID, tenantID)
+	if err != nil || !reflect.DeepEqual(roles, []string{"member"}) {
+		t.Errorf("Expected user bob to be member of tenant new, got %v: %v", roles, err)
+	}
+
+	// Creating an existing user adopts it and returns the existing ID.
+	existingUserID, adopted, err := client.CreateUser("bob", "secret", tenantID, "")
+	if err != nil || existingUserID != userID || !adopted {
+		t.Errorf("Expected adopted user ID %s, got %s %v: %v", userID, existingUserID, adopted, err)
+	}
+
+	if err := client.UpdateUser(userID, "carol", "rotated"); err != nil {
+		t.Fatalf("Unexpected error updating user: %v", err)
+	}
+	if u := k.users[userID]; u.Name != "carol" || k.passwords[userID] != "rotated" {
+		t.Errorf("Expected user carol with password rotated, got %v %q", u, k.passwords[userID])
+	}
+	if err := client.UpdateUser("u-missing", "", "rotated"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound updating missing user, got %v", err)
+	}
+
+	// Changing the role revokes the previous one.
+	if err := client.SetUserRole(userID, tenantID, crv1.TenantRoleAdmin); err != nil {
+		t.Fatalf("Unexpected error setting user role: %v", err)
+	}
+	roles, err = client.ListUserRoles(userID, tenantID)
+	if err != nil || !reflect.DeepEqual(roles, []string{"admin"}) {
+		t.Errorf("Expected user carol to be admin of tenant new, got %v: %v", roles, err)
+	}
+
+	if err := client.MoveUserToTenant(userID, tenantID, "p-test", crv1.TenantRoleReader); err != nil {
+		t.Fatalf("Unexpected error moving user: %v", err)
+	}
+	if u := k.users[userID]; u.DefaultProjectID != "p-test" {
+		t.Errorf("Expected default project p-test, got %s", u.DefaultProjectID)
+	}
+	roles, err = client.ListUserRoles(userID, "p-test")
+	if err != nil || !reflect.DeepEqual(roles, []string{"reader"}) {
+		t.Errorf("Expected user carol to be reader of tenant test, got %v: %v", roles, err)
+	}
+	roles, err = client.ListUserRoles(userID, tenantID)
+	if err != nil || len(roles) != 0 {
+		t.Errorf("Expected user carol to be removed from tenant new, got %v: %v", roles, err)
+	}
+	if err := client.MoveUserToTenant(userID, "p-test", tenantID, crv1.TenantRoleMember); err != nil {
+		t.Fatalf("Unexpected error moving user back: %v", err)
+	}
+
+	otherID, _, err := client.CreateUser("dave", "secret", tenantID, crv1.TenantRoleReader)
+	if err != nil {
+		t.Fatalf("Unexpected error creating user: %v", err)
+	}
+	if err := client.DeleteUser(otherID); err != nil {
+		t.Fatalf("Unexpected error deleting user: %v", err)
+	}
+	if _, ok := k.users[otherID]; ok {
+		t.Errorf("Expected user dave to be deleted")
+	}
+	if err := client.DeleteUser(otherID); err != nil {
+		t.Errorf("Expected deleting a deleted user to succeed, got %v", err)
+	}
+
+	if err := client.DeleteAllUsersOnTenant("new"); err != nil {
+		t.Fatalf("Unexpected error deleting users: %v", err)
+	}
+	if _, ok := k.users[userID]; ok {
+		t.Errorf("Expected user bob to be deleted")
+	}
+
+	if err := client.DeleteTenant("new"); err != nil {
+		t.Fatalf("Unexpected error deleting tenant: %v", err)
+	}
+	found, err := client.CheckTenantByID(tenantID)
+	if err != nil || found {
+		t.Errorf("Expected tenant %s to be deleted, got %v: %v", tenantID, found, err)
+	}
+	if err := client.DeleteTenant("new"); err != nil {
+		t.Errorf("Expected deleting a deleted tenant to succeed, got %v", err)
+	}
+}
+
+func TestListTenants(t *testing.T) {
+	k := newFakeKeystone(t)
+	defer k.close()
+	client := newFakeKeystoneClient(t, k)
+
+	testCases := []struct {
+		domainID string
+		tag      string
+		expected []string
+	}{
+		{domainID: "", tag: "", expected: []string{"dev", "test"}},
+		{domainID: "", tag: "stackube", expected: []string{"dev"}},
+		{domainID: "other", tag: "", expected: nil},
+	}
+
+	for _, tc := range testCases {
+		tenants, err := client.ListTenants(tc.domainID, tc.tag)
+		if err != nil {
+			t.Errorf("Case[%s/%s]: unexpected error: %v", tc.domainID, tc.tag, err)
+			continue
+		}
+		var names []string
+		for _, tenant := range tenants {
+			names = append(names, tenant.Name)
+		}
+		sort.Strings(names)
+		if !reflect.DeepEqual(names, tc.expected) {
+			t.Errorf("Case[%s/%s]: expected tenants %v, got %v", tc.domainID, tc.tag, tc.expected, names)
+		}
+	}
+}
+
+func TestAuthenticateToken(t *testing.T) {
+	k := newFakeKeystone(t)
+	defer k.close()
+	client := newFakeKeystoneClient(t, k)
+
+	user, err := client.AuthenticateToken(fakeUserToken)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := &UserInfo{
+		ID:       "u-123",
+		Name:     "alice",
+		Projects: []string{"dev", "test"},
+	}
+	if !reflect.DeepEqual(expected, user) {
+		t.Errorf("Expected user %v, got %v", expected, user)
+	}
+}
+
+func TestAuthenticateInvalidToken(t *testing.T) {
+	k := newFakeKeystone(t)
+	defer k.close()
+	client := newFakeKeystoneClient(t, k)
+
+	_, err := client.AuthenticateToken("invalid-token")
+	if err != ErrNotFound {
+		t.Errorf("Expected error %v, got %v", ErrNotFound, err)
+	}
+}
+
+func TestListUserRoles(t *testing.T) {
+	k := newFakeKeystone(t)
+	defer k.close()
+	client := newFakeKeystoneClient(t, k)
+
+	tenantID, err := client.GetTenantIDFromName("dev")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	roles, err := client.ListUserRoles("u-123", tenantID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []string{"member", "reader"}
+	if !reflect.DeepEqual(expected, roles) {
+		t.Errorf("Expected roles %v, got %v", expected, roles)
+	}
+}
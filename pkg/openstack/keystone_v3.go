@@ -0,0 +1,384 @@
+/*
+Copyright (c) 2017 OpenStack Foundation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack"
+	tokens3 "github.com/gophercloud/gophercloud/openstack/identity/v3/tokens"
+)
+
+// v3AuthOptions builds keystone v3 token requests. Compared with
+// gophercloud.AuthOptions, it supports separate user and project domains,
+// application credentials and trust scoped tokens.
+type v3AuthOptions struct {
+	UserID   string
+	Username string
+	Password string
+
+	UserDomainID   string
+	UserDomainName string
+
+	ProjectID         string
+	ProjectName       string
+	ProjectDomainID   string
+	ProjectDomainName string
+
+	ApplicationCredentialID     string
+	ApplicationCredentialName   string
+	ApplicationCredentialSecret string
+
+	TrustID string
+}
+
+var _ = tokens3.AuthOptionsBuilder(&v3AuthOptions{})
+
+// ToTokenV3CreateMap builds the body of a token request.
+func (opts *v3AuthOptions) ToTokenV3CreateMap(scope map[string]interface{}) (map[string]interface{}, error) {
+	identity := map[string]interface{}{}
+
+	if opts.ApplicationCredentialSecret != "" {
+		credential := map[string]interface{}{
+			"secret": opts.ApplicationCredentialSecret,
+		}
+		switch {
+		case opts.ApplicationCredentialID != "":
+			credential["id"] = opts.ApplicationCredentialID
+		case opts.ApplicationCredentialName != "":
+			// Application credential names are only unique per user.
+			user, err := opts.toUserMap()
+			if err != nil {
+				return nil, err
+			}
+			credential["name"] = opts.ApplicationCredentialName
+			credential["user"] = user
+		default:
+			return nil, errors.New("application credential ID or name is required")
+		}
+
+		identity["methods"] = []string{"application_credential"}
+		identity["application_credential"] = credential
+	} else {
+		if opts.Password == "" {
+			return nil, errors.New("password or application credential secret is required")
+		}
+		user, err := opts.toUserMap()
+		if err != nil {
+			return nil, err
+		}
+		user["password"] = opts.Password
+
+		identity["methods"] = []string{"password"}
+		identity["password"] = map[string]interface{}{"user": user}
+	}
+
+	auth := map[string]interface{}{"identity": identity}
+	if len(scope) != 0 {
+		auth["scope"] = scope
+	}
+
+	return map[string]interface{}{"auth": auth}, nil
+}
+
+// ToTokenV3ScopeMap builds the scope of a token request.
+func (opts *v3AuthOptions) ToTokenV3ScopeMap() (map[string]interface{}, error) {
+	// Application credentials are always bound to their project.
+	if opts.ApplicationCredentialSecret != "" {
+		return nil, nil
+	}
+
+	if opts.TrustID != "" {
+		return map[string]interface{}{
+			"OS-TRUST:trust": map[string]interface{}{"id": opts.TrustID},
+		}, nil
+	}
+
+	if opts.ProjectID != "" {
+		return map[string]interface{}{
+			"project": map[string]interface{}{"id": opts.ProjectID},
+		}, nil
+	}
+
+	if opts.ProjectName != "" {
+		domain := toDomainMap(opts.ProjectDomainID, opts.ProjectDomainName)
+		if domain == nil {
+			// Fall back to the user's domain as the openstack clients do.
+			domain = toDomainMap(opts.UserDomainID, opts.UserDomainName)
+		}
+		if domain == nil {
+			return nil, errors.New("project domain ID or name is required with project name")
+		}
+
+		return map[string]interface{}{
+			"project": map[string]interface{}{
+				"name":   opts.ProjectName,
+				"domain": domain,
+			},
+		}, nil
+	}
+
+	return nil, nil
+}
+
+// CanReauth returns true since the credentials are kept in the config.
+func (opts *v3AuthOptions) CanReauth() bool {
+	return true
+}
+
+func (opts *v3AuthOptions) toUserMap() (map[string]interface{}, error) {
+	if opts.UserID != "" {
+		return map[string]interface{}{"id": opts.UserID}, nil
+	}
+
+	if opts.Username == "" {
+		return nil, errors.New("user ID or username is required")
+	}
+	domain := toDomainMap(opts.UserDomainID, opts.UserDomainName)
+	if domain == nil {
+		return nil, errors.New("user domain ID or name is required with username")
+	}
+
+	return map[string]interface{}{
+		"name":   opts.Username,
+		"domain": domain,
+	}, nil
+}
+
+func toDomainMap(id, name string) map[string]interface{} {
+	if id != "" {
+		return map[string]interface{}{"id": id}
+	}
+	if name != "" {
+		return map[string]interface{}{"name": name}
+	}
+	return nil
+}
+
+// authenticateV3 authenticates the provider against the keystone v3 endpoint
+// in provider.IdentityEndpoint.
+func authenticateV3(provider *gophercloud.ProviderClient, opts *v3AuthOptions) error {
+	identity := &gophercloud.ServiceClient{
+		ProviderClient: provider,
+		Endpoint:       provider.IdentityEndpoint,
+		Type:           "identity",
+	}
+
+	result := tokens3.Create(identity, opts)
+	token, err := result.ExtractToken()
+	if err != nil {
+		return err
+	}
+	catalog, err := result.ExtractServiceCatalog()
+	if err != nil {
+		return err
+	}
+
+	provider.TokenID = token.ID
+	provider.ReauthFunc = func() error {
+		provider.TokenID = ""
+		return authenticateV3(provider, opts)
+	}
+	provider.EndpointLocator = func(eo gophercloud.EndpointOpts) (string, error) {
+		return openstack.V3EndpointURL(catalog, eo)
+	}
+
+	return nil
+}
+
+// newIdentityV3 returns a keystone v3 client for the identity endpoint in the
+// service catalog. It works with tokens issued by both keystone v2 and v3.
+func newIdentityV3(provider *gophercloud.ProviderClient, region string) (*gophercloud.ServiceClient, error) {
+	identity, err := openstack.NewIdentityV3(provider, gophercloud.EndpointOpts{
+		Region:       region,
+		Availability: gophercloud.AvailabilityAdmin,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The catalog may register a versionless or a v2.0 identity endpoint.
+	endpoint := strings.TrimSuffix(identity.Endpoint, "v2.0/")
+	endpoint = strings.TrimSuffix(endpoint, "v3/")
+	identity.Endpoint = endpoint + "v3/"
+
+	return identity, nil
+}
+
+type keystoneProject struct {
+	ID          string `json:"id,omitempty"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	DomainID    string `json:"domain_id,omitempty"`
+	Enabled     bool   `json:"enabled"`
+}
+
+type keystoneUser struct {
+	ID               string `json:"id,omitempty"`
+	Name             string `json:"name"`
+	Password         string `json:"password,omitempty"`
+	DomainID         string `json:"domain_id,omitempty"`
+	DefaultProjectID string `json:"default_project_id,omitempty"`
+	Enabled          bool   `json:"enabled"`
+}
+
+type keystoneRole struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type keystoneRoleAssignment struct {
+	Role keystoneRole `json:"role"`
+	User struct {
+		ID string `json:"id"`
+	} `json:"user"`
+}
+
+func withQuery(u string, query url.Values) string {
+	if len(query) == 0 {
+		return u
+	}
+	return u + "?" + query.Encode()
+}
+
+func listProjects(client *gophercloud.ServiceClient, query url.Values) ([]keystoneProject, error) {
+	var s struct {
+		Projects []keystoneProject `json:"projects"`
+	}
+	_, err := client.Get(withQuery(client.ServiceURL("projects"), query), &s, nil)
+	return s.Projects, err
+}
+
+func getProject(client *gophercloud.ServiceClient, projectID string) (*keystoneProject, error) {
+	var s struct {
+		Project keystoneProject `json:"project"`
+	}
+	_, err := client.Get(client.ServiceURL("projects", projectID), &s, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &s.Project, nil
+}
+
+func createProject(client *gophercloud.ServiceClient, project *keystoneProject) (*keystoneProject, error) {
+	var s struct {
+		Project keystoneProject `json:"project"`
+	}
+	body := map[string]interface{}{"project": project}
+	_, err := client.Post(client.ServiceURL("projects"), body, &s, &gophercloud.RequestOpts{
+		OkCodes: []int{201},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &s.Project, nil
+}
+
+func deleteProject(client *gophercloud.ServiceClient, projectID string) error {
+	_, err := client.Delete(client.ServiceURL("projects", projectID), nil)
+	return err
+}
+
+func listUsers(client *gophercloud.ServiceClient, query url.Values) ([]keystoneUser, error) {
+	var s struct {
+		Users []keystoneUser `json:"users"`
+	}
+	_, err := client.Get(withQuery(client.ServiceURL("users"), query), &s, nil)
+	return s.Users, err
+}
+
+func listUserProjects(client *gophercloud.ServiceClient, userID string) ([]keystoneProject, error) {
+	var s struct {
+		Projects []keystoneProject `json:"projects"`
+	}
+	_, err := client.Get(client.ServiceURL("users", userID, "projects"), &s, nil)
+	return s.Projects, err
+}
+
+func createUser(client *gophercloud.ServiceClient, user *keystoneUser) (*keystoneUser, error) {
+	var s struct {
+		User keystoneUser `json:"user"`
+	}
+	body := map[string]interface{}{"user": user}
+	_, err := client.Post(client.ServiceURL("users"), body, &s, &gophercloud.RequestOpts{
+		OkCodes: []int{201},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &s.User, nil
+}
+
+func updateUser(client *gophercloud.ServiceClient, userID string, opts map[string]interface{}) error {
+	body := map[string]interface{}{"user": opts}
+	_, err := client.Patch(client.ServiceURL("users", userID), body, nil, &gophercloud.RequestOpts{
+		OkCodes: []int{200},
+	})
+	return err
+}
+
+func deleteUser(client *gophercloud.ServiceClient, userID string) error {
+	_, err := client.Delete(client.ServiceURL("users", userID), nil)
+	return err
+}
+
+func listRoles(client *gophercloud.ServiceClient, query url.Values) ([]keystoneRole, error) {
+	var s struct {
+		Roles []keystoneRole `json:"roles"`
+	}
+	_, err := client.Get(withQuery(client.ServiceURL("roles"), query), &s, nil)
+	return s.Roles, err
+}
+
+func assignProjectRole(client *gophercloud.ServiceClient, projectID, userID, roleID string) error {
+	_, err := client.Put(client.ServiceURL("projects", projectID, "users", userID, "roles", roleID), nil, nil, &gophercloud.RequestOpts{
+		OkCodes: []int{204},
+	})
+	return err
+}
+
+func unassignProjectRole(client *gophercloud.ServiceClient, projectID, userID, roleID string) error {
+	_, err := client.Delete(client.ServiceURL("projects", projectID, "users", userID, "roles", roleID), nil)
+	return err
+}
+
+func listRoleAssignments(client *gophercloud.ServiceClient, query url.Values) ([]keystoneRoleAssignment, error) {
+	var s struct {
+		RoleAssignments []keystoneRoleAssignment `json:"role_assignments"`
+	}
+	_, err := client.Get(withQuery(client.ServiceURL("role_assignments"), query), &s, nil)
+	return s.RoleAssignments, err
+}
+
+func validateToken(client *gophercloud.ServiceClient, token string) (*tokens3.User, error) {
+	var s struct {
+		Token struct {
+			User tokens3.User `json:"user"`
+		} `json:"token"`
+	}
+	_, err := client.Get(client.ServiceURL("auth", "tokens"), &s, &gophercloud.RequestOpts{
+		MoreHeaders: map[string]string{"X-Subject-Token": token},
+		OkCodes:     []int{200, 203},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &s.Token.User, nil
+}
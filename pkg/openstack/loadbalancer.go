@@ -18,6 +18,7 @@ package openstack
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"k8s.io/apimachinery/pkg/util/wait"
@@ -36,6 +37,12 @@ const (
 	defaultMonitorDelay   = 10
 	defaultMonitorRetry   = 3
 	defaultMonotorTimeout = 3
+	// defaultConnectionLimit is unlimited.
+	defaultConnectionLimit = -1
+	// defaultMonitorURLPath and defaultMonitorExpectedCodes are the path
+	// requested and the status codes expected by HTTP health monitors.
+	defaultMonitorURLPath       = "/"
+	defaultMonitorExpectedCodes = "200"
 
 	// loadbalancerActive* is configuration of exponential backoff for
 	// going into ACTIVE loadbalancer provisioning status. Starting with 1
@@ -55,25 +62,92 @@ const (
 
 	activeStatus = "ACTIVE"
 	errorStatus  = "ERROR"
+
+	monitorTypeUDPConnect = "UDP-CONNECT"
+)
+
+// Protocols of the ports of load balancers.
+const (
+	ProtocolTCP = "TCP"
+	ProtocolUDP = "UDP"
+	// ProtocolHTTP balances HTTP requests.
+	ProtocolHTTP = "HTTP"
+	// ProtocolTerminatedHTTPS terminates TLS on the load balancer with
+	// the certificate of the load balancer, and balances HTTP requests.
+	ProtocolTerminatedHTTPS = "TERMINATED_HTTPS"
 )
 
+// FloatingIPDescription is the description of the floating IPs allocated
+// for load balancers, which tells them from the floating IPs of users.
+const FloatingIPDescription = "Allocated by stackube"
+
 // LoadBalancer contains all essential information of kubernetes service.
 type LoadBalancer struct {
-	Name            string
-	ServicePort     int
-	TenantID        string
-	SubnetID        string
-	Protocol        string
-	InternalIP      string
-	ExternalIP      string
-	SessionAffinity bool
-	Endpoints       []Endpoint
+	Name       string
+	TenantID   string
+	SubnetID   string
+	InternalIP string
+	// ExternalIP is the requested floating IP, a floating IP is allocated
+	// from the external network if it's empty.
+	ExternalIP string
+	// AllocatedFloatingIP is the floating IP allocated for the load
+	// balancer before. It's reused if ExternalIP is empty, and released if
+	// it's replaced by ExternalIP.
+	AllocatedFloatingIP string
+	SessionAffinity     bool
+	Ports               []LoadBalancerPort
+	// TLS is the certificate of the TERMINATED_HTTPS ports.
+	TLS *TLSCertificate
+	// VipSubnetID is the subnet of the VIP, SubnetID if it's empty. It
+	// can't be changed after the load balancer is created.
+	VipSubnetID string
+	// SourceRanges are the CIDRs admitted by the security group of the
+	// VIP port, all by default.
+	SourceRanges []string
+	Options      LoadBalancerOptions
+}
+
+// LoadBalancerOptions tunes the listeners, pools and health monitors of a load
+// balancer. Zero values are the defaults.
+type LoadBalancerOptions struct {
+	// LBMethod is the algorithm of the pools, ROUND_ROBIN by default.
+	LBMethod string
+	// MonitorType is the type of the health monitors, UDP-CONNECT for UDP
+	// ports and TCP for the others by default.
+	MonitorType string
+	// MonitorDelay, MonitorTimeout and MonitorMaxRetries are the interval
+	// and timeout in seconds and the retries of the health monitors.
+	MonitorDelay      int
+	MonitorTimeout    int
+	MonitorMaxRetries int
+	// ConnectionLimit is the max connections of each listener, unlimited
+	// by default.
+	ConnectionLimit int
+	// TimeoutClientData, TimeoutMemberConnect and TimeoutMemberData are
+	// the timeouts of the listeners in milliseconds. They are only
+	// supported by Octavia, and left unchanged if they are zero.
+	TimeoutClientData    int
+	TimeoutMemberConnect int
+	TimeoutMemberData    int
+}
+
+// LoadBalancerPort is a port of a load balancer, each port has its own
+// listener, pool, members and monitor.
+type LoadBalancerPort struct {
+	Port int
+	// Protocol is the protocol of the listener, one of ProtocolTCP,
+	// ProtocolUDP, ProtocolHTTP and ProtocolTerminatedHTTPS.
+	Protocol  string
+	Endpoints []Endpoint
 }
 
 // Endpoint represents a container endpoint.
 type Endpoint struct {
 	Address string
 	Port    int
+	// SubnetID is the subnet of the member, the subnet of the load
+	// balancer if it's empty.
+	SubnetID string
 }
 
 // LoadBalancerStatus contains the status of a load balancer.
@@ -84,6 +158,10 @@ type LoadBalancerStatus struct {
 
 // EnsureLoadBalancer ensures a load balancer is created.
 func (os *Client) EnsureLoadBalancer(lb *LoadBalancer) (*LoadBalancerStatus, error) {
+	if len(lb.Ports) == 0 {
+		return nil, fmt.Errorf("no ports provided for load balancer %q", lb.Name)
+	}
+
 	// removes old one if already exists.
 	loadbalancer, err := os.getLoadBalanceByName(lb.Name)
 	if err != nil {
@@ -92,7 +170,7 @@ func (os *Client) EnsureLoadBalancer(lb *LoadBalancer) (*LoadBalancerStatus, err
 			lbOpts := loadbalancers.CreateOpts{
 				Name:        lb.Name,
 				Description: "Stackube service",
-				VipSubnetID: lb.SubnetID,
+				VipSubnetID: vipSubnetID(lb),
 				TenantID:    lb.TenantID,
 			}
 			loadbalancer, err = loadbalancers.Create(os.Network, lbOpts).Extract()
@@ -103,6 +181,10 @@ func (os *Client) EnsureLoadBalancer(lb *LoadBalancer) (*LoadBalancerStatus, err
 		}
 	} else {
 		glog.V(3).Infof("LoadBalancer %s already exists", lb.Name)
+		if loadbalancer.VipSubnetID != vipSubnetID(lb) {
+			glog.Warningf("VIP of load balancer %s can't be moved from subnet %s to %s, recreate the service to move it",
+				lb.Name, loadbalancer.VipSubnetID, vipSubnetID(lb))
+		}
 	}
 
 	status, err := os.waitLoadBalancerStatus(loadbalancer.ID)
@@ -113,54 +195,152 @@ func (os *Client) EnsureLoadBalancer(lb *LoadBalancer) (*LoadBalancerStatus, err
 
 	glog.V(3).Infof("Load balancer %q becomes %q", lb.Name, status)
 
+	// store the certificate of TERMINATED_HTTPS ports in barbican.
+	var tlsContainerRef string
+	for _, port := range lb.Ports {
+		if port.Protocol != ProtocolTerminatedHTTPS {
+			continue
+		}
+		if lb.TLS == nil {
+			return nil, fmt.Errorf("no certificate provided for %s port %d", port.Protocol, port.Port)
+		}
+		tlsContainerRef, err = os.ensureTLSContainer(lb.Name, lb.TLS)
+		if err != nil {
+			glog.Errorf("Ensure certificate of load balancer %q failed: %v", lb.Name, err)
+			return nil, err
+		}
+		break
+	}
+
 	// get old listeners
-	var listener *listeners.Listener
 	oldListeners, err := os.getListenersByLoadBalancerID(loadbalancer.ID)
 	if err != nil {
 		return nil, fmt.Errorf("error getting LB %s listeners: %v", loadbalancer.Name, err)
 	}
+	ports := make(map[string]bool, len(lb.Ports))
+	for _, port := range lb.Ports {
+		ports[listenerKey(listenerProtocol(port.Protocol), port.Port)] = true
+	}
+	var staleTLSContainerRefs []string
+	listenersByKey := make(map[string]*listeners.Listener, len(oldListeners))
 	for i := range oldListeners {
 		l := oldListeners[i]
-		if l.ProtocolPort == lb.ServicePort {
-			listener = &l
-		} else {
-			// delete the obsolete listener
-			if err := os.ensureListenerDeleted(loadbalancer.ID, l); err != nil {
-				return nil, fmt.Errorf("error deleting listener %q: %v", l.Name, err)
+		if ports[listenerKey(l.Protocol, l.ProtocolPort)] {
+			listenersByKey[listenerKey(l.Protocol, l.ProtocolPort)] = &l
+			continue
+		}
+
+		// delete the listener of the removed port
+		glog.V(4).Infof("Deleting obsolete listener %s of load balancer %s port %s/%d", l.ID, lb.Name, l.Protocol, l.ProtocolPort)
+		if err := os.ensureListenerDeleted(loadbalancer.ID, l); err != nil {
+			return nil, fmt.Errorf("error deleting listener %q: %v", l.Name, err)
+		}
+		os.waitLoadBalancerStatus(loadbalancer.ID)
+		staleTLSContainerRefs = append(staleTLSContainerRefs, l.DefaultTlsContainerRef)
+	}
+
+	for _, port := range lb.Ports {
+		listener := listenersByKey[listenerKey(listenerProtocol(port.Protocol), port.Port)]
+		if listener != nil && port.Protocol == ProtocolTerminatedHTTPS && listener.DefaultTlsContainerRef != tlsContainerRef {
+			// the certificate is renewed.
+			opts := listeners.UpdateOpts{DefaultTlsContainerRef: tlsContainerRef}
+			if _, err := listeners.Update(os.Network, listener.ID, opts).Extract(); err != nil {
+				return nil, fmt.Errorf("error updating certificate of listener %q: %v", listener.ID, err)
 			}
 			os.waitLoadBalancerStatus(loadbalancer.ID)
+			staleTLSContainerRefs = append(staleTLSContainerRefs, listener.DefaultTlsContainerRef)
 		}
+
+		if err := os.ensureListener(loadbalancer.ID, lb, port, listener, tlsContainerRef); err != nil {
+			return nil, err
+		}
+	}
+
+	// delete the certificates no longer used.
+	for _, ref := range staleTLSContainerRefs {
+		if ref == "" || ref == tlsContainerRef {
+			continue
+		}
+		if err := os.deleteTLSContainer(ref); err != nil {
+			glog.Warningf("Delete certificate container %s of load balancer %s failed: %v", ref, lb.Name, err)
+		}
+	}
+
+	// only admit the source ranges to the vip.
+	if err := os.ensureLoadBalancerSecurityGroup(lb, loadbalancer.VipPortID); err != nil {
+		glog.Errorf("Ensure security group of load balancer %q failed: %v", lb.Name, err)
+		return nil, err
+	}
+
+	// associate external IP for the vip.
+	fip, err := os.ensureFloatingIP(lb, loadbalancer.VipPortID)
+	if err != nil {
+		glog.Errorf("Associate floating IP for port %q failed: %v", loadbalancer.VipPortID, err)
+		return nil, err
+	}
+
+	return &LoadBalancerStatus{
+		InternalIP: loadbalancer.VipAddress,
+		ExternalIP: fip,
+	}, nil
+}
+
+// ensureListener ensures the listener, pool, members and monitor of port are
+// created on the load balancer. listener is the existing listener of port,
+// or nil if it has not been created.
+func (os *Client) ensureListener(loadbalancerID string, lb *LoadBalancer, port LoadBalancerPort,
+	listener *listeners.Listener, tlsContainerRef string) error {
+	protocol := listenerProtocol(port.Protocol)
+	name := fmt.Sprintf("%s_%s_%d", lb.Name, strings.ToLower(protocol), port.Port)
+	connLimit := defaultConnectionLimit
+	if lb.Options.ConnectionLimit > 0 {
+		connLimit = lb.Options.ConnectionLimit
+	}
+	timeouts := listenerTimeouts{
+		ClientData:    lb.Options.TimeoutClientData,
+		MemberConnect: lb.Options.TimeoutMemberConnect,
+		MemberData:    lb.Options.TimeoutMemberData,
+	}
+	lbMethod := pools.LBMethodRoundRobin
+	if lb.Options.LBMethod != "" {
+		lbMethod = pools.LBMethod(lb.Options.LBMethod)
 	}
 
 	// create the listener.
 	if listener == nil {
 		lisOpts := listeners.CreateOpts{
-			LoadbalancerID: loadbalancer.ID,
-			// Only tcp is supported now.
-			Protocol:     listeners.ProtocolTCP,
-			ProtocolPort: lb.ServicePort,
-			TenantID:     lb.TenantID,
-			Name:         lb.Name,
-		}
-		listener, err = listeners.Create(os.Network, lisOpts).Extract()
+			LoadbalancerID: loadbalancerID,
+			Protocol:       listeners.Protocol(protocol),
+			ProtocolPort:   port.Port,
+			TenantID:       lb.TenantID,
+			Name:           name,
+			ConnLimit:      &connLimit,
+		}
+		if protocol == ProtocolTerminatedHTTPS {
+			lisOpts.DefaultTlsContainerRef = tlsContainerRef
+		}
+		var err error
+		listener, err = listeners.Create(os.Network, listenerCreateOpts{lisOpts, timeouts}).Extract()
 		if err != nil {
-			glog.Errorf("Create listener %q failed: %v", lb.Name, err)
-			return nil, err
+			glog.Errorf("Create listener %q failed: %v", name, err)
+			return err
 		}
-		os.waitLoadBalancerStatus(loadbalancer.ID)
+		os.waitLoadBalancerStatus(loadbalancerID)
+	} else if err := os.updateListener(loadbalancerID, listener, connLimit, timeouts); err != nil {
+		return err
 	}
 
 	// create the load balancer pool.
-	pool, err := os.getPoolByListenerID(loadbalancer.ID, listener.ID)
+	pool, err := os.getPoolByListenerID(loadbalancerID, listener.ID)
 	if err != nil && !isNotFound(err) {
-		return nil, fmt.Errorf("error getting pool for listener %q: %v", listener.ID, err)
+		return fmt.Errorf("error getting pool for listener %q: %v", listener.ID, err)
 	}
 	if pool == nil {
 		poolOpts := pools.CreateOpts{
-			Name:       lb.Name,
+			Name:       name,
 			ListenerID: listener.ID,
-			Protocol:   pools.ProtocolTCP,
-			LBMethod:   pools.LBMethodRoundRobin,
+			Protocol:   poolProtocol(protocol),
+			LBMethod:   lbMethod,
 			TenantID:   lb.TenantID,
 		}
 		if lb.SessionAffinity {
@@ -168,31 +348,42 @@ func (os *Client) EnsureLoadBalancer(lb *LoadBalancer) (*LoadBalancerStatus, err
 		}
 		pool, err = pools.Create(os.Network, poolOpts).Extract()
 		if err != nil {
-			glog.Errorf("Create pool %q failed: %v", lb.Name, err)
-			return nil, err
+			glog.Errorf("Create pool %q failed: %v", name, err)
+			return err
 		}
-		os.waitLoadBalancerStatus(loadbalancer.ID)
+		os.waitLoadBalancerStatus(loadbalancerID)
+	} else if pool.LBMethod != string(lbMethod) {
+		glog.V(4).Infof("Updating algorithm of pool %s from %s to %s", pool.ID, pool.LBMethod, lbMethod)
+		_, err = pools.Update(os.Network, pool.ID, pools.UpdateOpts{LBMethod: lbMethod}).Extract()
+		if err != nil {
+			return fmt.Errorf("error updating pool %q: %v", pool.ID, err)
+		}
+		os.waitLoadBalancerStatus(loadbalancerID)
 	}
 
 	// create load balancer members.
 	members, err := os.getMembersByPoolID(pool.ID)
 	if err != nil && !isNotFound(err) {
-		return nil, fmt.Errorf("error getting members for pool %q: %v", pool.ID, err)
+		return fmt.Errorf("error getting members for pool %q: %v", pool.ID, err)
 	}
-	for _, ep := range lb.Endpoints {
+	for _, ep := range port.Endpoints {
 		if !memberExists(members, ep.Address, ep.Port) {
 			memberName := fmt.Sprintf("%s-%s-%d", lb.Name, ep.Address, ep.Port)
+			subnetID := ep.SubnetID
+			if subnetID == "" {
+				subnetID = lb.SubnetID
+			}
 			_, err = pools.CreateMember(os.Network, pool.ID, pools.CreateMemberOpts{
 				Name:         memberName,
 				ProtocolPort: ep.Port,
 				Address:      ep.Address,
-				SubnetID:     lb.SubnetID,
+				SubnetID:     subnetID,
 			}).Extract()
 			if err != nil {
 				glog.Errorf("Create member %q failed: %v", memberName, err)
-				return nil, err
+				return err
 			}
-			os.waitLoadBalancerStatus(loadbalancer.ID)
+			os.waitLoadBalancerStatus(loadbalancerID)
 		} else {
 			members = popMember(members, ep.Address, ep.Port)
 		}
@@ -203,39 +394,213 @@ func (os *Client) EnsureLoadBalancer(lb *LoadBalancer) (*LoadBalancerStatus, err
 			pool.ID, member.Address)
 		err := pools.DeleteMember(os.Network, pool.ID, member.ID).ExtractErr()
 		if err != nil && !isNotFound(err) {
-			return nil, fmt.Errorf("error deleting member %s for pool %s address %s: %v",
+			return fmt.Errorf("error deleting member %s for pool %s address %s: %v",
 				member.ID, pool.ID, member.Address, err)
 		}
 	}
 
+	return os.ensureMonitor(loadbalancerID, lb, pool, name, protocol)
+}
+
+// ensureMonitor ensures the health monitor of pool is created with the
+// options of the load balancer. The monitor is updated in place, unless its
+// type is changed.
+func (os *Client) ensureMonitor(loadbalancerID string, lb *LoadBalancer, pool *pools.Pool, name, protocol string) error {
+	opts := monitors.CreateOpts{
+		Name:       name,
+		Type:       monitorType(protocol),
+		PoolID:     pool.ID,
+		TenantID:   lb.TenantID,
+		Delay:      defaultMonitorDelay,
+		Timeout:    defaultMonotorTimeout,
+		MaxRetries: defaultMonitorRetry,
+	}
+	if lb.Options.MonitorType != "" {
+		opts.Type = lb.Options.MonitorType
+	}
+	if opts.Type == monitors.TypeHTTP || opts.Type == monitors.TypeHTTPS {
+		opts.URLPath = defaultMonitorURLPath
+		opts.ExpectedCodes = defaultMonitorExpectedCodes
+	}
+	if lb.Options.MonitorDelay > 0 {
+		opts.Delay = lb.Options.MonitorDelay
+	}
+	if lb.Options.MonitorTimeout > 0 {
+		opts.Timeout = lb.Options.MonitorTimeout
+	}
+	if lb.Options.MonitorMaxRetries > 0 {
+		opts.MaxRetries = lb.Options.MonitorMaxRetries
+	}
+
+	if pool.MonitorID != "" {
+		monitor, err := monitors.Get(os.Network, pool.MonitorID).Extract()
+		if err != nil && !isNotFound(err) {
+			return fmt.Errorf("error getting monitor %q: %v", pool.MonitorID, err)
+		}
+		switch {
+		case monitor == nil:
+		case monitor.Type != opts.Type:
+			// the type of a monitor can't be updated.
+			glog.V(4).Infof("Deleting monitor %s of pool %s to change its type to %s", monitor.ID, pool.ID, opts.Type)
+			err = monitors.Delete(os.Network, monitor.ID).ExtractErr()
+			if err != nil && !isNotFound(err) {
+				return fmt.Errorf("error deleting monitor %q: %v", monitor.ID, err)
+			}
+			os.waitLoadBalancerStatus(loadbalancerID)
+		case monitor.Delay != opts.Delay || monitor.Timeout != opts.Timeout || monitor.MaxRetries != opts.MaxRetries:
+			glog.V(4).Infof("Updating monitor %s of pool %s", monitor.ID, pool.ID)
+			_, err = monitors.Update(os.Network, monitor.ID, monitors.UpdateOpts{
+				Delay:      opts.Delay,
+				Timeout:    opts.Timeout,
+				MaxRetries: opts.MaxRetries,
+			}).Extract()
+			if err != nil {
+				return fmt.Errorf("error updating monitor %q: %v", monitor.ID, err)
+			}
+			os.waitLoadBalancerStatus(loadbalancerID)
+			return nil
+		default:
+			return nil
+		}
+	}
+
 	// create loadbalancer monitor.
-	if pool.MonitorID == "" {
-		_, err = monitors.Create(os.Network, monitors.CreateOpts{
-			Name:       lb.Name,
-			Type:       monitors.TypeTCP,
-			PoolID:     pool.ID,
-			TenantID:   lb.TenantID,
-			Delay:      defaultMonitorDelay,
-			Timeout:    defaultMonotorTimeout,
-			MaxRetries: defaultMonitorRetry,
-		}).Extract()
+	_, err := monitors.Create(os.Network, opts).Extract()
+	if err != nil {
+		glog.Errorf("Create monitor for pool %q failed: %v", pool.ID, err)
+		return err
+	}
+	os.waitLoadBalancerStatus(loadbalancerID)
+
+	return nil
+}
+
+// listenerTimeouts are the timeouts of Octavia listeners in milliseconds,
+// which are not supported by gophercloud yet.
+type listenerTimeouts struct {
+	ClientData    int `json:"timeout_client_data,omitempty"`
+	MemberConnect int `json:"timeout_member_connect,omitempty"`
+	MemberData    int `json:"timeout_member_data,omitempty"`
+}
+
+// merge adds the timeouts which are set to the listener request body.
+func (t listenerTimeouts) merge(body map[string]interface{}) {
+	listener := body["listener"].(map[string]interface{})
+	if t.ClientData > 0 {
+		listener["timeout_client_data"] = t.ClientData
+	}
+	if t.MemberConnect > 0 {
+		listener["timeout_member_connect"] = t.MemberConnect
+	}
+	if t.MemberData > 0 {
+		listener["timeout_member_data"] = t.MemberData
+	}
+}
+
+// listenerCreateOpts are the create options of a listener with timeouts.
+type listenerCreateOpts struct {
+	listeners.CreateOpts
+	timeouts listenerTimeouts
+}
+
+func (opts listenerCreateOpts) ToListenerCreateMap() (map[string]interface{}, error) {
+	body, err := opts.CreateOpts.ToListenerCreateMap()
+	if err != nil {
+		return nil, err
+	}
+	opts.timeouts.merge(body)
+	return body, nil
+}
+
+// updateListener updates the connection limit and the timeouts of listener
+// if they are changed. Timeouts which are not set are left unchanged.
+func (os *Client) updateListener(loadbalancerID string, listener *listeners.Listener, connLimit int,
+	timeouts listenerTimeouts) error {
+	opts := listeners.UpdateOpts{}
+	changed := false
+	if listener.ConnLimit != connLimit {
+		opts.ConnLimit = &connLimit
+		changed = true
+	}
+	var updatedTimeouts listenerTimeouts
+
+	if timeouts != (listenerTimeouts{}) {
+		var current struct {
+			Listener listenerTimeouts `json:"listener"`
+		}
+		_, err := os.Network.Get(os.Network.ServiceURL("lbaas", "listeners", listener.ID), &current, nil)
 		if err != nil {
-			glog.Errorf("Create monitor for pool %q failed: %v", pool.ID, err)
-			return nil, err
+			return fmt.Errorf("error getting listener %q: %v", listener.ID, err)
+		}
+		if (timeouts.ClientData > 0 && timeouts.ClientData != current.Listener.ClientData) ||
+			(timeouts.MemberConnect > 0 && timeouts.MemberConnect != current.Listener.MemberConnect) ||
+			(timeouts.MemberData > 0 && timeouts.MemberData != current.Listener.MemberData) {
+			updatedTimeouts = timeouts
+			changed = true
 		}
 	}
 
-	// associate external IP for the vip.
-	fip, err := os.associateFloatingIP(lb.TenantID, loadbalancer.VipPortID, lb.ExternalIP)
+	if !changed {
+		return nil
+	}
+	// listeners.Update doesn't accept the timeouts.
+	body, err := opts.ToListenerUpdateMap()
 	if err != nil {
-		glog.Errorf("associateFloatingIP for port %q failed: %v", loadbalancer.VipPortID, err)
-		return nil, err
+		return err
 	}
+	updatedTimeouts.merge(body)
+	glog.V(4).Infof("Updating listener %s", listener.ID)
+	_, err = os.Network.Put(os.Network.ServiceURL("lbaas", "listeners", listener.ID), body, nil, &gophercloud.RequestOpts{
+		OkCodes: []int{200, 202},
+	})
+	if err != nil {
+		return fmt.Errorf("error updating listener %q: %v", listener.ID, err)
+	}
+	os.waitLoadBalancerStatus(loadbalancerID)
+	return nil
+}
 
-	return &LoadBalancerStatus{
-		InternalIP: loadbalancer.VipAddress,
-		ExternalIP: fip,
-	}, nil
+// vipSubnetID returns the subnet of the VIP of lb.
+func vipSubnetID(lb *LoadBalancer) string {
+	if lb.VipSubnetID != "" {
+		return lb.VipSubnetID
+	}
+	return lb.SubnetID
+}
+
+// listenerProtocol returns the listener protocol of the port protocol, TCP if
+// it's not set.
+func listenerProtocol(protocol string) string {
+	if protocol == "" {
+		return ProtocolTCP
+	}
+	return protocol
+}
+
+// listenerKey returns the key of the listener by its protocol and port.
+func listenerKey(protocol string, port int) string {
+	return fmt.Sprintf("%s/%d", protocol, port)
+}
+
+// poolProtocol returns the pool protocol of the listener protocol, TLS is
+// terminated by TERMINATED_HTTPS listeners.
+func poolProtocol(protocol string) pools.Protocol {
+	switch protocol {
+	case ProtocolUDP:
+		return pools.Protocol(ProtocolUDP)
+	case ProtocolHTTP, ProtocolTerminatedHTTPS:
+		return pools.ProtocolHTTP
+	default:
+		return pools.ProtocolTCP
+	}
+}
+
+// monitorType returns the health monitor type of the listener protocol.
+func monitorType(protocol string) string {
+	if protocol == ProtocolUDP {
+		return monitorTypeUDPConnect
+	}
+	return monitors.TypeTCP
 }
 
 // GetLoadBalancer gets a load balancer by name.
@@ -246,33 +611,41 @@ func (os *Client) GetLoadBalancer(name string) (*LoadBalancer, error) {
 		return nil, err
 	}
 
-	// get listener
-	listener, err := os.getListenerByName(name)
+	// get listeners
+	listenerList, err := os.getListenersByLoadBalancerID(lb.ID)
 	if err != nil {
 		return nil, err
 	}
 
-	// get members
-	endpoints := make([]Endpoint, 0)
-	for _, pool := range listener.Pools {
-		for _, m := range pool.Members {
-			endpoints = append(endpoints, Endpoint{
-				Address: m.Address,
-				Port:    m.ProtocolPort,
-			})
-		}
-	}
-
-	return &LoadBalancer{
-		Name:            lb.Name,
-		ServicePort:     listener.ProtocolPort,
-		TenantID:        lb.TenantID,
-		SubnetID:        lb.VipSubnetID,
-		Protocol:        listener.Protocol,
-		InternalIP:      lb.VipAddress,
-		SessionAffinity: listener.Pools[0].Persistence.Type != "",
-		Endpoints:       endpoints,
-	}, nil
+	result := &LoadBalancer{
+		Name:        lb.Name,
+		TenantID:    lb.TenantID,
+		SubnetID:    lb.VipSubnetID,
+		VipSubnetID: lb.VipSubnetID,
+		InternalIP:  lb.VipAddress,
+	}
+	for _, listener := range listenerList {
+		// get members
+		endpoints := make([]Endpoint, 0)
+		for _, pool := range listener.Pools {
+			if pool.Persistence.Type != "" {
+				result.SessionAffinity = true
+			}
+			for _, m := range pool.Members {
+				endpoints = append(endpoints, Endpoint{
+					Address: m.Address,
+					Port:    m.ProtocolPort,
+				})
+			}
+		}
+		result.Ports = append(result.Ports, LoadBalancerPort{
+			Port:      listener.ProtocolPort,
+			Protocol:  listener.Protocol,
+			Endpoints: endpoints,
+		})
+	}
+
+	return result, nil
 }
 
 // LoadBalancerExist returns whether a load balancer has already been exist.
@@ -289,34 +662,43 @@ func (os *Client) LoadBalancerExist(name string) (bool, error) {
 	return true, nil
 }
 
-// EnsureLoadBalancerDeleted ensures a load balancer is deleted.
-func (os *Client) EnsureLoadBalancerDeleted(name string) error {
+// EnsureLoadBalancerDeleted ensures a load balancer is deleted. The floating
+// IP of the load balancer is released if releaseFloatingIP is true, otherwise
+// it's only disassociated.
+func (os *Client) EnsureLoadBalancerDeleted(name string, releaseFloatingIP bool) error {
 	// get load balancer
 	lb, err := os.getLoadBalanceByName(name)
 	if err != nil {
 		if isNotFound(err) {
-			return nil
+			// the security group is left if the last deletion failed
+			// after the load balancer was deleted.
+			return os.deleteLoadBalancerSecurityGroup(name)
 		}
 
 		return err
 	}
 
-	// delete floatingip
+	// delete or disassociate floatingip
 	floatingIP, err := os.getFloatingIPByPortID(lb.VipPortID)
 	if err != nil && !isNotFound(err) {
 		return fmt.Errorf("error getting floating ip by port %q: %v", lb.VipPortID, err)
 	}
 	if floatingIP != nil {
-		err = floatingips.Delete(os.Network, floatingIP.ID).ExtractErr()
+		// Floating IPs not allocated by stackube are only disassociated.
+		if releaseFloatingIP && floatingIP.Description == FloatingIPDescription {
+			err = floatingips.Delete(os.Network, floatingIP.ID).ExtractErr()
+		} else {
+			_, err = floatingips.Update(os.Network, floatingIP.ID, floatingips.UpdateOpts{}).Extract()
+		}
 		if err != nil && !isNotFound(err) {
-			return fmt.Errorf("error deleting floating ip %q: %v", floatingIP.ID, err)
+			return fmt.Errorf("error releasing floating ip %q: %v", floatingIP.ID, err)
 		}
 	}
 
 	// get listeners and corelative pools and members
 	var poolIDs []string
 	var monitorIDs []string
-	var memberIDs []string
+	memberIDs := make(map[string][]string)
 	listenerList, err := os.getListenersByLoadBalancerID(lb.ID)
 	if err != nil {
 		return fmt.Errorf("Error getting load balancer %s listeners: %v", lb.ID, err)
@@ -327,6 +709,11 @@ func (os *Client) EnsureLoadBalancerDeleted(name string) error {
 		if err != nil && !isNotFound(err) {
 			return fmt.Errorf("error getting pool for listener %s: %v", listener.ID, err)
 		}
+		if pool == nil {
+			// the listener is left without a pool if the creation of the
+			// load balancer failed.
+			continue
+		}
 		poolIDs = append(poolIDs, pool.ID)
 		if pool.MonitorID != "" {
 			monitorIDs = append(monitorIDs, pool.MonitorID)
@@ -338,7 +725,7 @@ func (os *Client) EnsureLoadBalancerDeleted(name string) error {
 			return fmt.Errorf("Error getting pool members %s: %v", pool, err)
 		}
 		for _, member := range membersList {
-			memberIDs = append(memberIDs, member.ID)
+			memberIDs[pool] = append(memberIDs[pool], member.ID)
 		}
 	}
 
@@ -354,7 +741,7 @@ func (os *Client) EnsureLoadBalancerDeleted(name string) error {
 	// delete all members and pools
 	for _, poolID := range poolIDs {
 		// delete all members for this pool
-		for _, memberID := range memberIDs {
+		for _, memberID := range memberIDs[poolID] {
 			err := pools.DeleteMember(os.Network, poolID, memberID).ExtractErr()
 			if err != nil && !isNotFound(err) {
 				return err
@@ -370,13 +757,22 @@ func (os *Client) EnsureLoadBalancerDeleted(name string) error {
 		os.waitLoadBalancerStatus(lb.ID)
 	}
 
-	// delete all listeners
+	// delete all listeners and their certificates
+	tlsContainerRefs := make(map[string]bool)
 	for _, listener := range listenerList {
 		err := listeners.Delete(os.Network, listener.ID).ExtractErr()
 		if err != nil && !isNotFound(err) {
 			return err
 		}
 		os.waitLoadBalancerStatus(lb.ID)
+		if listener.DefaultTlsContainerRef != "" {
+			tlsContainerRefs[listener.DefaultTlsContainerRef] = true
+		}
+	}
+	for ref := range tlsContainerRefs {
+		if err := os.deleteTLSContainer(ref); err != nil {
+			return fmt.Errorf("error deleting certificate container %s: %v", ref, err)
+		}
 	}
 
 	// delete the load balancer
@@ -384,9 +780,12 @@ func (os *Client) EnsureLoadBalancerDeleted(name string) error {
 	if err != nil && !isNotFound(err) {
 		return err
 	}
-	os.waitLoadBalancerStatus(lb.ID)
 
-	return nil
+	// delete the security group after the vip port is deleted.
+	if err := os.waitLoadbalancerDeleted(lb.ID); err != nil {
+		return err
+	}
+	return os.deleteLoadBalancerSecurityGroup(name)
 }
 
 func (os *Client) ensureListenerDeleted(loadbalancerID string, listener listeners.Listener) error {
@@ -428,6 +827,7 @@ func (os *Client) waitLoadBalancerStatus(loadbalancerID string) (string, error)
 		Steps:    loadbalancerActiveSteps,
 	}
 
+	start := time.Now()
 	var provisioningStatus string
 	err := wait.ExponentialBackoff(backoff, func() (bool, error) {
 		loadbalancer, err := loadbalancers.Get(os.Network, loadbalancerID).Extract()
@@ -448,6 +848,9 @@ func (os *Client) waitLoadBalancerStatus(loadbalancerID string) (string, error)
 	if err == wait.ErrWaitTimeout {
 		err = fmt.Errorf("Loadbalancer failed to go into ACTIVE provisioning status within alloted time")
 	}
+	if provisioningStatus != "" {
+		loadBalancerProvisioningDuration.WithLabelValues(provisioningStatus).Observe(time.Since(start).Seconds())
+	}
 	return provisioningStatus, err
 }
 
@@ -460,7 +863,7 @@ func (os *Client) waitLoadbalancerDeleted(loadbalancerID string) error {
 	err := wait.ExponentialBackoff(backoff, func() (bool, error) {
 		_, err := loadbalancers.Get(os.Network, loadbalancerID).Extract()
 		if err != nil {
-			if err == ErrNotFound {
+			if isNotFound(err) {
 				return true, nil
 			} else {
 				return false, err
@@ -603,38 +1006,6 @@ func (os *Client) getPoolByName(name string) (*pools.Pool, error) {
 	return pool, nil
 }
 
-func (os *Client) getListenerByName(name string) (*listeners.Listener, error) {
-	var listener *listeners.Listener
-
-	opts := listeners.ListOpts{Name: name}
-	pager := listeners.List(os.Network, opts)
-	err := pager.EachPage(func(page pagination.Page) (bool, error) {
-		lists, err := listeners.ExtractListeners(page)
-		if err != nil {
-			return false, err
-		}
-
-		switch len(lists) {
-		case 0:
-			return false, ErrNotFound
-		case 1:
-			listener = &lists[0]
-			return true, nil
-		default:
-			return false, ErrMultipleResults
-		}
-	})
-	if err != nil {
-		return nil, err
-	}
-
-	if listener == nil {
-		return nil, ErrNotFound
-	}
-
-	return listener, nil
-}
-
 func (os *Client) getMembersByPoolID(id string) ([]pools.Member, error) {
 	var members []pools.Member
 	err := pools.ListMembers(os.Network, id, pools.ListMembersOpts{}).EachPage(func(page pagination.Page) (bool, error) {
@@ -653,16 +1024,16 @@ func (os *Client) getMembersByPoolID(id string) ([]pools.Member, error) {
 	return members, nil
 }
 
-func (os *Client) getFloatingIPByPortID(portID string) (*floatingips.FloatingIP, error) {
+func (os *Client) getFloatingIPByPortID(portID string) (*floatingIP, error) {
 	opts := floatingips.ListOpts{
 		PortID: portID,
 	}
 	pager := floatingips.List(os.Network, opts)
 
-	floatingIPList := make([]floatingips.FloatingIP, 0, 1)
+	floatingIPList := make([]floatingIP, 0, 1)
 
 	err := pager.EachPage(func(page pagination.Page) (bool, error) {
-		f, err := floatingips.ExtractFloatingIPs(page)
+		f, err := extractFloatingIPs(page)
 		if err != nil {
 			return false, err
 		}
@@ -699,6 +1070,79 @@ func memberExists(members []pools.Member, addr string, port int) bool {
 	return false
 }
 
+// ensureFloatingIP ensures the floating IP of lb is associated with the vip
+// port, and returns its address.
+func (os *Client) ensureFloatingIP(lb *LoadBalancer, portID string) (string, error) {
+	address := lb.ExternalIP
+	if address == "" {
+		address = lb.AllocatedFloatingIP
+	}
+
+	current, err := os.getFloatingIPByPortID(portID)
+	if err != nil && !isNotFound(err) {
+		return "", fmt.Errorf("error getting floating ip by port %q: %v", portID, err)
+	}
+	if current != nil {
+		// Only floating IPs allocated by stackube are kept as the allocated
+		// one, others are replaced by a new one.
+		allocated := current.Description == FloatingIPDescription
+		if lb.ExternalIP == "" {
+			if allocated {
+				return current.FloatingIP, nil
+			}
+			address = ""
+		} else if current.FloatingIP == address {
+			return current.FloatingIP, nil
+		}
+
+		// The floating IP is replaced by the requested or a new one.
+		if allocated {
+			glog.V(3).Infof("Releasing floating IP %s of load balancer %s", current.FloatingIP, lb.Name)
+			err = floatingips.Delete(os.Network, current.ID).ExtractErr()
+		} else {
+			glog.V(3).Infof("Disassociating floating IP %s of load balancer %s", current.FloatingIP, lb.Name)
+			_, err = floatingips.Update(os.Network, current.ID, floatingips.UpdateOpts{}).Extract()
+		}
+		if err != nil && !isNotFound(err) {
+			return "", fmt.Errorf("error releasing floating ip %q: %v", current.FloatingIP, err)
+		}
+	}
+
+	if address == "" {
+		// Allocate a new floating IP.
+		opts := floatingips.CreateOpts{
+			FloatingNetworkID: os.ExtNetID,
+			TenantID:          lb.TenantID,
+			PortID:            portID,
+		}
+		fip, err := floatingips.Create(os.Network, floatingIPCreateOpts{opts, FloatingIPDescription}).Extract()
+		if err != nil {
+			glog.Errorf("Allocate floatingip for load balancer %s failed: %v", lb.Name, err)
+			return "", err
+		}
+		glog.V(3).Infof("Allocated floating IP %s for load balancer %s", fip.FloatingIP, lb.Name)
+		return fip.FloatingIP, nil
+	}
+
+	return os.associateFloatingIP(lb.TenantID, portID, address)
+}
+
+// floatingIPCreateOpts are the create options of a floating IP with a
+// description.
+type floatingIPCreateOpts struct {
+	floatingips.CreateOpts
+	description string
+}
+
+func (opts floatingIPCreateOpts) ToFloatingIPCreateMap() (map[string]interface{}, error) {
+	body, err := opts.CreateOpts.ToFloatingIPCreateMap()
+	if err != nil {
+		return nil, err
+	}
+	body["floatingip"].(map[string]interface{})["description"] = opts.description
+	return body, nil
+}
+
 func (os *Client) associateFloatingIP(tenantID, portID, floatingIPAddress string) (string, error) {
 	var fip *floatingips.FloatingIP
 	opts := floatingips.ListOpts{FloatingIP: floatingIPAddress}
@@ -778,5 +1222,9 @@ func isNotFound(err error) bool {
 		return true
 	}
 
+	if _, ok := err.(gophercloud.ErrDefault404); ok {
+		return true
+	}
+
 	return false
 }
@@ -0,0 +1,438 @@
+/*
+Copyright (c) 2017 OpenStack Foundation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/lbaas_v2/listeners"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/lbaas_v2/monitors"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/lbaas_v2/pools"
+)
+
+// fakeLBaaS serves the load balancer lb-1 with the monitor, the listeners
+// and the pools given, and records the requests changing them. lb-1 is gone
+// once it's deleted.
+type fakeLBaaS struct {
+	monitor   map[string]interface{}
+	listener  map[string]interface{}
+	listeners []map[string]interface{}
+	pools     []map[string]interface{}
+	members   map[string][]map[string]interface{}
+	deleted   bool
+	requests  []string
+	bodies    []map[string]interface{}
+}
+
+func (f *fakeLBaaS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	lb := map[string]string{"id": "lb-1", "name": "lb", "provisioning_status": activeStatus}
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/v2.0/lbaas/loadbalancers/lb-1" && !f.deleted:
+		writeJSON(w, http.StatusOK, map[string]interface{}{"loadbalancer": lb})
+		return
+	case r.Method == "GET" && r.URL.Path == "/v2.0/lbaas/loadbalancers" && !f.deleted:
+		writeJSON(w, http.StatusOK, map[string]interface{}{"loadbalancers": []map[string]string{lb}})
+		return
+	case r.Method == "GET" && r.URL.Path == "/v2.0/lbaas/listeners" && f.listeners != nil:
+		writeJSON(w, http.StatusOK, map[string]interface{}{"listeners": f.listeners})
+		return
+	case r.Method == "GET" && r.URL.Path == "/v2.0/lbaas/pools" && f.pools != nil:
+		writeJSON(w, http.StatusOK, map[string]interface{}{"pools": f.pools})
+		return
+	case r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/members") && f.members != nil:
+		poolID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v2.0/lbaas/pools/"), "/members")
+		writeJSON(w, http.StatusOK, map[string]interface{}{"members": f.members[poolID]})
+		return
+	case r.Method == "GET" && r.URL.Path == "/v2.0/lbaas/healthmonitors/monitor-1" && f.monitor != nil:
+		writeJSON(w, http.StatusOK, map[string]interface{}{"healthmonitor": f.monitor})
+		return
+	case r.Method == "GET" && r.URL.Path == "/v2.0/lbaas/listeners/listener-1" && f.listener != nil:
+		writeJSON(w, http.StatusOK, map[string]interface{}{"listener": f.listener})
+		return
+	case r.Method == "GET":
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+	var body map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&body)
+	f.bodies = append(f.bodies, body)
+	switch r.Method {
+	case "POST":
+		writeJSON(w, http.StatusCreated, map[string]interface{}{"healthmonitor": map[string]string{"id": "monitor-2"}})
+	case "PUT":
+		writeJSON(w, http.StatusOK, body)
+	case "DELETE":
+		if r.URL.Path == "/v2.0/lbaas/loadbalancers/lb-1" {
+			f.deleted = true
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func newFakeLBaaSClient(f *fakeLBaaS) (*Client, func()) {
+	server := httptest.NewServer(f)
+	client := &Client{
+		Network: &gophercloud.ServiceClient{
+			ProviderClient: &gophercloud.ProviderClient{},
+			Endpoint:       server.URL + "/",
+			ResourceBase:   server.URL + "/v2.0/",
+		},
+	}
+	return client, server.Close
+}
+
+func TestEnsureMonitor(t *testing.T) {
+	defaultMonitor := map[string]interface{}{
+		"id":          "monitor-1",
+		"type":        monitors.TypeTCP,
+		"delay":       defaultMonitorDelay,
+		"timeout":     defaultMonotorTimeout,
+		"max_retries": defaultMonitorRetry,
+	}
+
+	testCases := []struct {
+		testName         string
+		monitor          map[string]interface{}
+		options          LoadBalancerOptions
+		expectedRequests []string
+	}{
+		{
+			testName:         "Create monitor",
+			expectedRequests: []string{"POST /v2.0/lbaas/healthmonitors"},
+		},
+		{
+			testName: "Monitor unchanged",
+			monitor:  defaultMonitor,
+		},
+		{
+			testName:         "Update monitor in place",
+			monitor:          defaultMonitor,
+			options:          LoadBalancerOptions{MonitorDelay: 5, MonitorMaxRetries: 5},
+			expectedRequests: []string{"PUT /v2.0/lbaas/healthmonitors/monitor-1"},
+		},
+		{
+			testName: "Recreate monitor of another type",
+			monitor:  defaultMonitor,
+			options:  LoadBalancerOptions{MonitorType: monitors.TypeHTTP},
+			expectedRequests: []string{
+				"DELETE /v2.0/lbaas/healthmonitors/monitor-1",
+				"POST /v2.0/lbaas/healthmonitors",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		f := &fakeLBaaS{monitor: tc.monitor}
+		client, closeServer := newFakeLBaaSClient(f)
+
+		pool := &pools.Pool{ID: "pool-1"}
+		if tc.monitor != nil {
+			pool.MonitorID = "monitor-1"
+		}
+		lb := &LoadBalancer{Name: "lb", Options: tc.options}
+		if err := client.ensureMonitor("lb-1", lb, pool, "lb_tcp_80", ProtocolTCP); err != nil {
+			t.Errorf("Case[%s]: unexpected error: %v", tc.testName, err)
+		}
+		if !reflect.DeepEqual(f.requests, tc.expectedRequests) {
+			t.Errorf("Case[%s]: expected requests %v, got %v", tc.testName, tc.expectedRequests, f.requests)
+		}
+		closeServer()
+	}
+}
+
+func TestUpdateListener(t *testing.T) {
+	timeouts := map[string]interface{}{
+		"id":                     "listener-1",
+		"timeout_client_data":    50000,
+		"timeout_member_connect": 5000,
+		"timeout_member_data":    50000,
+	}
+
+	testCases := []struct {
+		testName         string
+		connLimit        int
+		timeouts         listenerTimeouts
+		expectedRequests []string
+		expectedBodies   []map[string]interface{}
+	}{
+		{
+			testName:  "Listener unchanged",
+			connLimit: defaultConnectionLimit,
+		},
+		{
+			testName:         "Update connection limit",
+			connLimit:        100,
+			expectedRequests: []string{"PUT /v2.0/lbaas/listeners/listener-1"},
+			expectedBodies: []map[string]interface{}{
+				{"listener": map[string]interface{}{"connection_limit": float64(100)}},
+			},
+		},
+		{
+			testName:  "Timeouts unchanged",
+			connLimit: defaultConnectionLimit,
+			timeouts:  listenerTimeouts{ClientData: 50000},
+		},
+		{
+			testName:         "Update timeouts",
+			connLimit:        defaultConnectionLimit,
+			timeouts:         listenerTimeouts{ClientData: 50000, MemberConnect: 3000},
+			expectedRequests: []string{"PUT /v2.0/lbaas/listeners/listener-1"},
+			expectedBodies: []map[string]interface{}{
+				{"listener": map[string]interface{}{
+					"timeout_client_data":    float64(50000),
+					"timeout_member_connect": float64(3000),
+				}},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		f := &fakeLBaaS{listener: timeouts}
+		client, closeServer := newFakeLBaaSClient(f)
+
+		listener := &listeners.Listener{ID: "listener-1", ConnLimit: defaultConnectionLimit}
+		if err := client.updateListener("lb-1", listener, tc.connLimit, tc.timeouts); err != nil {
+			t.Errorf("Case[%s]: unexpected error: %v", tc.testName, err)
+		}
+		if !reflect.DeepEqual(f.requests, tc.expectedRequests) {
+			t.Errorf("Case[%s]: expected requests %v, got %v", tc.testName, tc.expectedRequests, f.requests)
+		}
+		if !reflect.DeepEqual(f.bodies, tc.expectedBodies) {
+			t.Errorf("Case[%s]: expected bodies %v, got %v", tc.testName, tc.expectedBodies, f.bodies)
+		}
+		closeServer()
+	}
+}
+
+func TestAllocatedFloatingIPDescription(t *testing.T) {
+	var created []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/v2.0/floatingips":
+			list := []map[string]interface{}{}
+			if r.URL.Query().Get("port_id") == "" {
+				list = append(list, created...)
+			}
+			writeJSON(w, http.StatusOK, map[string]interface{}{"floatingips": list})
+		case r.Method == "POST" && r.URL.Path == "/v2.0/floatingips":
+			var body map[string]map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			fip := body["floatingip"]
+			fip["id"] = "fip-1"
+			fip["floating_ip_address"] = "172.24.4.100"
+			created = append(created, fip)
+			writeJSON(w, http.StatusCreated, map[string]interface{}{"floatingip": fip})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	client := &Client{
+		Network: &gophercloud.ServiceClient{
+			ProviderClient: &gophercloud.ProviderClient{},
+			Endpoint:       server.URL + "/",
+			ResourceBase:   server.URL + "/v2.0/",
+		},
+		ExtNetID: "ext-net",
+	}
+
+	address, err := client.ensureFloatingIP(&LoadBalancer{Name: "lb", TenantID: "tenant-id"}, "vip-port")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if address != "172.24.4.100" {
+		t.Errorf("Expected floating IP 172.24.4.100 allocated, got %s", address)
+	}
+
+	resources, err := client.ListResources(ResourceFloatingIP, "tenant-id")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(resources) != 1 || resources[0].Description != FloatingIPDescription {
+		t.Errorf("Expected floating IP listed with description %q, got %v", FloatingIPDescription, resources)
+	}
+}
+
+func TestEnsureFloatingIPNotAllocated(t *testing.T) {
+	testCases := []struct {
+		testName        string
+		lb              *LoadBalancer
+		current         map[string]interface{}
+		expectedAddress string
+		expectedCalls   []string
+	}{
+		{
+			testName: "Removed externalIP",
+			lb:       &LoadBalancer{Name: "lb", TenantID: "tenant-id", AllocatedFloatingIP: "172.24.4.10"},
+			current: map[string]interface{}{
+				"id":                  "fip-user",
+				"floating_ip_address": "172.24.4.10",
+				"port_id":             "vip-port",
+			},
+			expectedAddress: "172.24.4.100",
+			expectedCalls:   []string{"PUT /v2.0/floatingips/fip-user", "POST /v2.0/floatingips"},
+		},
+		{
+			testName: "Allocated floating IP",
+			lb:       &LoadBalancer{Name: "lb", TenantID: "tenant-id", AllocatedFloatingIP: "172.24.4.11"},
+			current: map[string]interface{}{
+				"id":                  "fip-allocated",
+				"floating_ip_address": "172.24.4.11",
+				"port_id":             "vip-port",
+				"description":         FloatingIPDescription,
+			},
+			expectedAddress: "172.24.4.11",
+		},
+		{
+			testName: "Requested externalIP",
+			lb:       &LoadBalancer{Name: "lb", TenantID: "tenant-id", ExternalIP: "172.24.4.10"},
+			current: map[string]interface{}{
+				"id":                  "fip-user",
+				"floating_ip_address": "172.24.4.10",
+				"port_id":             "vip-port",
+			},
+			expectedAddress: "172.24.4.10",
+		},
+	}
+
+	for _, tc := range testCases {
+		var calls []string
+		current := tc.current
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.Method == "GET" && r.URL.Path == "/v2.0/floatingips":
+				list := []map[string]interface{}{}
+				if current != nil && r.URL.Query().Get("port_id") == "vip-port" {
+					list = append(list, current)
+				}
+				writeJSON(w, http.StatusOK, map[string]interface{}{"floatingips": list})
+			case r.Method == "PUT" && r.URL.Path == "/v2.0/floatingips/"+current["id"].(string):
+				calls = append(calls, r.Method+" "+r.URL.Path)
+				current["port_id"] = nil
+				writeJSON(w, http.StatusOK, map[string]interface{}{"floatingip": current})
+				current = nil
+			case r.Method == "POST" && r.URL.Path == "/v2.0/floatingips":
+				calls = append(calls, r.Method+" "+r.URL.Path)
+				var body map[string]map[string]interface{}
+				json.NewDecoder(r.Body).Decode(&body)
+				fip := body["floatingip"]
+				fip["id"] = "fip-new"
+				fip["floating_ip_address"] = "172.24.4.100"
+				writeJSON(w, http.StatusCreated, map[string]interface{}{"floatingip": fip})
+			default:
+				calls = append(calls, r.Method+" "+r.URL.Path)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		client := &Client{
+			Network: &gophercloud.ServiceClient{
+				ProviderClient: &gophercloud.ProviderClient{},
+				Endpoint:       server.URL + "/",
+				ResourceBase:   server.URL + "/v2.0/",
+			},
+			ExtNetID: "ext-net",
+		}
+
+		address, err := client.ensureFloatingIP(tc.lb, "vip-port")
+		if err != nil {
+			t.Errorf("Case[%s]: unexpected error: %v", tc.testName, err)
+		}
+		if address != tc.expectedAddress {
+			t.Errorf("Case[%s]: expected floating IP %s, got %s", tc.testName, tc.expectedAddress, address)
+		}
+		if !reflect.DeepEqual(calls, tc.expectedCalls) {
+			t.Errorf("Case[%s]: expected calls %v, got %v", tc.testName, tc.expectedCalls, calls)
+		}
+		server.Close()
+	}
+}
+
+func TestDeleteOrphanedLoadBalancer(t *testing.T) {
+	// The creation of the load balancer failed before the pool of
+	// listener-1 was created.
+	lbs := []map[string]string{{"id": "lb-1"}}
+	f := &fakeLBaaS{
+		listeners: []map[string]interface{}{
+			{"id": "listener-1", "loadbalancers": lbs},
+			{"id": "listener-2", "loadbalancers": lbs},
+		},
+		pools: []map[string]interface{}{
+			{"id": "pool-2", "listeners": []map[string]string{{"id": "listener-2"}}},
+		},
+	}
+	client, closeServer := newFakeLBaaSClient(f)
+	defer closeServer()
+
+	err := client.DeleteResource(Resource{Kind: ResourceLoadBalancer, ID: "lb-1", Name: "lb"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectedRequests := []string{
+		"DELETE /v2.0/lbaas/pools/pool-2",
+		"DELETE /v2.0/lbaas/listeners/listener-1",
+		"DELETE /v2.0/lbaas/listeners/listener-2",
+		"DELETE /v2.0/lbaas/loadbalancers/lb-1",
+	}
+	if !reflect.DeepEqual(f.requests, expectedRequests) {
+		t.Errorf("Expected requests %v, got %v", expectedRequests, f.requests)
+	}
+}
+
+func TestEnsureLoadBalancerDeletedMembers(t *testing.T) {
+	lbs := []map[string]string{{"id": "lb-1"}}
+	f := &fakeLBaaS{
+		listeners: []map[string]interface{}{
+			{"id": "listener-1", "loadbalancers": lbs},
+			{"id": "listener-2", "loadbalancers": lbs},
+		},
+		pools: []map[string]interface{}{
+			{"id": "pool-1", "listeners": []map[string]string{{"id": "listener-1"}}},
+			{"id": "pool-2", "listeners": []map[string]string{{"id": "listener-2"}}},
+		},
+		members: map[string][]map[string]interface{}{
+			"pool-1": {{"id": "member-1"}},
+			"pool-2": {{"id": "member-2"}},
+		},
+	}
+	client, closeServer := newFakeLBaaSClient(f)
+	defer closeServer()
+
+	if err := client.EnsureLoadBalancerDeleted("lb", true); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Each pool only deletes its own members.
+	expectedRequests := []string{
+		"DELETE /v2.0/lbaas/pools/pool-1/members/member-1",
+		"DELETE /v2.0/lbaas/pools/pool-1",
+		"DELETE /v2.0/lbaas/pools/pool-2/members/member-2",
+		"DELETE /v2.0/lbaas/pools/pool-2",
+		"DELETE /v2.0/lbaas/listeners/listener-1",
+		"DELETE /v2.0/lbaas/listeners/listener-2",
+		"DELETE /v2.0/lbaas/loadbalancers/lb-1",
+	}
+	if !reflect.DeepEqual(f.requests, expectedRequests) {
+		t.Errorf("Expected requests %v, got %v", expectedRequests, f.requests)
+	}
+}
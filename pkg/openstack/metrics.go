@@ -0,0 +1,246 @@
+/*
+Copyright (c) 2017 OpenStack Foundation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"time"
+
+	crv1 "git.openstack.org/openstack/stackube/pkg/apis/v1"
+	crdClient "git.openstack.org/openstack/stackube/pkg/kubecrd"
+	"git.openstack.org/openstack/stackube/pkg/metrics"
+	drivertypes "git.openstack.org/openstack/stackube/pkg/openstack/types"
+
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/portsbinding"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+)
+
+var (
+	requestDuration = metrics.NewHistogramVec("stackube_openstack_request_duration_seconds",
+		"Duration of the OpenStack operations of the openstack client.", metrics.DefBuckets, "operation")
+	requestErrors = metrics.NewCounterVec("stackube_openstack_request_errors_total",
+		"Number of failed OpenStack operations of the openstack client.", "operation")
+	loadBalancerProvisioningDuration = metrics.NewHistogramVec("stackube_loadbalancer_provisioning_duration_seconds",
+		"How long load balancers take to leave the pending provisioning status, by the final status.",
+		[]float64{1, 2, 5, 10, 20, 30, 60, 120, 300}, "status")
+)
+
+func init() {
+	metrics.MustRegister(requestDuration, requestErrors, loadBalancerProvisioningDuration)
+}
+
+// observeOperation records an operation which started at start and
+// returned *err.
+func observeOperation(operation string, start time.Time, err *error) {
+	requestDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if *err != nil {
+		requestErrors.WithLabelValues(operation).Inc()
+	}
+}
+
+// instrumentedClient records the latency and errors of the operations of
+// client.
+type instrumentedClient struct {
+	client Interface
+}
+
+// newInstrumentedClient returns an Interface which records the metrics of
+// the operations of client.
+func newInstrumentedClient(client Interface) Interface {
+	return &instrumentedClient{client: client}
+}
+
+func (c *instrumentedClient) CreateTenant(tenantName string) (result string, err error) {
+	defer observeOperation("CreateTenant", time.Now(), &err)
+	return c.client.CreateTenant(tenantName)
+}
+
+func (c *instrumentedClient) DeleteTenant(tenantName string) (err error) {
+	defer observeOperation("DeleteTenant", time.Now(), &err)
+	return c.client.DeleteTenant(tenantName)
+}
+
+func (c *instrumentedClient) GetTenantIDFromName(tenantName string) (result string, err error) {
+	defer observeOperation("GetTenantIDFromName", time.Now(), &err)
+	return c.client.GetTenantIDFromName(tenantName)
+}
+
+func (c *instrumentedClient) GetTenantIDFromNamespace(namespace string) (result string, err error) {
+	defer observeOperation("GetTenantIDFromNamespace", time.Now(), &err)
+	return c.client.GetTenantIDFromNamespace(namespace)
+}
+
+func (c *instrumentedClient) ListTenants(domainID, tag string) (result []TenantInfo, err error) {
+	defer observeOperation("ListTenants", time.Now(), &err)
+	return c.client.ListTenants(domainID, tag)
+}
+
+func (c *instrumentedClient) CheckTenantByID(tenantID string) (result bool, err error) {
+	defer observeOperation("CheckTenantByID", time.Now(), &err)
+	return c.client.CheckTenantByID(tenantID)
+}
+
+func (c *instrumentedClient) CreateUser(username, password, tenantID string, role crv1.TenantRole) (result string, adopted bool, err error) {
+	defer observeOperation("CreateUser", time.Now(), &err)
+	return c.client.CreateUser(username, password, tenantID, role)
+}
+
+func (c *instrumentedClient) UpdateUser(userID, username, password string) (err error) {
+	defer observeOperation("UpdateUser", time.Now(), &err)
+	return c.client.UpdateUser(userID, username, password)
+}
+
+func (c *instrumentedClient) SetUserRole(userID, tenantID string, role crv1.TenantRole) (err error) {
+	defer observeOperation("SetUserRole", time.Now(), &err)
+	return c.client.SetUserRole(userID, tenantID, role)
+}
+
+func (c *instrumentedClient) RevokeUserRoles(userID, tenantID string) (err error) {
+	defer observeOperation("RevokeUserRoles", time.Now(), &err)
+	return c.client.RevokeUserRoles(userID, tenantID)
+}
+
+func (c *instrumentedClient) MoveUserToTenant(userID, fromTenantID, toTenantID string, role crv1.TenantRole) (err error) {
+	defer observeOperation("MoveUserToTenant", time.Now(), &err)
+	return c.client.MoveUserToTenant(userID, fromTenantID, toTenantID, role)
+}
+
+func (c *instrumentedClient) DeleteUser(userID string) (err error) {
+	defer observeOperation("DeleteUser", time.Now(), &err)
+	return c.client.DeleteUser(userID)
+}
+
+func (c *instrumentedClient) DeleteAllUsersOnTenant(tenantName string) (err error) {
+	defer observeOperation("DeleteAllUsersOnTenant", time.Now(), &err)
+	return c.client.DeleteAllUsersOnTenant(tenantName)
+}
+
+func (c *instrumentedClient) AuthenticateToken(token string) (result *UserInfo, err error) {
+	defer observeOperation("AuthenticateToken", time.Now(), &err)
+	return c.client.AuthenticateToken(token)
+}
+
+func (c *instrumentedClient) ListUserRoles(userID, tenantID string) (result []string, err error) {
+	defer observeOperation("ListUserRoles", time.Now(), &err)
+	return c.client.ListUserRoles(userID, tenantID)
+}
+
+func (c *instrumentedClient) UpdateQuota(tenantID string, quota *crv1.TenantQuota) (result *crv1.TenantQuota, err error) {
+	defer observeOperation("UpdateQuota", time.Now(), &err)
+	return c.client.UpdateQuota(tenantID, quota)
+}
+
+func (c *instrumentedClient) CreateNetwork(network *drivertypes.Network) (err error) {
+	defer observeOperation("CreateNetwork", time.Now(), &err)
+	return c.client.CreateNetwork(network)
+}
+
+func (c *instrumentedClient) GetNetworkByID(networkID string) (result *drivertypes.Network, err error) {
+	defer observeOperation("GetNetworkByID", time.Now(), &err)
+	return c.client.GetNetworkByID(networkID)
+}
+
+func (c *instrumentedClient) GetNetworkByName(networkName string) (result *drivertypes.Network, err error) {
+	defer observeOperation("GetNetworkByName", time.Now(), &err)
+	return c.client.GetNetworkByName(networkName)
+}
+
+func (c *instrumentedClient) GetNetworkDetails(network *drivertypes.Network) (err error) {
+	defer observeOperation("GetNetworkDetails", time.Now(), &err)
+	return c.client.GetNetworkDetails(network)
+}
+
+func (c *instrumentedClient) UpdateNetwork(network *drivertypes.Network) (err error) {
+	defer observeOperation("UpdateNetwork", time.Now(), &err)
+	return c.client.UpdateNetwork(network)
+}
+
+func (c *instrumentedClient) DeleteNetwork(networkName string) (err error) {
+	defer observeOperation("DeleteNetwork", time.Now(), &err)
+	return c.client.DeleteNetwork(networkName)
+}
+
+func (c *instrumentedClient) GetProviderSubnet(osSubnetID string) (result *drivertypes.Subnet, err error) {
+	defer observeOperation("GetProviderSubnet", time.Now(), &err)
+	return c.client.GetProviderSubnet(osSubnetID)
+}
+
+func (c *instrumentedClient) CreatePort(networkID, tenantID, portName string) (result *portsbinding.Port, err error) {
+	defer observeOperation("CreatePort", time.Now(), &err)
+	return c.client.CreatePort(networkID, tenantID, portName)
+}
+
+func (c *instrumentedClient) GetPort(name string) (result *ports.Port, err error) {
+	defer observeOperation("GetPort", time.Now(), &err)
+	return c.client.GetPort(name)
+}
+
+func (c *instrumentedClient) ListPorts(networkID, deviceOwner string) (result []ports.Port, err error) {
+	defer observeOperation("ListPorts", time.Now(), &err)
+	return c.client.ListPorts(networkID, deviceOwner)
+}
+
+func (c *instrumentedClient) DeletePortByName(portName string) (err error) {
+	defer observeOperation("DeletePortByName", time.Now(), &err)
+	return c.client.DeletePortByName(portName)
+}
+
+func (c *instrumentedClient) DeletePortByID(portID string) (err error) {
+	defer observeOperation("DeletePortByID", time.Now(), &err)
+	return c.client.DeletePortByID(portID)
+}
+
+func (c *instrumentedClient) UpdatePortsBinding(portID, deviceOwner string) (err error) {
+	defer observeOperation("UpdatePortsBinding", time.Now(), &err)
+	return c.client.UpdatePortsBinding(portID, deviceOwner)
+}
+
+func (c *instrumentedClient) LoadBalancerExist(name string) (result bool, err error) {
+	defer observeOperation("LoadBalancerExist", time.Now(), &err)
+	return c.client.LoadBalancerExist(name)
+}
+
+func (c *instrumentedClient) EnsureLoadBalancer(lb *LoadBalancer) (result *LoadBalancerStatus, err error) {
+	defer observeOperation("EnsureLoadBalancer", time.Now(), &err)
+	return c.client.EnsureLoadBalancer(lb)
+}
+
+func (c *instrumentedClient) EnsureLoadBalancerDeleted(name string, releaseFloatingIP bool) (err error) {
+	defer observeOperation("EnsureLoadBalancerDeleted", time.Now(), &err)
+	return c.client.EnsureLoadBalancerDeleted(name, releaseFloatingIP)
+}
+
+func (c *instrumentedClient) ListResources(kind, tenantID string) (result []Resource, err error) {
+	defer observeOperation("ListResources", time.Now(), &err)
+	return c.client.ListResources(kind, tenantID)
+}
+
+func (c *instrumentedClient) DeleteResource(resource Resource) (err error) {
+	defer observeOperation("DeleteResource", time.Now(), &err)
+	return c.client.DeleteResource(resource)
+}
+
+func (c *instrumentedClient) GetCRDClient() crdClient.Interface {
+	return c.client.GetCRDClient()
+}
+
+func (c *instrumentedClient) GetPluginName() string {
+	return c.client.GetPluginName()
+}
+
+func (c *instrumentedClient) GetIntegrationBridge() string {
+	return c.client.GetIntegrationBridge()
+}
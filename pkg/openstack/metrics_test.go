@@ -0,0 +1,62 @@
+/*
+Copyright (c) 2017 OpenStack Foundation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	crdClient "git.openstack.org/openstack/stackube/pkg/kubecrd"
+	"git.openstack.org/openstack/stackube/pkg/metrics"
+)
+
+func TestInstrumentedClient(t *testing.T) {
+	kubeCRDClient, err := crdClient.NewFake()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	fakeClient := NewFake(kubeCRDClient)
+	client := newInstrumentedClient(fakeClient)
+
+	if _, err := client.CreateTenant("test"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	fakeClient.InjectError("CreateTenant", fmt.Errorf("keystone unavailable"))
+	if _, err := client.CreateTenant("test"); err == nil {
+		t.Fatalf("Expected error for injected failure")
+	}
+	if tenants, err := client.ListTenants("", ""); err != nil || len(tenants) != 1 {
+		t.Errorf("Expected tenant test, got %v: %v", tenants, err)
+	}
+
+	buf := &bytes.Buffer{}
+	metrics.DefaultRegistry.WriteText(buf)
+	for _, expected := range []string{
+		`stackube_openstack_request_duration_seconds_count{operation="CreateTenant"} 2`,
+		`stackube_openstack_request_errors_total{operation="CreateTenant"} 1`,
+		`stackube_openstack_request_duration_seconds_count{operation="ListTenants"} 1`,
+	} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("Expected metric %s, got:\n%s", expected, buf.String())
+		}
+	}
+	if strings.Contains(buf.String(), `stackube_openstack_request_errors_total{operation="ListTenants"}`) {
+		t.Errorf("Expected no errors of ListTenants")
+	}
+}
@@ -20,8 +20,10 @@ import (
 	"crypto/sha1"
 	"fmt"
 	"io"
+	"strings"
 	"sync"
 
+	crv1 "git.openstack.org/openstack/stackube/pkg/apis/v1"
 	crdClient "git.openstack.org/openstack/stackube/pkg/kubecrd"
 	drivertypes "git.openstack.org/openstack/stackube/pkg/openstack/types"
 	"git.openstack.org/openstack/stackube/pkg/util"
@@ -31,8 +33,13 @@ import (
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/portsbinding"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/subnets"
+	apiv1 "k8s.io/api/core/v1"
 )
 
+// FakeAllocatedFloatingIP is the floating IP allocated by FakeOSClient for
+// the load balancers without a requested one.
+const FakeAllocatedFloatingIP = "172.24.4.100"
+
 // CalledDetail is the struct contains called function name and arguments.
 type CalledDetail struct {
 	// Name of the function called.
@@ -48,12 +55,21 @@ type FakeOSClient struct {
 	called            []CalledDetail
 	errors            map[string]error
 	Tenants           map[string]*tenants.Tenant
+	TenantTags        map[string][]string
 	Users             map[string]*users.User
+	RoleUsers         map[string]*users.User
+	Passwords         map[string]string
 	Networks          map[string]*drivertypes.Network
 	Subnets           map[string]*subnets.Subnet
 	Routers           map[string]*routers.Router
 	Ports             map[string][]ports.Port
 	LoadBalancers     map[string]*LoadBalancer
+	Resources         map[string]*Resource
+	Tokens            map[string]*UserInfo
+	Namespaces        map[string]*apiv1.Namespace
+	UserRoles         map[string][]string
+	Quotas            map[string]*crv1.TenantQuota
+	QuotaUsed         map[string]*crv1.TenantQuota
 	CRDClient         crdClient.Interface
 	PluginName        string
 	IntegrationBridge string
@@ -66,12 +82,21 @@ func NewFake(crdClient crdClient.Interface) *FakeOSClient {
 	return &FakeOSClient{
 		errors:            make(map[string]error),
 		Tenants:           make(map[string]*tenants.Tenant),
+		TenantTags:        make(map[string][]string),
 		Users:             make(map[string]*users.User),
+		RoleUsers:         make(map[string]*users.User),
+		Passwords:         make(map[string]string),
 		Networks:          make(map[string]*drivertypes.Network),
 		Subnets:           make(map[string]*subnets.Subnet),
 		Routers:           make(map[string]*routers.Router),
 		Ports:             make(map[string][]ports.Port),
 		LoadBalancers:     make(map[string]*LoadBalancer),
+		Resources:         make(map[string]*Resource),
+		Tokens:            make(map[string]*UserInfo),
+		Namespaces:        make(map[string]*apiv1.Namespace),
+		UserRoles:         make(map[string][]string),
+		Quotas:            make(map[string]*crv1.TenantQuota),
+		QuotaUsed:         make(map[string]*crv1.TenantQuota),
 		CRDClient:         crdClient,
 		PluginName:        "ovs",
 		IntegrationBridge: "bi-int",
@@ -192,6 +217,30 @@ func (f *FakeOSClient) SetLoadbalancer(lb *LoadBalancer) {
 	f.LoadBalancers[lb.Name] = lb
 }
 
+// SetToken injects fake keystone token.
+func (f *FakeOSClient) SetToken(token string, user *UserInfo) {
+	f.Lock()
+	defer f.Unlock()
+
+	f.Tokens[token] = user
+}
+
+// SetNamespace injects fake namespace.
+func (f *FakeOSClient) SetNamespace(namespace *apiv1.Namespace) {
+	f.Lock()
+	defer f.Unlock()
+
+	f.Namespaces[namespace.Name] = namespace
+}
+
+// SetUserRoles injects fake roles of the user on the tenant.
+func (f *FakeOSClient) SetUserRoles(userID, tenantID string, roles ...string) {
+	f.Lock()
+	defer f.Unlock()
+
+	f.UserRoles[tenantID+"/"+userID] = roles
+}
+
 func tenantIDHash(tenantName string) string {
 	return idHash(tenantName)
 }
@@ -268,6 +317,26 @@ func (f *FakeOSClient) GetTenantIDFromName(tenantName string) (string, error) {
 		return "", err
 	}
 
+	return f.getTenantIDFromName(tenantName)
+}
+
+// GetTenantIDFromNamespace is a test implementation of Interface.GetTenantIDFromNamespace.
+func (f *FakeOSClient) GetTenantIDFromNamespace(namespace string) (string, error) {
+	f.Lock()
+	defer f.Unlock()
+	f.appendCalled("GetTenantIDFromNamespace", namespace)
+	if err := f.getError("GetTenantIDFromNamespace"); err != nil {
+		return "", err
+	}
+
+	tenantName := namespace
+	if ns, ok := f.Namespaces[namespace]; ok {
+		tenantName = util.TenantOfNamespace(ns)
+	}
+	return f.getTenantIDFromName(tenantName)
+}
+
+func (f *FakeOSClient) getTenantIDFromName(tenantName string) (string, error) {
 	if util.IsSystemNamespace(tenantName) {
 		tenantName = util.SystemTenant
 	}
@@ -289,6 +358,35 @@ func (f *FakeOSClient) GetTenantIDFromName(tenantName string) (string, error) {
 	return t.ID, nil
 }
 
+// ListTenants is a test implementation of Interface.ListTenants. Tenants are
+// filtered by their tags in TenantTags.
+func (f *FakeOSClient) ListTenants(domainID, tag string) ([]TenantInfo, error) {
+	f.Lock()
+	defer f.Unlock()
+	f.appendCalled("ListTenants", domainID, tag)
+	if err := f.getError("ListTenants"); err != nil {
+		return nil, err
+	}
+
+	var list []TenantInfo
+	for _, tenant := range f.Tenants {
+		if tag != "" && !containsString(f.TenantTags[tenant.Name], tag) {
+			continue
+		}
+		list = append(list, TenantInfo{ID: tenant.ID, Name: tenant.Name})
+	}
+	return list, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
 // CheckTenantByID is a test implementation of Interface.CheckTenantByID.
 func (f *FakeOSClient) CheckTenantByID(tenantID string) (bool, error) {
 	f.Lock()
@@ -306,13 +404,21 @@ func (f *FakeOSClient) CheckTenantByID(tenantID string) (bool, error) {
 	return false, nil
 }
 
-// CreateUser is a test implementation of Interface.CreateUser.
-func (f *FakeOSClient) CreateUser(username, password, tenantID string) error {
+// CreateUser is a test implementation of Interface.CreateUser. Users
+// created with the default role are kept in Users by tenantID, users created
+// with an explicit role are kept in RoleUsers by user ID. Existing users with
+// the same name are adopted.
+func (f *FakeOSClient) CreateUser(username, password, tenantID string, role crv1.TenantRole) (string, bool, error) {
 	f.Lock()
 	defer f.Unlock()
-	f.appendCalled("CreateUser", username, password, tenantID)
+	f.appendCalled("CreateUser", username, password, tenantID, role)
 	if err := f.getError("CreateUser"); err != nil {
-		return err
+		return "", false, err
+	}
+
+	if user := f.findUser(userIDHash(username, tenantID)); user != nil {
+		f.UserRoles[tenantID+"/"+user.ID] = []string{string(role)}
+		return user.ID, true, nil
 	}
 
 	user := &users.User{
@@ -320,7 +426,115 @@ func (f *FakeOSClient) CreateUser(username, password, tenantID string) error {
 		TenantID: tenantID,
 		ID:       userIDHash(username, tenantID),
 	}
-	f.Users[tenantID] = user
+	if role == "" {
+		f.Users[tenantID] = user
+	} else {
+		f.RoleUsers[user.ID] = user
+	}
+	f.Passwords[user.ID] = password
+	f.UserRoles[tenantID+"/"+user.ID] = []string{string(role)}
+	return user.ID, false, nil
+}
+
+func (f *FakeOSClient) findUser(userID string) *users.User {
+	for _, user := range f.Users {
+		if user.ID == userID {
+			return user
+		}
+	}
+	return f.RoleUsers[userID]
+}
+
+// UpdateUser is a test implementation of Interface.UpdateUser.
+func (f *FakeOSClient) UpdateUser(userID, username, password string) error {
+	f.Lock()
+	defer f.Unlock()
+	f.appendCalled("UpdateUser", userID, username, password)
+	if err := f.getError("UpdateUser"); err != nil {
+		return err
+	}
+
+	user := f.findUser(userID)
+	if user == nil {
+		return ErrNotFound
+	}
+	if username != "" {
+		user.Name = username
+	}
+	if password != "" {
+		f.Passwords[userID] = password
+	}
+	return nil
+}
+
+// SetUserRole is a test implementation of Interface.SetUserRole.
+func (f *FakeOSClient) SetUserRole(userID, tenantID string, role crv1.TenantRole) error {
+	f.Lock()
+	defer f.Unlock()
+	f.appendCalled("SetUserRole", userID, tenantID, role)
+	if err := f.getError("SetUserRole"); err != nil {
+		return err
+	}
+
+	if f.findUser(userID) == nil {
+		return ErrNotFound
+	}
+	f.UserRoles[tenantID+"/"+userID] = []string{string(role)}
+	return nil
+}
+
+// RevokeUserRoles is a test implementation of Interface.RevokeUserRoles.
+func (f *FakeOSClient) RevokeUserRoles(userID, tenantID string) error {
+	f.Lock()
+	defer f.Unlock()
+	f.appendCalled("RevokeUserRoles", userID, tenantID)
+	if err := f.getError("RevokeUserRoles"); err != nil {
+		return err
+	}
+
+	delete(f.UserRoles, tenantID+"/"+userID)
+	return nil
+}
+
+// MoveUserToTenant is a test implementation of Interface.MoveUserToTenant.
+func (f *FakeOSClient) MoveUserToTenant(userID, fromTenantID, toTenantID string, role crv1.TenantRole) error {
+	f.Lock()
+	defer f.Unlock()
+	f.appendCalled("MoveUserToTenant", userID, fromTenantID, toTenantID, role)
+	if err := f.getError("MoveUserToTenant"); err != nil {
+		return err
+	}
+
+	user := f.findUser(userID)
+	if user == nil {
+		return ErrNotFound
+	}
+	if f.Users[user.TenantID] == user {
+		delete(f.Users, user.TenantID)
+		f.Users[toTenantID] = user
+	}
+	delete(f.UserRoles, fromTenantID+"/"+userID)
+	f.UserRoles[toTenantID+"/"+userID] = []string{string(role)}
+	user.TenantID = toTenantID
+	return nil
+}
+
+// DeleteUser is a test implementation of Interface.DeleteUser.
+func (f *FakeOSClient) DeleteUser(userID string) error {
+	f.Lock()
+	defer f.Unlock()
+	f.appendCalled("DeleteUser", userID)
+	if err := f.getError("DeleteUser"); err != nil {
+		return err
+	}
+
+	for tenantID, user := range f.Users {
+		if user.ID == userID {
+			delete(f.Users, tenantID)
+		}
+	}
+	delete(f.RoleUsers, userID)
+	delete(f.Passwords, userID)
 	return nil
 }
 
@@ -336,9 +550,73 @@ func (f *FakeOSClient) DeleteAllUsersOnTenant(tenantName string) error {
 	tenant := f.Tenants[tenantName]
 
 	delete(f.Users, tenant.ID)
+	for userID, user := range f.RoleUsers {
+		if user.TenantID == tenant.ID {
+			delete(f.RoleUsers, userID)
+		}
+	}
 	return nil
 }
 
+// AuthenticateToken is a test implementation of Interface.AuthenticateToken.
+func (f *FakeOSClient) AuthenticateToken(token string) (*UserInfo, error) {
+	f.Lock()
+	defer f.Unlock()
+	f.appendCalled("AuthenticateToken", token)
+	if err := f.getError("AuthenticateToken"); err != nil {
+		return nil, err
+	}
+
+	user, ok := f.Tokens[token]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return user, nil
+}
+
+// ListUserRoles is a test implementation of Interface.ListUserRoles.
+func (f *FakeOSClient) ListUserRoles(userID, tenantID string) ([]string, error) {
+	f.Lock()
+	defer f.Unlock()
+	f.appendCalled("ListUserRoles", userID, tenantID)
+	if err := f.getError("ListUserRoles"); err != nil {
+		return nil, err
+	}
+
+	return f.UserRoles[tenantID+"/"+userID], nil
+}
+
+// UpdateQuota is a test implementation of Interface.UpdateQuota.
+func (f *FakeOSClient) UpdateQuota(tenantID string, quota *crv1.TenantQuota) (*crv1.TenantQuota, error) {
+	f.Lock()
+	defer f.Unlock()
+	f.appendCalled("UpdateQuota", tenantID, quota)
+	if err := f.getError("UpdateQuota"); err != nil {
+		return nil, err
+	}
+
+	// Limits which are not set are left unchanged.
+	limits, ok := f.Quotas[tenantID]
+	if !ok {
+		limits = &crv1.TenantQuota{}
+		f.Quotas[tenantID] = limits
+	}
+	if quota.FloatingIPs != nil {
+		limits.FloatingIPs = quota.FloatingIPs
+	}
+	if quota.Ports != nil {
+		limits.Ports = quota.Ports
+	}
+	if quota.LoadBalancers != nil {
+		limits.LoadBalancers = quota.LoadBalancers
+	}
+	if used, ok := f.QuotaUsed[tenantID]; ok {
+		return used.DeepCopy(), nil
+	}
+	return &crv1.TenantQuota{}, nil
+}
+
 func (f *FakeOSClient) createNetwork(networkName, tenantID string) error {
 	f.Lock()
 	defer f.Unlock()
@@ -468,6 +746,57 @@ func (f *FakeOSClient) CreateNetwork(network *drivertypes.Network) error {
 		f.deleteNetwork(network.Name)
 		return err
 	}
+
+	f.Lock()
+	defer f.Unlock()
+	for _, sub := range network.Subnets {
+		sub.Uid = subnetIDHash(sub.Name)
+	}
+	f.Networks[network.Name].Subnets = network.Subnets
+	f.Networks[network.Name].AdminStateUp = network.AdminStateUp
+	f.Networks[network.Name].RouterID = f.Routers[network.Name].ID
+	return nil
+}
+
+// UpdateNetwork is a test implementation of Interface.UpdateNetwork.
+func (f *FakeOSClient) UpdateNetwork(network *drivertypes.Network) error {
+	f.Lock()
+	defer f.Unlock()
+	f.appendCalled("UpdateNetwork", network)
+	if err := f.getError("UpdateNetwork"); err != nil {
+		return err
+	}
+
+	existing, ok := f.Networks[network.Name]
+	if !ok {
+		return ErrNotFound
+	}
+
+	wanted := make(map[string]bool)
+	for _, sub := range network.Subnets {
+		wanted[sub.Cidr] = true
+	}
+	for _, sub := range existing.Subnets {
+		if wanted[sub.Cidr] {
+			continue
+		}
+		// Fake ports are not bound to subnets, so any port counts.
+		count := 0
+		for _, port := range f.Ports[existing.Uid] {
+			if !strings.HasPrefix(port.DeviceOwner, "network:") {
+				count++
+			}
+		}
+		if count > 0 {
+			return &SubnetInUseError{CIDR: sub.Cidr, Ports: count}
+		}
+	}
+
+	for _, sub := range network.Subnets {
+		sub.Uid = subnetIDHash(sub.Name)
+	}
+	existing.Subnets = network.Subnets
+	existing.AdminStateUp = network.AdminStateUp
 	return nil
 }
 
@@ -481,6 +810,15 @@ func (f *FakeOSClient) GetNetworkByID(networkID string) (*drivertypes.Network, e
 	return nil, ErrNotFound
 }
 
+// GetNetworkDetails is a test implementation of Interface.GetNetworkDetails.
+// The router is set when the network is created.
+func (f *FakeOSClient) GetNetworkDetails(network *drivertypes.Network) error {
+	f.Lock()
+	defer f.Unlock()
+	f.appendCalled("GetNetworkDetails", network.Name)
+	return f.getError("GetNetworkDetails")
+}
+
 // GetNetworkByName is a test implementation of Interface.GetNetworkByName.
 func (f *FakeOSClient) GetNetworkByName(networkName string) (*drivertypes.Network, error) {
 	f.Lock()
@@ -591,17 +929,24 @@ func (f *FakeOSClient) EnsureLoadBalancer(lb *LoadBalancer) (*LoadBalancerStatus
 
 	f.LoadBalancers[lb.Name] = lb
 
+	externalIP := lb.ExternalIP
+	if externalIP == "" {
+		externalIP = lb.AllocatedFloatingIP
+	}
+	if externalIP == "" {
+		externalIP = FakeAllocatedFloatingIP
+	}
 	return &LoadBalancerStatus{
 		InternalIP: lb.InternalIP,
-		ExternalIP: lb.ExternalIP,
+		ExternalIP: externalIP,
 	}, nil
 }
 
 // EnsureLoadBalancerDeleted is a test implementation of Interface.EnsureLoadBalancerDeleted.
-func (f *FakeOSClient) EnsureLoadBalancerDeleted(name string) error {
+func (f *FakeOSClient) EnsureLoadBalancerDeleted(name string, releaseFloatingIP bool) error {
 	f.Lock()
 	defer f.Unlock()
-	f.appendCalled("EnsureLoadBalancerDeleted", name)
+	f.appendCalled("EnsureLoadBalancerDeleted", name, releaseFloatingIP)
 	if err := f.getError("EnsureLoadBalancerDeleted"); err != nil {
 		return err
 	}
@@ -610,6 +955,45 @@ func (f *FakeOSClient) EnsureLoadBalancerDeleted(name string) error {
 	return nil
 }
 
+// SetResource sets the resource listed by ListResources.
+func (f *FakeOSClient) SetResource(resource Resource) {
+	f.Lock()
+	defer f.Unlock()
+
+	f.Resources[resource.Kind+"/"+resource.ID] = &resource
+}
+
+// ListResources is a test implementation of Interface.ListResources.
+func (f *FakeOSClient) ListResources(kind, tenantID string) ([]Resource, error) {
+	f.Lock()
+	defer f.Unlock()
+	f.appendCalled("ListResources", kind, tenantID)
+	if err := f.getError("ListResources"); err != nil {
+		return nil, err
+	}
+
+	var results []Resource
+	for _, resource := range f.Resources {
+		if resource.Kind == kind && resource.TenantID == tenantID {
+			results = append(results, *resource)
+		}
+	}
+	return results, nil
+}
+
+// DeleteResource is a test implementation of Interface.DeleteResource.
+func (f *FakeOSClient) DeleteResource(resource Resource) error {
+	f.Lock()
+	defer f.Unlock()
+	f.appendCalled("DeleteResource", resource)
+	if err := f.getError("DeleteResource"); err != nil {
+		return err
+	}
+
+	delete(f.Resources, resource.Kind+"/"+resource.ID)
+	return nil
+}
+
 // GetCRDClient is a test implementation of Interface.GetCRDClient.
 func (f *FakeOSClient) GetCRDClient() crdClient.Interface {
 	return f.CRDClient
@@ -0,0 +1,86 @@
+/*
+Copyright (c) 2017 OpenStack Foundation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	crv1 "git.openstack.org/openstack/stackube/pkg/apis/v1"
+
+	"github.com/golang/glog"
+	"github.com/gophercloud/gophercloud"
+)
+
+// Names of the Neutron quota resources limited by tenant quotas.
+const (
+	quotaFloatingIP   = "floatingip"
+	quotaPort         = "port"
+	quotaLoadBalancer = "loadbalancer"
+)
+
+type quotaDetail struct {
+	Used int64 `json:"used"`
+}
+
+// UpdateQuota sets the Neutron quota of the tenant to the floating IP, port
+// and load balancer limits of quota, and returns the Neutron usage of them.
+// Limits which are not set in quota are left unchanged.
+func (os *Client) UpdateQuota(tenantID string, quota *crv1.TenantQuota) (*crv1.TenantQuota, error) {
+	limits := map[string]int64{}
+	for name, limit := range map[string]*int64{
+		quotaFloatingIP:   quota.FloatingIPs,
+		quotaPort:         quota.Ports,
+		quotaLoadBalancer: quota.LoadBalancers,
+	} {
+		if limit != nil {
+			limits[name] = *limit
+		}
+	}
+
+	if len(limits) != 0 {
+		body := map[string]interface{}{"quota": limits}
+		_, err := os.Network.Put(os.Network.ServiceURL("quotas", tenantID), body, nil, &gophercloud.RequestOpts{
+			OkCodes: []int{200},
+		})
+		if err != nil {
+			glog.Errorf("Failed to update quota of tenant %s: %v", tenantID, err)
+			return nil, err
+		}
+		glog.V(4).Infof("Quota of tenant %s updated to %v", tenantID, limits)
+	}
+
+	var s struct {
+		Quota map[string]quotaDetail `json:"quota"`
+	}
+	_, err := os.Network.Get(os.Network.ServiceURL("quotas", tenantID, "details"), &s, nil)
+	if err != nil {
+		glog.Errorf("Failed to get quota usage of tenant %s: %v", tenantID, err)
+		return nil, err
+	}
+
+	used := &crv1.TenantQuota{}
+	for name, usage := range map[string]**int64{
+		quotaFloatingIP:   &used.FloatingIPs,
+		quotaPort:         &used.Ports,
+		quotaLoadBalancer: &used.LoadBalancers,
+	} {
+		if detail, ok := s.Quota[name]; ok {
+			value := detail.Used
+			*usage = &value
+		}
+	}
+
+	return used, nil
+}
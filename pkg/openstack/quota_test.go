@@ -0,0 +1,114 @@
+/*
+Copyright (c) 2017 OpenStack Foundation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	crv1 "git.openstack.org/openstack/stackube/pkg/apis/v1"
+
+	"github.com/gophercloud/gophercloud"
+)
+
+func int64Ptr(i int64) *int64 {
+	return &i
+}
+
+func TestUpdateQuota(t *testing.T) {
+	var updated []map[string]int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "PUT" && r.URL.Path == "/v2.0/quotas/p-dev":
+			var s struct {
+				Quota map[string]int64 `json:"quota"`
+			}
+			json.NewDecoder(r.Body).Decode(&s)
+			updated = append(updated, s.Quota)
+			writeJSON(w, http.StatusOK, s)
+		case r.Method == "GET" && r.URL.Path == "/v2.0/quotas/p-dev/details":
+			writeJSON(w, http.StatusOK, map[string]interface{}{
+				"quota": map[string]interface{}{
+					"floatingip":   map[string]int64{"used": 1, "limit": 5, "reserved": 0},
+					"port":         map[string]int64{"used": 7, "limit": 50, "reserved": 0},
+					"loadbalancer": map[string]int64{"used": 2, "limit": 10, "reserved": 0},
+					"network":      map[string]int64{"used": 1, "limit": 10, "reserved": 0},
+				},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := &Client{
+		Network: &gophercloud.ServiceClient{
+			ProviderClient: &gophercloud.ProviderClient{},
+			Endpoint:       server.URL + "/",
+			ResourceBase:   server.URL + "/v2.0/",
+		},
+	}
+
+	expectedUsed := &crv1.TenantQuota{
+		FloatingIPs:   int64Ptr(1),
+		Ports:         int64Ptr(7),
+		LoadBalancers: int64Ptr(2),
+	}
+	testCases := []struct {
+		testName        string
+		quota           *crv1.TenantQuota
+		expectedUpdated []map[string]int64
+	}{
+		{
+			testName: "Update limits",
+			quota: &crv1.TenantQuota{
+				Pods:        int64Ptr(10),
+				FloatingIPs: int64Ptr(5),
+				Ports:       int64Ptr(50),
+			},
+			expectedUpdated: []map[string]int64{{"floatingip": 5, "port": 50}},
+		},
+		{
+			testName: "No network limits",
+			quota: &crv1.TenantQuota{
+				Pods: int64Ptr(10),
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		updated = nil
+		used, err := client.UpdateQuota("p-dev", tc.quota)
+		if err != nil {
+			t.Errorf("Case[%s]: unexpected error: %v", tc.testName, err)
+			continue
+		}
+		if !reflect.DeepEqual(updated, tc.expectedUpdated) {
+			t.Errorf("Case[%s]: expected quota updated to %v, got %v", tc.testName, tc.expectedUpdated, updated)
+		}
+		if !reflect.DeepEqual(used, expectedUsed) {
+			t.Errorf("Case[%s]: expected usage %v, got %v", tc.testName, expectedUsed, used)
+		}
+	}
+
+	if _, err := client.UpdateQuota("p-missing", &crv1.TenantQuota{}); err == nil {
+		t.Errorf("Expected error for missing tenant")
+	}
+}
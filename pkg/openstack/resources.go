@@ -0,0 +1,247 @@
+/*
+Copyright (c) 2017 OpenStack Foundation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/layer3/floatingips"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/layer3/routers"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/lbaas_v2/loadbalancers"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/networks"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	"github.com/gophercloud/gophercloud/pagination"
+)
+
+// Kinds of the resources listed by ListResources.
+const (
+	ResourceLoadBalancer = "loadbalancer"
+	ResourceFloatingIP   = "floatingip"
+	ResourcePort         = "port"
+	ResourceNetwork      = "network"
+	ResourceRouter       = "router"
+)
+
+// ResourceDescription is the description of the networks, routers and ports
+// created by stackube, which tells them from the resources of users.
+const ResourceDescription = "Created by stackube"
+
+// ResourceKinds are the kinds of the resources listed by ListResources, in
+// the order they can be deleted: load balancers hold floating IPs and ports
+// on networks, and networks are deleted together with their routers.
+var ResourceKinds = []string{
+	ResourceLoadBalancer,
+	ResourceFloatingIP,
+	ResourcePort,
+	ResourceNetwork,
+	ResourceRouter,
+}
+
+// Resource is a Neutron resource of a tenant.
+type Resource struct {
+	Kind     string
+	ID       string
+	Name     string
+	TenantID string
+	// FloatingIP is the address of a floating IP.
+	FloatingIP string
+	// PortID is the port a floating IP is associated with.
+	PortID string
+	// Description is FloatingIPDescription for a floating IP allocated by
+	// stackube, and ResourceDescription for the other resources created by
+	// stackube.
+	Description string
+}
+
+// namedResource is a network, router or port with its description, which
+// is not extracted by gophercloud.
+type namedResource struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	TenantID    string `json:"tenant_id"`
+	Description string `json:"description"`
+}
+
+// extractNamedResources extracts the networks, routers or ports of page with
+// their descriptions.
+func extractNamedResources(page pagination.Page) ([]namedResource, error) {
+	var s struct {
+		Networks []namedResource `json:"networks"`
+		Routers  []namedResource `json:"routers"`
+		Ports    []namedResource `json:"ports"`
+	}
+	err := page.(interface {
+		ExtractInto(interface{}) error
+	}).ExtractInto(&s)
+	return append(append(s.Networks, s.Routers...), s.Ports...), err
+}
+
+// floatingIP is a floating IP with its description, which is not extracted
+// by gophercloud.
+type floatingIP struct {
+	ID          string `json:"id"`
+	FloatingIP  string `json:"floating_ip_address"`
+	PortID      string `json:"port_id"`
+	TenantID    string `json:"tenant_id"`
+	Description string `json:"description"`
+}
+
+// extractFloatingIPs extracts the floating IPs of page with their
+// descriptions.
+func extractFloatingIPs(page pagination.Page) ([]floatingIP, error) {
+	var s struct {
+		FloatingIPs []floatingIP `json:"floatingips"`
+	}
+	err := page.(floatingips.FloatingIPPage).ExtractInto(&s)
+	return s.FloatingIPs, err
+}
+
+// ListResources lists the resources of kind in the tenant. Floating IPs are
+// only listed on the external network.
+func (os *Client) ListResources(kind, tenantID string) ([]Resource, error) {
+	var results []Resource
+	var pager pagination.Pager
+	var extract func(page pagination.Page) error
+
+	switch kind {
+	case ResourceLoadBalancer:
+		pager = loadbalancers.List(os.Network, loadbalancers.ListOpts{TenantID: tenantID})
+		extract = func(page pagination.Page) error {
+			list, err := loadbalancers.ExtractLoadBalancers(page)
+			for _, lb := range list {
+				results = append(results, Resource{Kind: kind, ID: lb.ID, Name: lb.Name, TenantID: lb.TenantID})
+			}
+			return err
+		}
+	case ResourceFloatingIP:
+		pager = floatingips.List(os.Network, floatingips.ListOpts{TenantID: tenantID, FloatingNetworkID: os.ExtNetID})
+		extract = func(page pagination.Page) error {
+			list, err := extractFloatingIPs(page)
+			for _, fip := range list {
+				results = append(results, Resource{Kind: kind, ID: fip.ID, TenantID: fip.TenantID,
+					FloatingIP: fip.FloatingIP, PortID: fip.PortID, Description: fip.Description})
+			}
+			return err
+		}
+	case ResourcePort:
+		pager = ports.List(os.Network, ports.ListOpts{TenantID: tenantID})
+	case ResourceNetwork:
+		pager = networks.List(os.Network, networks.ListOpts{TenantID: tenantID})
+	case ResourceRouter:
+		pager = routers.List(os.Network, routers.ListOpts{TenantID: tenantID})
+	default:
+		return nil, fmt.Errorf("unknown resource kind %q", kind)
+	}
+
+	if extract == nil {
+		extract = func(page pagination.Page) error {
+			list, err := extractNamedResources(page)
+			for _, r := range list {
+				results = append(results, Resource{Kind: kind, ID: r.ID, Name: r.Name, TenantID: r.TenantID,
+					Description: r.Description})
+			}
+			return err
+		}
+	}
+
+	err := pager.EachPage(func(page pagination.Page) (bool, error) {
+		if err := extract(page); err != nil {
+			return false, err
+		}
+		return true, nil
+	})
+	if err != nil {
+		glog.Errorf("List %ss of tenant %s failed: %v", kind, tenantID, err)
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// DeleteResource deletes the resource listed by ListResources. Networks are
+// deleted with their subnets, ports and router, and load balancers with
+// their floating IP.
+func (os *Client) DeleteResource(resource Resource) error {
+	switch resource.Kind {
+	case ResourceLoadBalancer:
+		// The floating IP of an orphaned load balancer is only
+		// disassociated, it's released like the other orphaned floating
+		// IPs if it's allocated by stackube.
+		return os.EnsureLoadBalancerDeleted(resource.Name, false)
+	case ResourceFloatingIP:
+		err := floatingips.Delete(os.Network, resource.ID).ExtractErr()
+		if err != nil && !isNotFound(err) {
+			return err
+		}
+		return nil
+	case ResourcePort:
+		err := ports.Delete(os.Network, resource.ID).ExtractErr()
+		if err != nil && !isNotFound(err) {
+			return err
+		}
+		return nil
+	case ResourceNetwork:
+		return os.DeleteNetwork(resource.Name)
+	case ResourceRouter:
+		return os.deleteRouter(resource.ID)
+	}
+
+	return fmt.Errorf("unknown resource kind %q", resource.Kind)
+}
+
+// deleteRouter detaches the router from its subnets and deletes it.
+func (os *Client) deleteRouter(routerID string) error {
+	interfaces, err := os.listPortsByDevice(routerID, "network:router_interface")
+	if err != nil {
+		return err
+	}
+	for _, port := range interfaces {
+		opts := routers.RemoveInterfaceOpts{PortID: port.ID}
+		if _, err := routers.RemoveInterface(os.Network, routerID, opts).Extract(); err != nil && !isNotFound(err) {
+			return fmt.Errorf("remove interface %s of router %s failed: %v", port.ID, routerID, err)
+		}
+	}
+
+	err = routers.Delete(os.Network, routerID).ExtractErr()
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// listPortsByDevice lists the ports of the device by deviceOwner.
+func (os *Client) listPortsByDevice(deviceID, deviceOwner string) ([]ports.Port, error) {
+	var results []ports.Port
+	opts := ports.ListOpts{
+		DeviceID:    deviceID,
+		DeviceOwner: deviceOwner,
+	}
+	err := ports.List(os.Network, opts).EachPage(func(page pagination.Page) (bool, error) {
+		portList, err := ports.ExtractPorts(page)
+		if err != nil {
+			return false, err
+		}
+		results = append(results, portList...)
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
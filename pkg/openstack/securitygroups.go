@@ -0,0 +1,214 @@
+/*
+Copyright (c) 2017 OpenStack Foundation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/golang/glog"
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/security/groups"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/security/rules"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	"github.com/gophercloud/gophercloud/pagination"
+)
+
+// defaultSourceRanges admit all the IPv4 and IPv6 clients when a load
+// balancer has no source ranges.
+var defaultSourceRanges = []string{"0.0.0.0/0", "::/0"}
+
+// loadBalancerRule is an ingress rule of the security group of a load
+// balancer.
+type loadBalancerRule struct {
+	protocol  string
+	port      int
+	cidr      string
+	etherType string
+}
+
+// loadBalancerRules returns the ingress rules admitting the source ranges of
+// lb to its ports.
+func loadBalancerRules(lb *LoadBalancer) (map[loadBalancerRule]bool, error) {
+	sourceRanges := lb.SourceRanges
+	if len(sourceRanges) == 0 {
+		sourceRanges = defaultSourceRanges
+	}
+
+	results := make(map[loadBalancerRule]bool)
+	for _, sourceRange := range sourceRanges {
+		ip, ipNet, err := net.ParseCIDR(sourceRange)
+		if err != nil {
+			return nil, fmt.Errorf("invalid source range %q: %v", sourceRange, err)
+		}
+		etherType := string(rules.EtherType4)
+		if ip.To4() == nil {
+			etherType = string(rules.EtherType6)
+		}
+
+		for _, port := range lb.Ports {
+			protocol := string(rules.ProtocolTCP)
+			if port.Protocol == ProtocolUDP {
+				protocol = string(rules.ProtocolUDP)
+			}
+			results[loadBalancerRule{
+				protocol:  protocol,
+				port:      port.Port,
+				cidr:      ipNet.String(),
+				etherType: etherType,
+			}] = true
+		}
+	}
+
+	return results, nil
+}
+
+// getSecurityGroupByName gets the security group by name, in all the tenants
+// if tenantID is empty.
+func (os *Client) getSecurityGroupByName(tenantID, name string) (*groups.SecGroup, error) {
+	var result *groups.SecGroup
+	opts := groups.ListOpts{
+		TenantID: tenantID,
+		Name:     name,
+	}
+	err := groups.List(os.Network, opts).EachPage(func(page pagination.Page) (bool, error) {
+		list, err := groups.ExtractGroups(page)
+		if err != nil {
+			return false, err
+		}
+		if len(list) > 0 {
+			result = &list[0]
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return nil, ErrNotFound
+	}
+
+	return result, nil
+}
+
+// ensureLoadBalancerSecurityGroup ensures the security group of lb only
+// admits its source ranges to its ports, and is the only security group of
+// the VIP port.
+func (os *Client) ensureLoadBalancerSecurityGroup(lb *LoadBalancer, vipPortID string) error {
+	wanted, err := loadBalancerRules(lb)
+	if err != nil {
+		return err
+	}
+
+	sg, err := os.getSecurityGroupByName(lb.TenantID, lb.Name)
+	if err != nil {
+		if !isNotFound(err) {
+			return fmt.Errorf("error getting security group %q: %v", lb.Name, err)
+		}
+		sg, err = groups.Create(os.Network, groups.CreateOpts{
+			Name:        lb.Name,
+			Description: "Stackube service",
+			TenantID:    lb.TenantID,
+		}).Extract()
+		if err != nil {
+			glog.Errorf("Create security group %q failed: %v", lb.Name, err)
+			return err
+		}
+	}
+
+	// delete the rules of removed ports and source ranges.
+	for _, rule := range sg.Rules {
+		if rule.Direction != string(rules.DirIngress) {
+			continue
+		}
+		key := loadBalancerRule{
+			protocol:  rule.Protocol,
+			port:      rule.PortRangeMin,
+			cidr:      rule.RemoteIPPrefix,
+			etherType: rule.EtherType,
+		}
+		if wanted[key] && rule.PortRangeMax == rule.PortRangeMin && rule.RemoteGroupID == "" {
+			delete(wanted, key)
+			continue
+		}
+
+		glog.V(4).Infof("Deleting obsolete rule %s of security group %s", rule.ID, sg.Name)
+		err := rules.Delete(os.Network, rule.ID).ExtractErr()
+		if err != nil && !isNotFound(err) {
+			return fmt.Errorf("error deleting rule %q of security group %q: %v", rule.ID, sg.Name, err)
+		}
+	}
+
+	// create the missing rules.
+	for rule := range wanted {
+		_, err := rules.Create(os.Network, rules.CreateOpts{
+			Direction:      rules.DirIngress,
+			EtherType:      rules.RuleEtherType(rule.etherType),
+			SecGroupID:     sg.ID,
+			Protocol:       rules.RuleProtocol(rule.protocol),
+			PortRangeMin:   rule.port,
+			PortRangeMax:   rule.port,
+			RemoteIPPrefix: rule.cidr,
+			TenantID:       lb.TenantID,
+		}).Extract()
+		if err != nil {
+			return fmt.Errorf("error creating rule %s/%d from %s of security group %q: %v",
+				rule.protocol, rule.port, rule.cidr, sg.Name, err)
+		}
+	}
+
+	// replace the security groups of the VIP port.
+	port, err := ports.Get(os.Network, vipPortID).Extract()
+	if err != nil {
+		return fmt.Errorf("error getting VIP port %q: %v", vipPortID, err)
+	}
+	if len(port.SecurityGroups) == 1 && port.SecurityGroups[0] == sg.ID {
+		return nil
+	}
+	// ports.Update resets the allowed address pairs, so only the security
+	// groups are sent.
+	body := map[string]interface{}{
+		"port": map[string]interface{}{"security_groups": []string{sg.ID}},
+	}
+	_, err = os.Network.Put(os.Network.ServiceURL("ports", vipPortID), body, nil, &gophercloud.RequestOpts{
+		OkCodes: []int{200},
+	})
+	if err != nil {
+		return fmt.Errorf("error updating security groups of VIP port %q: %v", vipPortID, err)
+	}
+
+	return nil
+}
+
+// deleteLoadBalancerSecurityGroup deletes the security group of the load
+// balancer named name, after its VIP port is deleted.
+func (os *Client) deleteLoadBalancerSecurityGroup(name string) error {
+	sg, err := os.getSecurityGroupByName("", name)
+	if err != nil {
+		if isNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	err = groups.Delete(os.Network, sg.ID).ExtractErr()
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+	return nil
+}
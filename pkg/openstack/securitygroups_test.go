@@ -0,0 +1,185 @@
+/*
+Copyright (c) 2017 OpenStack Foundation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/gophercloud/gophercloud"
+)
+
+// fakeSecurityGroups serves the security group and the VIP port of a load
+// balancer, and records the requests changing them.
+type fakeSecurityGroups struct {
+	group    map[string]interface{}
+	portSGs  []string
+	requests []string
+}
+
+func (f *fakeSecurityGroups) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/v2.0/security-groups":
+		list := []interface{}{}
+		if f.group != nil {
+			list = append(list, f.group)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"security_groups": list})
+		return
+	case r.Method == "GET" && r.URL.Path == "/v2.0/ports/vip-port":
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"port": map[string]interface{}{"id": "vip-port", "security_groups": f.portSGs},
+		})
+		return
+	}
+
+	var body map[string]map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&body)
+	switch {
+	case r.Method == "POST" && r.URL.Path == "/v2.0/security-groups":
+		f.requests = append(f.requests, "create group")
+		writeJSON(w, http.StatusCreated, map[string]interface{}{
+			"security_group": map[string]interface{}{"id": "sg-new", "name": body["security_group"]["name"]},
+		})
+	case r.Method == "POST" && r.URL.Path == "/v2.0/security-group-rules":
+		rule := body["security_group_rule"]
+		f.requests = append(f.requests, fmt.Sprintf("create rule %v/%v from %v of %v",
+			rule["protocol"], rule["port_range_min"], rule["remote_ip_prefix"], rule["security_group_id"]))
+		writeJSON(w, http.StatusCreated, map[string]interface{}{"security_group_rule": rule})
+	case r.Method == "DELETE":
+		f.requests = append(f.requests, "delete "+r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == "PUT" && r.URL.Path == "/v2.0/ports/vip-port":
+		f.requests = append(f.requests, fmt.Sprintf("update port %v", body["port"]["security_groups"]))
+		writeJSON(w, http.StatusOK, body)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestEnsureLoadBalancerSecurityGroup(t *testing.T) {
+	existing := map[string]interface{}{
+		"id":   "sg-1",
+		"name": "stackube_default_svc",
+		"security_group_rules": []map[string]interface{}{
+			{"id": "egress", "direction": "egress", "ethertype": "IPv4"},
+			{"id": "keep", "direction": "ingress", "ethertype": "IPv4", "protocol": "tcp",
+				"port_range_min": 80, "port_range_max": 80, "remote_ip_prefix": "10.0.0.0/8"},
+			{"id": "stale", "direction": "ingress", "ethertype": "IPv4", "protocol": "tcp",
+				"port_range_min": 80, "port_range_max": 80, "remote_ip_prefix": "0.0.0.0/0"},
+		},
+	}
+
+	testCases := []struct {
+		testName         string
+		group            map[string]interface{}
+		portSGs          []string
+		ports            []LoadBalancerPort
+		sourceRanges     []string
+		expectedRequests []string
+		expectErr        bool
+	}{
+		{
+			testName: "Create security group",
+			portSGs:  []string{"default"},
+			ports: []LoadBalancerPort{
+				{Port: 80, Protocol: ProtocolHTTP},
+				{Port: 53, Protocol: ProtocolUDP},
+			},
+			expectedRequests: []string{
+				"create group",
+				"create rule tcp/80 from 0.0.0.0/0 of sg-new",
+				"create rule tcp/80 from ::/0 of sg-new",
+				"create rule udp/53 from 0.0.0.0/0 of sg-new",
+				"create rule udp/53 from ::/0 of sg-new",
+				"update port [sg-new]",
+			},
+		},
+		{
+			testName: "Default source ranges",
+			group:    existing,
+			portSGs:  []string{"sg-1"},
+			ports:    []LoadBalancerPort{{Port: 80, Protocol: ProtocolTCP}},
+			expectedRequests: []string{
+				"create rule tcp/80 from ::/0 of sg-1",
+				"delete /v2.0/security-group-rules/keep",
+			},
+		},
+		{
+			testName:     "Sync source ranges",
+			group:        existing,
+			portSGs:      []string{"sg-1"},
+			ports:        []LoadBalancerPort{{Port: 80, Protocol: ProtocolTCP}},
+			sourceRanges: []string{"10.0.0.0/8", "192.168.0.0/16", "fd00::/8"},
+			expectedRequests: []string{
+				"create rule tcp/80 from 192.168.0.0/16 of sg-1",
+				"create rule tcp/80 from fd00::/8 of sg-1",
+				"delete /v2.0/security-group-rules/stale",
+			},
+		},
+		{
+			testName:     "Invalid source range",
+			group:        existing,
+			ports:        []LoadBalancerPort{{Port: 80, Protocol: ProtocolTCP}},
+			sourceRanges: []string{"10.0.0.0"},
+			expectErr:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		f := &fakeSecurityGroups{group: tc.group, portSGs: tc.portSGs}
+		server := httptest.NewServer(f)
+		client := &Client{
+			Network: &gophercloud.ServiceClient{
+				ProviderClient: &gophercloud.ProviderClient{},
+				Endpoint:       server.URL + "/",
+				ResourceBase:   server.URL + "/v2.0/",
+			},
+		}
+
+		lb := &LoadBalancer{
+			Name:         "stackube_default_svc",
+			TenantID:     "tenant-id",
+			Ports:        tc.ports,
+			SourceRanges: tc.sourceRanges,
+		}
+		err := client.ensureLoadBalancerSecurityGroup(lb, "vip-port")
+		server.Close()
+		if tc.expectErr {
+			if err == nil {
+				t.Errorf("Case[%s]: expected error", tc.testName)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Case[%s]: unexpected error: %v", tc.testName, err)
+			continue
+		}
+
+		// rules are created in random order.
+		sort.Strings(f.requests)
+		sort.Strings(tc.expectedRequests)
+		if !reflect.DeepEqual(f.requests, tc.expectedRequests) {
+			t.Errorf("Case[%s]: expected requests %v, got %v", tc.testName, tc.expectedRequests, f.requests)
+		}
+	}
+}
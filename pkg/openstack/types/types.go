@@ -22,6 +22,12 @@ type Network struct {
 	TenantID  string
 	SegmentID int32
 	Subnets   []*Subnet
+	// RouterID is the ID of the router the subnets are attached to.
+	RouterID string
+	// ExternalGatewayIP is the IP of the router on the external network.
+	ExternalGatewayIP string
+	// AdminStateUp is the administrative state of network, nil means up.
+	AdminStateUp *bool
 	// Status of network
 	// Valid value: Initializing, Active, Pending, Failed, Terminating
 	Status string
@@ -36,6 +42,19 @@ type Subnet struct {
 	Tenantid   string
 	Dnsservers []string
 	Routes     []*Route
+	// IPVersion is 4 or 6, defaults to 4.
+	IPVersion int
+	// IPv6Mode is used as both IPv6 address mode and RA mode.
+	IPv6Mode string
+	// AllocationPools are the ranges of IPs allocated to ports, empty means
+	// the whole subnet.
+	AllocationPools []*AllocationPool
+}
+
+// AllocationPool is a range of IPs allocated to ports.
+type AllocationPool struct {
+	Start string
+	End   string
 }
 
 // Route is a representation of an advanced routing rule.
@@ -0,0 +1,32 @@
+/*
+Copyright (c) 2017 OpenStack Foundation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"git.openstack.org/openstack/stackube/pkg/metrics"
+)
+
+var (
+	syncProxyRulesDuration = metrics.NewHistogramVec("stackube_proxy_sync_proxy_rules_duration_seconds",
+		"Duration of syncing the iptables rules of services.", metrics.DefBuckets)
+	syncProxyRulesFailures = metrics.NewCounterVec("stackube_proxy_sync_proxy_rules_failures_total",
+		"Number of failures to sync the iptables rules of services by namespace.", "namespace")
+)
+
+func init() {
+	metrics.MustRegister(syncProxyRulesDuration, syncProxyRulesFailures)
+}
@@ -146,6 +146,15 @@ func (p *Proxier) isInitialized() bool {
 	return atomic.LoadInt32(&p.initialized) > 0
 }
 
+// Ready returns an error until the namespaces, services and endpoints have
+// been synced.
+func (p *Proxier) Ready() error {
+	if !p.isInitialized() {
+		return fmt.Errorf("namespaces, services and endpoints not synced")
+	}
+	return nil
+}
+
 func (p *Proxier) onServiceAdded(obj interface{}) {
 	service, ok := obj.(*v1.Service)
 	if !ok {
@@ -199,6 +208,7 @@ func (p *Proxier) onServiceDeleted(obj interface{}) {
 
 func (p *Proxier) getRouterForNamespace(namespace string) (string, error) {
 	// Only support one network and network's name is same with namespace.
+	// Namespaces of the same tenant have their own networks and routers.
 	// TODO: make it general after multi-network is supported.
 	networkName := util.BuildNetworkName(namespace, namespace)
 	network, err := p.osClient.GetNetworkByName(networkName)
@@ -495,6 +505,11 @@ func (p *Proxier) syncProxyRules() {
 		return
 	}
 
+	start := time.Now()
+	defer func() {
+		syncProxyRulesDuration.WithLabelValues().Observe(time.Since(start).Seconds())
+	}()
+
 	// update local caches.
 	p.updateCaches()
 
@@ -511,6 +526,7 @@ func (p *Proxier) syncProxyRules() {
 		nsInfo, ok := p.namespaceMap[namespace]
 		if !ok {
 			glog.Errorf("Namespace %q doesn't exist in caches", namespace)
+			syncProxyRulesFailures.WithLabelValues(namespace).Inc()
 			continue
 		}
 		glog.V(3).Infof("Syncing iptables for namespace %q: %v", namespace, nsInfo)
@@ -539,6 +555,7 @@ func (p *Proxier) syncProxyRules() {
 		err := p.iptables.ensureChain()
 		if err != nil {
 			glog.Errorf("EnsureChain %q in netns %q failed: %v", ChainSKPrerouting, netns, err)
+			syncProxyRulesFailures.WithLabelValues(namespace).Inc()
 			continue
 		}
 		// link STACKUBE-PREROUTING chain.
@@ -547,6 +564,7 @@ func (p *Proxier) syncProxyRules() {
 		})
 		if err != nil {
 			glog.Errorf("Link chain %q in netns %q failed: %v", ChainSKPrerouting, netns, err)
+			syncProxyRulesFailures.WithLabelValues(namespace).Inc()
 			continue
 		}
 
@@ -611,6 +629,7 @@ func (p *Proxier) syncProxyRules() {
 		err = p.iptables.restoreAll(iptablesData.Bytes())
 		if err != nil {
 			glog.Errorf("Failed to execute iptables-restore: %v", err)
+			syncProxyRulesFailures.WithLabelValues(namespace).Inc()
 			continue
 		}
 	}
@@ -0,0 +1,204 @@
+/*
+Copyright (c) 2017 OpenStack Foundation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"git.openstack.org/openstack/stackube/pkg/openstack"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+const (
+	// AnnotationProtocol selects the protocol of the listeners of the TCP
+	// ports, "TCP" by default, "HTTP" or "TERMINATED_HTTPS".
+	AnnotationProtocol = "loadbalancer.stackube.io/protocol"
+	// AnnotationTLSPorts lists the ports, by number or name, which
+	// terminate TLS if the protocol is "TERMINATED_HTTPS". The other TCP
+	// ports are "HTTP". All TCP ports terminate TLS if it's not set.
+	AnnotationTLSPorts = "loadbalancer.stackube.io/tls-ports"
+	// AnnotationTLSSecret is the name of the kubernetes.io/tls Secret in
+	// the namespace of the service, which holds the certificate of the
+	// "TERMINATED_HTTPS" ports.
+	AnnotationTLSSecret = "loadbalancer.stackube.io/tls-secret"
+
+	// AnnotationLBMethod is the algorithm of the pools, "ROUND_ROBIN" by
+	// default, "LEAST_CONNECTIONS" or "SOURCE_IP".
+	AnnotationLBMethod = "loadbalancer.stackube.io/lb-method"
+	// AnnotationMonitorType is the type of the health monitors, "TCP" by
+	// default, "HTTP", "HTTPS", "PING" or "UDP-CONNECT".
+	AnnotationMonitorType = "loadbalancer.stackube.io/health-monitor-type"
+	// AnnotationMonitorDelay is the interval of health checks in seconds.
+	AnnotationMonitorDelay = "loadbalancer.stackube.io/health-monitor-delay"
+	// AnnotationMonitorTimeout is the timeout of health checks in seconds.
+	AnnotationMonitorTimeout = "loadbalancer.stackube.io/health-monitor-timeout"
+	// AnnotationMonitorMaxRetries is the number of failed health checks
+	// before a member is marked down.
+	AnnotationMonitorMaxRetries = "loadbalancer.stackube.io/health-monitor-max-retries"
+	// AnnotationConnectionLimit is the max connections of each port.
+	AnnotationConnectionLimit = "loadbalancer.stackube.io/connection-limit"
+	// AnnotationTimeoutClientData, AnnotationTimeoutMemberConnect and
+	// AnnotationTimeoutMemberData are the timeouts of the listeners in
+	// milliseconds, only supported by Octavia.
+	AnnotationTimeoutClientData    = "loadbalancer.stackube.io/timeout-client-data"
+	AnnotationTimeoutMemberConnect = "loadbalancer.stackube.io/timeout-member-connect"
+	AnnotationTimeoutMemberData    = "loadbalancer.stackube.io/timeout-member-data"
+	// AnnotationVIPSubnetID is the subnet of the VIP, the subnet of the
+	// namespace network in the IP family of the service by default. It only
+	// applies when the load balancer is created.
+	AnnotationVIPSubnetID = "loadbalancer.stackube.io/vip-subnet-id"
+
+	// AnnotationSourceRanges is the kubernetes annotation of the source
+	// ranges, which is used if loadBalancerSourceRanges is not set.
+	AnnotationSourceRanges = "service.beta.kubernetes.io/load-balancer-source-ranges"
+)
+
+var (
+	lbMethods    = sets.NewString("ROUND_ROBIN", "LEAST_CONNECTIONS", "SOURCE_IP")
+	monitorTypes = sets.NewString("TCP", "HTTP", "HTTPS", "PING", "UDP-CONNECT")
+)
+
+// getPortProtocol returns the listener protocol of the service port.
+func getPortProtocol(service *v1.Service, port v1.ServicePort) (string, error) {
+	if port.Protocol == v1.ProtocolUDP {
+		return openstack.ProtocolUDP, nil
+	}
+
+	protocol := strings.ToUpper(service.Annotations[AnnotationProtocol])
+	switch protocol {
+	case "", openstack.ProtocolTCP:
+		return openstack.ProtocolTCP, nil
+	case openstack.ProtocolHTTP:
+		return openstack.ProtocolHTTP, nil
+	case openstack.ProtocolTerminatedHTTPS:
+		tlsPorts, ok := service.Annotations[AnnotationTLSPorts]
+		if !ok {
+			return openstack.ProtocolTerminatedHTTPS, nil
+		}
+		for _, p := range strings.Split(tlsPorts, ",") {
+			p = strings.TrimSpace(p)
+			if p == port.Name || p == strconv.Itoa(int(port.Port)) {
+				return openstack.ProtocolTerminatedHTTPS, nil
+			}
+		}
+		return openstack.ProtocolHTTP, nil
+	}
+
+	return "", fmt.Errorf("invalid %s annotation %q, must be %s, %s or %s", AnnotationProtocol,
+		service.Annotations[AnnotationProtocol], openstack.ProtocolTCP, openstack.ProtocolHTTP, openstack.ProtocolTerminatedHTTPS)
+}
+
+// getTLSCertificate returns the certificate in the TLS secret of service.
+func (s *ServiceController) getTLSCertificate(service *v1.Service) (*openstack.TLSCertificate, error) {
+	name := service.Annotations[AnnotationTLSSecret]
+	if name == "" {
+		return nil, fmt.Errorf("%s annotation is required by %s ports", AnnotationTLSSecret, openstack.ProtocolTerminatedHTTPS)
+	}
+
+	secret, err := s.kubeClient.Core().Secrets(service.Namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get TLS secret %s: %v", name, err)
+	}
+	cert := &openstack.TLSCertificate{
+		Certificate: secret.Data[v1.TLSCertKey],
+		PrivateKey:  secret.Data[v1.TLSPrivateKeyKey],
+	}
+	if len(cert.Certificate) == 0 || len(cert.PrivateKey) == 0 {
+		return nil, fmt.Errorf("TLS secret %s must have %s and %s", name, v1.TLSCertKey, v1.TLSPrivateKeyKey)
+	}
+
+	return cert, nil
+}
+
+// getLoadBalancerOptions returns the load balancer options of the annotations
+// of service.
+func getLoadBalancerOptions(service *v1.Service) (openstack.LoadBalancerOptions, error) {
+	opts := openstack.LoadBalancerOptions{}
+
+	if method, ok := service.Annotations[AnnotationLBMethod]; ok {
+		opts.LBMethod = strings.ToUpper(method)
+		if !lbMethods.Has(opts.LBMethod) {
+			return opts, fmt.Errorf("invalid %s annotation %q, must be one of %v", AnnotationLBMethod, method, lbMethods.List())
+		}
+	}
+	if monitorType, ok := service.Annotations[AnnotationMonitorType]; ok {
+		opts.MonitorType = strings.ToUpper(monitorType)
+		if !monitorTypes.Has(opts.MonitorType) {
+			return opts, fmt.Errorf("invalid %s annotation %q, must be one of %v", AnnotationMonitorType, monitorType, monitorTypes.List())
+		}
+	}
+
+	ints := []struct {
+		annotation string
+		value      *int
+	}{
+		{AnnotationMonitorDelay, &opts.MonitorDelay},
+		{AnnotationMonitorTimeout, &opts.MonitorTimeout},
+		{AnnotationMonitorMaxRetries, &opts.MonitorMaxRetries},
+		{AnnotationConnectionLimit, &opts.ConnectionLimit},
+		{AnnotationTimeoutClientData, &opts.TimeoutClientData},
+		{AnnotationTimeoutMemberConnect, &opts.TimeoutMemberConnect},
+		{AnnotationTimeoutMemberData, &opts.TimeoutMemberData},
+	}
+	for _, i := range ints {
+		value, ok := service.Annotations[i.annotation]
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || n <= 0 {
+			return opts, fmt.Errorf("invalid %s annotation %q, must be a positive integer", i.annotation, value)
+		}
+		*i.value = n
+	}
+	if opts.MonitorMaxRetries > 10 {
+		return opts, fmt.Errorf("invalid %s annotation %d, must be at most 10", AnnotationMonitorMaxRetries, opts.MonitorMaxRetries)
+	}
+	if opts.MonitorDelay > 0 && opts.MonitorTimeout > opts.MonitorDelay {
+		return opts, fmt.Errorf("%s annotation %d must not be greater than %s annotation %d", AnnotationMonitorTimeout,
+			opts.MonitorTimeout, AnnotationMonitorDelay, opts.MonitorDelay)
+	}
+
+	return opts, nil
+}
+
+// getSourceRanges returns the CIDRs admitted by the load balancer of service,
+// from loadBalancerSourceRanges or else the source ranges annotation. All the
+// clients are admitted if none is set.
+func getSourceRanges(service *v1.Service) ([]string, error) {
+	sourceRanges := service.Spec.LoadBalancerSourceRanges
+	if len(sourceRanges) == 0 && strings.TrimSpace(service.Annotations[AnnotationSourceRanges]) != "" {
+		sourceRanges = strings.Split(service.Annotations[AnnotationSourceRanges], ",")
+	}
+
+	results := make([]string, 0, len(sourceRanges))
+	for _, sourceRange := range sourceRanges {
+		_, ipNet, err := net.ParseCIDR(strings.TrimSpace(sourceRange))
+		if err != nil {
+			return nil, fmt.Errorf("invalid source range %q: %v", sourceRange, err)
+		}
+		results = append(results, ipNet.String())
+	}
+
+	return results, nil
+}
@@ -19,11 +19,9 @@ package service
 import (
 	"fmt"
 
-	"k8s.io/api/core/v1"
-)
+	"git.openstack.org/openstack/stackube/pkg/util"
 
-const (
-	lbPrefix = "stackube"
+	"k8s.io/api/core/v1"
 )
 
 func buildServiceName(service *v1.Service) string {
@@ -31,5 +29,5 @@ func buildServiceName(service *v1.Service) string {
 }
 
 func buildLoadBalancerName(service *v1.Service) string {
-	return fmt.Sprintf("%s_%s_%s", lbPrefix, service.Namespace, service.Name)
+	return util.BuildLoadBalancerName(service.Namespace, service.Name)
 }
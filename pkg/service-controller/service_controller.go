@@ -18,6 +18,7 @@ package service
 
 import (
 	"fmt"
+	"net"
 	"reflect"
 	"sync"
 	"time"
@@ -34,7 +35,10 @@ import (
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
 
+	"git.openstack.org/openstack/stackube/pkg/events"
+	"git.openstack.org/openstack/stackube/pkg/metrics"
 	"git.openstack.org/openstack/stackube/pkg/openstack"
+	drivertypes "git.openstack.org/openstack/stackube/pkg/openstack/types"
 	"git.openstack.org/openstack/stackube/pkg/util"
 	"github.com/golang/glog"
 )
@@ -55,6 +59,10 @@ const (
 	notRetryable           = false
 
 	doNotRetry = time.Duration(0)
+
+	// AllocatedFloatingIPAnnotation is set on the services whose floating IP
+	// is allocated by stackube, so that it's released with the load balancer.
+	AllocatedFloatingIPAnnotation = util.AllocatedFloatingIPAnnotation
 )
 
 type cachedService struct {
@@ -77,6 +85,7 @@ type ServiceController struct {
 	factory          informers.SharedInformerFactory
 	serviceInformer  informersV1.ServiceInformer
 	endpointInformer informersV1.EndpointsInformer
+	recorder         events.EventRecorder
 
 	// services that need to be synced
 	workingQueue workqueue.DelayingInterface
@@ -95,6 +104,7 @@ func NewServiceController(kubeClient kubernetes.Interface,
 		workingQueue:     workqueue.NewNamedDelayingQueue("service"),
 		serviceInformer:  factory.Core().V1().Services(),
 		endpointInformer: factory.Core().V1().Endpoints(),
+		recorder:         events.NewRecorder(kubeClient, "service-controller"),
 	}
 
 	s.serviceInformer.Informer().AddEventHandlerWithResyncPeriod(
@@ -174,6 +184,11 @@ func (s *ServiceController) Run(stopCh <-chan struct{}) error {
 	return nil
 }
 
+// HasSynced returns true if the services and endpoints have been synced.
+func (s *ServiceController) HasSynced() bool {
+	return s.serviceInformer.Informer().HasSynced() && s.endpointInformer.Informer().HasSynced()
+}
+
 // obj could be an *v1.Endpoint, or a DeletionFinalStateUnknown marker item.
 func (s *ServiceController) enqueueEndpoints(obj interface{}) {
 	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
@@ -194,7 +209,9 @@ func (s *ServiceController) worker() {
 				return
 			}
 			defer s.workingQueue.Done(key)
+			start := time.Now()
 			err := s.syncService(key.(string))
+			metrics.ObserveReconcile("service", start, err)
 			if err != nil {
 				glog.Errorf("Error syncing service: %v", err)
 			}
@@ -219,6 +236,7 @@ func (s *ServiceController) processServiceUpdate(cachedService *cachedService, s
 		}
 		message += err.Error()
 		glog.V(3).Infof("Create service %q failed: %v, message: %q", buildServiceName(service), err, message)
+		s.recorder.Event(service, v1.EventTypeWarning, "LoadBalancerFailed", message)
 
 		return err, cachedService.nextRetryDelay()
 	}
@@ -237,6 +255,7 @@ func (s *ServiceController) createLoadBalancerIfNeeded(key string, service *v1.S
 	// Save the state so we can avoid a write if it doesn't change
 	previousState := util.LoadBalancerStatusDeepCopy(&service.Status.LoadBalancer)
 	var newState *v1.LoadBalancerStatus
+	var allocatedFloatingIP string
 	var err error
 
 	lbName := buildLoadBalancerName(service)
@@ -252,22 +271,42 @@ func (s *ServiceController) createLoadBalancerIfNeeded(key string, service *v1.S
 
 		if needDelete {
 			glog.Infof("Deleting existing load balancer for service %s that no longer needs a load balancer.", key)
-			if err := s.osClient.EnsureLoadBalancerDeleted(lbName); err != nil {
+			s.recorder.Event(service, v1.EventTypeNormal, "DeletingLoadBalancer", "Deleting load balancer")
+			releaseFloatingIP := service.Annotations[AllocatedFloatingIPAnnotation] != ""
+			if err := s.osClient.EnsureLoadBalancerDeleted(lbName, releaseFloatingIP); err != nil {
 				glog.Errorf("EnsureLoadBalancerDeleted %q failed: %v", lbName, err)
 				return err, retryable
 			}
+			s.recorder.Event(service, v1.EventTypeNormal, "DeletedLoadBalancer", "Deleted load balancer")
 		}
 
 		newState = &v1.LoadBalancerStatus{}
 	} else {
 		glog.V(2).Infof("Ensuring LB for service %s", key)
+		if len(previousState.Ingress) == 0 {
+			s.recorder.Event(service, v1.EventTypeNormal, "EnsuringLoadBalancer", "Ensuring load balancer")
+		}
 
 		// The load balancer doesn't exist yet, so create it.
-		newState, err = s.createLoadBalancer(service)
+		newState, allocatedFloatingIP, err = s.createLoadBalancer(service)
 		if err != nil {
 			return fmt.Errorf("Failed to create load balancer for service %s: %v", key, err), retryable
 		}
 		glog.V(3).Infof("LoadBalancer %q created", lbName)
+		if ip := newState.Ingress[0].IP; ip != "" && !util.LoadBalancerStatusEqual(previousState, newState) {
+			s.recorder.Eventf(service, v1.EventTypeNormal, "FloatingIPAssociated", "Floating IP %s associated with load balancer", ip)
+		}
+	}
+
+	// Remember the allocated floating IP if changed
+	if service.Annotations[AllocatedFloatingIPAnnotation] != allocatedFloatingIP {
+		service, err = s.persistAllocatedFloatingIP(service, allocatedFloatingIP)
+		if err != nil {
+			return fmt.Errorf("Failed to persist allocated floating IP of service %s: %v", key, err), retryable
+		}
+		if service == nil {
+			return nil, notRetryable
+		}
 	}
 
 	// Write the state if changed
@@ -321,78 +360,212 @@ func (s *ServiceController) persistUpdate(service *v1.Service) error {
 	return err
 }
 
-func (s *ServiceController) createLoadBalancer(service *v1.Service) (*v1.LoadBalancerStatus, error) {
-	// Only one protocol and one externalIPs supported per service.
+// persistAllocatedFloatingIP sets the allocated floating IP annotation of
+// service, or removes it if allocatedFloatingIP is empty. It returns the
+// updated service, or nil if the service no longer exists.
+func (s *ServiceController) persistAllocatedFloatingIP(service *v1.Service, allocatedFloatingIP string) (*v1.Service, error) {
+	// Make a copy so we don't mutate the shared informer cache
+	copy, err := scheme.Scheme.DeepCopy(service)
+	if err != nil {
+		return nil, err
+	}
+	service = copy.(*v1.Service)
+
+	if allocatedFloatingIP == "" {
+		delete(service.Annotations, AllocatedFloatingIPAnnotation)
+	} else {
+		if service.Annotations == nil {
+			service.Annotations = make(map[string]string)
+		}
+		service.Annotations[AllocatedFloatingIPAnnotation] = allocatedFloatingIP
+	}
+
+	result, err := s.kubeClient.Core().Services(service.Namespace).Update(service)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			glog.Infof("Not persisting allocated floating IP to service '%s/%s' that no longer exists: %v",
+				service.Namespace, service.Name, err)
+			return nil, nil
+		}
+		return nil, err
+	}
+	return result, nil
+}
+
+// createLoadBalancer ensures the load balancer of service, and returns its
+// status and the floating IP allocated by stackube, which is empty if the
+// floating IP is requested by the service.
+func (s *ServiceController) createLoadBalancer(service *v1.Service) (*v1.LoadBalancerStatus, string, error) {
+	// Only one externalIPs supported per service.
 	if len(service.Spec.ExternalIPs) > 1 {
-		return nil, fmt.Errorf("multiple floatingips are not supported")
+		return nil, "", fmt.Errorf("multiple floatingips are not supported")
 	}
-	if len(service.Spec.Ports) > 1 {
-		return nil, fmt.Errorf("multiple floatingips are not supported")
+	// The floating IP is requested by externalIPs, or else by
+	// loadBalancerIP, and allocated from the external network if none is
+	// requested.
+	requestedIP := service.Spec.LoadBalancerIP
+	if len(service.Spec.ExternalIPs) > 0 {
+		requestedIP = service.Spec.ExternalIPs[0]
 	}
 
 	// Only support one network and network's name is same with namespace.
+	// The network is created in the tenant which owns the namespace, so the
+	// loadbalancer is created in that tenant too.
 	networkName := util.BuildNetworkName(service.Namespace, service.Namespace)
 	network, err := s.osClient.GetNetworkByName(networkName)
 	if err != nil {
 		glog.Errorf("Get network by name %q failed: %v", networkName, err)
-		return nil, err
+		return nil, "", err
+	}
+	subnetID, err := serviceSubnetID(service, network)
+	if err != nil {
+		return nil, "", err
 	}
 
-	// get endpoints for the service.
-	endpoints, err := s.getEndpoints(service)
+	// get endpoints for the service ports.
+	ports, err := s.getLoadBalancerPorts(service)
 	if err != nil {
 		glog.Errorf("Get endpoints for service %q failed: %v", buildServiceName(service), err)
-		return nil, err
+		return nil, "", err
+	}
+	for i := range ports {
+		for j := range ports[i].Endpoints {
+			endpoint := &ports[i].Endpoints[j]
+			endpoint.SubnetID = endpointSubnetID(network, endpoint.Address)
+		}
+	}
+
+	options, err := getLoadBalancerOptions(service)
+	if err != nil {
+		return nil, "", err
+	}
+	sourceRanges, err := getSourceRanges(service)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// get the certificate for the ports terminating TLS.
+	var tls *openstack.TLSCertificate
+	for _, port := range ports {
+		if port.Protocol == openstack.ProtocolTerminatedHTTPS {
+			tls, err = s.getTLSCertificate(service)
+			if err != nil {
+				return nil, "", err
+			}
+			break
+		}
 	}
 
 	// create the loadbalancer.
 	lbName := buildLoadBalancerName(service)
-	svcPort := service.Spec.Ports[0]
-	externalIP := service.Spec.ExternalIPs[0]
-
 	lb, err := s.osClient.EnsureLoadBalancer(&openstack.LoadBalancer{
-		Name:            lbName,
-		Endpoints:       endpoints,
-		ServicePort:     int(svcPort.Port),
-		TenantID:        network.TenantID,
-		SubnetID:        network.Subnets[0].Uid,
-		Protocol:        string(svcPort.Protocol),
-		ExternalIP:      externalIP,
-		SessionAffinity: service.Spec.SessionAffinity != v1.ServiceAffinityNone,
+		Name:                lbName,
+		Ports:               ports,
+		TenantID:            network.TenantID,
+		SubnetID:            subnetID,
+		ExternalIP:          requestedIP,
+		AllocatedFloatingIP: service.Annotations[AllocatedFloatingIPAnnotation],
+		SessionAffinity:     service.Spec.SessionAffinity != v1.ServiceAffinityNone,
+		TLS:                 tls,
+		VipSubnetID:         service.Annotations[AnnotationVIPSubnetID],
+		Options:             options,
+		SourceRanges:        sourceRanges,
 	})
 	if err != nil {
 		glog.Errorf("EnsureLoadBalancer %q failed: %v", lbName, err)
-		return nil, err
+		return nil, "", err
 	}
 
+	allocatedFloatingIP := ""
+	if requestedIP == "" {
+		allocatedFloatingIP = lb.ExternalIP
+	}
 	return &v1.LoadBalancerStatus{
 		Ingress: []v1.LoadBalancerIngress{{IP: lb.ExternalIP}},
-	}, nil
+	}, allocatedFloatingIP, nil
 
 }
 
-func (s *ServiceController) getEndpoints(service *v1.Service) ([]openstack.Endpoint, error) {
+// getLoadBalancerPorts returns the load balancer ports of the service ports,
+// with the endpoints of the endpoint ports of the same name.
+func (s *ServiceController) getLoadBalancerPorts(service *v1.Service) ([]openstack.LoadBalancerPort, error) {
 	endpoints, err := s.kubeClient.Core().Endpoints(service.Namespace).Get(service.Name, metav1.GetOptions{})
 	if err != nil {
 		return nil, err
 	}
 
-	results := make([]openstack.Endpoint, 0)
-	for i := range endpoints.Subsets {
-		ep := endpoints.Subsets[i]
-		for _, ip := range ep.Addresses {
+	results := make([]openstack.LoadBalancerPort, 0, len(service.Spec.Ports))
+	for _, svcPort := range service.Spec.Ports {
+		protocol, err := getPortProtocol(service, svcPort)
+		if err != nil {
+			return nil, err
+		}
+		lbPort := openstack.LoadBalancerPort{
+			Port:      int(svcPort.Port),
+			Protocol:  protocol,
+			Endpoints: make([]openstack.Endpoint, 0),
+		}
+		for i := range endpoints.Subsets {
+			ep := endpoints.Subsets[i]
 			for _, port := range ep.Ports {
-				results = append(results, openstack.Endpoint{
-					Address: ip.IP,
-					Port:    int(port.Port),
-				})
+				if port.Name != svcPort.Name {
+					continue
+				}
+				for _, ip := range ep.Addresses {
+					lbPort.Endpoints = append(lbPort.Endpoints, openstack.Endpoint{
+						Address: ip.IP,
+						Port:    int(port.Port),
+					})
+				}
 			}
 		}
+		results = append(results, lbPort)
 	}
 
 	return results, nil
 }
 
+// serviceSubnetID returns the first subnet of network in the IP family of the
+// cluster IP of service, which is the subnet of the VIP unless it's set by
+// annotation.
+func serviceSubnetID(service *v1.Service, network *drivertypes.Network) (string, error) {
+	if len(network.Subnets) == 0 {
+		return "", fmt.Errorf("network %s has no subnets", network.Name)
+	}
+
+	ipVersion := 4
+	if ip := net.ParseIP(service.Spec.ClusterIP); ip != nil && ip.To4() == nil {
+		ipVersion = 6
+	}
+	for _, subnet := range network.Subnets {
+		version := subnet.IPVersion
+		if version == 0 {
+			version = 4
+		}
+		if version == ipVersion {
+			return subnet.Uid, nil
+		}
+	}
+
+	return network.Subnets[0].Uid, nil
+}
+
+// endpointSubnetID returns the subnet of network whose CIDR contains the
+// address of an endpoint, or empty if there is none.
+func endpointSubnetID(network *drivertypes.Network, address string) string {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return ""
+	}
+	for _, subnet := range network.Subnets {
+		_, cidr, err := net.ParseCIDR(subnet.Cidr)
+		if err == nil && cidr.Contains(ip) {
+			return subnet.Uid
+		}
+	}
+	return ""
+}
+
 // ListKeys implements the interface required by DeltaFIFO to list the keys we
 // already know about.
 func (s *serviceCache) ListKeys() []string {
@@ -505,6 +678,7 @@ func (s *ServiceController) needsUpdate(oldService *v1.Service, newService *v1.S
 		}
 	}
 	if !reflect.DeepEqual(oldService.Annotations, newService.Annotations) {
+		glog.V(3).Infof("service %q's annotations changed", buildServiceName(newService))
 		return true
 	}
 	if oldService.UID != newService.UID {
@@ -521,34 +695,17 @@ func (s *ServiceController) needsUpdate(oldService *v1.Service, newService *v1.S
 	return false
 }
 
-func getPortsForLB(service *v1.Service) ([]*v1.ServicePort, error) {
-	var protocol v1.Protocol
-
+func getPortsForLB(service *v1.Service) []*v1.ServicePort {
 	ports := []*v1.ServicePort{}
 	for i := range service.Spec.Ports {
-		sp := &service.Spec.Ports[i]
-		// The check on protocol was removed here.  The cloud provider itself is now responsible for all protocol validation
-		ports = append(ports, sp)
-		if protocol == "" {
-			protocol = sp.Protocol
-		} else if protocol != sp.Protocol && wantsLoadBalancer(service) {
-			// TODO:  Convert error messages to use event recorder
-			return nil, fmt.Errorf("mixed protocol external load balancers are not supported.")
-		}
+		// TCP and UDP ports may be mixed, each port has its own listener.
+		ports = append(ports, &service.Spec.Ports[i])
 	}
-	return ports, nil
+	return ports
 }
 
 func portsEqualForLB(x, y *v1.Service) bool {
-	xPorts, err := getPortsForLB(x)
-	if err != nil {
-		return false
-	}
-	yPorts, err := getPortsForLB(y)
-	if err != nil {
-		return false
-	}
-	return portSlicesEqualForLB(xPorts, yPorts)
+	return portSlicesEqualForLB(getPortsForLB(x), getPortsForLB(y))
 }
 
 func portSlicesEqualForLB(x, y []*v1.ServicePort) bool {
@@ -672,12 +829,16 @@ func (s *ServiceController) processServiceDeletion(key string) (error, time.Dura
 	}
 
 	lbName := buildLoadBalancerName(service)
-	err := s.osClient.EnsureLoadBalancerDeleted(lbName)
+	s.recorder.Event(service, v1.EventTypeNormal, "DeletingLoadBalancer", "Deleting load balancer")
+	releaseFloatingIP := service.Annotations[AllocatedFloatingIPAnnotation] != ""
+	err := s.osClient.EnsureLoadBalancerDeleted(lbName, releaseFloatingIP)
 	if err != nil {
 		glog.Errorf("Error deleting load balancer (will retry): %v", err)
+		s.recorder.Eventf(service, v1.EventTypeWarning, "DeletingLoadBalancerFailed", "Error deleting load balancer (will retry): %v", err)
 		return err, cachedService.nextRetryDelay()
 	}
 	glog.V(3).Infof("Loadbalancer %q deleted", lbName)
+	s.recorder.Event(service, v1.EventTypeNormal, "DeletedLoadBalancer", "Deleted load balancer")
 	s.cache.delete(key)
 
 	cachedService.resetRetryDelay()
@@ -20,9 +20,11 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"testing"
 	"time"
 
+	"git.openstack.org/openstack/stackube/pkg/events"
 	"git.openstack.org/openstack/stackube/pkg/openstack"
 	drivertypes "git.openstack.org/openstack/stackube/pkg/openstack/types"
 	"k8s.io/api/core/v1"
@@ -100,6 +102,7 @@ func newController() (*ServiceController, *openstack.FakeOSClient, *fake.Clients
 	client := fake.NewSimpleClientset()
 
 	controller, _ := NewServiceController(client, osClient)
+	controller.recorder = events.NewFakeRecorder()
 
 	return controller, osClient, client
 }
@@ -110,6 +113,7 @@ func newControllerFakeHTTPServer(url, svcName, namespace string) (*ServiceContro
 	client := kubernetes.NewForConfigOrDie(&restclient.Config{Host: url, ContentConfig: restclient.ContentConfig{GroupVersion: &api.Registry.GroupOrDie(v1.GroupName).GroupVersion}})
 
 	controller, _ := NewServiceController(client, osClient)
+	controller.recorder = events.NewFakeRecorder()
 
 	// Sets fake network.
 	osClient.SetNetwork(defaultNetwork())
@@ -199,11 +203,14 @@ func TestCreateExternalLoadBalancer(t *testing.T) {
 							Port: 8080,
 						},
 					},
+					ExternalIPs: []string{
+						"1.1.1.1",
+					},
 					Type: v1.ServiceTypeLoadBalancer,
 				},
 			},
-			expectErr:     true,
-			expectCreated: false,
+			expectErr:     false,
+			expectCreated: true,
 		},
 		{
 			service: &v1.Service{
@@ -281,7 +288,7 @@ func TestCreateExternalLoadBalancer(t *testing.T) {
 			if balancer == nil {
 				t.Errorf("expected one load balancer to be created, got none")
 			} else if balancer.Name != buildLoadBalancerName(item.service) &&
-				balancer.ServicePort != int(item.service.Spec.Ports[0].Port) &&
+				len(balancer.Ports) != len(item.service.Spec.Ports) &&
 				balancer.ExternalIP != item.service.Spec.ExternalIPs[0] {
 				t.Errorf("created load balancer has incorrect parameters: %v", balancer)
 			}
@@ -290,6 +297,583 @@ func TestCreateExternalLoadBalancer(t *testing.T) {
 	}
 }
 
+func TestGetLoadBalancerPorts(t *testing.T) {
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: "default"},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{
+				{Name: "http", Port: 80, Protocol: v1.ProtocolTCP},
+				{Name: "https", Port: 443, Protocol: v1.ProtocolTCP},
+				{Name: "metrics", Port: 9090, Protocol: v1.ProtocolTCP},
+			},
+			Type: v1.ServiceTypeLoadBalancer,
+		},
+	}
+	endpoints := &v1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: "default"},
+		Subsets: []v1.EndpointSubset{
+			{
+				Addresses: []v1.EndpointAddress{{IP: "10.0.0.1"}, {IP: "10.0.0.2"}},
+				Ports:     []v1.EndpointPort{{Name: "http", Port: 8080}, {Name: "https", Port: 8443}},
+			},
+			{
+				Addresses: []v1.EndpointAddress{{IP: "10.0.0.3"}},
+				Ports:     []v1.EndpointPort{{Name: "http", Port: 8081}},
+			},
+		},
+	}
+
+	controller, _, _ := newController()
+	controller.kubeClient = fake.NewSimpleClientset(endpoints)
+
+	ports, err := controller.getLoadBalancerPorts(service)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []openstack.LoadBalancerPort{
+		{
+			Port:     80,
+			Protocol: "TCP",
+			Endpoints: []openstack.Endpoint{
+				{Address: "10.0.0.1", Port: 8080},
+				{Address: "10.0.0.2", Port: 8080},
+				{Address: "10.0.0.3", Port: 8081},
+			},
+		},
+		{
+			Port:     443,
+			Protocol: "TCP",
+			Endpoints: []openstack.Endpoint{
+				{Address: "10.0.0.1", Port: 8443},
+				{Address: "10.0.0.2", Port: 8443},
+			},
+		},
+		{
+			Port:      9090,
+			Protocol:  "TCP",
+			Endpoints: []openstack.Endpoint{},
+		},
+	}
+	if !reflect.DeepEqual(ports, expected) {
+		t.Errorf("Expected ports %v, got %v", expected, ports)
+	}
+}
+
+func TestGetPortProtocol(t *testing.T) {
+	ports := []v1.ServicePort{
+		{Name: "dns", Port: 53, Protocol: v1.ProtocolUDP},
+		{Name: "http", Port: 80, Protocol: v1.ProtocolTCP},
+		{Name: "https", Port: 443, Protocol: v1.ProtocolTCP},
+	}
+
+	testCases := []struct {
+		name        string
+		annotations map[string]string
+		expected    []string
+		expectErr   bool
+	}{
+		{
+			name:     "default",
+			expected: []string{"UDP", "TCP", "TCP"},
+		},
+		{
+			name:        "HTTP",
+			annotations: map[string]string{AnnotationProtocol: "http"},
+			expected:    []string{"UDP", "HTTP", "HTTP"},
+		},
+		{
+			name:        "TERMINATED_HTTPS",
+			annotations: map[string]string{AnnotationProtocol: "TERMINATED_HTTPS"},
+			expected:    []string{"UDP", "TERMINATED_HTTPS", "TERMINATED_HTTPS"},
+		},
+		{
+			name: "TERMINATED_HTTPS ports",
+			annotations: map[string]string{
+				AnnotationProtocol: "TERMINATED_HTTPS",
+				AnnotationTLSPorts: "https, 8443",
+			},
+			expected: []string{"UDP", "HTTP", "TERMINATED_HTTPS"},
+		},
+		{
+			name:        "invalid protocol",
+			annotations: map[string]string{AnnotationProtocol: "HTTPS"},
+			expectErr:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		service := &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: "default", Annotations: tc.annotations},
+			Spec:       v1.ServiceSpec{Ports: ports, Type: v1.ServiceTypeLoadBalancer},
+		}
+
+		var protocols []string
+		var err error
+		for _, port := range ports {
+			var protocol string
+			protocol, err = getPortProtocol(service, port)
+			if err != nil {
+				break
+			}
+			protocols = append(protocols, protocol)
+		}
+		if tc.expectErr {
+			if err == nil {
+				t.Errorf("Case[%s]: expected error", tc.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Case[%s]: unexpected error: %v", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(protocols, tc.expected) {
+			t.Errorf("Case[%s]: expected protocols %v, got %v", tc.name, tc.expected, protocols)
+		}
+	}
+}
+
+func TestGetLoadBalancerOptions(t *testing.T) {
+	testCases := []struct {
+		name        string
+		annotations map[string]string
+		expected    openstack.LoadBalancerOptions
+		expectErr   bool
+	}{
+		{
+			name: "default",
+		},
+		{
+			name: "all options",
+			annotations: map[string]string{
+				AnnotationLBMethod:             "least_connections",
+				AnnotationMonitorType:          "HTTP",
+				AnnotationMonitorDelay:         "5",
+				AnnotationMonitorTimeout:       "2",
+				AnnotationMonitorMaxRetries:    "4",
+				AnnotationConnectionLimit:      "1000",
+				AnnotationTimeoutClientData:    "60000",
+				AnnotationTimeoutMemberConnect: "3000",
+				AnnotationTimeoutMemberData:    "60000",
+			},
+			expected: openstack.LoadBalancerOptions{
+				LBMethod:             "LEAST_CONNECTIONS",
+				MonitorType:          "HTTP",
+				MonitorDelay:         5,
+				MonitorTimeout:       2,
+				MonitorMaxRetries:    4,
+				ConnectionLimit:      1000,
+				TimeoutClientData:    60000,
+				TimeoutMemberConnect: 3000,
+				TimeoutMemberData:    60000,
+			},
+		},
+		{
+			name:        "invalid lb method",
+			annotations: map[string]string{AnnotationLBMethod: "RANDOM"},
+			expectErr:   true,
+		},
+		{
+			name:        "invalid monitor type",
+			annotations: map[string]string{AnnotationMonitorType: "UDP"},
+			expectErr:   true,
+		},
+		{
+			name:        "invalid integer",
+			annotations: map[string]string{AnnotationConnectionLimit: "-1"},
+			expectErr:   true,
+		},
+		{
+			name:        "too many retries",
+			annotations: map[string]string{AnnotationMonitorMaxRetries: "11"},
+			expectErr:   true,
+		},
+		{
+			name: "timeout greater than delay",
+			annotations: map[string]string{
+				AnnotationMonitorDelay:   "3",
+				AnnotationMonitorTimeout: "5",
+			},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		service := &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: "default", Annotations: tc.annotations},
+		}
+		opts, err := getLoadBalancerOptions(service)
+		if tc.expectErr {
+			if err == nil {
+				t.Errorf("Case[%s]: expected error", tc.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Case[%s]: unexpected error: %v", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(opts, tc.expected) {
+			t.Errorf("Case[%s]: expected options %+v, got %+v", tc.name, tc.expected, opts)
+		}
+	}
+}
+
+func TestGetSourceRanges(t *testing.T) {
+	testCases := []struct {
+		name         string
+		sourceRanges []string
+		annotations  map[string]string
+		expected     []string
+		expectErr    bool
+	}{
+		{
+			name:     "all clients",
+			expected: []string{},
+		},
+		{
+			name:         "loadBalancerSourceRanges",
+			sourceRanges: []string{"10.0.0.0/8", " 192.168.1.1/16"},
+			annotations:  map[string]string{AnnotationSourceRanges: "172.16.0.0/12"},
+			expected:     []string{"10.0.0.0/8", "192.168.0.0/16"},
+		},
+		{
+			name:        "source ranges annotation",
+			annotations: map[string]string{AnnotationSourceRanges: "172.16.0.0/12, fd00::/8"},
+			expected:    []string{"172.16.0.0/12", "fd00::/8"},
+		},
+		{
+			name:         "invalid source range",
+			sourceRanges: []string{"10.0.0.1"},
+			expectErr:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		service := &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: "default", Annotations: tc.annotations},
+			Spec:       v1.ServiceSpec{LoadBalancerSourceRanges: tc.sourceRanges},
+		}
+		sourceRanges, err := getSourceRanges(service)
+		if tc.expectErr {
+			if err == nil {
+				t.Errorf("Case[%s]: expected error", tc.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Case[%s]: unexpected error: %v", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(sourceRanges, tc.expected) {
+			t.Errorf("Case[%s]: expected source ranges %v, got %v", tc.name, tc.expected, sourceRanges)
+		}
+	}
+}
+
+func TestCreateLoadBalancerTLS(t *testing.T) {
+	testCases := []struct {
+		name        string
+		annotations map[string]string
+		secretData  map[string][]byte
+		expectedTLS *openstack.TLSCertificate
+		expectErr   bool
+	}{
+		{
+			name:        "no TLS",
+			annotations: map[string]string{AnnotationProtocol: "HTTP"},
+		},
+		{
+			name: "TLS secret",
+			annotations: map[string]string{
+				AnnotationProtocol:  "TERMINATED_HTTPS",
+				AnnotationTLSSecret: "tls",
+			},
+			secretData: map[string][]byte{
+				v1.TLSCertKey:       []byte("cert"),
+				v1.TLSPrivateKeyKey: []byte("key"),
+			},
+			expectedTLS: &openstack.TLSCertificate{Certificate: []byte("cert"), PrivateKey: []byte("key")},
+		},
+		{
+			name:        "missing TLS secret annotation",
+			annotations: map[string]string{AnnotationProtocol: "TERMINATED_HTTPS"},
+			expectErr:   true,
+		},
+		{
+			name: "missing TLS secret",
+			annotations: map[string]string{
+				AnnotationProtocol:  "TERMINATED_HTTPS",
+				AnnotationTLSSecret: "other",
+			},
+			expectErr: true,
+		},
+		{
+			name: "TLS secret without private key",
+			annotations: map[string]string{
+				AnnotationProtocol:  "TERMINATED_HTTPS",
+				AnnotationTLSSecret: "tls",
+			},
+			secretData: map[string][]byte{v1.TLSCertKey: []byte("cert")},
+			expectErr:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		service := &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: "default", Annotations: tc.annotations},
+			Spec: v1.ServiceSpec{
+				Ports: []v1.ServicePort{{Port: 443, Protocol: v1.ProtocolTCP}},
+				Type:  v1.ServiceTypeLoadBalancer,
+			},
+		}
+		endpoints := &v1.Endpoints{ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: "default"}}
+		secret := &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "tls", Namespace: "default"},
+			Type:       v1.SecretTypeTLS,
+			Data:       tc.secretData,
+		}
+
+		controller, osClient, _ := newController()
+		controller.kubeClient = fake.NewSimpleClientset(service, endpoints, secret)
+		osClient.SetNetwork(defaultNetwork())
+
+		_, _, err := controller.createLoadBalancer(service)
+		if tc.expectErr {
+			if err == nil {
+				t.Errorf("Case[%s]: expected error", tc.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Case[%s]: unexpected error: %v", tc.name, err)
+			continue
+		}
+
+		lb := osClient.LoadBalancers[buildLoadBalancerName(service)]
+		if lb == nil {
+			t.Errorf("Case[%s]: expected load balancer to be created", tc.name)
+			continue
+		}
+		if !reflect.DeepEqual(lb.TLS, tc.expectedTLS) {
+			t.Errorf("Case[%s]: expected TLS certificate %v, got %v", tc.name, tc.expectedTLS, lb.TLS)
+		}
+	}
+}
+
+func TestCreateLoadBalancerSubnets(t *testing.T) {
+	network := &drivertypes.Network{
+		Name:     "kube-default-default",
+		TenantID: "123",
+		Subnets: []*drivertypes.Subnet{
+			{Uid: "v6", Cidr: "fd00::/64", IPVersion: 6},
+			{Uid: "v4-a", Cidr: "10.0.0.0/24", IPVersion: 4},
+			{Uid: "v4-b", Cidr: "10.0.1.0/24"},
+		},
+	}
+
+	testCases := []struct {
+		name              string
+		clusterIP         string
+		addresses         []string
+		expectedSubnetID  string
+		expectedEndpoints []openstack.Endpoint
+	}{
+		{
+			name:             "IPv4 service without endpoints",
+			clusterIP:        "10.96.0.10",
+			expectedSubnetID: "v4-a",
+		},
+		{
+			name:             "IPv6 service",
+			clusterIP:        "fd01::10",
+			addresses:        []string{"fd00::5"},
+			expectedSubnetID: "v6",
+			expectedEndpoints: []openstack.Endpoint{
+				{Address: "fd00::5", Port: 8080, SubnetID: "v6"},
+			},
+		},
+		{
+			name:             "endpoints in several subnets",
+			clusterIP:        "10.96.0.10",
+			addresses:        []string{"10.0.1.5", "10.0.0.5", "192.168.0.5"},
+			expectedSubnetID: "v4-a",
+			expectedEndpoints: []openstack.Endpoint{
+				{Address: "10.0.1.5", Port: 8080, SubnetID: "v4-b"},
+				{Address: "10.0.0.5", Port: 8080, SubnetID: "v4-a"},
+				{Address: "192.168.0.5", Port: 8080},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		service := &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: "default"},
+			Spec: v1.ServiceSpec{
+				Ports:     []v1.ServicePort{{Port: 80, Protocol: v1.ProtocolTCP}},
+				Type:      v1.ServiceTypeLoadBalancer,
+				ClusterIP: tc.clusterIP,
+			},
+		}
+		endpoints := &v1.Endpoints{ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: "default"}}
+		if len(tc.addresses) > 0 {
+			subset := v1.EndpointSubset{Ports: []v1.EndpointPort{{Port: 8080}}}
+			for _, address := range tc.addresses {
+				subset.Addresses = append(subset.Addresses, v1.EndpointAddress{IP: address})
+			}
+			endpoints.Subsets = []v1.EndpointSubset{subset}
+		}
+
+		controller, osClient, _ := newController()
+		controller.kubeClient = fake.NewSimpleClientset(service, endpoints)
+		osClient.SetNetwork(network)
+
+		if _, _, err := controller.createLoadBalancer(service); err != nil {
+			t.Errorf("Case[%s]: unexpected error: %v", tc.name, err)
+			continue
+		}
+		lb := osClient.LoadBalancers[buildLoadBalancerName(service)]
+		if lb.SubnetID != tc.expectedSubnetID {
+			t.Errorf("Case[%s]: expected subnet %s, got %s", tc.name, tc.expectedSubnetID, lb.SubnetID)
+		}
+		if endpoints := lb.Ports[0].Endpoints; len(endpoints) > 0 || len(tc.expectedEndpoints) > 0 {
+			if !reflect.DeepEqual(endpoints, tc.expectedEndpoints) {
+				t.Errorf("Case[%s]: expected endpoints %v, got %v", tc.name, tc.expectedEndpoints, endpoints)
+			}
+		}
+	}
+
+	// A network without subnets is an error rather than a panic.
+	controller, osClient, _ := newController()
+	osClient.SetNetwork(&drivertypes.Network{Name: "kube-default-default", TenantID: "123"})
+	service := defaultExternalService()
+	controller.kubeClient = fake.NewSimpleClientset(service)
+	if _, _, err := controller.createLoadBalancer(service); err == nil {
+		t.Errorf("Expected error for network without subnets")
+	}
+}
+
+func TestCreateLoadBalancerFloatingIP(t *testing.T) {
+	testCases := []struct {
+		name                string
+		externalIPs         []string
+		loadBalancerIP      string
+		allocated           string
+		expectedExternalIP  string
+		expectedAllocated   string
+		expectedIngressIP   string
+		expectedAnnotations map[string]string
+	}{
+		{
+			name:              "allocate floating IP",
+			expectedIngressIP: openstack.FakeAllocatedFloatingIP,
+			expectedAnnotations: map[string]string{
+				AllocatedFloatingIPAnnotation: openstack.FakeAllocatedFloatingIP,
+			},
+		},
+		{
+			name:              "reuse allocated floating IP",
+			allocated:         "172.24.4.3",
+			expectedAllocated: "172.24.4.3",
+			expectedIngressIP: "172.24.4.3",
+			expectedAnnotations: map[string]string{
+				AllocatedFloatingIPAnnotation: "172.24.4.3",
+			},
+		},
+		{
+			name:               "loadBalancerIP",
+			loadBalancerIP:     "172.24.4.4",
+			expectedExternalIP: "172.24.4.4",
+			expectedIngressIP:  "172.24.4.4",
+		},
+		{
+			name:               "externalIPs replace allocated floating IP",
+			externalIPs:        []string{"172.24.4.5"},
+			allocated:          "172.24.4.3",
+			expectedExternalIP: "172.24.4.5",
+			expectedAllocated:  "172.24.4.3",
+			expectedIngressIP:  "172.24.4.5",
+		},
+	}
+
+	for _, tc := range testCases {
+		service := &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: "default"},
+			Spec: v1.ServiceSpec{
+				Ports:          []v1.ServicePort{{Port: 80}},
+				ExternalIPs:    tc.externalIPs,
+				LoadBalancerIP: tc.loadBalancerIP,
+				Type:           v1.ServiceTypeLoadBalancer,
+			},
+		}
+		if tc.allocated != "" {
+			service.Annotations = map[string]string{AllocatedFloatingIPAnnotation: tc.allocated}
+		}
+		endpoints := &v1.Endpoints{ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: "default"}}
+
+		controller, osClient, _ := newController()
+		client := fake.NewSimpleClientset(service, endpoints)
+		controller.kubeClient = client
+		osClient.SetNetwork(defaultNetwork())
+
+		if err, _ := controller.createLoadBalancerIfNeeded("default/svc", service); err != nil {
+			t.Errorf("Case[%s]: unexpected error: %v", tc.name, err)
+			continue
+		}
+
+		lb := osClient.LoadBalancers[buildLoadBalancerName(service)]
+		if lb == nil || lb.ExternalIP != tc.expectedExternalIP || lb.AllocatedFloatingIP != tc.expectedAllocated {
+			t.Errorf("Case[%s]: expected load balancer with external IP %q and allocated floating IP %q, got %v",
+				tc.name, tc.expectedExternalIP, tc.expectedAllocated, lb)
+		}
+
+		updated, err := client.Core().Services("default").Get("svc", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("Case[%s]: unexpected error: %v", tc.name, err)
+		}
+		if len(updated.Annotations) != len(tc.expectedAnnotations) ||
+			updated.Annotations[AllocatedFloatingIPAnnotation] != tc.expectedAnnotations[AllocatedFloatingIPAnnotation] {
+			t.Errorf("Case[%s]: expected annotations %v, got %v", tc.name, tc.expectedAnnotations, updated.Annotations)
+		}
+		ingress := updated.Status.LoadBalancer.Ingress
+		if len(ingress) != 1 || ingress[0].IP != tc.expectedIngressIP {
+			t.Errorf("Case[%s]: expected ingress IP %s, got %v", tc.name, tc.expectedIngressIP, ingress)
+		}
+	}
+}
+
+func TestProcessServiceDeletionReleaseFloatingIP(t *testing.T) {
+	testCases := []struct {
+		name      string
+		allocated string
+		release   bool
+	}{
+		{name: "allocated floating IP", allocated: "172.24.4.3", release: true},
+		{name: "requested floating IP", release: false},
+	}
+
+	for _, tc := range testCases {
+		service := defaultExternalService()
+		if tc.allocated != "" {
+			service.Annotations = map[string]string{AllocatedFloatingIPAnnotation: tc.allocated}
+		}
+		controller, osClient, _ := newController()
+		key := "default/" + service.Name
+		controller.cache.set(key, &cachedService{state: service})
+
+		if err, _ := controller.processServiceDeletion(key); err != nil {
+			t.Errorf("Case[%s]: unexpected error: %v", tc.name, err)
+		}
+		expected := []openstack.CalledDetail{{
+			Name:     EnsureLoadBalancerDeleted,
+			Argument: []interface{}{buildLoadBalancerName(service), tc.release},
+		}}
+		if !reflect.DeepEqual(osClient.GetCalledDetails(), expected) {
+			t.Errorf("Case[%s]: expected openstack client calls %v, got %v", tc.name, expected, osClient.GetCalledDetails())
+		}
+	}
+}
+
 func TestProcessServiceUpdate(t *testing.T) {
 
 	var controller *ServiceController
@@ -408,6 +992,48 @@ func TestProcessServiceUpdate(t *testing.T) {
 
 }
 
+func TestProcessServiceUpdateEvents(t *testing.T) {
+	testServer, _ := makeTestServer(t, "default")
+	defer testServer.Close()
+
+	testCases := []struct {
+		testName       string
+		injectErr      error
+		expectedEvents []string
+	}{
+		{
+			testName: "Load balancer created",
+			expectedEvents: []string{
+				"Normal EnsuringLoadBalancer Ensuring load balancer",
+				"Normal FloatingIPAssociated Floating IP 1.1.1.1 associated with load balancer",
+			},
+		},
+		{
+			testName:  "Load balancer failed",
+			injectErr: fmt.Errorf("quota exceeded for resources: ['loadbalancer']"),
+			expectedEvents: []string{
+				"Normal EnsuringLoadBalancer Ensuring load balancer",
+				"Warning LoadBalancerFailed Error creating load balancer (will retry): " +
+					"Failed to create load balancer for service default/external-balancer: quota exceeded for resources: ['loadbalancer']",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		controller, osClient := newControllerFakeHTTPServer(testServer.URL, "external-balancer", "default")
+		if tc.injectErr != nil {
+			osClient.InjectError("EnsureLoadBalancer", tc.injectErr)
+		}
+		key := "default/external-balancer"
+		controller.processServiceUpdate(controller.cache.getOrCreate(key), defaultExternalService(), key)
+
+		recorded := controller.recorder.(*events.FakeRecorder).GetEvents()
+		if !reflect.DeepEqual(recorded, tc.expectedEvents) {
+			t.Errorf("Case[%s]: expected events %v, got %v", tc.testName, tc.expectedEvents, recorded)
+		}
+	}
+}
+
 func TestSyncService(t *testing.T) {
 
 	var controller *ServiceController
@@ -697,6 +1323,15 @@ func TestDoesExternalLoadBalancerNeedsUpdate(t *testing.T) {
 			},
 			expectedNeedsUpdate: true,
 		},
+		{
+			testName: "If load balancer annotations are different",
+			updateFn: func() {
+				oldSvc = defaultExternalService()
+				newSvc = defaultExternalService()
+				newSvc.Annotations = map[string]string{AnnotationLBMethod: "LEAST_CONNECTIONS"}
+			},
+			expectedNeedsUpdate: true,
+		},
 		{
 			testName: "If ExternalTrafficPolicy is different",
 			updateFn: func() {
@@ -23,9 +23,11 @@ import (
 	"k8s.io/api/core/v1"
 	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
 	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 )
@@ -119,3 +121,83 @@ func ingressEqual(lhs, rhs *v1.LoadBalancerIngress) bool {
 	}
 	return true
 }
+
+// HasFinalizer returns true if obj has finalizer.
+func HasFinalizer(obj metav1.Object, finalizer string) bool {
+	for _, f := range obj.GetFinalizers() {
+		if f == finalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// AddFinalizer adds finalizer to obj if it is not there.
+func AddFinalizer(obj metav1.Object, finalizer string) {
+	if HasFinalizer(obj, finalizer) {
+		return
+	}
+	obj.SetFinalizers(append(obj.GetFinalizers(), finalizer))
+}
+
+// RemoveFinalizer removes finalizer from obj.
+func RemoveFinalizer(obj metav1.Object, finalizer string) {
+	var finalizers []string
+	for _, f := range obj.GetFinalizers() {
+		if f != finalizer {
+			finalizers = append(finalizers, f)
+		}
+	}
+	obj.SetFinalizers(finalizers)
+}
+
+// TenantOfNamespace returns the name of the tenant which owns namespace. A
+// namespace declares its tenant by the TenantLabel label or annotation,
+// otherwise it is owned by the tenant with the same name. System namespaces
+// are always owned by the system tenant.
+func TenantOfNamespace(namespace *v1.Namespace) string {
+	if IsSystemNamespace(namespace.Name) {
+		return SystemTenant
+	}
+	if tenant := namespace.Labels[TenantLabel]; tenant != "" {
+		return tenant
+	}
+	if tenant := namespace.Annotations[TenantLabel]; tenant != "" {
+		return tenant
+	}
+	return namespace.Name
+}
+
+// GetTenantOfNamespace gets the name of the tenant which owns the namespace
+// by its name. A namespace which doesn't exist is owned by the tenant with
+// the same name.
+func GetTenantOfNamespace(client kubernetes.Interface, name string) (string, error) {
+	if IsSystemNamespace(name) {
+		return SystemTenant, nil
+	}
+
+	namespace, err := client.CoreV1().Namespaces().Get(name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return name, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return TenantOfNamespace(namespace), nil
+}
+
+// ListTenantNamespaces lists the namespaces owned by the tenant.
+func ListTenantNamespaces(client kubernetes.Interface, tenant string) ([]v1.Namespace, error) {
+	list, err := client.CoreV1().Namespaces().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var namespaces []v1.Namespace
+	for _, namespace := range list.Items {
+		if TenantOfNamespace(&namespace) == tenant {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	return namespaces, nil
+}
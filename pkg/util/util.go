@@ -17,21 +17,36 @@ limitations under the License.
 package util
 
 import (
+	"crypto/sha256"
 	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"fmt"
 	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 const (
 	namePrefix = "kube"
 
-	SystemTenant   = apiv1.NamespaceDefault
-	SystemPassword = "password"
+	// loadBalancerPrefix is the prefix of the names of the load balancers
+	// created for services.
+	loadBalancerPrefix = "stackube"
+
+	SystemTenant = apiv1.NamespaceDefault
 
 	SystemNetwork = apiv1.NamespaceDefault
+
+	// TenantLabel is the label of the kubernetes objects managed for a
+	// tenant. Namespaces declare their tenant by it as a label or an
+	// annotation.
+	TenantLabel = "stackube.kubernetes.io/tenant"
+
+	// AllocatedFloatingIPAnnotation is set on the services whose floating IP
+	// is allocated by stackube, so that it's released with the load balancer.
+	AllocatedFloatingIPAnnotation = "stackube.kubernetes.io/allocated-floating-ip"
 )
 
 var ErrNotFound = errors.New("NotFound")
@@ -45,11 +60,21 @@ func BuildNetworkName(namespace, name string) string {
 	return namePrefix + "-" + namespace + "-" + name
 }
 
+// BuildLoadBalancerName returns the name of the load balancer of the
+// service with namespace and name.
 func BuildLoadBalancerName(namespace, name string) string {
-	if IsSystemNamespace(namespace) {
-		namespace = SystemTenant
-	}
-	return namePrefix + "-" + namespace + "-" + name
+	return loadBalancerPrefix + "_" + namespace + "_" + name
+}
+
+// IsLoadBalancerName returns true if name is built by BuildLoadBalancerName.
+func IsLoadBalancerName(name string) bool {
+	return strings.HasPrefix(name, loadBalancerPrefix+"_")
+}
+
+// IsNetworkOrPortName returns true if name is built by BuildNetworkName or
+// BuildPortName.
+func IsNetworkOrPortName(name string) bool {
+	return strings.HasPrefix(name, namePrefix+"-")
 }
 
 func BuildPortName(namespace, podName string) string {
@@ -63,6 +88,15 @@ func BuildFullPodName(namespace, name string) string {
 	return fmt.Sprintf("%s-%s", namespace, name)
 }
 
+// BuildObjectName returns name if it can be used in the names of kubernetes
+// objects, otherwise a hash of name.
+func BuildObjectName(name string) string {
+	if len(validation.IsDNS1123Label(name)) == 0 {
+		return name
+	}
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(name)))[:16]
+}
+
 func IsSystemNamespace(ns string) bool {
 	switch ns {
 	case